@@ -0,0 +1,84 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"syscall"
+
+	"grpc_anotation_sample/generator"
+	"grpc_anotation_sample/internal/mcp"
+)
+
+const version = "0.1.0"
+
+const instructions = `Manages the gRPC services of a grpc-gateway project through gen_service.sh.
+Call list_services first to see the existing services and the field DSL of their entities.
+Changes that would break clients of proto/baseline.binpb are refused; retry with force only when the user agrees.
+Each RPC is also a tool named Service_Method (e.g. BookService_GetBook) taking the request message as arguments.
+call_rpc and the RPC tools need the server running (make dev or make run); after a change, rebuild and restart it before calling new RPCs.`
+
+// Serves the service-management tools over stdio for MCP clients such as
+// Claude for Desktop. Logs go to stderr since stdout carries the protocol.
+func main() {
+	root := flag.String("root", os.Getenv("MCP_GRPC_PROJECT_ROOT"), "project root containing gen_service.sh (MCP_GRPC_PROJECT_ROOT; default: found from the working directory or the executable)")
+	verbose := flag.Bool("v", false, "log requests to stderr")
+	exposeRPCs := flag.Bool("rpc-tools", true, "expose each RPC in proto/ as a tool calling the running server")
+	flag.Parse()
+
+	logger := log.New(os.Stderr, "mcp: ", log.LstdFlags)
+	dir, err := projectRoot(*root)
+	if err != nil {
+		logger.Fatal(err)
+	}
+
+	s := mcp.NewServer("grpc-service-manager", version)
+	s.Instructions = instructions
+	if *verbose {
+		s.Log = logger
+	}
+	t := &tools{project: generator.Project{Root: dir}}
+	t.register(s)
+	if *exposeRPCs {
+		t.rpcs = &rpcTools{protoDir: t.project.ProtoDir()}
+		if err := t.rpcs.refresh(s); err != nil {
+			logger.Printf("no RPC tools: %v", err)
+		}
+	}
+	logger.Printf("serving %s over stdio", dir)
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	if err := s.Serve(ctx, os.Stdin, os.Stdout); err != nil {
+		logger.Fatal(err)
+	}
+}
+
+// projectRoot returns dir made absolute, or the nearest directory containing
+// gen_service.sh above the working directory or the executable.
+func projectRoot(dir string) (string, error) {
+	if dir != "" {
+		abs, err := filepath.Abs(dir)
+		if err != nil {
+			return "", err
+		}
+		if !generator.IsRoot(abs) {
+			return "", fmt.Errorf("%s is not a project root: gen_service.sh not found", abs)
+		}
+		return abs, nil
+	}
+	var starts []string
+	if wd, err := os.Getwd(); err == nil {
+		starts = append(starts, wd)
+	}
+	if exe, err := os.Executable(); err == nil {
+		if exe, err = filepath.EvalSymlinks(exe); err == nil {
+			starts = append(starts, filepath.Dir(exe))
+		}
+	}
+	return generator.FindRoot(starts...)
+}
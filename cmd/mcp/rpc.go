@@ -0,0 +1,160 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"google.golang.org/protobuf/reflect/protoreflect"
+
+	"grpc_anotation_sample/console"
+	"grpc_anotation_sample/internal/mcp"
+	"grpc_anotation_sample/protoset"
+)
+
+// rpcTools exposes every RPC in proto/ as its own tool, named Service_Method
+// (e.g. BookService_GetBook), whose arguments are the request message.
+// Client-streaming RPCs take {"messages": [...]} instead.
+type rpcTools struct {
+	protoDir string
+	names    map[string]bool
+}
+
+// refresh replaces the RPC tools with those of the current protos and tells
+// the client when they changed.
+func (r *rpcTools) refresh(s *mcp.Server) error {
+	set, err := protoset.Compile(r.protoDir)
+	if err != nil {
+		return fmt.Errorf("failed to compile protos: %w", err)
+	}
+
+	var tools []mcp.Tool
+	names := map[string]bool{}
+	for _, m := range console.Methods(set) {
+		md, err := console.FindMethod(set, m.Service, m.Method)
+		if err != nil {
+			return err
+		}
+		tool := rpcTool(set, md)
+		tools = append(tools, tool)
+		names[tool.Name] = true
+	}
+
+	s.RemoveTools(func(t mcp.Tool) bool { return r.names[t.Name] })
+	for _, t := range tools {
+		s.AddTool(t)
+	}
+	changed := len(names) != len(r.names)
+	for name := range names {
+		changed = changed || !r.names[name]
+	}
+	r.names = names
+	if changed {
+		s.ToolsChanged()
+	}
+	return nil
+}
+
+func rpcTool(set *protoset.Set, md protoreflect.MethodDescriptor) mcp.Tool {
+	sd := md.Parent().(protoreflect.ServiceDescriptor)
+	in, out := console.Schema(md.Input()), console.Schema(md.Output())
+	if md.IsStreamingClient() {
+		in = map[string]any{
+			"type":       "object",
+			"properties": map[string]any{"messages": map[string]any{"type": "array", "items": in}},
+			"required":   []string{"messages"},
+		}
+	}
+	if md.IsStreamingServer() {
+		out = map[string]any{
+			"type":       "object",
+			"properties": map[string]any{"messages": map[string]any{"type": "array", "items": out}},
+		}
+	}
+	inSchema, _ := json.Marshal(in)
+	outSchema, _ := json.Marshal(out)
+
+	return mcp.Tool{
+		Name:         fmt.Sprintf("%s_%s", sd.Name(), md.Name()),
+		Title:        fmt.Sprintf("%s.%s", sd.Name(), md.Name()),
+		Description:  rpcDescription(md),
+		InputSchema:  inSchema,
+		OutputSchema: outSchema,
+		Annotations:  rpcAnnotations(md),
+		Handler: func(ctx context.Context, args json.RawMessage) *mcp.Result {
+			return callMethod(ctx, set, md, args)
+		},
+	}
+}
+
+func rpcDescription(md protoreflect.MethodDescriptor) string {
+	var b strings.Builder
+	if c := console.Comment(md); c != "" {
+		b.WriteString(c + "\n\n")
+	}
+	fmt.Fprintf(&b, "Calls %s on the running gRPC server", console.MethodPath(md))
+	if bindings := protoset.Bindings(md); len(bindings) > 0 {
+		fmt.Fprintf(&b, " (REST: %s)", bindings[0])
+	}
+	fmt.Fprintf(&b, " and returns its %s.", md.Output().Name())
+	switch {
+	case md.IsStreamingClient() && md.IsStreamingServer():
+		b.WriteString(" Bidirectional stream: pass the request messages in order; the replies are returned once the server closes the stream.")
+	case md.IsStreamingClient():
+		b.WriteString(" Client stream: pass the request messages in order.")
+	case md.IsStreamingServer():
+		fmt.Fprintf(&b, " Server stream: returns the messages received until the server closes the stream; one still open after %s fails with DeadlineExceeded, listing the messages so far.", console.Timeout)
+	}
+	return b.String()
+}
+
+// rpcAnnotations derives hints from the primary HTTP binding: GET reads and
+// DELETE destroys; RPCs without a binding get no hints.
+func rpcAnnotations(md protoreflect.MethodDescriptor) *mcp.ToolAnnotations {
+	bindings := protoset.Bindings(md)
+	if len(bindings) == 0 {
+		return nil
+	}
+	destructive := false
+	switch bindings[0].Method {
+	case "GET":
+		return &mcp.ToolAnnotations{ReadOnlyHint: true}
+	case "DELETE":
+		destructive = true
+		return &mcp.ToolAnnotations{DestructiveHint: &destructive, IdempotentHint: true}
+	case "PUT":
+		return &mcp.ToolAnnotations{DestructiveHint: &destructive, IdempotentHint: true}
+	}
+	return &mcp.ToolAnnotations{DestructiveHint: &destructive}
+}
+
+// callMethod calls md over gRPC with args as the request and returns the
+// response as text and structured content.
+func callMethod(ctx context.Context, set *protoset.Set, md protoreflect.MethodDescriptor, args json.RawMessage) *mcp.Result {
+	req := console.Request{Service: string(md.Parent().FullName()), Method: string(md.Name()), Request: args}
+	if md.IsStreamingClient() {
+		var a struct {
+			Messages json.RawMessage `json:"messages"`
+		}
+		if err := json.Unmarshal(args, &a); err != nil {
+			return mcp.Errorf("Invalid arguments: %v", err)
+		}
+		req.Request = a.Messages
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, console.Timeout)
+	defer cancel()
+	resp := console.InvokeGRPC(ctx, console.GRPCAddr(), set, md, req)
+	if resp.Error != "" {
+		return mcp.Errorf("%s %s: %s\n\n%s", resp.Target, resp.Status, resp.Error, resp.Body)
+	}
+
+	r := mcp.Text("%s", resp.Body)
+	if md.IsStreamingServer() {
+		r.Structured = map[string]json.RawMessage{"messages": json.RawMessage(resp.Body)}
+	} else {
+		r.Structured = json.RawMessage(resp.Body)
+	}
+	return r
+}
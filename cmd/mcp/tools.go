@@ -0,0 +1,318 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+
+	"grpc_anotation_sample/console"
+	"grpc_anotation_sample/generator"
+	"grpc_anotation_sample/internal/mcp"
+	"grpc_anotation_sample/protoset"
+)
+
+// tools serves the service-management tools for one project. Changes are
+// applied one at a time since they all rewrite proto/ and regenerate pb/.
+// When rpcs is set, each RPC is also a tool of its own, refreshed after
+// every change.
+type tools struct {
+	project generator.Project
+	changes sync.Mutex
+	rpcs    *rpcTools
+	server  *mcp.Server
+}
+
+// register adds every tool to s
+func (t *tools) register(s *mcp.Server) {
+	t.server = s
+	s.AddTool(mcp.Tool{
+		Name:        "list_services",
+		Description: "List the project's gRPC services with their entity fields (in the field DSL), RPCs and HTTP bindings.",
+		InputSchema: json.RawMessage(`{"type":"object","properties":{}}`),
+		Handler:     t.listServices,
+	})
+	s.AddTool(mcp.Tool{
+		Name: "generate_service",
+		Description: "Create a CRUD service with an entity message, MongoDB model and REST bindings, then regenerate the protos. " +
+			"Fields use the generator DSL, e.g. \"title:string,tags:repeated string,status:Status{DRAFT,PUBLISHED},labels:map<string,string>,ttl:duration,nickname:string?\".",
+		InputSchema: json.RawMessage(`{"type":"object","properties":{` +
+			`"service_name":{"type":"string","description":"Service name in PascalCase, e.g. Book"},` +
+			`"fields":{"type":"string","description":"Comma-separated fields, e.g. title:string,pages:int32"},` +
+			`"force":{"type":"boolean","description":"Apply even if it breaks clients of proto/baseline.binpb"}},` +
+			`"required":["service_name","fields"]}`),
+		Handler: t.generateService,
+	})
+	s.AddTool(mcp.Tool{
+		Name:        "add_rpc",
+		Description: "Add a unary or streaming RPC to an existing service, then regenerate the protos.",
+		InputSchema: json.RawMessage(`{"type":"object","properties":{` +
+			`"service_name":{"type":"string","description":"Target service, e.g. Book"},` +
+			`"rpc_name":{"type":"string","description":"RPC name in PascalCase, e.g. SearchBooks"},` +
+			`"req_fields":{"type":"string","description":"Request fields, e.g. query:string,limit:int32"},` +
+			`"res_fields":{"type":"string","description":"Response fields, e.g. data:repeated Book"},` +
+			`"stream":{"type":"string","enum":["unary","server","client","bidi"],"description":"Streaming mode (default unary)"},` +
+			`"http":{"type":"string","description":"HTTP binding METHOD:/path, e.g. GET:/v1/books:search. Required for unary RPCs; server and bidi streams may be bound to GET (served over a WebSocket); client streams cannot be bound"},` +
+			`"body":{"type":"string","description":"Body mapping: * or a request field"}},` +
+			`"required":["service_name","rpc_name","req_fields","res_fields"]}`),
+		Handler: t.addRPC,
+	})
+	s.AddTool(mcp.Tool{
+		Name:        "add_nested",
+		Description: "Add a nested message and a field of that type to a service's entity, then regenerate the protos.",
+		InputSchema: json.RawMessage(`{"type":"object","properties":{` +
+			`"service_name":{"type":"string","description":"Target service, e.g. Place"},` +
+			`"field_name":{"type":"string","description":"Field on the entity in snake_case, e.g. location"},` +
+			`"fields":{"type":"string","description":"Fields of the nested message, e.g. type:string,coordinates:repeated double"},` +
+			`"repeated":{"type":"boolean","description":"Make the entity field repeated"},` +
+			`"message_name":{"type":"string","description":"Name of the nested message, derived from field_name by default"}},` +
+			`"required":["service_name","field_name","fields"]}`),
+		Handler: t.addNested,
+	})
+	s.AddTool(mcp.Tool{
+		Name:        "remove_service",
+		Description: "Remove a service's proto, implementation and registrations, then regenerate the protos.",
+		InputSchema: json.RawMessage(`{"type":"object","properties":{` +
+			`"service_name":{"type":"string","description":"Service to remove, e.g. Book"},` +
+			`"force":{"type":"boolean","description":"Apply even if it breaks clients of proto/baseline.binpb"}},` +
+			`"required":["service_name"]}`),
+		Handler: t.removeService,
+	})
+	s.AddTool(mcp.Tool{
+		Name:        "regenerate_proto",
+		Description: "Run `make proto` to regenerate the Go, gateway and OpenAPI code from proto/.",
+		InputSchema: json.RawMessage(`{"type":"object","properties":{}}`),
+		Handler:     t.regenerateProto,
+	})
+	s.AddTool(mcp.Tool{
+		Name: "call_rpc",
+		Description: "Call an RPC of the running server over gRPC (default) or its REST binding. " +
+			"The request is the request message in protojson form; client-streaming RPCs take an array of messages.",
+		InputSchema: json.RawMessage(`{"type":"object","properties":{` +
+			`"service":{"type":"string","description":"Service name, e.g. Book, BookService or pb.BookService"},` +
+			`"method":{"type":"string","description":"RPC name, e.g. GetBook"},` +
+			`"request":{"description":"Request message as JSON, e.g. {\"id\":\"1\"}"},` +
+			`"transport":{"type":"string","enum":["grpc","rest"]},` +
+			`"binding":{"type":"integer","minimum":0,"description":"Index of the HTTP binding for rest"},` +
+			`"metadata":{"type":"object","additionalProperties":{"type":"string"},"description":"gRPC metadata or HTTP headers"}},` +
+			`"required":["service","method"]}`),
+		Handler: t.callRPC,
+	})
+}
+
+// argNames maps the parameters named in validation errors to tool arguments
+var argNames = map[string]string{
+	"serviceName":   "service_name",
+	"serviceFields": "fields",
+	"rpcName":       "rpc_name",
+	"reqFields":     "req_fields",
+	"resFields":     "res_fields",
+	"fieldName":     "field_name",
+	"messageName":   "message_name",
+	"method":        "http",
+	"path":          "http",
+}
+
+// invalid reports a rejected argument under its tool argument name
+func invalid(err *generator.ValidationError) *mcp.Result {
+	param, _, _ := strings.Cut(err.Field, " ")
+	arg, ok := argNames[param]
+	if !ok {
+		arg = param
+	}
+	msg := err.Message
+	if arg != "http" {
+		msg = strings.Replace(msg, param, arg, 1)
+	}
+	return mcp.Errorf("Invalid %s (%s): %s", arg, err.Code, msg)
+}
+
+func decode(args json.RawMessage, v any) *mcp.Result {
+	if err := json.Unmarshal(args, v); err != nil {
+		return mcp.Errorf("Invalid arguments: %v", err)
+	}
+	return nil
+}
+
+// apply runs a validated change and reports it like the UI does
+func (t *tools) apply(ctx context.Context, c generator.Change, verr *generator.ValidationError) *mcp.Result {
+	if verr != nil {
+		return invalid(verr)
+	}
+	t.changes.Lock()
+	defer t.changes.Unlock()
+
+	out, err := t.project.Apply(ctx, c)
+	switch {
+	case errors.Is(err, generator.ErrBreaking):
+		return mcp.Errorf("Change would break existing clients; retry with force: true to apply it anyway.\n\n%s", out)
+	case err != nil:
+		return mcp.Errorf("%v\n\n%s", err, out)
+	}
+	return mcp.Text("%s\n\n%s%s", c.Success, out, t.refreshRPCs())
+}
+
+// refreshRPCs updates the per-RPC tools after a change and returns a note
+// for the result when that failed.
+func (t *tools) refreshRPCs() string {
+	if t.rpcs == nil || t.server == nil {
+		return ""
+	}
+	if err := t.rpcs.refresh(t.server); err != nil {
+		return fmt.Sprintf("\n\nRPC tools were not updated: %v", err)
+	}
+	return ""
+}
+
+func (t *tools) listServices(ctx context.Context, _ json.RawMessage) *mcp.Result {
+	services, err := generator.Discover(t.project.ProtoDir())
+	if err != nil {
+		return mcp.Errorf("Failed to discover services: %v", err)
+	}
+	if len(services) == 0 {
+		return mcp.Text("No services found in %s", t.project.ProtoDir())
+	}
+
+	var b strings.Builder
+	for _, svc := range services {
+		fmt.Fprintf(&b, "%s (%s, proto/%s)\n", svc.Name, svc.FullName, svc.File)
+		if len(svc.Fields) > 0 {
+			fmt.Fprintf(&b, "  fields: %s\n", strings.Join(svc.Fields, ","))
+		}
+		for _, rpc := range svc.RPCs {
+			req, res := rpc.Request, rpc.Response
+			if rpc.ClientStreaming {
+				req = "stream " + req
+			}
+			if rpc.ServerStreaming {
+				res = "stream " + res
+			}
+			fmt.Fprintf(&b, "  rpc %s(%s) returns (%s)", rpc.Name, req, res)
+			for _, h := range rpc.HTTP {
+				fmt.Fprintf(&b, " [%s]", h)
+			}
+			b.WriteString("\n")
+		}
+	}
+	r := mcp.Text("%s", strings.TrimSuffix(b.String(), "\n"))
+	r.Structured = map[string]any{"services": services}
+	return r
+}
+
+func (t *tools) generateService(ctx context.Context, args json.RawMessage) *mcp.Result {
+	var a struct {
+		ServiceName string `json:"service_name"`
+		Fields      string `json:"fields"`
+		Force       bool   `json:"force"`
+	}
+	if r := decode(args, &a); r != nil {
+		return r
+	}
+	c, err := generator.CreateService(a.ServiceName, a.Fields)
+	c.Force = a.Force
+	return t.apply(ctx, c, err)
+}
+
+func (t *tools) addRPC(ctx context.Context, args json.RawMessage) *mcp.Result {
+	var a struct {
+		ServiceName string `json:"service_name"`
+		RPCName     string `json:"rpc_name"`
+		ReqFields   string `json:"req_fields"`
+		ResFields   string `json:"res_fields"`
+		Stream      string `json:"stream"`
+		HTTP        string `json:"http"`
+		Body        string `json:"body"`
+	}
+	if r := decode(args, &a); r != nil {
+		return r
+	}
+	c, err := generator.AddRPC(a.ServiceName, a.RPCName, a.ReqFields, a.ResFields, a.Stream, a.HTTP, a.Body)
+	return t.apply(ctx, c, err)
+}
+
+func (t *tools) addNested(ctx context.Context, args json.RawMessage) *mcp.Result {
+	var a struct {
+		ServiceName string `json:"service_name"`
+		FieldName   string `json:"field_name"`
+		Fields      string `json:"fields"`
+		Repeated    bool   `json:"repeated"`
+		MessageName string `json:"message_name"`
+	}
+	if r := decode(args, &a); r != nil {
+		return r
+	}
+	c, err := generator.AddNested(a.ServiceName, a.FieldName, a.Fields, a.Repeated, a.MessageName)
+	return t.apply(ctx, c, err)
+}
+
+func (t *tools) removeService(ctx context.Context, args json.RawMessage) *mcp.Result {
+	var a struct {
+		ServiceName string `json:"service_name"`
+		Force       bool   `json:"force"`
+	}
+	if r := decode(args, &a); r != nil {
+		return r
+	}
+	c, err := generator.RemoveService(a.ServiceName)
+	c.Force = a.Force
+	return t.apply(ctx, c, err)
+}
+
+func (t *tools) regenerateProto(ctx context.Context, _ json.RawMessage) *mcp.Result {
+	t.changes.Lock()
+	defer t.changes.Unlock()
+
+	var out bytes.Buffer
+	if err := t.project.Regenerate(ctx, &out); err != nil {
+		return mcp.Errorf("Proto regeneration failed: %v\n\n%s", err, out.String())
+	}
+	return mcp.Text("Protocol buffer code regenerated\n\n%s%s", out.String(), t.refreshRPCs())
+}
+
+func (t *tools) callRPC(ctx context.Context, args json.RawMessage) *mcp.Result {
+	var req console.Request
+	if r := decode(args, &req); r != nil {
+		return r
+	}
+	set, err := protoset.Compile(t.project.ProtoDir())
+	if err != nil {
+		return mcp.Errorf("Failed to compile protos: %v", err)
+	}
+	req.Service = resolveService(set, req.Service)
+	md, err := console.FindMethod(set, req.Service, req.Method)
+	if err != nil {
+		return mcp.Errorf("%v", err)
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, console.Timeout)
+	defer cancel()
+	resp, err := console.Invoke(ctx, set, md, req)
+	if err != nil {
+		return mcp.Errorf("%v", err)
+	}
+
+	r := mcp.Text("%s %s (%dms)\n\n%s", resp.Target, resp.Status, resp.DurationMs, resp.Body)
+	if resp.Error != "" {
+		r = mcp.Errorf("%s %s: %s\n\n%s", resp.Target, resp.Status, resp.Error, resp.Body)
+	}
+	r.Structured = resp
+	return r
+}
+
+// resolveService accepts the generator's name (Book), the service name
+// (BookService) or the full name (pb.BookService) and returns the full name.
+func resolveService(set *protoset.Set, name string) string {
+	for _, file := range set.Project() {
+		svcs := file.Services()
+		for i := 0; i < svcs.Len(); i++ {
+			sd := svcs.Get(i)
+			if full := string(sd.FullName()); full == name || string(sd.Name()) == name || string(sd.Name()) == name+"Service" {
+				return full
+			}
+		}
+	}
+	return name
+}
@@ -0,0 +1,281 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"google.golang.org/grpc"
+
+	"grpc_anotation_sample/generator"
+	"grpc_anotation_sample/internal/mcp"
+	"grpc_anotation_sample/pb"
+)
+
+// repo is the project these tests run in; its protos are only read
+var repo = tools{project: generator.Project{Root: "../.."}}
+
+// fakeProject returns tools for a project whose gen_service.sh prints its
+// arguments and refuses "Breaking" without FORCE=1, and whose `make proto`
+// prints "protoc".
+func fakeProject(t *testing.T) *tools {
+	t.Helper()
+	root := t.TempDir()
+	script := `#!/bin/sh
+echo "gen $*"
+case "$*" in *Breaking*) [ "$FORCE" = 1 ] || { echo "json: field removed"; exit 3; } ;; esac
+`
+	if err := os.WriteFile(filepath.Join(root, "gen_service.sh"), []byte(script), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(root, "Makefile"), []byte("proto:\n\t@echo protoc\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	return &tools{project: generator.Project{Root: root}}
+}
+
+func text(r *mcp.Result) string {
+	return r.Content[0].Text
+}
+
+type listedTool struct {
+	Name         string
+	Description  string
+	InputSchema  map[string]any
+	OutputSchema map[string]any
+	Annotations  map[string]any
+}
+
+// serve sends lines to s and returns its output; tools/list and tools/call
+// are the only way to reach the registered tools.
+func serve(t *testing.T, s *mcp.Server, lines ...string) string {
+	t.Helper()
+	var out strings.Builder
+	if err := s.Serve(context.Background(), strings.NewReader(strings.Join(lines, "\n")+"\n"), &out); err != nil {
+		t.Fatal(err)
+	}
+	return out.String()
+}
+
+func listTools(t *testing.T, s *mcp.Server) []listedTool {
+	t.Helper()
+	var resp struct {
+		Result struct{ Tools []listedTool }
+	}
+	if err := json.Unmarshal([]byte(serve(t, s, `{"jsonrpc":"2.0","id":1,"method":"tools/list"}`)), &resp); err != nil {
+		t.Fatal(err)
+	}
+	return resp.Result.Tools
+}
+
+func TestRegister(t *testing.T) {
+	s := mcp.NewServer("test", version)
+	repo.register(s)
+	want := []string{"list_services", "generate_service", "add_rpc", "add_nested", "remove_service", "regenerate_proto", "call_rpc"}
+
+	var got []string
+	for _, tool := range listTools(t, s) {
+		got = append(got, tool.Name)
+		if tool.InputSchema["type"] != "object" {
+			t.Errorf("%s schema = %v", tool.Name, tool.InputSchema)
+		}
+	}
+	if strings.Join(got, ",") != strings.Join(want, ",") {
+		t.Errorf("tools = %v, want %v", got, want)
+	}
+}
+
+func TestListServices(t *testing.T) {
+	r := repo.listServices(context.Background(), nil)
+	if r.IsError {
+		t.Fatal(text(r))
+	}
+	if !strings.Contains(text(r), "Book (pb.BookService, proto/book.proto)") ||
+		!strings.Contains(text(r), "rpc GetBook(GetBookRequest) returns (GetBookResponse) [GET /v1/books/{id}]") ||
+		!strings.Contains(text(r), "rpc Watch(HealthCheckRequest) returns (stream HealthCheckResponse)") {
+		t.Errorf("list_services:\n%s", text(r))
+	}
+}
+
+func TestChanges(t *testing.T) {
+	p := fakeProject(t)
+	ctx := context.Background()
+
+	r := p.generateService(ctx, json.RawMessage(`{"service_name":"Book","fields":"title:string,pages:int32"}`))
+	if r.IsError || !strings.Contains(text(r), "gen Book title:string,pages:int32\nprotoc") {
+		t.Errorf("generate_service = %q", text(r))
+	}
+	r = p.addRPC(ctx, json.RawMessage(`{"service_name":"Book","rpc_name":"Search","req_fields":"q:string","res_fields":"n:int32","http":"POST:/v1/books:search","body":"*"}`))
+	if r.IsError || !strings.Contains(text(r), "gen add-rpc Book Search q:string n:int32 http=POST:/v1/books:search body=*") {
+		t.Errorf("add_rpc = %q", text(r))
+	}
+	r = p.addRPC(ctx, json.RawMessage(`{"service_name":"Book","rpc_name":"Tail","req_fields":"q:string","res_fields":"n:int32","stream":"server","http":"GET:/v1/books:tail"}`))
+	if r.IsError || !strings.Contains(text(r), "gen add-rpc Book Tail q:string n:int32 http=GET:/v1/books:tail stream=server") {
+		t.Errorf("add_rpc stream = %q", text(r))
+	}
+	r = p.addNested(ctx, json.RawMessage(`{"service_name":"Place","field_name":"location","fields":"x:double","repeated":true}`))
+	if r.IsError || !strings.Contains(text(r), "gen add-nested Place location x:double repeated") {
+		t.Errorf("add_nested = %q", text(r))
+	}
+
+	r = p.removeService(ctx, json.RawMessage(`{"service_name":"Breaking"}`))
+	if !r.IsError || !strings.Contains(text(r), "force: true") || strings.Contains(text(r), "protoc") {
+		t.Errorf("remove_service without force = %q", text(r))
+	}
+	r = p.removeService(ctx, json.RawMessage(`{"service_name":"Breaking","force":true}`))
+	if r.IsError || !strings.Contains(text(r), "protoc") {
+		t.Errorf("remove_service with force = %q", text(r))
+	}
+
+	r = p.regenerateProto(ctx, nil)
+	if r.IsError || !strings.Contains(text(r), "protoc") {
+		t.Errorf("regenerate_proto = %q", text(r))
+	}
+}
+
+func TestChangesRejectInjection(t *testing.T) {
+	p := fakeProject(t)
+	tests := []struct {
+		call func(context.Context, json.RawMessage) *mcp.Result
+		args string
+		want string
+	}{
+		{p.generateService, `{"service_name":"Book;touch pwned","fields":"title:string"}`, "Invalid service_name (invalid_identifier)"},
+		{p.generateService, `{"service_name":"Book","fields":"title:string;rm -rf ~"}`, "Invalid fields (invalid_characters)"},
+		{p.addRPC, `{"service_name":"Book","rpc_name":"Find","req_fields":"q:string","res_fields":"n:int32","http":"GET:/v1/x\" }"}`, "Invalid http (invalid_http_path)"},
+		{p.addRPC, `{"service_name":"Book","rpc_name":"Find","req_fields":"1q:string","res_fields":"n:int32","http":"GET:/v1/x"}`, "Invalid req_fields (invalid_identifier): req_fields name"},
+		{p.addNested, `{"service_name":"Book","field_name":"loc","fields":"x:double","message_name":"Loc\nEvil"}`, "Invalid message_name"},
+		{p.removeService, `{"service_name":"message"}`, "Invalid service_name (reserved_keyword)"},
+		{p.removeService, `{"service_name":1}`, "Invalid arguments"},
+	}
+	for _, tt := range tests {
+		r := tt.call(context.Background(), json.RawMessage(tt.args))
+		if !r.IsError || !strings.HasPrefix(text(r), tt.want) {
+			t.Errorf("%s = %q, want %q", tt.args, text(r), tt.want)
+		}
+		if strings.Contains(text(r), "gen ") {
+			t.Errorf("%s ran gen_service.sh", tt.args)
+		}
+	}
+}
+
+type healthServer struct {
+	pb.UnimplementedHealthServer
+}
+
+func (healthServer) Check(context.Context, *pb.HealthCheckRequest) (*pb.HealthCheckResponse, error) {
+	return &pb.HealthCheckResponse{Status: pb.HealthCheckResponse_SERVING}, nil
+}
+
+// healthService serves pb.Health for the length of the test and points
+// GRPC_ADDR at it.
+func healthService(t *testing.T) {
+	t.Helper()
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	srv := grpc.NewServer()
+	pb.RegisterHealthServer(srv, healthServer{})
+	go srv.Serve(lis)
+	t.Cleanup(srv.Stop)
+	t.Setenv("GRPC_ADDR", lis.Addr().String())
+}
+
+func TestCallRPC(t *testing.T) {
+	healthService(t)
+
+	r := repo.callRPC(context.Background(), json.RawMessage(`{"service":"Health","method":"Check","request":{}}`))
+	if r.IsError || !strings.Contains(text(r), "/pb.Health/Check OK") || !strings.Contains(text(r), `"SERVING"`) {
+		t.Errorf("call_rpc = %q", text(r))
+	}
+	r = repo.callRPC(context.Background(), json.RawMessage(`{"service":"Book","method":"GetBook","request":{"id":"1"}}`))
+	if !r.IsError || !strings.Contains(text(r), "/pb.BookService/GetBook Unimplemented") {
+		t.Errorf("call_rpc of an unregistered service = %q", text(r))
+	}
+	r = repo.callRPC(context.Background(), json.RawMessage(`{"service":"Book","method":"Nope"}`))
+	if !r.IsError || !strings.Contains(text(r), "method Nope not found in pb.BookService") {
+		t.Errorf("call_rpc of an unknown method = %q", text(r))
+	}
+}
+
+func TestRPCTools(t *testing.T) {
+	s := mcp.NewServer("test", version)
+	rpcs := &rpcTools{protoDir: repo.project.ProtoDir()}
+	if err := rpcs.refresh(s); err != nil {
+		t.Fatal(err)
+	}
+	tools := map[string]listedTool{}
+	for _, tool := range listTools(t, s) {
+		tools[tool.Name] = tool
+	}
+
+	get, ok := tools["BookService_GetBook"]
+	if !ok {
+		t.Fatalf("tools = %v, want BookService_GetBook", tools)
+	}
+	if props := get.InputSchema["properties"].(map[string]any); props["id"] == nil {
+		t.Errorf("GetBook input schema = %v", get.InputSchema)
+	}
+	if !strings.Contains(get.Description, "GET /v1/books/{id}") || get.Annotations["readOnlyHint"] != true {
+		t.Errorf("GetBook = %+v", get)
+	}
+	if del := tools["BookService_DeleteBook"]; del.Annotations["destructiveHint"] != true {
+		t.Errorf("DeleteBook annotations = %v", del.Annotations)
+	}
+	watch := tools["Health_Watch"]
+	if items := watch.OutputSchema["properties"].(map[string]any)["messages"].(map[string]any)["items"]; items == nil {
+		t.Errorf("Watch output schema = %v", watch.OutputSchema)
+	}
+
+	healthService(t)
+	out := serve(t, s, `{"jsonrpc":"2.0","id":2,"method":"tools/call","params":{"name":"Health_Check","arguments":{}}}`)
+	if !strings.Contains(out, `"structuredContent":{"status":"SERVING"}`) || strings.Contains(out, `"isError"`) {
+		t.Errorf("Health_Check = %s", out)
+	}
+	out = serve(t, s, `{"jsonrpc":"2.0","id":3,"method":"tools/call","params":{"name":"BookService_GetBook","arguments":{"id":"1"}}}`)
+	if !strings.Contains(out, `"isError":true`) || !strings.Contains(out, "Unimplemented") {
+		t.Errorf("GetBook on a server without it = %s", out)
+	}
+}
+
+func TestRPCToolsRefresh(t *testing.T) {
+	dir := t.TempDir()
+	write := func(rpcs string) {
+		src := "syntax = \"proto3\";\npackage pb;\nmessage Req { string q = 1; }\nmessage Res { int32 n = 1; }\nservice Search {\n" + rpcs + "}\n"
+		if err := os.WriteFile(filepath.Join(dir, "search.proto"), []byte(src), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	s := mcp.NewServer("test", version)
+	s.AddTool(mcp.Tool{Name: "list_services", InputSchema: json.RawMessage(`{"type":"object"}`)})
+	rpcs := &rpcTools{protoDir: dir}
+
+	write("  rpc Find(Req) returns (Res);\n")
+	if err := rpcs.refresh(s); err != nil {
+		t.Fatal(err)
+	}
+	write("  rpc Count(Req) returns (Res);\n  rpc Stream(stream Req) returns (Res);\n")
+	if err := rpcs.refresh(s); err != nil {
+		t.Fatal(err)
+	}
+
+	var got []string
+	var stream listedTool
+	for _, tool := range listTools(t, s) {
+		got = append(got, tool.Name)
+		if tool.Name == "Search_Stream" {
+			stream = tool
+		}
+	}
+	if want := "list_services,Search_Count,Search_Stream"; strings.Join(got, ",") != want {
+		t.Errorf("tools = %v, want %s", got, want)
+	}
+	if items := stream.InputSchema["properties"].(map[string]any)["messages"].(map[string]any)["items"].(map[string]any); items["properties"].(map[string]any)["q"] == nil {
+		t.Errorf("client-streaming input schema = %v", stream.InputSchema)
+	}
+}
@@ -0,0 +1,84 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"grpc_anotation_sample/migrations"
+	"log"
+	"os"
+	"strconv"
+
+	"github.com/joho/godotenv"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+const usage = `Usage: migrate [command]
+
+Commands:
+  up          Apply all pending migrations (default)
+  down [n]    Revert the last n applied migrations (default 1)
+  status      List migrations and whether they have been applied`
+
+// Applies the MongoDB migrations registered in package migrations using
+// MONGO_URL and DB_NAME from the environment (or .env).
+func main() {
+	if err := godotenv.Load(); err != nil {
+		log.Printf("Failed to load env: %v", err)
+	}
+	cmd := "up"
+	if len(os.Args) > 1 {
+		cmd = os.Args[1]
+	}
+
+	ctx := context.Background()
+	client, err := mongo.Connect(ctx, options.Client().ApplyURI(os.Getenv("MONGO_URL")))
+	if err != nil {
+		log.Fatalf("Failed to connect to mongo: %v", err)
+	}
+	defer client.Disconnect(ctx)
+	runner := migrations.NewRunner(client.Database(os.Getenv("DB_NAME")))
+
+	switch cmd {
+	case "up":
+		ran, err := runner.Up(ctx)
+		for _, id := range ran {
+			fmt.Printf("applied  %s\n", id)
+		}
+		if err != nil {
+			log.Fatalf("migrate up: %v", err)
+		}
+		if len(ran) == 0 {
+			fmt.Println("No pending migrations")
+		}
+	case "down":
+		steps := 1
+		if len(os.Args) > 2 {
+			if steps, err = strconv.Atoi(os.Args[2]); err != nil || steps < 1 {
+				log.Fatalf("invalid step count %q", os.Args[2])
+			}
+		}
+		reverted, err := runner.Down(ctx, steps)
+		for _, id := range reverted {
+			fmt.Printf("reverted %s\n", id)
+		}
+		if err != nil {
+			log.Fatalf("migrate down: %v", err)
+		}
+	case "status":
+		statuses, err := runner.Status(ctx)
+		if err != nil {
+			log.Fatalf("migrate status: %v", err)
+		}
+		for _, s := range statuses {
+			state := "pending"
+			if s.Applied {
+				state = "applied " + s.AppliedAt.Format("2006-01-02 15:04:05")
+			}
+			fmt.Printf("%-28s %s  %s\n", state, s.ID, s.Description)
+		}
+	default:
+		fmt.Fprintln(os.Stderr, usage)
+		os.Exit(2)
+	}
+}
@@ -0,0 +1,63 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"grpc_anotation_sample/protoset"
+	"os"
+)
+
+// Exit codes understood by gen_service.sh and the UI.
+const (
+	exitOK       = 0
+	exitBreaking = 1
+	exitError    = 2
+)
+
+// Compares proto/*.proto against the saved baseline descriptor set and lists
+// changes that would break existing gRPC (wire) or REST (JSON) clients.
+func main() {
+	protoDir := flag.String("proto", "proto", "directory containing the project's .proto files")
+	baseline := flag.String("baseline", "proto/baseline.binpb", "baseline FileDescriptorSet to compare against")
+	update := flag.Bool("update", false, "overwrite the baseline with the current protos instead of checking")
+	asJSON := flag.Bool("json", false, "print changes as a JSON array")
+	flag.Parse()
+
+	cur, err := protoset.Compile(*protoDir)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "failed to compile protos: %v\n", err)
+		os.Exit(exitError)
+	}
+	if *update {
+		if err := cur.Save(*baseline); err != nil {
+			fmt.Fprintf(os.Stderr, "failed to write baseline: %v\n", err)
+			os.Exit(exitError)
+		}
+		fmt.Printf("Baseline written to %s\n", *baseline)
+		return
+	}
+
+	base, err := protoset.Load(*baseline)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "failed to load baseline: %v\n", err)
+		os.Exit(exitError)
+	}
+	changes := protoset.Compare(base, cur)
+	if *asJSON {
+		if changes == nil {
+			changes = []protoset.Change{}
+		}
+		json.NewEncoder(os.Stdout).Encode(changes)
+	} else {
+		for _, c := range changes {
+			fmt.Println(c)
+		}
+	}
+	if len(changes) > 0 {
+		if !*asJSON {
+			fmt.Fprintf(os.Stderr, "%d breaking change(s) against %s\n", len(changes), *baseline)
+		}
+		os.Exit(exitBreaking)
+	}
+}
@@ -3,6 +3,8 @@ package main
 import (
 	"grpc_anotation_sample/server"
 	"log"
+
+	"github.com/joho/godotenv"
 )
 
 const (
@@ -14,6 +16,11 @@ const (
 // - gRPC: standard gRPC health check service (grpc_health_v1.Health)
 // - HTTP: GET /healthz returns 200 OK with body 'ok'
 func main() {
+	// Both servers read their settings from the environment
+	if err := godotenv.Load(); err != nil {
+		log.Fatalf("failed to load .env: %v", err)
+	}
+
 	go func() {
 		err := server.StartGRPCServer(grpcPort)
 		if err != nil {
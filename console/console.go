@@ -0,0 +1,508 @@
+// Package console calls the project's RPCs from their descriptors, over gRPC
+// with dynamic messages or through the grpc-gateway's HTTP bindings, so tools
+// need no generated client code.
+package console
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"google.golang.org/protobuf/types/dynamicpb"
+
+	"grpc_anotation_sample/protoset"
+)
+
+// Defaults match cmd/server; override with GRPC_ADDR and GATEWAY_URL.
+const (
+	defaultGRPCAddr   = "localhost:9090"
+	defaultGatewayURL = "http://localhost:8080"
+)
+
+// Timeout is how long callers should allow a call; streams are read until the
+// server closes them, maxStreamMessages arrive or the context expires.
+const (
+	Timeout           = 10 * time.Second
+	maxStreamMessages = 100
+	maxFormDepth      = 6
+)
+
+// GRPCAddr is the gRPC server to call, GRPC_ADDR or localhost:9090
+func GRPCAddr() string {
+	if addr := os.Getenv("GRPC_ADDR"); addr != "" {
+		return addr
+	}
+	return defaultGRPCAddr
+}
+
+// GatewayURL is the grpc-gateway to call, GATEWAY_URL or http://localhost:8080
+func GatewayURL() string {
+	if u := os.Getenv("GATEWAY_URL"); u != "" {
+		return strings.TrimRight(u, "/")
+	}
+	return defaultGatewayURL
+}
+
+// Method is one callable RPC with a form description of its request.
+type Method struct {
+	Service         string                 `json:"service"`
+	Method          string                 `json:"method"`
+	Path            string                 `json:"path"`
+	ClientStreaming bool                   `json:"clientStreaming,omitempty"`
+	ServerStreaming bool                   `json:"serverStreaming,omitempty"`
+	HTTP            []protoset.HTTPBinding `json:"http,omitempty"`
+	Request         string                 `json:"request"`
+	Response        string                 `json:"response"`
+	Fields          []FormField            `json:"fields"`
+}
+
+// FormField describes how to render one request field. Kind is a proto scalar
+// kind, "enum", "message", "map", or one of the well-known forms "timestamp",
+// "duration" and "json" (Struct, Value, Any and messages nested too deeply).
+// Nullable marks google.protobuf wrappers, which may be left unset.
+type FormField struct {
+	Name     string      `json:"name"`
+	JSONName string      `json:"jsonName"`
+	Kind     string      `json:"kind"`
+	Repeated bool        `json:"repeated,omitempty"`
+	Nullable bool        `json:"nullable,omitempty"`
+	Oneof    string      `json:"oneof,omitempty"`
+	Type     string      `json:"type,omitempty"`
+	Enum     []string    `json:"enum,omitempty"`
+	Fields   []FormField `json:"fields,omitempty"`
+	Key      *FormField  `json:"key,omitempty"`
+	Value    *FormField  `json:"value,omitempty"`
+}
+
+// Request is a call made from the console. Request holds the request
+// message in protojson form (an array of messages for client streaming);
+// Binding picks one of the method's HTTP bindings for the rest transport.
+type Request struct {
+	Service   string            `json:"service"`
+	Method    string            `json:"method"`
+	Transport string            `json:"transport"`
+	Binding   int               `json:"binding,omitempty"`
+	Request   json.RawMessage   `json:"request"`
+	Metadata  map[string]string `json:"metadata,omitempty"`
+}
+
+// Response reports the outcome of a console call. Status and Code are
+// the gRPC status (or HTTP status for rest); Body is the response, pretty
+// printed when it is JSON, and a JSON array of messages for server streams.
+type Response struct {
+	Transport  string              `json:"transport"`
+	Target     string              `json:"target"`
+	Status     string              `json:"status"`
+	Code       int                 `json:"code"`
+	Headers    map[string][]string `json:"headers,omitempty"`
+	Trailers   map[string][]string `json:"trailers,omitempty"`
+	Body       string              `json:"body,omitempty"`
+	Error      string              `json:"error,omitempty"`
+	DurationMs int64               `json:"durationMs"`
+}
+
+// Methods lists every RPC of the project's services.
+func Methods(set *protoset.Set) []Method {
+	var out []Method
+	for _, file := range set.Project() {
+		svcs := file.Services()
+		for i := 0; i < svcs.Len(); i++ {
+			sd := svcs.Get(i)
+			methods := sd.Methods()
+			for j := 0; j < methods.Len(); j++ {
+				md := methods.Get(j)
+				out = append(out, Method{
+					Service:         string(sd.FullName()),
+					Method:          string(md.Name()),
+					Path:            MethodPath(md),
+					ClientStreaming: md.IsStreamingClient(),
+					ServerStreaming: md.IsStreamingServer(),
+					HTTP:            protoset.Bindings(md),
+					Request:         string(md.Input().FullName()),
+					Response:        string(md.Output().FullName()),
+					Fields:          formFields(md.Input(), 0),
+				})
+			}
+		}
+	}
+	return out
+}
+
+// MethodPath is the gRPC path of md, /package.Service/Method
+func MethodPath(md protoreflect.MethodDescriptor) string {
+	return fmt.Sprintf("/%s/%s", md.Parent().FullName(), md.Name())
+}
+
+// FindMethod looks up method of the fully qualified service
+func FindMethod(set *protoset.Set, service, method string) (protoreflect.MethodDescriptor, error) {
+	desc, err := set.Files.FindDescriptorByName(protoreflect.FullName(service))
+	if err != nil {
+		return nil, fmt.Errorf("service %s not found", service)
+	}
+	sd, ok := desc.(protoreflect.ServiceDescriptor)
+	if !ok {
+		return nil, fmt.Errorf("%s is not a service", service)
+	}
+	md := sd.Methods().ByName(protoreflect.Name(method))
+	if md == nil {
+		return nil, fmt.Errorf("method %s not found in %s", method, service)
+	}
+	return md, nil
+}
+
+func formFields(md protoreflect.MessageDescriptor, depth int) []FormField {
+	fields := []FormField{}
+	list := md.Fields()
+	for i := 0; i < list.Len(); i++ {
+		fd := list.Get(i)
+		f := FormField{Name: string(fd.Name()), JSONName: fd.JSONName()}
+		if fd.IsMap() {
+			key, value := formField(fd.MapKey(), depth+1), formField(fd.MapValue(), depth+1)
+			f.Kind, f.Key, f.Value = "map", &key, &value
+		} else {
+			f = formField(fd, depth)
+			f.Repeated = fd.IsList()
+		}
+		if oneof := fd.ContainingOneof(); oneof != nil && !oneof.IsSynthetic() {
+			f.Oneof = string(oneof.Name())
+		}
+		fields = append(fields, f)
+	}
+	return fields
+}
+
+// formField describes the value of fd, ignoring its cardinality.
+func formField(fd protoreflect.FieldDescriptor, depth int) FormField {
+	f := FormField{Name: string(fd.Name()), JSONName: fd.JSONName(), Kind: fd.Kind().String()}
+	switch fd.Kind() {
+	case protoreflect.EnumKind:
+		f.Kind, f.Type = "enum", string(fd.Enum().FullName())
+		values := fd.Enum().Values()
+		for i := 0; i < values.Len(); i++ {
+			f.Enum = append(f.Enum, string(values.Get(i).Name()))
+		}
+	case protoreflect.MessageKind, protoreflect.GroupKind:
+		msg := fd.Message()
+		f.Type = string(msg.FullName())
+		switch name := msg.FullName(); {
+		case name == "google.protobuf.Timestamp":
+			f.Kind = "timestamp"
+		case name == "google.protobuf.Duration":
+			f.Kind = "duration"
+		case protoset.WrapperScalar(name) != "":
+			f.Kind, f.Nullable = protoset.WrapperScalar(name), true
+		case strings.HasPrefix(string(name), "google.protobuf.") || depth >= maxFormDepth:
+			f.Kind = "json"
+		default:
+			f.Kind = "message"
+			f.Fields = formFields(msg, depth+1)
+		}
+	}
+	return f
+}
+
+// Invoke calls md over req.Transport: "grpc" (the default) at GRPCAddr or
+// "rest" at GatewayURL. Call failures are reported in the Response; the error
+// is for an unknown transport.
+func Invoke(ctx context.Context, set *protoset.Set, md protoreflect.MethodDescriptor, req Request) (Response, error) {
+	switch req.Transport {
+	case "grpc", "":
+		return InvokeGRPC(ctx, GRPCAddr(), set, md, req), nil
+	case "rest":
+		return InvokeREST(ctx, GatewayURL(), set, md, req), nil
+	}
+	return Response{}, fmt.Errorf("unknown transport %q; use grpc or rest", req.Transport)
+}
+
+// ParseRequest decodes one request message in protojson form; an empty body is
+// the empty message.
+func ParseRequest(set *protoset.Set, md protoreflect.MessageDescriptor, raw json.RawMessage) (*dynamicpb.Message, error) {
+	msg := dynamicpb.NewMessage(md)
+	if len(bytes.TrimSpace(raw)) == 0 || string(bytes.TrimSpace(raw)) == "null" {
+		return msg, nil
+	}
+	opts := protojson.UnmarshalOptions{Resolver: dynamicpb.NewTypes(set.Files)}
+	if err := opts.Unmarshal(raw, msg); err != nil {
+		return nil, fmt.Errorf("invalid %s: %v", md.FullName(), err)
+	}
+	return msg, nil
+}
+
+// InvokeGRPC calls md on the gRPC server at addr with dynamic messages built
+// from the descriptors.
+func InvokeGRPC(ctx context.Context, addr string, set *protoset.Set, md protoreflect.MethodDescriptor, req Request) (resp Response) {
+	resp = Response{Transport: "grpc", Target: addr + MethodPath(md)}
+	start := time.Now()
+	defer func() { resp.DurationMs = time.Since(start).Milliseconds() }()
+
+	// Client streams take an array of request messages
+	raws := []json.RawMessage{req.Request}
+	if md.IsStreamingClient() {
+		raws = nil
+		if len(bytes.TrimSpace(req.Request)) > 0 {
+			if err := json.Unmarshal(req.Request, &raws); err != nil {
+				resp.Error = "A client-streaming request must be a JSON array of messages"
+				return resp
+			}
+		}
+	}
+	var in []*dynamicpb.Message
+	for _, raw := range raws {
+		msg, err := ParseRequest(set, md.Input(), raw)
+		if err != nil {
+			resp.Error = err.Error()
+			return resp
+		}
+		in = append(in, msg)
+	}
+
+	conn, err := grpc.NewClient(addr, grpc.WithTransportCredentials(insecure.NewCredentials()))
+	if err != nil {
+		resp.Error = fmt.Sprintf("Failed to connect to %s: %v", addr, err)
+		return resp
+	}
+	defer conn.Close()
+
+	if len(req.Metadata) > 0 {
+		ctx = metadata.NewOutgoingContext(ctx, metadata.New(req.Metadata))
+	}
+	var header, trailer metadata.MD
+	var out []*dynamicpb.Message
+	if !md.IsStreamingClient() && !md.IsStreamingServer() {
+		msg := dynamicpb.NewMessage(md.Output())
+		err = conn.Invoke(ctx, MethodPath(md), in[0], msg, grpc.Header(&header), grpc.Trailer(&trailer))
+		if err == nil {
+			out = append(out, msg)
+		}
+	} else {
+		out, header, trailer, err = invokeStream(ctx, conn, md, in)
+	}
+
+	st := status.Convert(err)
+	resp.Status, resp.Code = st.Code().String(), int(st.Code())
+	resp.Headers, resp.Trailers = header, trailer
+	if err != nil {
+		resp.Error = st.Message()
+	}
+
+	marshal := protojson.MarshalOptions{Resolver: dynamicpb.NewTypes(set.Files)}
+	if !md.IsStreamingServer() {
+		if len(out) > 0 {
+			marshal.Multiline, marshal.Indent = true, "  "
+			b, _ := marshal.Marshal(out[0])
+			resp.Body = string(b)
+		}
+		return resp
+	}
+	msgs := make([]json.RawMessage, 0, len(out))
+	for _, m := range out {
+		b, _ := marshal.Marshal(m)
+		msgs = append(msgs, b)
+	}
+	b, _ := json.MarshalIndent(msgs, "", "  ")
+	resp.Body = string(b)
+	return resp
+}
+
+func invokeStream(ctx context.Context, conn *grpc.ClientConn, md protoreflect.MethodDescriptor, in []*dynamicpb.Message) ([]*dynamicpb.Message, metadata.MD, metadata.MD, error) {
+	desc := &grpc.StreamDesc{
+		StreamName:    string(md.Name()),
+		ClientStreams: md.IsStreamingClient(),
+		ServerStreams: md.IsStreamingServer(),
+	}
+	stream, err := conn.NewStream(ctx, desc, MethodPath(md))
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	for _, msg := range in {
+		if err := stream.SendMsg(msg); err != nil {
+			break // the error is reported by RecvMsg
+		}
+	}
+	if err := stream.CloseSend(); err != nil {
+		return nil, nil, nil, err
+	}
+
+	var out []*dynamicpb.Message
+	for len(out) < maxStreamMessages {
+		msg := dynamicpb.NewMessage(md.Output())
+		if err = stream.RecvMsg(msg); err != nil {
+			break
+		}
+		out = append(out, msg)
+	}
+	header, _ := stream.Header()
+	if errors.Is(err, io.EOF) || len(out) == maxStreamMessages {
+		err = nil
+	}
+	return out, header, stream.Trailer(), err
+}
+
+var pathParam = regexp.MustCompile(`\{([^}=]+)(=[^}]*)?\}`)
+
+// buildRESTRequest maps a request message onto an HTTP binding the way
+// grpc-gateway reads it back: path parameters are substituted from the message,
+// the body field (or the whole message for "*") becomes the JSON body and every
+// other field is sent as a query parameter.
+func buildRESTRequest(ctx context.Context, base string, b protoset.HTTPBinding, msg *dynamicpb.Message) (*http.Request, error) {
+	data, err := protojson.MarshalOptions{UseProtoNames: true}.Marshal(msg)
+	if err != nil {
+		return nil, err
+	}
+	var fields map[string]any
+	if err := json.Unmarshal(data, &fields); err != nil {
+		return nil, err
+	}
+
+	var missing []string
+	path := pathParam.ReplaceAllStringFunc(b.Path, func(m string) string {
+		name := pathParam.FindStringSubmatch(m)[1]
+		v, ok := popField(fields, strings.Split(name, "."))
+		if !ok {
+			missing = append(missing, name)
+			return m
+		}
+		// Multi-segment templates such as {name=shelves/*} keep their slashes
+		if strings.Contains(m, "=") {
+			return strings.ReplaceAll(url.PathEscape(fmt.Sprint(v)), "%2F", "/")
+		}
+		return url.PathEscape(fmt.Sprint(v))
+	})
+	if len(missing) > 0 {
+		return nil, fmt.Errorf("path parameter %s is required", strings.Join(missing, ", "))
+	}
+
+	var body io.Reader
+	switch b.Body {
+	case "":
+	case "*":
+		data, _ := json.Marshal(fields)
+		body, fields = bytes.NewReader(data), nil
+	default:
+		v, _ := popField(fields, strings.Split(b.Body, "."))
+		data, _ := json.Marshal(v)
+		body = bytes.NewReader(data)
+	}
+
+	query := url.Values{}
+	addQuery(query, "", fields)
+	target := base + path
+	if len(query) > 0 {
+		target += "?" + query.Encode()
+	}
+	httpReq, err := http.NewRequestWithContext(ctx, b.Method, target, body)
+	if err != nil {
+		return nil, err
+	}
+	if body != nil {
+		httpReq.Header.Set("Content-Type", "application/json")
+	}
+	return httpReq, nil
+}
+
+// popField removes the value at path from fields and returns it.
+func popField(fields map[string]any, path []string) (any, bool) {
+	for i, name := range path {
+		v, ok := fields[name]
+		if !ok {
+			return nil, false
+		}
+		if i == len(path)-1 {
+			delete(fields, name)
+			return v, true
+		}
+		if fields, ok = v.(map[string]any); !ok {
+			return nil, false
+		}
+	}
+	return nil, false
+}
+
+// addQuery flattens nested fields to dotted names; lists repeat the parameter.
+func addQuery(query url.Values, prefix string, fields map[string]any) {
+	keys := make([]string, 0, len(fields))
+	for k := range fields {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		switch v := fields[k].(type) {
+		case map[string]any:
+			addQuery(query, prefix+k+".", v)
+		case []any:
+			for _, item := range v {
+				query.Add(prefix+k, fmt.Sprint(item))
+			}
+		default:
+			query.Add(prefix+k, fmt.Sprint(v))
+		}
+	}
+}
+
+// InvokeREST calls md through the grpc-gateway at base using one of its HTTP bindings.
+func InvokeREST(ctx context.Context, base string, set *protoset.Set, md protoreflect.MethodDescriptor, req Request) (resp Response) {
+	resp = Response{Transport: "rest"}
+	start := time.Now()
+	defer func() { resp.DurationMs = time.Since(start).Milliseconds() }()
+
+	bindings := protoset.Bindings(md)
+	if req.Binding < 0 || req.Binding >= len(bindings) {
+		resp.Error = fmt.Sprintf("%s has no HTTP binding %d; call it over gRPC", md.Name(), req.Binding)
+		return resp
+	}
+	if md.IsStreamingClient() {
+		resp.Error = "Client-streaming RPCs can only be called over gRPC"
+		return resp
+	}
+	msg, err := ParseRequest(set, md.Input(), req.Request)
+	if err != nil {
+		resp.Error = err.Error()
+		return resp
+	}
+	httpReq, err := buildRESTRequest(ctx, base, bindings[req.Binding], msg)
+	if err != nil {
+		resp.Error = err.Error()
+		return resp
+	}
+	for k, v := range req.Metadata {
+		httpReq.Header.Set(k, v)
+	}
+	resp.Target = httpReq.Method + " " + httpReq.URL.String()
+
+	httpResp, err := http.DefaultClient.Do(httpReq)
+	if err != nil {
+		resp.Error = fmt.Sprintf("Request failed: %v", err)
+		return resp
+	}
+	defer httpResp.Body.Close()
+	data, err := io.ReadAll(httpResp.Body)
+	if err != nil {
+		resp.Error = fmt.Sprintf("Failed to read response: %v", err)
+	}
+
+	resp.Status, resp.Code = httpResp.Status, httpResp.StatusCode
+	resp.Headers = httpResp.Header
+	var pretty bytes.Buffer
+	if json.Indent(&pretty, data, "", "  ") == nil {
+		resp.Body = pretty.String()
+	} else {
+		resp.Body = string(data)
+	}
+	return resp
+}
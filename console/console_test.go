@@ -0,0 +1,286 @@
+package console
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"google.golang.org/protobuf/types/dynamicpb"
+
+	"grpc_anotation_sample/protoset"
+)
+
+const consoleProto = `syntax = "proto3";
+
+package pb;
+
+import "google/api/annotations.proto";
+import "google/protobuf/timestamp.proto";
+import "google/protobuf/wrappers.proto";
+
+// An item in the catalogue
+message Item {
+  string id = 1; // Server-assigned id
+  string name = 2;
+  repeated string tags = 3;
+  google.protobuf.Timestamp due = 4;
+  google.protobuf.Int32Value rank = 5;
+  map<string, int32> counts = 6;
+  Kind kind = 7;
+}
+
+enum Kind {
+  KIND_UNSPECIFIED = 0;
+  KIND_SMALL = 1;
+}
+
+message GetItemRequest { string id = 1; string view = 2; repeated string fields = 3; }
+message UpdateItemRequest { Item data = 1; bool dry_run = 2; }
+message ItemResponse { Item data = 1; }
+
+service ItemService {
+  rpc GetItem(GetItemRequest) returns (ItemResponse) {
+    option (google.api.http) = { get: "/v1/items/{id}" };
+  }
+  rpc UpdateItem(UpdateItemRequest) returns (ItemResponse) {
+    option (google.api.http) = {
+      put: "/v1/items/{data.id}" body: "data"
+      additional_bindings { patch: "/v1/items/{data.id}" body: "*" }
+    };
+  }
+  rpc WatchItems(GetItemRequest) returns (stream ItemResponse);
+}
+`
+
+func compileConsoleProto(t *testing.T) *protoset.Set {
+	t.Helper()
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, "item.proto"), []byte(consoleProto), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	set, err := protoset.Compile(dir)
+	if err != nil {
+		t.Fatalf("Compile: %v", err)
+	}
+	return set
+}
+
+func TestMethods(t *testing.T) {
+	methods := Methods(compileConsoleProto(t))
+	if len(methods) != 3 {
+		t.Fatalf("got %d methods, want 3", len(methods))
+	}
+	watch := methods[2]
+	if watch.Path != "/pb.ItemService/WatchItems" || !watch.ServerStreaming || watch.HTTP != nil {
+		t.Errorf("WatchItems = %+v", watch)
+	}
+
+	update := methods[1]
+	if len(update.HTTP) != 2 || len(update.Fields) != 2 {
+		t.Fatalf("UpdateItem = %+v", update)
+	}
+	data := update.Fields[0]
+	if data.Kind != "message" || data.Type != "pb.Item" || len(data.Fields) != 7 {
+		t.Fatalf("data = %+v", data)
+	}
+	byName := map[string]FormField{}
+	for _, f := range data.Fields {
+		byName[f.Name] = f
+	}
+	if f := byName["tags"]; f.Kind != "string" || !f.Repeated {
+		t.Errorf("tags = %+v", f)
+	}
+	if f := byName["due"]; f.Kind != "timestamp" {
+		t.Errorf("due = %+v", f)
+	}
+	if f := byName["rank"]; f.Kind != "int32" || !f.Nullable {
+		t.Errorf("rank = %+v", f)
+	}
+	if f := byName["counts"]; f.Kind != "map" || f.Key.Kind != "string" || f.Value.Kind != "int32" {
+		t.Errorf("counts = %+v", f)
+	}
+	if f := byName["kind"]; f.Kind != "enum" || strings.Join(f.Enum, ",") != "KIND_UNSPECIFIED,KIND_SMALL" {
+		t.Errorf("kind = %+v", f)
+	}
+	if f := update.Fields[1]; f.Name != "dry_run" || f.JSONName != "dryRun" || f.Kind != "bool" {
+		t.Errorf("dry_run = %+v", f)
+	}
+}
+
+func TestSchema(t *testing.T) {
+	set := compileConsoleProto(t)
+	md, err := FindMethod(set, "pb.ItemService", "UpdateItem")
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, _ := json.Marshal(Schema(md.Input()))
+	var schema struct {
+		Properties struct {
+			Data struct {
+				Description string
+				Properties  map[string]map[string]any
+			}
+			DryRun map[string]any
+		}
+	}
+	if err := json.Unmarshal(data, &schema); err != nil {
+		t.Fatal(err)
+	}
+	if schema.Properties.DryRun["type"] != "boolean" {
+		t.Errorf("dryRun = %v", schema.Properties.DryRun)
+	}
+	item := schema.Properties.Data
+	if item.Description != "An item in the catalogue" {
+		t.Errorf("data description = %q", item.Description)
+	}
+	want := map[string]string{
+		"id":     `{"description":"Server-assigned id","type":"string"}`,
+		"tags":   `{"items":{"type":"string"},"type":"array"}`,
+		"due":    `{"description":"RFC 3339, e.g. 2024-01-02T15:04:05Z","format":"date-time","type":"string"}`,
+		"rank":   `{"type":["null","integer"]}`,
+		"counts": `{"additionalProperties":{"type":"integer"},"type":"object"}`,
+		"kind":   `{"enum":["KIND_UNSPECIFIED","KIND_SMALL"],"type":"string"}`,
+	}
+	for name, w := range want {
+		got, _ := json.Marshal(item.Properties[name])
+		if string(got) != w {
+			t.Errorf("%s = %s, want %s", name, got, w)
+		}
+	}
+}
+
+func TestBuildRESTRequest(t *testing.T) {
+	set := compileConsoleProto(t)
+	tests := []struct {
+		method  string
+		binding int
+		request string
+		want    string
+		body    string
+	}{
+		{"GetItem", 0, `{"id":"a/b","view":"full","fields":["x","y"]}`, "GET http://gw/v1/items/a%2Fb?fields=x&fields=y&view=full", ""},
+		{"UpdateItem", 0, `{"data":{"id":"7","name":"n"},"dryRun":true}`, "PUT http://gw/v1/items/7?dry_run=true", `{"name":"n"}`},
+		{"UpdateItem", 1, `{"data":{"id":"7","name":"n"},"dryRun":true}`, "PATCH http://gw/v1/items/7", `{"data":{"name":"n"},"dry_run":true}`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.want, func(t *testing.T) {
+			md, err := FindMethod(set, "pb.ItemService", tt.method)
+			if err != nil {
+				t.Fatal(err)
+			}
+			msg, err := ParseRequest(set, md.Input(), json.RawMessage(tt.request))
+			if err != nil {
+				t.Fatal(err)
+			}
+			req, err := buildRESTRequest(context.Background(), "http://gw", protoset.Bindings(md)[tt.binding], msg)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := req.Method + " " + req.URL.String(); got != tt.want {
+				t.Errorf("request = %s, want %s", got, tt.want)
+			}
+			var body string
+			if req.Body != nil {
+				b, _ := io.ReadAll(req.Body)
+				body = string(b)
+			}
+			if body != tt.body {
+				t.Errorf("body = %s, want %s", body, tt.body)
+			}
+		})
+	}
+
+	md, _ := FindMethod(set, "pb.ItemService", "UpdateItem")
+	msg, _ := ParseRequest(set, md.Input(), nil)
+	if _, err := buildRESTRequest(context.Background(), "http://gw", protoset.Bindings(md)[0], msg); err == nil {
+		t.Error("expected an error for a missing path parameter")
+	}
+}
+
+// itemServer answers ItemService calls with dynamic messages, echoing the
+// request id and the "x-user" metadata value as the item name.
+func itemServer(t *testing.T, set *protoset.Set) string {
+	t.Helper()
+	lookup := func(name string) protoreflect.MessageDescriptor {
+		d, err := set.Files.FindDescriptorByName(protoreflect.FullName(name))
+		if err != nil {
+			t.Fatal(err)
+		}
+		return d.(protoreflect.MessageDescriptor)
+	}
+	reqDesc, resDesc, itemDesc := lookup("pb.GetItemRequest"), lookup("pb.ItemResponse"), lookup("pb.Item")
+
+	srv := grpc.NewServer(grpc.UnknownServiceHandler(func(_ any, stream grpc.ServerStream) error {
+		in := dynamicpb.NewMessage(reqDesc)
+		if err := stream.RecvMsg(in); err != nil {
+			return err
+		}
+		md, _ := metadata.FromIncomingContext(stream.Context())
+		stream.SetHeader(metadata.Pairs("x-served-by", "test"))
+		n := 1
+		if method, _ := grpc.MethodFromServerStream(stream); method == "/pb.ItemService/WatchItems" {
+			n = 2
+		}
+		for i := 0; i < n; i++ {
+			item := dynamicpb.NewMessage(itemDesc)
+			item.Set(itemDesc.Fields().ByName("id"), protoreflect.ValueOfString(in.Get(reqDesc.Fields().ByName("id")).String()))
+			item.Set(itemDesc.Fields().ByName("name"), protoreflect.ValueOfString(strings.Join(md.Get("x-user"), ",")))
+			out := dynamicpb.NewMessage(resDesc)
+			out.Set(resDesc.Fields().ByName("data"), protoreflect.ValueOfMessage(item))
+			if err := stream.SendMsg(out); err != nil {
+				return err
+			}
+		}
+		return nil
+	}))
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	go srv.Serve(lis)
+	t.Cleanup(srv.Stop)
+	return lis.Addr().String()
+}
+
+func TestInvokeGRPC(t *testing.T) {
+	set := compileConsoleProto(t)
+	addr := itemServer(t, set)
+
+	get, _ := FindMethod(set, "pb.ItemService", "GetItem")
+	resp := InvokeGRPC(context.Background(), addr, set, get, Request{
+		Request:  json.RawMessage(`{"id":"42"}`),
+		Metadata: map[string]string{"x-user": "ada"},
+	})
+	if resp.Error != "" || resp.Status != "OK" {
+		t.Fatalf("GetItem = %+v", resp)
+	}
+	var out struct {
+		Data struct{ ID, Name string }
+	}
+	if err := json.Unmarshal([]byte(resp.Body), &out); err != nil || out.Data.ID != "42" || out.Data.Name != "ada" {
+		t.Errorf("GetItem body = %s", resp.Body)
+	}
+	if got := resp.Headers["x-served-by"]; len(got) != 1 || got[0] != "test" {
+		t.Errorf("headers = %v", resp.Headers)
+	}
+
+	watch, _ := FindMethod(set, "pb.ItemService", "WatchItems")
+	resp = InvokeGRPC(context.Background(), addr, set, watch, Request{Request: json.RawMessage(`{"id":"7"}`)})
+	var msgs []json.RawMessage
+	if err := json.Unmarshal([]byte(resp.Body), &msgs); err != nil || len(msgs) != 2 || resp.Status != "OK" {
+		t.Errorf("WatchItems = %+v", resp)
+	}
+
+	resp = InvokeGRPC(context.Background(), addr, set, get, Request{Request: json.RawMessage(`{"nope":1}`)})
+	if resp.Error == "" {
+		t.Error("expected an error for an unknown request field")
+	}
+}
@@ -0,0 +1,171 @@
+package console
+
+import (
+	"strings"
+
+	"google.golang.org/protobuf/reflect/protoreflect"
+
+	"grpc_anotation_sample/protoset"
+)
+
+// maxSchemaDepth bounds nested messages in a schema; recursive messages are
+// cut off there and accept any object.
+const maxSchemaDepth = 8
+
+// Schema returns a JSON Schema for md in protojson form: properties use JSON
+// names, 64-bit integers may be strings, enums are their value names and
+// well-known types have their JSON mappings. Proto comments become
+// descriptions.
+func Schema(md protoreflect.MessageDescriptor) map[string]any {
+	return schemaBuilder{}.message(md, 0)
+}
+
+// SchemaRefs is like Schema, but fields of message types other than the
+// well-known types get the schema returned by ref, such as a $ref to a
+// shared definition, instead of being expanded.
+func SchemaRefs(md protoreflect.MessageDescriptor, ref func(protoreflect.MessageDescriptor) map[string]any) map[string]any {
+	return schemaBuilder{ref: ref}.message(md, 0)
+}
+
+type schemaBuilder struct {
+	ref func(protoreflect.MessageDescriptor) map[string]any
+}
+
+func (b schemaBuilder) message(md protoreflect.MessageDescriptor, depth int) map[string]any {
+	if s := wellKnownSchema(md); s != nil {
+		return s
+	}
+	if b.ref != nil && depth > 0 {
+		return b.ref(md)
+	}
+	s := map[string]any{"type": "object"}
+	if desc := Comment(md); desc != "" {
+		s["description"] = desc
+	}
+	if depth >= maxSchemaDepth {
+		return s
+	}
+	props := map[string]any{}
+	fields := md.Fields()
+	for i := 0; i < fields.Len(); i++ {
+		fd := fields.Get(i)
+		props[fd.JSONName()] = b.field(fd, depth)
+	}
+	s["properties"] = props
+	return s
+}
+
+func (b schemaBuilder) field(fd protoreflect.FieldDescriptor, depth int) map[string]any {
+	var s map[string]any
+	switch {
+	case fd.IsMap():
+		s = map[string]any{"type": "object", "additionalProperties": b.value(fd.MapValue(), depth+1)}
+	case fd.IsList():
+		s = map[string]any{"type": "array", "items": b.value(fd, depth+1)}
+	default:
+		s = b.value(fd, depth+1)
+	}
+
+	desc := Comment(fd)
+	if oneof := fd.ContainingOneof(); oneof != nil && !oneof.IsSynthetic() {
+		desc = strings.TrimSpace(desc + "\nPart of oneof " + string(oneof.Name()) + ": set at most one of its fields.")
+	}
+	if desc != "" {
+		// Copy so shared well-known schemas are not modified
+		out := make(map[string]any, len(s)+1)
+		for k, v := range s {
+			out[k] = v
+		}
+		out["description"] = desc
+		s = out
+	}
+	return s
+}
+
+// FieldSchema describes one value of fd, ignoring its cardinality, with
+// message types expanded as by Schema.
+func FieldSchema(fd protoreflect.FieldDescriptor) map[string]any {
+	return schemaBuilder{}.value(fd, 1)
+}
+
+// value describes one value of fd, ignoring its cardinality
+func (b schemaBuilder) value(fd protoreflect.FieldDescriptor, depth int) map[string]any {
+	switch fd.Kind() {
+	case protoreflect.BoolKind:
+		return map[string]any{"type": "boolean"}
+	case protoreflect.StringKind:
+		return map[string]any{"type": "string"}
+	case protoreflect.BytesKind:
+		return map[string]any{"type": "string", "contentEncoding": "base64"}
+	case protoreflect.Int32Kind, protoreflect.Sint32Kind, protoreflect.Sfixed32Kind,
+		protoreflect.Uint32Kind, protoreflect.Fixed32Kind:
+		return map[string]any{"type": "integer"}
+	case protoreflect.Int64Kind, protoreflect.Sint64Kind, protoreflect.Sfixed64Kind,
+		protoreflect.Uint64Kind, protoreflect.Fixed64Kind:
+		return map[string]any{"type": []string{"integer", "string"}, "pattern": `^-?[0-9]+$`}
+	case protoreflect.FloatKind, protoreflect.DoubleKind:
+		return map[string]any{"type": "number"}
+	case protoreflect.EnumKind:
+		if fd.Enum().FullName() == "google.protobuf.NullValue" {
+			return map[string]any{"type": "null"}
+		}
+		var names []string
+		values := fd.Enum().Values()
+		for i := 0; i < values.Len(); i++ {
+			names = append(names, string(values.Get(i).Name()))
+		}
+		return map[string]any{"type": "string", "enum": names}
+	}
+	return b.message(fd.Message(), depth)
+}
+
+// wellKnownSchema returns the JSON mapping of the google.protobuf types that
+// are not encoded as objects of their fields, or nil.
+func wellKnownSchema(md protoreflect.MessageDescriptor) map[string]any {
+	if scalar := protoset.WrapperScalar(md.FullName()); scalar != "" {
+		s := schemaBuilder{}.value(md.Fields().ByName("value"), 0)
+		types := []any{"null"}
+		if t, ok := s["type"].([]string); ok {
+			for _, t := range t {
+				types = append(types, t)
+			}
+		} else {
+			types = append(types, s["type"])
+		}
+		s["type"] = types
+		return s
+	}
+	switch md.FullName() {
+	case "google.protobuf.Timestamp":
+		return map[string]any{"type": "string", "format": "date-time", "description": "RFC 3339, e.g. 2024-01-02T15:04:05Z"}
+	case "google.protobuf.Duration":
+		return map[string]any{"type": "string", "pattern": `^-?[0-9]+(\.[0-9]+)?s$`, "description": "Seconds with an s suffix, e.g. 1.5s"}
+	case "google.protobuf.FieldMask":
+		return map[string]any{"type": "string", "description": "Comma-separated field paths in camelCase"}
+	case "google.protobuf.Struct":
+		return map[string]any{"type": "object"}
+	case "google.protobuf.ListValue":
+		return map[string]any{"type": "array"}
+	case "google.protobuf.Value":
+		return map[string]any{}
+	case "google.protobuf.Any":
+		return map[string]any{"type": "object", "properties": map[string]any{"@type": map[string]any{"type": "string"}}, "required": []string{"@type"}}
+	case "google.protobuf.Empty":
+		return map[string]any{"type": "object", "additionalProperties": false}
+	}
+	return nil
+}
+
+// Comment returns the leading (or else trailing) comment on d, trimmed
+func Comment(d protoreflect.Descriptor) string {
+	loc := d.ParentFile().SourceLocations().ByDescriptor(d)
+	c := loc.LeadingComments
+	if strings.TrimSpace(c) == "" {
+		c = loc.TrailingComments
+	}
+	lines := strings.Split(strings.TrimSpace(c), "\n")
+	for i, line := range lines {
+		lines[i] = strings.TrimSpace(line)
+	}
+	return strings.Join(lines, "\n")
+}
@@ -2,8 +2,23 @@
 
 # Usage: ./gen_service.sh ServiceName "field1:type1,field2:type2,..."
 #        ./gen_service.sh remove ServiceName
-#        ./gen_service.sh add-rpc ServiceName RpcName "req_field1:type,..." "res_field1:type,..." "http=METHOD:/path" ["body=*"]
+#        ./gen_service.sh add-rpc ServiceName RpcName "req_field1:type,..." "res_field1:type,..." ["http=METHOD:/path"|none] ["body=*"] [stream=server|client|bidi]
 #        ./gen_service.sh add-nested ServiceName field_name "nested_field1:type,..." [repeated] [MessageName]
+#        ./gen_service.sh add-migration backfill ServiceName field [value]
+#        ./gen_service.sh add-migration rename ServiceName old_field new_field
+#        ./gen_service.sh edit-field ServiceName field_name "type" [MessageName]
+#        ./gen_service.sh remove-field ServiceName field_name [MessageName]
+#        ./gen_service.sh remove-rpc ServiceName RpcName
+#        ./gen_service.sh set-http ServiceName RpcName "http=METHOD:/path"|none ["body=*"]
+#        ./gen_service.sh lock [ServiceName]
+#
+# Field types may declare an enum inline: "status:Status{DRAFT,PUBLISHED}".
+# Maps, oneofs and well-known types: "labels:map<string,string>",
+# "payload:oneof{text:string|image:bytes}", "ttl:duration", "attrs:struct" and
+# "nickname:string?" (a google.protobuf wrapper for a nullable scalar).
+#
+# Changes that would break clients of proto/baseline.binpb (see `make proto-check`)
+# are refused with exit code 3 unless FORCE=1 is set in the environment.
 
 set -e
 
@@ -99,24 +114,997 @@ pluralize() {
   esac
 }
 
-# Helper to normalize field types (placed early so all subcommands can use it)
+# Scalar proto types that map directly onto Go types
+SCALAR_TYPES="string bool bytes int32 int64 sint32 sint64 uint32 uint64 fixed32 fixed64 sfixed32 sfixed64 float double"
+WRAPPER_TYPES="DoubleValue FloatValue Int64Value UInt64Value Int32Value UInt32Value BoolValue StringValue BytesValue"
+
+is_scalar_type() {
+  case " $SCALAR_TYPES " in *" $1 "*) return 0 ;; esac
+  return 1
+}
+
+# Helper to normalize field types (placed early so all subcommands can use it).
+# Besides scalars and messages it understands timestamp, duration, struct,
+# map<K,V> and nullable scalars written as `string?` (google.protobuf wrappers).
 normalize_type() {
-  local t="$1"
+  local t
+  t="$(echo "$1" | xargs)"
   local tlc="$(echo "$t" | tr '[:upper:]' '[:lower:]')"
+  if is_scalar_type "$tlc"; then
+    echo "$tlc"; return 0
+  fi
   case "$tlc" in
-    string|bool|bytes|int32|int64|sint32|sint64|uint32|uint64|fixed32|fixed64|sfixed32|sfixed64|float|double)
-      echo "$tlc"; return 0 ;;
-    timestamp|datetime|date)
+    timestamp|datetime|date|google.protobuf.timestamp)
       echo "google.protobuf.Timestamp"; return 0 ;;
+    duration|google.protobuf.duration)
+      echo "google.protobuf.Duration"; return 0 ;;
+    struct|google.protobuf.struct)
+      echo "google.protobuf.Struct"; return 0 ;;
+    *\?)
+      local base
+      base="$(normalize_type "${t%\?}")"
+      if ! is_scalar_type "$base"; then
+        echo "Only scalar types can be nullable: '$t'" >&2
+        exit 1
+      fi
+      wrapper_type "$base"; return 0 ;;
+    map\<*\>)
+      local inner="${t#*<}"
+      inner="${inner%>}"
+      local key value
+      key="$(normalize_type "${inner%%,*}")"
+      value="$(normalize_type "${inner#*,}")"
+      case "$key" in
+        string|bool|int32|int64|sint32|sint64|uint32|uint64|fixed32|fixed64|sfixed32|sfixed64) ;;
+        *) echo "Map keys must be integral or string types: '$t'" >&2; exit 1 ;;
+      esac
+      echo "map<${key}, ${value}>"; return 0 ;;
   esac
-  local tlc_lower="$(echo "$t" | tr '[:upper:]' '[:lower:]')"
-  if [ "$tlc_lower" = "google.protobuf.timestamp" ]; then
-    echo "google.protobuf.Timestamp"; return 0
-  fi
+  local w
+  for w in $WRAPPER_TYPES; do
+    if [ "$tlc" = "$(echo "google.protobuf.$w" | tr '[:upper:]' '[:lower:]')" ] || [ "$tlc" = "$(echo "$w" | tr '[:upper:]' '[:lower:]')" ]; then
+      echo "google.protobuf.$w"; return 0
+    fi
+  done
   local first="$(echo "${t:0:1}" | tr '[:lower:]' '[:upper:]')"
   echo "${first}${t:1}"
 }
 
+# Wrapper message used for a nullable scalar: string -> google.protobuf.StringValue
+wrapper_type() {
+  case "$1" in
+    double) echo "google.protobuf.DoubleValue" ;;
+    float) echo "google.protobuf.FloatValue" ;;
+    int64|sint64|sfixed64) echo "google.protobuf.Int64Value" ;;
+    uint64|fixed64) echo "google.protobuf.UInt64Value" ;;
+    int32|sint32|sfixed32) echo "google.protobuf.Int32Value" ;;
+    uint32|fixed32) echo "google.protobuf.UInt32Value" ;;
+    bool) echo "google.protobuf.BoolValue" ;;
+    string) echo "google.protobuf.StringValue" ;;
+    bytes) echo "google.protobuf.BytesValue" ;;
+  esac
+}
+
+# Proto import required by a normalized type, if any
+proto_import_for() {
+  case "$1" in
+    *google.protobuf.Timestamp*) echo "google/protobuf/timestamp.proto" ;;
+    *google.protobuf.Duration*) echo "google/protobuf/duration.proto" ;;
+    *google.protobuf.Struct*) echo "google/protobuf/struct.proto" ;;
+    *google.protobuf.*Value*) echo "google/protobuf/wrappers.proto" ;;
+  esac
+}
+
+# Add `import "PATH";` to PROTO after its last import (or after the package line)
+ensure_proto_import() {
+  local proto="$1" path="$2"
+  [ -z "$path" ] && return 0
+  grep -q "^import \"${path}\";" "$proto" && return 0
+  local tmp="$proto.tmp"
+  awk -v imp="import \"${path}\";" '
+    { lines[NR] = $0; if ($0 ~ /^import /) last = NR; if ($0 ~ /^package /) pkg = NR }
+    END {
+      at = last ? last : pkg
+      for (i = 1; i <= NR; i++) {
+        print lines[i]
+        if (i == at) { if (!last) print ""; print imp }
+      }
+      if (!at) print imp
+    }
+  ' "$proto" > "$tmp" && mv "$tmp" "$proto"
+}
+
+# Go type used in models for a normalized, non-repeated proto type
+go_type_for() {
+  case "$1" in
+    string) echo "string" ;;
+    bool) echo "bool" ;;
+    bytes|google.protobuf.BytesValue) echo "[]byte" ;;
+    int32|sint32|sfixed32) echo "int32" ;;
+    int64|sint64|sfixed64) echo "int64" ;;
+    uint32|fixed32) echo "uint32" ;;
+    uint64|fixed64) echo "uint64" ;;
+    float) echo "float32" ;;
+    double) echo "float64" ;;
+    google.protobuf.Timestamp) echo "time.Time" ;;
+    google.protobuf.Duration) echo "time.Duration" ;;
+    google.protobuf.Struct) echo "map[string]interface{}" ;;
+    google.protobuf.*Value) echo "*$(go_type_for "$(wrapped_scalar "$1")")" ;;
+    map\<*)
+      local inner="${1#map<}"
+      inner="${inner%>}"
+      echo "map[$(go_type_for "${inner%%, *}")]$(go_type_for "${inner#*, }")" ;;
+    *) echo "string" ;; # Default to string for custom types
+  esac
+}
+
+# Scalar wrapped by a google.protobuf wrapper: google.protobuf.UInt32Value -> uint32
+wrapped_scalar() {
+  local w="${1#google.protobuf.}"
+  echo "${w%Value}" | tr '[:upper:]' '[:lower:]'
+}
+
+# Go struct field name for a proto field: avatar_url -> AvatarUrl
+go_field_name() {
+  echo "$1" | awk -F'_' '{for(i=1;i<=NF;i++){ $i=toupper(substr($i,1,1)) substr($i,2) }}1' OFS=""
+}
+
+# Split one field spec ("name:type", "name:repeated type" or "repeated type name")
+# into NAME, TYPE_RAW and IS_REPEATED. Fails for an empty or malformed spec.
+parse_field_spec() {
+  local raw
+  raw="$(echo "$1" | xargs)"
+  NAME=""
+  TYPE_RAW=""
+  IS_REPEATED=0
+  [ -z "$raw" ] && return 1
+  if [[ "$raw" == *:* ]]; then
+    NAME="$(echo "$raw" | cut -d: -f1 | xargs)"
+    TYPE_RAW="$(echo "$raw" | cut -d: -f2- | xargs)"
+    case "$TYPE_RAW" in
+      [Rr]epeated\ *) IS_REPEATED=1; TYPE_RAW="$(echo "${TYPE_RAW#* }" | xargs)" ;;
+    esac
+  elif [[ "$raw" =~ ^[Rr]epeated[[:space:]]+([^[:space:]]+)[[:space:]]+([a-z][A-Za-z0-9_]*)$ ]]; then
+    IS_REPEATED=1
+    TYPE_RAW="${BASH_REMATCH[1]}"
+    NAME="${BASH_REMATCH[2]}"
+  else
+    return 1
+  fi
+}
+
+# Go package a model needs to convert a normalized, non-repeated proto type
+go_import_for() {
+  case "$1" in
+    google.protobuf.Timestamp) echo "google.golang.org/protobuf/types/known/timestamppb" ;;
+    google.protobuf.Duration) echo "google.golang.org/protobuf/types/known/durationpb" ;;
+    google.protobuf.Struct) echo "google.golang.org/protobuf/types/known/structpb" ;;
+    google.protobuf.*Value) echo "google.golang.org/protobuf/types/known/wrapperspb" ;;
+  esac
+}
+
+# Go enum type for a field type: the name of an inline declaration
+# (Status{DRAFT,PUBLISHED}) or of an enum that already exists in proto/ and models/
+model_enum_name() {
+  if parse_enum "$1"; then
+    echo "$ENUM_NAME"; return 0
+  fi
+  local t
+  t="$(normalize_type "$1")"
+  if grep -qs "^enum ${t} {" proto/*.proto && grep -qs "^type ${t} string$" models/*.go; then
+    echo "$t"; return 0
+  fi
+  return 1
+}
+
+# Print the model struct line(s) for a field; each oneof variant becomes an
+# optional field of its own.
+model_field_lines() {
+  local name="$1" type_raw="$2" repeated="$3" variant v_name go_type
+  if parse_oneof "$type_raw"; then
+    for variant in "${ONEOF_VARIANTS[@]}"; do
+      v_name="${variant%%:*}"
+      go_type="$(go_type_for "$(normalize_type "${variant#*:}")")"
+      [ "$go_type" != "[]byte" ] && go_type="*${go_type}"
+      echo "	$(go_field_name "$v_name") ${go_type} \`json:\"${v_name},omitempty\" bson:\"${v_name},omitempty\"\`"
+    done
+    return 0
+  fi
+  if ! go_type="$(model_enum_name "$type_raw")"; then
+    go_type="$(go_type_for "$(normalize_type "$type_raw")")"
+  fi
+  [ "$repeated" = "1" ] && go_type="[]${go_type}"
+  echo "	$(go_field_name "$name") ${go_type} \`json:\"${name}\" bson:\"${name}\"\`"
+}
+
+# Conversion of a field of message MSG in ToProto (DIR=to) or FromProto (DIR=from).
+# Sets CONV_LINE to the struct literal entry, or "" when the field is assigned
+# after the literal by the statements in CONV_POST (printf %b escapes).
+model_conversion() {
+  local dir="$1" name="$2" type_raw="$3" repeated="$4" msg="$5"
+  local field variant v_field v_value src="m" expr="" enum type_norm wrapper
+  field="$(go_field_name "$name")"
+  [ "$dir" = "from" ] && src="p"
+  CONV_LINE=""
+  CONV_POST=""
+
+  if parse_oneof "$type_raw"; then
+    if [ "$dir" = "to" ]; then
+      CONV_POST+="\tswitch {\n"
+    else
+      CONV_POST+="\tswitch v := p.${field}.(type) {\n"
+    fi
+    for variant in "${ONEOF_VARIANTS[@]}"; do
+      v_field="$(go_field_name "${variant%%:*}")"
+      if [ "$dir" = "to" ]; then
+        v_value="*m.${v_field}"
+        [ "$(normalize_type "${variant#*:}")" = "bytes" ] && v_value="m.${v_field}"
+        CONV_POST+="\tcase m.${v_field} != nil:\n"
+        CONV_POST+="\t\tproto.${field} = &pb.${msg}_${v_field}{${v_field}: ${v_value}}\n"
+      else
+        v_value="&v.${v_field}"
+        [ "$(normalize_type "${variant#*:}")" = "bytes" ] && v_value="v.${v_field}"
+        CONV_POST+="\tcase *pb.${msg}_${v_field}:\n"
+        CONV_POST+="\t\tm.${v_field} = ${v_value}\n"
+      fi
+    done
+    CONV_POST+="\t}\n"
+    return 0
+  fi
+
+  if [ "$repeated" = "1" ]; then
+    expr="${src}.${field}"
+  elif enum="$(model_enum_name "$type_raw")"; then
+    if [ "$dir" = "to" ]; then expr="m.${field}.ToProto()"; else expr="${enum}FromProto(p.${field})"; fi
+  else
+    type_norm="$(normalize_type "$type_raw")"
+    case "$dir:$type_norm" in
+      to:google.protobuf.Timestamp) expr="timestamppb.New(m.${field})" ;;
+      from:google.protobuf.Timestamp) expr="p.Get${field}().AsTime()" ;;
+      to:google.protobuf.Duration) expr="durationpb.New(m.${field})" ;;
+      from:google.protobuf.Duration) expr="p.Get${field}().AsDuration()" ;;
+      to:google.protobuf.Struct)
+        CONV_POST+="\tif s, err := structpb.NewStruct(m.${field}); err == nil {\n"
+        CONV_POST+="\t\tproto.${field} = s\n\t}\n"
+        ;;
+      from:google.protobuf.Struct) expr="p.Get${field}().AsMap()" ;;
+      to:google.protobuf.BytesValue)
+        CONV_POST+="\tif m.${field} != nil {\n"
+        CONV_POST+="\t\tproto.${field} = wrapperspb.Bytes(m.${field})\n\t}\n"
+        ;;
+      from:google.protobuf.BytesValue) expr="p.Get${field}().GetValue()" ;;
+      to:google.protobuf.*Value)
+        wrapper="${type_norm#google.protobuf.}"
+        CONV_POST+="\tif m.${field} != nil {\n"
+        CONV_POST+="\t\tproto.${field} = wrapperspb.${wrapper%Value}(*m.${field})\n\t}\n"
+        ;;
+      from:google.protobuf.*Value)
+        CONV_POST+="\tif p.${field} != nil {\n"
+        CONV_POST+="\t\tv := p.${field}.GetValue()\n"
+        CONV_POST+="\t\tm.${field} = &v\n\t}\n"
+        ;;
+      *) expr="${src}.${field}" ;;
+    esac
+  fi
+  [ -n "$expr" ] && CONV_LINE="		${field}: ${expr},"
+  return 0
+}
+
+# Add PKG to the import block of the Go FILE if missing
+ensure_go_import() {
+  local file="$1" pkg="$2"
+  [ -z "$pkg" ] && return 0
+  grep -q "\"${pkg}\"" "$file" && return 0
+  local tmp="$file.tmp"
+  awk -v imp="	\"${pkg}\"" '
+    /^import \(/ { inimp=1 }
+    inimp && /^\)/ { print imp; inimp=0 }
+    { print }
+  ' "$file" > "$tmp" && mv "$tmp" "$file"
+}
+
+# Add standard library package PKG to the first import group of FILE, in order
+ensure_go_std_import() {
+  local file="$1" pkg="$2"
+  grep -q "^	\"${pkg}\"$" "$file" && return 0
+  local tmp="$file.tmp"
+  awk -v pkg="\"${pkg}\"" '
+    /^import \(/ { inimp=1; print; next }
+    inimp && !done && ($0 ~ /^$/ || $0 ~ /^\)/ || substr($0, 2) > pkg) { print "\t" pkg; done=1 }
+    inimp && /^\)/ { inimp=0 }
+    { print }
+  ' "$file" > "$tmp" && mv "$tmp" "$file"
+}
+
+# Drop well-known type imports that FILE no longer uses
+prune_go_imports() {
+  local file="$1" pkg
+  for pkg in timestamppb durationpb structpb wrapperspb; do
+    if grep -q "/${pkg}\"$" "$file" && ! grep -q "${pkg}\." "$file"; then
+      grep -v "/${pkg}\"$" "$file" > "$file.tmp" && mv "$file.tmp" "$file"
+    fi
+  done
+}
+
+# Oneofs are declared as name:oneof{text:string|image:bytes}. parse_oneof
+# succeeds for such a type and sets ONEOF_VARIANTS to the "name:type" variants.
+parse_oneof() {
+  [[ "$1" =~ ^[Oo]neof[[:space:]]*\{(.*)\}$ ]] || return 1
+  local raw v
+  IFS='|' read -ra raw <<< "${BASH_REMATCH[1]}"
+  ONEOF_VARIANTS=()
+  for v in "${raw[@]}"; do
+    v="$(echo "$v" | xargs)"
+    [ -z "$v" ] && continue
+    if ! [[ "$v" =~ ^[a-z][A-Za-z0-9_]*:[^:]+$ ]] || [[ "$v" =~ :[[:space:]]*([Rr]epeated|map\<) ]]; then
+      echo "Invalid oneof variant '$v'. Use name:type; variants cannot be repeated or maps" >&2
+      exit 1
+    fi
+    ONEOF_VARIANTS+=("$v")
+  done
+  if [ ${#ONEOF_VARIANTS[@]} -eq 0 ]; then
+    echo "A oneof needs at least one variant, e.g. payload:oneof{text:string|image:bytes}" >&2
+    exit 1
+  fi
+}
+
+# Split a field list on top-level commas only, so enum value lists such as
+# status:Status{DRAFT,PUBLISHED} stay in one piece. Fields are printed ';'-separated
+# for `IFS=';' read -ra`.
+split_fields() {
+  printf '%s' "$1" | awk '
+    { src = src (NR > 1 ? " " : "") $0 }
+    END {
+      depth = 0; out = ""
+      for (i = 1; i <= length(src); i++) {
+        c = substr(src, i, 1)
+        if (c == "{" || c == "<") depth++
+        if (c == "}" || c == ">") depth--
+        if (c == "," && depth == 0) c = ";"
+        out = out c
+      }
+      print out
+    }
+  '
+}
+
+# Enums are declared inline in the field type: status:Status{DRAFT,PUBLISHED}.
+# parse_enum succeeds for such a type and sets ENUM_NAME and ENUM_VALUES
+# (upper-case, comma separated, without the UNSPECIFIED zero value).
+parse_enum() {
+  [[ "$1" =~ ^([A-Za-z][A-Za-z0-9_]*)[[:space:]]*\{(.*)\}$ ]] || return 1
+  [ "$(echo "${BASH_REMATCH[1]}" | tr '[:upper:]' '[:lower:]')" = "oneof" ] && return 1
+  ENUM_NAME="$(echo "${BASH_REMATCH[1]}" | awk '{print toupper(substr($0,1,1)) substr($0,2)}')"
+  local raw="${BASH_REMATCH[2]}" v values=""
+  local vals
+  IFS=',' read -ra vals <<< "$raw"
+  for v in "${vals[@]}"; do
+    v="$(echo "$v" | xargs | tr '[:lower:]' '[:upper:]' | tr ' -' '__')"
+    [ -z "$v" ] && continue
+    if ! [[ "$v" =~ ^[A-Z][A-Z0-9_]*$ ]]; then
+      echo "Invalid value '$v' in enum ${ENUM_NAME}. Use letters, digits and underscores" >&2
+      exit 1
+    fi
+    [ "$v" = "UNSPECIFIED" ] && continue
+    case ",$values," in *",$v,"*) continue ;; esac
+    values+="${values:+,}$v"
+  done
+  if [ -z "$values" ]; then
+    echo "Enum ${ENUM_NAME} needs at least one value, e.g. ${ENUM_NAME}{ACTIVE,INACTIVE}" >&2
+    exit 1
+  fi
+  ENUM_VALUES="$values"
+}
+
+# Prefix for the values of enum NAME: OrderStatus -> ORDER_STATUS
+enum_prefix() {
+  echo "$1" | sed 's/\([a-z0-9]\)\([A-Z]\)/\1_\2/g' | tr '[:lower:]' '[:upper:]'
+}
+
+# Go identifier for an enum value: IN_PROGRESS -> InProgress
+enum_value_camel() {
+  echo "$1" | awk -F'_' '{for(i=1;i<=NF;i++){ $i=toupper(substr($i,1,1)) tolower(substr($i,2)) }}1' OFS=""
+}
+
+# Fail unless enum NAME is free to declare in PROTO. All protos share package pb
+# and all models package models, so the name must not be an enum of another
+# proto, a top-level message of any proto or a type of another model.
+check_enum_name() {
+  local proto="$1" name="$2" other service model
+  service="$(basename "$proto" .proto | awk '{print toupper(substr($0,1,1)) substr($0,2)}')"
+  model="models/$(basename "$proto" .proto).go"
+  other="$(grep -l "^enum ${name} {" proto/*.proto 2>/dev/null | grep -v "^${proto}\$" | head -1 || true)"
+  if [ -z "$other" ]; then
+    other="$(grep -l "^message ${name} {" proto/*.proto 2>/dev/null | head -1 || true)"
+  fi
+  if [ -z "$other" ]; then
+    other="$(grep -l "^type ${name} " models/*.go 2>/dev/null | grep -v "^${model}\$" | head -1 || true)"
+  fi
+  if [ -n "$other" ]; then
+    echo "${name} is already declared in ${other}; name the enum after the service, e.g. ${service}${name}" >&2
+    exit 1
+  fi
+}
+
+# Declare enum NAME in PROTO with a NAME_UNSPECIFIED = 0 zero value, placed
+# before the service block. If the enum already exists, values it lacks are
+# appended with new numbers. All protos share package pb, so an enum of the
+# same name in another proto file is an error.
+ensure_proto_enum() {
+  local proto="$1" name="$2" values="$3" prefix v
+  prefix="$(enum_prefix "$name")"
+  check_enum_name "$proto" "$name"
+  local vals
+  IFS=',' read -ra vals <<< "$values"
+  local tmp="$proto.tmp"
+  if grep -q "^enum ${name} {" "$proto"; then
+    local missing=""
+    for v in "${vals[@]}"; do
+      grep -q "^[[:space:]]*${prefix}_${v}[[:space:]]*=" "$proto" || missing+="${missing:+,}${prefix}_${v}"
+    done
+    [ -z "$missing" ] && return 0
+    awk -v name="$name" -v missing="$missing" '
+      $0 ~ "^enum " name " \\{" { ine=1 }
+      ine && match($0, /=[ \t]*[0-9]+/) { n = substr($0, RSTART+1, RLENGTH-1) + 0; if (n > max) max = n }
+      ine && $0 ~ /^}/ {
+        k = split(missing, m, ",")
+        for (i = 1; i <= k; i++) print "  " m[i] " = " (++max) ";"
+        ine=0
+      }
+      { print }
+    ' "$proto" > "$tmp" && mv "$tmp" "$proto"
+    echo "Added ${missing} to enum ${name} in ${proto}"
+    return 0
+  fi
+
+  local block="enum ${name} {\n  ${prefix}_UNSPECIFIED = 0;\n" n=1
+  for v in "${vals[@]}"; do
+    block+="  ${prefix}_${v} = ${n};\n"
+    n=$((n+1))
+  done
+  block+="}\n"
+  if grep -q '^service ' "$proto"; then
+    awk -v block="$block" '
+      !done && /^service / { printf "%s\n", block; done=1 }
+      { print }
+    ' "$proto" > "$tmp" && mv "$tmp" "$proto"
+  else
+    printf "\n%b" "$block" >> "$proto"
+  fi
+  echo "Declared enum ${name} in ${proto}"
+}
+
+# Append a string-backed Go type for enum NAME to MODEL unless it exists.
+# Values are stored by name in MongoDB and converted with ToProto/NameFromProto.
+ensure_go_enum() {
+  local model="$1" name="$2" values="$3" prefix v width=0 c
+  grep -q "^type ${name} string" "$model" && return 0
+  prefix="$(enum_prefix "$name")"
+  local vals
+  IFS=',' read -ra vals <<< "$values"
+  for v in "${vals[@]}"; do
+    c="${name}$(enum_value_camel "$v")"
+    [ ${#c} -gt $width ] && width=${#c}
+  done
+  {
+    echo ""
+    echo "// ${name} mirrors pb.${name}; values are stored by name in MongoDB."
+    echo "type ${name} string"
+    echo ""
+    echo "const ("
+    for v in "${vals[@]}"; do
+      printf '\t%-*s %s = "%s"\n' "$width" "${name}$(enum_value_camel "$v")" "$name" "$v"
+    done
+    echo ")"
+    echo ""
+    echo "// Valid reports whether v is one of the declared ${name} values."
+    echo "func (v ${name}) Valid() bool {"
+    echo "	return v.ToProto() != pb.${name}_${prefix}_UNSPECIFIED"
+    echo "}"
+    echo ""
+    echo "// ToProto converts v to the protobuf enum; unknown values become ${prefix}_UNSPECIFIED."
+    echo "func (v ${name}) ToProto() pb.${name} {"
+    echo "	switch v {"
+    for v in "${vals[@]}"; do
+      echo "	case ${name}$(enum_value_camel "$v"):"
+      echo "		return pb.${name}_${prefix}_${v}"
+    done
+    echo "	}"
+    echo "	return pb.${name}_${prefix}_UNSPECIFIED"
+    echo "}"
+    echo ""
+    echo "// ${name}FromProto converts a protobuf enum value; ${prefix}_UNSPECIFIED becomes \"\"."
+    echo "func ${name}FromProto(p pb.${name}) ${name} {"
+    echo "	switch p {"
+    for v in "${vals[@]}"; do
+      echo "	case pb.${name}_${prefix}_${v}:"
+      echo "		return ${name}$(enum_value_camel "$v")"
+    done
+    echo "	}"
+    echo "	return \"\""
+    echo "}"
+  } >> "$model"
+}
+
+# Field number lock files (proto/<service>.lock) remember every field number ever
+# assigned to a top-level message, one "Message field number state" line each.
+# Numbers of fields that disappear from the proto are kept as "reserved" and
+# emitted as `reserved` statements so they are never handed out again.
+
+# Print "Message field number" for every field of every top-level message and
+# "Message @reserved number|name" for its reserved statements.
+proto_field_table() {
+  awk '
+    { sub(/\/\/.*$/, ""); src = src $0 " " }
+    END {
+      depth = 0; cur = ""; instr = 0; skipstmt = 0
+      for (i = 1; i <= length(src); i++) {
+        c = substr(src, i, 1)
+        if (c == "\"") { instr = !instr; cur = cur c; continue }
+        if (instr) { cur = cur c; continue }
+        if (c == "{") {
+          hdr = cur; gsub(/^[ \t]+|[ \t]+$/, "", hdr); cur = ""
+          split(hdr, w, /[ \t]+/)
+          depth++; kind[depth] = w[1]; name[depth] = w[2]
+          if (w[1] != "message" && w[1] != "enum" && w[1] != "oneof" && w[1] != "service" && w[1] != "rpc") kind[depth] = "opt"
+          continue
+        }
+        if (c == "}") {
+          if (kind[depth] == "opt") skipstmt = 1
+          depth--; cur = ""
+          continue
+        }
+        if (c == ";") {
+          stmt = cur; gsub(/^[ \t]+|[ \t]+$/, "", stmt); cur = ""
+          if (skipstmt) { skipstmt = 0; continue }
+          msg = ""
+          if (depth == 1 && kind[1] == "message") msg = name[1]
+          if (depth == 2 && kind[1] == "message" && kind[2] == "oneof") msg = name[1]
+          if (msg == "" || stmt == "") continue
+          if (stmt ~ /^reserved[ \t]/) {
+            sub(/^reserved[ \t]+/, "", stmt)
+            n = split(stmt, parts, /,/)
+            for (j = 1; j <= n; j++) {
+              p = parts[j]; gsub(/^[ \t]+|[ \t]+$/, "", p); gsub(/"/, "", p)
+              if (p ~ /^[0-9]+[ \t]+to[ \t]+[0-9]+$/) {
+                split(p, rg, /[ \t]+to[ \t]+/)
+                for (k = rg[1] + 0; k <= rg[2] + 0; k++) print msg, "@reserved", k
+              } else if (p != "") {
+                print msg, "@reserved", p
+              }
+            }
+            continue
+          }
+          if (stmt ~ /^(option|extensions)[ \t]/ || stmt !~ /=/) continue
+          lhs = stmt; sub(/[ \t]*=.*$/, "", lhs)
+          num = stmt; sub(/^[^=]*=[ \t]*/, "", num); sub(/[ \t\[].*$/, "", num)
+          nf = split(lhs, w, /[ \t]+/)
+          print msg, w[nf], num
+          continue
+        }
+        cur = cur c
+      }
+    }
+  ' "$1"
+}
+
+# Lock file path for a proto file
+lock_file_for() {
+  echo "${1%.proto}.lock"
+}
+
+# Succeeds when NUM is reserved for MESSAGE in the lock file of PROTO
+lock_is_reserved() {
+  local lock; lock="$(lock_file_for "$1")"
+  [ -f "$lock" ] && awk -v m="$2" -v n="$3" '$1==m && $3==n && $4=="reserved" {found=1} END {exit !found}' "$lock"
+}
+
+# Highest field number MESSAGE has ever used, counting both the proto and its lock file
+max_field_number() {
+  local lock; lock="$(lock_file_for "$1")"
+  { proto_field_table "$1"; [ -f "$lock" ] && grep -v '^#' "$lock"; } | awk -v m="$2" '
+    $1==m && $3 ~ /^[0-9]+$/ && $3+0 > max { max = $3+0 }
+    END { print max+0 }
+  '
+}
+
+# Next free field number for MESSAGE that has never been used or reserved
+next_field_number() {
+  echo $(( $(max_field_number "$1" "$2") + 1 ))
+}
+
+# Reconcile PROTO with its lock file: record new fields, mark fields that were
+# removed from the proto as reserved (adding `reserved` statements to the
+# message), and refuse renumbered fields or reuse of a previously assigned number.
+sync_field_lock() {
+  local PROTO="$1"
+  local LOCK; LOCK="$(lock_file_for "$PROTO")"
+  local TABLE; TABLE="$(mktemp)"
+  local PLAN; PLAN="$(mktemp)"
+  proto_field_table "$PROTO" > "$TABLE"
+  [ -f "$LOCK" ] || : > "$LOCK"
+
+  if ! awk '
+    FNR==NR {
+      if ($2 == "@reserved") { reserved[$1" "$3]=1; next }
+      cur[$1" "$2]=$3; curnum[$1" "$3]=$2; msgs[$1]=1
+      next
+    }
+    /^#/ || NF < 4 { next }
+    {
+      m=$1; f=$2; n=$3; st=$4
+      locked[m" "f]=1
+      if (st == "active" && (m" "f) in cur && cur[m" "f] != n) {
+        printf "error %s.%s was renumbered from %s to %s; field numbers must never change\n", m, f, n, cur[m" "f]; bad=1
+      }
+      if ((m" "n) in curnum && curnum[m" "n] != f) {
+        printf "error %s field number %s was previously assigned to %s; refusing to reuse it for %s\n", m, n, f, curnum[m" "n]; bad=1
+      }
+      if (st == "reserved" || !((m" "f) in cur)) {
+        if (m in msgs && !((m" "n) in reserved)) printf "reserve %s %s\n", m, n
+        if (m in msgs && !((m" "f) in reserved)) printf "reserve %s \"%s\"\n", m, f
+        printf "lock %s %s %s reserved\n", m, f, n
+      } else {
+        printf "lock %s %s %s active\n", m, f, n
+      }
+    }
+    END {
+      for (k in cur) if (!(k in locked)) { split(k, a, " "); printf "lock %s %s %s active\n", a[1], a[2], cur[k] }
+      exit bad
+    }
+  ' "$TABLE" "$LOCK" > "$PLAN"; then
+    grep '^error ' "$PLAN" | sed 's/^error /Error: /' >&2
+    rm -f "$TABLE" "$PLAN"
+    return 1
+  fi
+
+  # Add reserved statements for fields that disappeared from the proto
+  if grep -q '^reserve ' "$PLAN"; then
+    local TMP_R="$PROTO.tmp"
+    awk '
+      FNR==NR { if ($1=="reserve") add[$2]=add[$2] "reserved " $3 "; "; next }
+      {
+        line=$0
+        if (match(line, /^message [A-Za-z0-9_]+/)) {
+          m=substr(line, 9, RLENGTH-8)
+          if (m in add) {
+            if (line ~ /\}[ \t]*$/) sub(/[ \t]*\}[ \t]*$/, " " add[m] "}", line)
+            else inm=m
+          }
+        } else if (inm != "" && line ~ /^\}/) {
+          n=split(add[inm], st, /; /)
+          for (i=1; i<=n; i++) if (st[i] != "") print "  " st[i] ";"
+          inm=""
+        }
+        print line
+      }
+    ' "$PLAN" "$PROTO" > "$TMP_R" && mv "$TMP_R" "$PROTO"
+    grep '^reserve ' "$PLAN" | while read -r _ m r; do
+      echo "Reserved $r in message $m of $PROTO"
+    done
+  fi
+
+  {
+    echo "# Field number lock for $(basename "$PROTO"). Managed by gen_service.sh; commit this file."
+    echo "# message field number state"
+    grep '^lock ' "$PLAN" | cut -d' ' -f2- | sort -k1,1 -k3,3n
+  } > "$LOCK"
+  rm -f "$TABLE" "$PLAN"
+}
+
+# Breaking-change guard: compare the protos in DIR (default proto/) with the
+# descriptor set saved by `make proto-baseline` and refuse changes that would
+# break existing gRPC (wire) or REST (JSON) clients. FORCE=1 applies them anyway.
+# Returns 3 when a change is refused; without a baseline nothing is checked.
+BASELINE_FILE="proto/baseline.binpb"
+check_compat() {
+  local dir="${1:-proto}"
+  [ -f "$BASELINE_FILE" ] || return 0
+  local bin rc=0
+  bin="$(mktemp -d)/protocheck"
+  go build -o "$bin" ./cmd/protocheck || return 1
+  "$bin" -proto "$dir" -baseline "$BASELINE_FILE" >&2 || rc=$?
+  rm -rf "$(dirname "$bin")"
+  case $rc in
+    0) return 0 ;;
+    1)
+      if [ "$FORCE" = "1" ]; then
+        echo "Warning: applying breaking changes because FORCE=1" >&2
+        return 0
+      fi
+      echo "Refusing breaking change. Re-run with FORCE=1 to apply it anyway." >&2
+      return 3
+      ;;
+    *)
+      echo "Error: compatibility check failed" >&2
+      return 1
+      ;;
+  esac
+}
+
+# Run check_compat against the protos as they would be without FILE
+check_compat_without() {
+  local stage rc=0
+  stage="$(mktemp -d)"
+  cp proto/*.proto "$stage"/ 2>/dev/null || true
+  rm -f "$stage/$(basename "$1")"
+  check_compat "$stage" || rc=$?
+  rm -rf "$stage"
+  return $rc
+}
+
+# Run the breaking-change guard on an edited PROTO; when the change is refused
+# (or the check fails) restore the copy saved in BACKUP, and the lock file from
+# LOCK_BACKUP when given, and return its status.
+guard_proto_edit() {
+  local proto="$1" backup="$2" lock_backup="$3" rc=0
+  check_compat || rc=$?
+  if [ $rc -ne 0 ]; then
+    mv "$backup" "$proto"
+    [ -n "$lock_backup" ] && mv "$lock_backup" "$(lock_file_for "$proto")"
+    return $rc
+  fi
+  rm -f "$backup" ${lock_backup:+"$lock_backup"}
+}
+
+# Print "TYPE ONEOF" for FIELD of top-level message MSG ("-" when FIELD is not
+# in a oneof); prints nothing when the message has no such field.
+proto_field_info() {
+  awk -v msg="$2" -v field="$3" '
+    function check(stmt,    t) {
+      if (stmt !~ "[ \t]" field "[ \t]*=[ \t]*[0-9]+" || stmt ~ /^[ \t]*(reserved|option)[ \t]/) return
+      t=stmt; sub("[ \t]+" field "[ \t]*=.*$", "", t); sub(/^[ \t]+/, "", t)
+      print t, (oneof != "" ? oneof : "-")
+      exit
+    }
+    $0 ~ "^message " msg " \\{.*\\}[ \t]*$" {
+      body=$0; sub(/^[^{]*\{/, "", body); sub(/\}[ \t]*$/, "", body)
+      n=split(body, stmts, /;/)
+      for (i=1; i<=n; i++) check(stmts[i])
+      exit
+    }
+    $0 ~ "^message " msg " \\{" { inm=1; next }
+    inm && /^\}/ { exit }
+    inm && /^[ \t]*oneof [A-Za-z0-9_]+[ \t]*\{/ {
+      oneof=$0; sub(/^[ \t]*oneof[ \t]+/, "", oneof); sub(/[ \t]*\{.*$/, "", oneof)
+      next
+    }
+    inm && oneof != "" && /^[ \t]*\}[ \t]*$/ { oneof=""; next }
+    inm { check($0) }
+  ' "$1"
+}
+
+# Succeeds when NAME is a oneof of top-level message MSG in PROTO
+proto_has_oneof() {
+  awk -v msg="$2" -v name="$3" '
+    $0 ~ "^message " msg " \\{" { inm=1; next }
+    inm && /^\}/ { exit }
+    inm && $0 ~ "^[ \t]*oneof " name "[ \t]*\\{" { found=1; exit }
+    END { exit !found }
+  ' "$1"
+}
+
+# Rewrite the declaration of FIELD in top-level message MSG of PROTO with
+# NEW_TYPE, keeping its number and options, or remove it when NEW_TYPE is empty.
+# Oneof blocks left without fields are removed as well.
+proto_set_field() {
+  local proto="$1" tmp="$1.tmp"
+  awk -v msg="$2" -v field="$3" -v newtype="$4" '
+    function rewrite(stmt,    lead, rest) {
+      if (newtype == "") return ""
+      match(stmt, /^[ \t]*/); lead=substr(stmt, 1, RLENGTH)
+      match(stmt, "[ \t]" field "[ \t]*="); rest=substr(stmt, RSTART+1)
+      return lead newtype " " rest
+    }
+    function is_field(stmt) { return stmt ~ "[ \t]" field "[ \t]*=[ \t]*[0-9]+" && stmt !~ /^[ \t]*(reserved|option)[ \t]/ }
+    $0 ~ "^message " msg " \\{.*\\}[ \t]*$" {
+      # Single-line message: message M { string a = 1; string b = 2; }
+      head=$0; sub(/\{.*$/, "{", head)
+      body=$0; sub(/^[^{]*\{/, "", body); sub(/\}[ \t]*$/, "", body)
+      n=split(body, stmts, /;/); out=""
+      for (i=1; i<=n; i++) {
+        s=stmts[i]; if (s ~ /^[ \t]*$/) continue
+        if (is_field(s)) { s=rewrite(s); if (s == "") continue }
+        out=out s ";"
+      }
+      print head out (out == "" ? "}" : " }")
+      next
+    }
+    $0 ~ "^message " msg " \\{" { inm=1; print; next }
+    inm && /^\}/ { inm=0; if (oneof != "") { printf "%s", oneof; oneof="" } print; next }
+    inm && /^[ \t]*oneof [A-Za-z0-9_]+[ \t]*\{[ \t]*$/ { oneof=$0 "\n"; kept=0; next }
+    inm && oneof != "" && /^[ \t]*\}[ \t]*$/ { if (kept) printf "%s%s\n", oneof, $0; oneof=""; next }
+    inm && is_field($0) { line=rewrite($0); if (line == "") next; $0=line }
+    inm && oneof != "" { oneof=oneof $0 "\n"; kept=1; next }
+    { print }
+  ' "$proto" > "$tmp" && mv "$tmp" "$proto"
+}
+
+# Remove the oneof NAME and all of its fields from top-level message MSG of PROTO
+proto_remove_oneof() {
+  local proto="$1" tmp="$1.tmp"
+  awk -v msg="$2" -v name="$3" '
+    $0 ~ "^message " msg " \\{" { inm=1 }
+    inm && /^\}/ { inm=0 }
+    inm && $0 ~ "^[ \t]*oneof " name "[ \t]*\\{" { skip=1; next }
+    skip { if ($0 ~ /^[ \t]*\}[ \t]*$/) skip=0; next }
+    { print }
+  ' "$proto" > "$tmp" && mv "$tmp" "$proto"
+}
+
+# Remove top-level message MSG from PROTO
+proto_remove_message() {
+  local proto="$1" tmp="$1.tmp"
+  awk -v msg="$2" '
+    $0 ~ "^message " msg " \\{.*\\}[ \t]*$" { next }
+    $0 ~ "^message " msg " \\{" { skip=1; next }
+    skip { if ($0 ~ /^\}/) skip=0; next }
+    { print }
+  ' "$proto" > "$tmp" && mv "$tmp" "$proto"
+}
+
+# Print the declaration line of RPC in service SVC: "  rpc X(A) returns (B) {"
+proto_rpc_line() {
+  awk -v svc="$2" -v rpc="$3" '
+    $0 ~ "^service " svc " \\{" { ins=1; next }
+    ins && /^\}/ { exit }
+    ins && $0 ~ "^[ \t]*rpc " rpc "[ \t]*\\(" { print; exit }
+  ' "$1"
+}
+
+# Replace the body of RPC in service SVC with OPTION (an `option ...;` statement,
+# or empty for none). The google.api.http option is dropped; other options stay.
+# With REMOVE=1 the whole RPC is deleted instead.
+proto_rewrite_rpc() {
+  local proto="$1" tmp="$1.tmp"
+  awk -v svc="$2" -v rpc="$3" -v opt="$4" -v remove="${5:-0}" '
+    function emit(    i) {
+      if (remove) return
+      if (opt == "" && nkeep == 0) { print header ";"; return }
+      print header " {"
+      if (opt != "") print "    " opt
+      for (i=1; i<=nkeep; i++) print keep[i]
+      print indent "}"
+    }
+    $0 ~ "^service " svc " \\{" { ins=1; print; next }
+    ins && /^\}/ { ins=0 }
+    ins && !inrpc && $0 ~ "^[ \t]*rpc " rpc "[ \t]*\\(" {
+      header=$0; match(header, /^[ \t]*/); indent=substr(header, 1, RLENGTH)
+      sub(/[ \t]*(\{|;)[ \t]*$/, "", header)
+      nkeep=0
+      if ($0 ~ /;[ \t]*$/) { emit(); next }
+      inrpc=1; depth=1; inhttp=0
+      next
+    }
+    inrpc {
+      line=$0
+      depth += gsub(/\{/, "{", line) - gsub(/\}/, "}", line)
+      if (depth <= 0) { inrpc=0; emit(); next }
+      if (line ~ /option[ \t]*\(google\.api\.http\)/) inhttp=1
+      if (inhttp) { if (line ~ /;[ \t]*$/ && depth == 1) inhttp=0; next }
+      if (line !~ /^[ \t]*$/) keep[++nkeep]=$0
+      next
+    }
+    { print }
+  ' "$proto" > "$tmp" && mv "$tmp" "$proto"
+}
+
+# Build the google.api.http option for METHOD (lower-case), PATH and optional BODY
+http_option() {
+  local opt="option (google.api.http) = { $1: \"$2\""
+  [ -n "$3" ] && opt+=" body: \"$3\""
+  echo "$opt };"
+}
+
+# Print the stream mode (unary, server, client or bidi) of an RPC declaration line
+rpc_stream_mode() {
+  if [[ "$1" =~ \((stream[[:space:]]+)?[A-Za-z0-9_.]+\)[[:space:]]*returns[[:space:]]*\((stream[[:space:]]+)?[A-Za-z0-9_.]+\) ]]; then
+    case "${BASH_REMATCH[1]:+c}${BASH_REMATCH[2]:+s}" in
+      cs) echo bidi ;;
+      c) echo client ;;
+      s) echo server ;;
+      *) echo unary ;;
+    esac
+  fi
+}
+
+# Check that an HTTP binding (lower-case METHOD, optional BODY) suits an RPC of
+# stream MODE: unary, server, client or bidi. The gateway serves server and bidi
+# streams over a WebSocket, which is opened with a GET, and a client stream
+# cannot be bound at all.
+check_stream_binding() {
+  local mode="$1" method="$2" body="$3"
+  if [ -z "$method" ] || [ "$mode" = "unary" ]; then
+    return 0
+  fi
+  if [ "$mode" = "client" ]; then
+    echo "A client-streaming RPC cannot have an HTTP binding; use 'none'" >&2
+    return 1
+  fi
+  if [ "$method" != "get" ] || [ -n "$body" ]; then
+    echo "A ${mode}-streaming RPC is served over a WebSocket, so it can only be bound to GET without a body" >&2
+    return 1
+  fi
+}
+
+# Prefix of the gateway test table entry generated for a route:
+# {http.MethodGet, "/v1/books/test-id"
+gateway_test_entry() {
+  local method
+  method="$(echo "$1" | awk '{print toupper(substr($0,1,1)) tolower(substr($0,2))}')"
+  echo "{http.Method${method}, \"$(echo "$2" | sed -E 's/\{[^}]*\}/test-id/g')\""
+}
+
+# Print "METHOD PATH" for each HTTP binding of RPC in service SVC of PROTO
+proto_rpc_bindings() {
+  awk -v svc="$2" -v rpc="$3" '
+    $0 ~ "^service " svc " \\{" { ins=1; next }
+    ins && /^\}/ { exit }
+    ins && $0 ~ "^[ \t]*rpc " rpc "[ \t]*\\(" { inrpc=1 }
+    inrpc {
+      src=$0
+      while (match(src, /(get|put|post|delete|patch)[ \t]*:[ \t]*"[^"]*"/)) {
+        b=substr(src, RSTART, RLENGTH); src=substr(src, RSTART+RLENGTH)
+        m=b; sub(/[ \t]*:.*$/, "", m)
+        p=b; sub(/^[^"]*"/, "", p); sub(/"$/, "", p)
+        print m, p
+      }
+      if ($0 ~ /;[ \t]*$/ && $0 ~ "rpc " rpc) exit
+      if ($0 ~ /^[ \t]*\}[ \t]*$/) exit
+    }
+  ' "$1"
+}
+
+# Update the model for FIELD of message STRUCT. STRUCT_LINES replaces the struct
+# field(s); for the entity (ENTITY=1) TO_LINE/TO_POST and FROM_LINE/FROM_POST
+# replace its ToProto and FromProto conversions. Empty values remove them.
+# VARIANT_BYTES is set (0/1) when FIELD is a oneof variant whose case lines stay.
+model_set_field() {
+  local model="$1" tmp="$1.tmp"
+  awk -v st="$2" -v f="$3" -v entity="$4" -v structlines="$5" \
+      -v toline="$6" -v topost="$7" -v fromline="$8" -v frompost="$9" -v vbytes="${10}" '
+    $0 ~ "^type " st " struct \\{" { ins=1; print; next }
+    ins && /^\}/ { ins=0 }
+    ins && $0 ~ "^\t" f " " { if (structlines != "") print structlines; next }
+    !entity { print; next }
+
+    $0 ~ "^func \\(m \\*" st "\\) ToProto\\(" { fn="to"; lit=0 }
+    $0 ~ "^func " st "FromProto\\(" { fn="from"; lit=0 }
+    fn != "" && /^\t(proto|m) := &/ { lit=1; placed=0; print; next }
+    lit && $0 ~ "^\t\t" f ": " {
+      line=(fn == "to" ? toline : fromline)
+      if (line != "") print line
+      placed=1; next
+    }
+    lit && /^\t}$/ {
+      line=(fn == "to" ? toline : fromline)
+      if (!placed && line != "") print line
+      lit=0; print; next
+    }
+    fn != "" && $0 ~ "^\tif .*[mp]\\." f "[^A-Za-z0-9_].*\\{$" { skip=1; next }
+    skip { if ($0 ~ /^\t}$/) skip=0; next }
+    fn == "to" && /^\treturn proto$/ { printf "%s", topost; fn=""; print; next }
+    fn == "from" && /^\treturn m$/ { printf "%s", frompost; fn=""; print; next }
+
+    # oneof variants: keep or drop the case and its assignment
+    $0 ~ "^\tcase m\\." f " != nil:$" || $0 ~ "^\tcase \\*pb\\.[A-Za-z0-9_]+_" f ":$" {
+      if (vbytes == "") { getline; next }
+      print; getline
+      if (fn == "to") sub("\\{" f ": \\*?m\\.", "{" f ": " (vbytes ? "" : "*") "m.")
+      else sub("= &?v\\.", "= " (vbytes ? "" : "\\&") "v.")
+      print; next
+    }
+    { print }
+  ' "$model" > "$tmp" && mv "$tmp" "$model"
+
+  # Drop switch statements left without cases
+  awk '
+    /^\tswitch .*\{$/ { held=$0; next }
+    held != "" { if ($0 ~ /^\t}$/) { held=""; next } print held; held="" }
+    { print }
+  ' "$model" > "$tmp" && mv "$tmp" "$model"
+}
+
 if [ "$1" = "remove" ]; then
   if [ -z "$2" ]; then
     echo "Usage: $0 remove ServiceName"
@@ -134,12 +1122,20 @@ if [ "$1" = "remove" ]; then
 
   # Remove proto file
   if [ -f "$PROTO_FILE" ]; then
+    check_compat_without "$PROTO_FILE" || exit $?
     rm "$PROTO_FILE"
     echo "Removed proto file: $PROTO_FILE"
   else
     echo "Proto file not found: $PROTO_FILE"
   fi
 
+  # Remove field number lock
+  LOCK_FILE="$(lock_file_for "$PROTO_FILE")"
+  if [ -f "$LOCK_FILE" ]; then
+    rm "$LOCK_FILE"
+    echo "Removed field lock: $LOCK_FILE"
+  fi
+
   # Remove Go service file
   if [ -f "$GO_FILE" ]; then
     rm "$GO_FILE"
@@ -148,6 +1144,13 @@ if [ "$1" = "remove" ]; then
     echo "Go service file not found: $GO_FILE"
   fi
 
+  # Remove generated service tests
+  TEST_FILE="services/${SERVICE_NAME_LC}_test.go"
+  if [ -f "$TEST_FILE" ]; then
+    rm "$TEST_FILE"
+    echo "Removed Go service tests: $TEST_FILE"
+  fi
+
   # Remove model file
   MODEL_FILE="models/${SERVICE_NAME_LC}.go"
   if [ -f "$MODEL_FILE" ]; then
@@ -179,11 +1182,184 @@ if [ "$1" = "remove" ]; then
   exit 0
 fi
 
+# Sync field number lock files with the current protos
+if [ "$1" = "lock" ]; then
+  if [ -n "$2" ]; then
+    PROTO_FILES=("proto/$(echo "$2" | tr '[:upper:]' '[:lower:]').proto")
+  else
+    PROTO_FILES=(proto/*.proto)
+  fi
+  for PROTO_FILE in "${PROTO_FILES[@]}"; do
+    if [ ! -f "$PROTO_FILE" ]; then
+      echo "Proto file not found: $PROTO_FILE" >&2
+      exit 1
+    fi
+    sync_field_lock "$PROTO_FILE"
+    echo "Synced field lock: $(lock_file_for "$PROTO_FILE")"
+  done
+  exit 0
+fi
+
+# Generate a MongoDB migration under migrations/ (applied with `make migrate`)
+if [ "$1" = "add-migration" ]; then
+  # Args: add-migration backfill ServiceName field [value]
+  #       add-migration rename ServiceName old_field new_field
+  KIND="$2"
+  if [ -z "$KIND" ] || [ -z "$3" ] || [ -z "$4" ] || { [ "$KIND" = "rename" ] && [ -z "$5" ]; }; then
+    echo "Usage: $0 add-migration backfill ServiceName field [value]" >&2
+    echo "       $0 add-migration rename ServiceName old_field new_field" >&2
+    exit 1
+  fi
+
+  SERVICE_NAME_RAW="$3"
+  SERVICE_NAME="$(echo "$SERVICE_NAME_RAW" | awk '{print toupper(substr($0,1,1)) tolower(substr($0,2))}')"
+  SERVICE_NAME_LC="$(echo "$SERVICE_NAME_RAW" | tr '[:upper:]' '[:lower:]')"
+  COLLECTION="$(pluralize "$SERVICE_NAME" | tr '[:upper:]' '[:lower:]')"
+  PROTO_FILE="proto/${SERVICE_NAME_LC}.proto"
+  MODEL_FILE="models/${SERVICE_NAME_LC}.go"
+
+  if [ ! -f "$PROTO_FILE" ]; then
+    echo "Proto file not found: $PROTO_FILE" >&2
+    exit 1
+  fi
+  sync_field_lock "$PROTO_FILE"
+
+  # Type of a field in the entity message, e.g. "repeated string"
+  entity_field_type() {
+    awk -v entity="$SERVICE_NAME" -v field="$1" '
+      $0 ~ "^message " entity " " { inm=1; next }
+      inm==1 && $0 ~ /^}/ { exit }
+      inm==1 && $0 ~ "[ \t]" field "[ \t]*=" {
+        line=$0; sub(/^[ \t]+/, "", line); sub("[ \t]+" field "[ \t]*=.*$", "", line)
+        print line; exit
+      }
+    ' "$PROTO_FILE"
+  }
+
+  MIGRATION_TS="$(date -u +%Y%m%d%H%M%S)"
+  IMPORTS=""
+  case "$KIND" in
+    backfill)
+      FIELD="$4"
+      VALUE="$5"
+      FIELD_TYPE="$(entity_field_type "$FIELD")"
+      if [ -z "$FIELD_TYPE" ]; then
+        echo "Field ${FIELD} not found in message ${SERVICE_NAME} of ${PROTO_FILE}" >&2
+        exit 1
+      fi
+      case "$FIELD_TYPE" in
+        repeated\ *) GO_VALUE="bson.A{}"; IMPORTS="go.mongodb.org/mongo-driver/bson" ;;
+        string) GO_VALUE="\"$(printf '%s' "$VALUE" | sed 's/\\/\\\\/g; s/"/\\"/g')\"" ;;
+        bool) GO_VALUE="${VALUE:-false}" ;;
+        int32|sint32|sfixed32) GO_VALUE="int32(${VALUE:-0})" ;;
+        int64|sint64|sfixed64) GO_VALUE="int64(${VALUE:-0})" ;;
+        uint32|fixed32) GO_VALUE="uint32(${VALUE:-0})" ;;
+        uint64|fixed64) GO_VALUE="uint64(${VALUE:-0})" ;;
+        float) GO_VALUE="float32(${VALUE:-0})" ;;
+        double) GO_VALUE="float64(${VALUE:-0})" ;;
+        google.protobuf.Timestamp)
+          IMPORTS="time"
+          if [ "$VALUE" = "now" ]; then GO_VALUE="time.Now().UTC()"; else GO_VALUE="time.Time{}"; fi
+          ;;
+        *) GO_VALUE="nil" ;;
+      esac
+      MIGRATION_ID="${MIGRATION_TS}_backfill_${COLLECTION}_${FIELD}"
+      DESCRIPTION="Backfill ${FIELD} on ${COLLECTION}"
+      UP="Backfill(\"${COLLECTION}\", \"${FIELD}\", ${GO_VALUE})"
+      DOWN="nil"
+      ;;
+    rename)
+      FROM="$4"
+      TO="$5"
+      if [ -z "$(entity_field_type "$FROM")" ]; then
+        echo "Field ${FROM} not found in message ${SERVICE_NAME} of ${PROTO_FILE}" >&2
+        exit 1
+      fi
+      if [ -n "$(entity_field_type "$TO")" ]; then
+        echo "Field ${TO} already exists in message ${SERVICE_NAME} of ${PROTO_FILE}" >&2
+        exit 1
+      fi
+      # Rename in proto (same field number, so the wire format is unchanged) and in the lock.
+      # The JSON name does change, so the rename must pass the breaking-change guard.
+      TMP_P="$PROTO_FILE.tmp"
+      PREV_P="$(mktemp)"
+      cp "$PROTO_FILE" "$PREV_P"
+      awk -v entity="$SERVICE_NAME" -v from="$FROM" -v to="$TO" '
+        $0 ~ "^message " entity " " { inm=1 }
+        inm==1 && $0 ~ /^}/ { inm=0 }
+        inm==1 { sub("[ \t]" from "[ \t]*=", " " to " =") }
+        { print }
+      ' "$PROTO_FILE" > "$TMP_P" && mv "$TMP_P" "$PROTO_FILE"
+      RC=0
+      check_compat || RC=$?
+      if [ $RC -ne 0 ]; then
+        mv "$PREV_P" "$PROTO_FILE"
+        exit $RC
+      fi
+      rm -f "$PREV_P"
+      LOCK_FILE="$(lock_file_for "$PROTO_FILE")"
+      TMP_L="$LOCK_FILE.tmp"
+      awk -v entity="$SERVICE_NAME" -v from="$FROM" -v to="$TO" '
+        $1==entity && $2==from && $4=="active" { $2=to }
+        { print }
+      ' "$LOCK_FILE" > "$TMP_L" && mv "$TMP_L" "$LOCK_FILE"
+      sync_field_lock "$PROTO_FILE"
+      echo "Renamed ${SERVICE_NAME}.${FROM} to ${TO} in ${PROTO_FILE}"
+
+      # Rename the model field and its json/bson tags
+      if [ -f "$MODEL_FILE" ]; then
+        FROM_CAMEL="$(echo "$FROM" | awk -F'_' '{for(i=1;i<=NF;i++){ $i=toupper(substr($i,1,1)) substr($i,2) }}1' OFS="")"
+        TO_CAMEL="$(echo "$TO" | awk -F'_' '{for(i=1;i<=NF;i++){ $i=toupper(substr($i,1,1)) substr($i,2) }}1' OFS="")"
+        sed -i '' -e "s/\\([^A-Za-z0-9_]\\)${FROM_CAMEL}\\([^A-Za-z0-9_]\\)/\\1${TO_CAMEL}\\2/g" \
+          -e "s/\\([^A-Za-z0-9_]\\)${FROM_CAMEL}\\([^A-Za-z0-9_]\\)/\\1${TO_CAMEL}\\2/g" \
+          -e "s/Get${FROM_CAMEL}(/Get${TO_CAMEL}(/g" \
+          -e "s/json:\"${FROM}\"/json:\"${TO}\"/g" \
+          -e "s/bson:\"${FROM}\"/bson:\"${TO}\"/g" "$MODEL_FILE"
+        echo "Renamed ${FROM_CAMEL} to ${TO_CAMEL} in ${MODEL_FILE}"
+      fi
+
+      MIGRATION_ID="${MIGRATION_TS}_rename_${COLLECTION}_${FROM}_to_${TO}"
+      DESCRIPTION="Rename ${FROM} to ${TO} on ${COLLECTION}"
+      UP="Rename(\"${COLLECTION}\", \"${FROM}\", \"${TO}\")"
+      DOWN="Rename(\"${COLLECTION}\", \"${TO}\", \"${FROM}\")"
+      ;;
+    *)
+      echo "Unknown migration kind '$KIND'. Expected 'backfill' or 'rename'" >&2
+      exit 1
+      ;;
+  esac
+
+  mkdir -p migrations
+  MIGRATION_FILE="migrations/${MIGRATION_ID}.go"
+  {
+    echo "package migrations"
+    echo ""
+    if [ -n "$IMPORTS" ]; then
+      echo "import \"${IMPORTS}\""
+      echo ""
+    fi
+    echo "func init() {"
+    echo "	Register(Migration{"
+    echo "		ID:          \"${MIGRATION_ID}\","
+    echo "		Description: \"${DESCRIPTION}\","
+    echo "		Up:          ${UP},"
+    [ "$DOWN" != "nil" ] && echo "		Down:        ${DOWN},"
+    echo "	})"
+    echo "}"
+  } > "$MIGRATION_FILE"
+  echo "Created migration: $MIGRATION_FILE"
+  echo "Apply it with: make migrate"
+  exit 0
+fi
+
 # Add a new RPC to an existing service and proto
 if [ "$1" = "add-rpc" ]; then
-  # Args: add-rpc ServiceName RpcName "req_fields" "res_fields" "http=METHOD:/path" ["body=*"]
-  if [ -z "$2" ] || [ -z "$3" ] || [ -z "$4" ] || [ -z "$5" ] || [ -z "$6" ]; then
-    echo "Usage: $0 add-rpc ServiceName RpcName \"req_field1:type,...\" \"res_field1:type,...\" \"http=METHOD:/path\" [\"body=*\"]" >&2
+  # Args: add-rpc ServiceName RpcName "req_fields" "res_fields" ["http=METHOD:/path"|none] ["body=*"] [stream=MODE]
+  # A unary RPC needs an HTTP spec. A server or bidi stream may be bound to GET,
+  # where the gateway serves it over a WebSocket; a client stream has no binding.
+  ADD_RPC_USAGE="Usage: $0 add-rpc ServiceName RpcName \"req_field1:type,...\" \"res_field1:type,...\" [\"http=METHOD:/path\"|none] [\"body=*\"] [stream=server|client|bidi]"
+  if [ -z "$2" ] || [ -z "$3" ] || [ -z "$4" ] || [ -z "$5" ]; then
+    echo "$ADD_RPC_USAGE" >&2
     exit 1
   fi
 
@@ -191,8 +1367,26 @@ if [ "$1" = "add-rpc" ]; then
   RPC_NAME_RAW="$3"
   REQ_FIELDS_RAW="$4"
   RES_FIELDS_RAW="$5"
-  HTTP_SPEC_RAW="$6"
-  BODY_SPEC_RAW="$7"
+  HTTP_SPEC_RAW=""
+  BODY_SPEC_RAW=""
+  STREAM_MODE="unary"
+  for OPT in "${@:6}"; do
+    case "$OPT" in
+      http=*|none) HTTP_SPEC_RAW="$OPT" ;;
+      body=*) BODY_SPEC_RAW="$OPT" ;;
+      stream=*) STREAM_MODE="${OPT#stream=}" ;;
+      *) echo "Unknown option '$OPT'" >&2; echo "$ADD_RPC_USAGE" >&2; exit 1 ;;
+    esac
+  done
+  case "$STREAM_MODE" in
+    unary|server|client|bidi) ;;
+    *) echo "Invalid stream mode '${STREAM_MODE}'. Expected server, client or bidi" >&2; exit 1 ;;
+  esac
+  if [ "$STREAM_MODE" = "unary" ] && [ -z "$HTTP_SPEC_RAW" ]; then
+    echo "$ADD_RPC_USAGE" >&2
+    exit 1
+  fi
+  [ "$HTTP_SPEC_RAW" = "none" ] && HTTP_SPEC_RAW=""
 
   SERVICE_NAME="$(echo "$SERVICE_NAME_RAW" | awk '{print toupper(substr($0,1,1)) tolower(substr($0,2))}')"
   SERVICE_NAME_LC="$(echo "$SERVICE_NAME_RAW" | tr '[:upper:]' '[:lower:]')"
@@ -205,12 +1399,16 @@ if [ "$1" = "add-rpc" ]; then
   fi
 
   # Extract METHOD and PATH from http=METHOD:/path
-  if [[ "$HTTP_SPEC_RAW" =~ ^http=([A-Za-z]+):(.*)$ ]]; then
-    HTTP_METHOD="$(echo "${BASH_REMATCH[1]}" | tr '[:upper:]' '[:lower:]')"
-    HTTP_PATH="${BASH_REMATCH[2]}"
-  else
-    echo "Invalid HTTP spec. Expected 'http=METHOD:/path'" >&2
-    exit 1
+  HTTP_METHOD=""
+  HTTP_PATH=""
+  if [ -n "$HTTP_SPEC_RAW" ]; then
+    if [[ "$HTTP_SPEC_RAW" =~ ^http=([A-Za-z]+):(.*)$ ]]; then
+      HTTP_METHOD="$(echo "${BASH_REMATCH[1]}" | tr '[:upper:]' '[:lower:]')"
+      HTTP_PATH="${BASH_REMATCH[2]}"
+    else
+      echo "Invalid HTTP spec. Expected 'http=METHOD:/path'" >&2
+      exit 1
+    fi
   fi
 
   HTTP_BODY=""
@@ -222,14 +1420,18 @@ if [ "$1" = "add-rpc" ]; then
       exit 1
     fi
   fi
+  check_stream_binding "$STREAM_MODE" "$HTTP_METHOD" "$HTTP_BODY" || exit 1
+
+  # Pick up fields removed by hand before allocating new numbers
+  sync_field_lock "$PROTO_FILE"
 
   # Helpers re-used: normalize_type and snake_to_camel exist below; re-implement small builder here for fields
   build_fields_block() {
     local FIELDS_RAW_STR="$1"
-    local TIMESTAMP_FLAG_VAR="$2"
+    local MSG_NAME="$2"
     local LINES=""
     local NUM=1
-    IFS=',' read -ra FIELDS_ARR <<< "$FIELDS_RAW_STR"
+    IFS=';' read -ra FIELDS_ARR <<< "$(split_fields "$FIELDS_RAW_STR")"
     for FIELD in "${FIELDS_ARR[@]}"; do
       local RAW_TRIMMED="$(echo "$FIELD" | xargs)"
       [ -z "$RAW_TRIMMED" ] && continue
@@ -253,11 +1455,27 @@ if [ "$1" = "add-rpc" ]; then
           exit 1
         fi
       fi
+      if parse_enum "$TYPE_RAW"; then
+        ensure_proto_enum "$PROTO_FILE" "$ENUM_NAME" "$ENUM_VALUES" >&2
+        TYPE_RAW="$ENUM_NAME"
+      fi
+      if parse_oneof "$TYPE_RAW"; then
+        LINES+="  oneof ${NAME} {\n"
+        local VARIANT V_TYPE
+        for VARIANT in "${ONEOF_VARIANTS[@]}"; do
+          V_TYPE="$(normalize_type "${VARIANT#*:}")"
+          ensure_proto_import "$PROTO_FILE" "$(proto_import_for "$V_TYPE")"
+          while lock_is_reserved "$PROTO_FILE" "$MSG_NAME" "$NUM"; do NUM=$((NUM+1)); done
+          LINES+="    ${V_TYPE} ${VARIANT%%:*} = ${NUM};\n"
+          NUM=$((NUM+1))
+        done
+        LINES+="  }\n"
+        continue
+      fi
       local TYPE_NORM
       TYPE_NORM="$(normalize_type "$TYPE_RAW")"
-      if [ "$TYPE_NORM" = "google.protobuf.Timestamp" ]; then
-        eval "$TIMESTAMP_FLAG_VAR=1"
-      fi
+      ensure_proto_import "$PROTO_FILE" "$(proto_import_for "$TYPE_NORM")"
+      while lock_is_reserved "$PROTO_FILE" "$MSG_NAME" "$NUM"; do NUM=$((NUM+1)); done
       if [ $IS_REPEATED -eq 1 ]; then
         LINES+="  repeated ${TYPE_NORM} ${NAME} = ${NUM};\n"
       else
@@ -272,25 +1490,9 @@ if [ "$1" = "add-rpc" ]; then
   REQ_MSG_NAME="${RPC_NAME}Request"
   RES_MSG_NAME="${RPC_NAME}Response"
 
-  TS_USED=0
-  REQ_FIELDS_BLOCK="$(build_fields_block "$REQ_FIELDS_RAW" TS_USED)"
-  RES_FIELDS_BLOCK="$(build_fields_block "$RES_FIELDS_RAW" TS_USED)"
-
-  # Ensure timestamp import exists if needed
-  if [ "$TS_USED" -eq 1 ] && ! grep -q 'google/protobuf/timestamp.proto' "$PROTO_FILE"; then
-    # Insert after annotations import
-    if grep -q 'import "google/api/annotations.proto";' "$PROTO_FILE"; then
-      sed -i '' '/import "google\/api\/annotations.proto";/a\
-import "google/protobuf/timestamp.proto";
-' "$PROTO_FILE"
-    else
-      # Fallback: add near top
-      sed -i '' '1,/^package pb;/!b; /^package pb;/a\
-\
-import "google/protobuf/timestamp.proto";
-' "$PROTO_FILE"
-    fi
-  fi
+  # Builders add enum declarations and well-known type imports to the proto as they go
+  REQ_FIELDS_BLOCK="$(build_fields_block "$REQ_FIELDS_RAW" "$REQ_MSG_NAME")"
+  RES_FIELDS_BLOCK="$(build_fields_block "$RES_FIELDS_RAW" "$RES_MSG_NAME")"
 
   # Append messages to the end of proto (before service insertion to keep things simple)
   {
@@ -304,22 +1506,32 @@ import "google/protobuf/timestamp.proto";
   } >> "$PROTO_FILE"
 
   # Build HTTP annotation
-  HTTP_OPTION="option (google.api.http) = { ${HTTP_METHOD}: \"${HTTP_PATH}\"";
-  if [ -n "$HTTP_BODY" ]; then
-    HTTP_OPTION+=" body: \"${HTTP_BODY}\"";
+  HTTP_OPTION=""
+  if [ -n "$HTTP_METHOD" ]; then
+    HTTP_OPTION="$(http_option "$HTTP_METHOD" "$HTTP_PATH" "$HTTP_BODY")"
   fi
-  HTTP_OPTION+=" };"
+  REQ_TYPE="$REQ_MSG_NAME"
+  RES_TYPE="$RES_MSG_NAME"
+  case "$STREAM_MODE" in
+    client) REQ_TYPE="stream ${REQ_MSG_NAME}" ;;
+    server) RES_TYPE="stream ${RES_MSG_NAME}" ;;
+    bidi) REQ_TYPE="stream ${REQ_MSG_NAME}"; RES_TYPE="stream ${RES_MSG_NAME}" ;;
+  esac
 
   # Insert RPC into service block using awk
   TMP_PROTO="${PROTO_FILE}.tmp"
-  awk -v svc="${SERVICE_NAME}Service" -v rpc="${RPC_NAME}" -v req="${REQ_MSG_NAME}" -v res="${RES_MSG_NAME}" -v httpopt="${HTTP_OPTION}" '
+  awk -v svc="${SERVICE_NAME}Service" -v rpc="${RPC_NAME}" -v req="${REQ_TYPE}" -v res="${RES_TYPE}" -v httpopt="${HTTP_OPTION}" '
     BEGIN { in_svc=0 }
     {
       if ($0 ~ "^service "svc" \\{") { in_svc=1; print; next }
       if (in_svc==1 && $0 ~ /^\}$/) {
-        print "  rpc "rpc"("req") returns ("res") {";
-        print "    "httpopt;
-        print "  }";
+        if (httpopt == "") {
+          print "  rpc "rpc"("req") returns ("res");";
+        } else {
+          print "  rpc "rpc"("req") returns ("res") {";
+          print "    "httpopt;
+          print "  }";
+        }
         in_svc=2;
       }
       print $0
@@ -327,17 +1539,72 @@ import "google/protobuf/timestamp.proto";
   ' "$PROTO_FILE" > "$TMP_PROTO"
   mv "$TMP_PROTO" "$PROTO_FILE"
 
-  echo "Added RPC ${RPC_NAME} to service ${SERVICE_NAME} in $PROTO_FILE"
+  sync_field_lock "$PROTO_FILE"
+  if [ "$STREAM_MODE" = "unary" ]; then
+    echo "Added RPC ${RPC_NAME} to service ${SERVICE_NAME} in $PROTO_FILE"
+  else
+    echo "Added ${STREAM_MODE}-streaming RPC ${RPC_NAME} to service ${SERVICE_NAME} in $PROTO_FILE"
+  fi
 
   # Append Go method stub if missing
   if [ -f "$GO_FILE" ]; then
     if ! grep -q "func (s \*${SERVICE_NAME}Service) ${RPC_NAME}(" "$GO_FILE"; then
-      cat >> "$GO_FILE" <<EOF
+      STREAM_TYPE="pb.${SERVICE_NAME}Service_${RPC_NAME}Server"
+      case "$STREAM_MODE" in
+        unary)
+          cat >> "$GO_FILE" <<EOF
 
 func (s *${SERVICE_NAME}Service) ${RPC_NAME}(ctx context.Context, req *pb.${REQ_MSG_NAME}) (*pb.${RES_MSG_NAME}, error) {
 	return &pb.${RES_MSG_NAME}{}, nil
 }
 EOF
+          ;;
+        server)
+          cat >> "$GO_FILE" <<EOF
+
+func (s *${SERVICE_NAME}Service) ${RPC_NAME}(req *pb.${REQ_MSG_NAME}, stream ${STREAM_TYPE}) error {
+	return stream.Send(&pb.${RES_MSG_NAME}{})
+}
+EOF
+          ;;
+        client)
+          ensure_go_std_import "$GO_FILE" "io"
+          cat >> "$GO_FILE" <<EOF
+
+func (s *${SERVICE_NAME}Service) ${RPC_NAME}(stream ${STREAM_TYPE}) error {
+	for {
+		_, err := stream.Recv()
+		if err == io.EOF {
+			return stream.SendAndClose(&pb.${RES_MSG_NAME}{})
+		}
+		if err != nil {
+			return err
+		}
+	}
+}
+EOF
+          ;;
+        bidi)
+          ensure_go_std_import "$GO_FILE" "io"
+          cat >> "$GO_FILE" <<EOF
+
+func (s *${SERVICE_NAME}Service) ${RPC_NAME}(stream ${STREAM_TYPE}) error {
+	for {
+		_, err := stream.Recv()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		if err := stream.Send(&pb.${RES_MSG_NAME}{}); err != nil {
+			return err
+		}
+	}
+}
+EOF
+          ;;
+      esac
       echo "Appended Go stub to $GO_FILE"
     else
       echo "Go stub already exists in $GO_FILE"
@@ -379,18 +1646,20 @@ if [ "$1" = "add-nested" ]; then
     exit 1
   fi
 
+  # Pick up fields removed by hand before allocating new numbers
+  sync_field_lock "$PROTO_FILE"
+
   # Normalize names
   FIELD_NAME_SNAKE="$FIELD_NAME_RAW"
   FIELD_NAME_CAMEL="$(echo "$FIELD_NAME_SNAKE" | awk -F'_' '{for(i=1;i<=NF;i++){ $i=toupper(substr($i,1,1)) tolower(substr($i,2)) }}1' OFS="")"
   NESTED_MSG_NAME="${CUSTOM_MSG_NAME:-$FIELD_NAME_CAMEL}"
 
-  # Build nested message fields block and detect timestamp usage
-  TS_USED=0
+  # Build nested message fields block (adds enum declarations and imports to the proto)
   build_nested_block() {
     local RAW="$1"
     local LINES=""
     local NUM=1
-    IFS=',' read -ra FL <<< "$RAW"
+    IFS=';' read -ra FL <<< "$(split_fields "$RAW")"
     for F in "${FL[@]}"; do
       local T="$(echo "$F" | xargs)"; [ -z "$T" ] && continue
       local N=""; local TY=""; local REP=0
@@ -404,9 +1673,30 @@ if [ "$1" = "add-nested" ]; then
       else
         echo "Invalid field format in nested: '$T'" >&2; exit 1
       fi
+      if parse_enum "$TY"; then
+        if [ $REP -eq 1 ]; then
+          echo "Repeated enum fields are not supported: '$T'" >&2; exit 1
+        fi
+        ensure_proto_enum "$PROTO_FILE" "$ENUM_NAME" "$ENUM_VALUES" >&2
+        TY="$ENUM_NAME"
+      fi
+      if parse_oneof "$TY"; then
+        LINES+="  oneof ${N} {\n"
+        local VARIANT V_TYPE
+        for VARIANT in "${ONEOF_VARIANTS[@]}"; do
+          V_TYPE="$(normalize_type "${VARIANT#*:}")"
+          ensure_proto_import "$PROTO_FILE" "$(proto_import_for "$V_TYPE")"
+          while lock_is_reserved "$PROTO_FILE" "$NESTED_MSG_NAME" "$NUM"; do NUM=$((NUM+1)); done
+          LINES+="    ${V_TYPE} ${VARIANT%%:*} = ${NUM};\n"
+          NUM=$((NUM+1))
+        done
+        LINES+="  }\n"
+        continue
+      fi
       local TN
       TN="$(normalize_type "$TY")"
-      if [ "$TN" = "google.protobuf.Timestamp" ]; then TS_USED=1; fi
+      ensure_proto_import "$PROTO_FILE" "$(proto_import_for "$TN")"
+      while lock_is_reserved "$PROTO_FILE" "$NESTED_MSG_NAME" "$NUM"; do NUM=$((NUM+1)); done
       if [ $REP -eq 1 ]; then
         LINES+="  repeated ${TN} ${N} = ${NUM};\n"
       else
@@ -419,20 +1709,6 @@ if [ "$1" = "add-nested" ]; then
 
   NESTED_BLOCK="$(build_nested_block "$NESTED_FIELDS_RAW")"
 
-  # Ensure timestamp import if needed
-  if [ "$TS_USED" -eq 1 ] && ! grep -q 'google/protobuf/timestamp.proto' "$PROTO_FILE"; then
-    if grep -q 'import "google/api/annotations.proto";' "$PROTO_FILE"; then
-      sed -i '' '/import "google\/api\/annotations.proto";/a\
-import "google/protobuf/timestamp.proto";
-' "$PROTO_FILE"
-    else
-      sed -i '' '1,/^package pb;/!b; /^package pb;/a\
-\
-import "google/protobuf/timestamp.proto";
-' "$PROTO_FILE"
-    fi
-  fi
-
   # Append nested message before service definition (macOS-safe)
   NESTED_MSG_FILE="$(mktemp)"
   {
@@ -442,88 +1718,404 @@ import "google/protobuf/timestamp.proto";
     echo ""
   } > "$NESTED_MSG_FILE"
 
-  TMP_P="$PROTO_FILE.tmp"
-  awk 'FNR==NR{buf=buf $0 "\n"; next} { if (!printed && $0 ~ /^service [A-Za-z0-9_]+Service[ ]*\{/){ printf "%s", buf; printed=1 } print }' "$NESTED_MSG_FILE" "$PROTO_FILE" > "$TMP_P" && mv "$TMP_P" "$PROTO_FILE"
-  rm -f "$NESTED_MSG_FILE"
+  TMP_P="$PROTO_FILE.tmp"
+  awk 'FNR==NR{buf=buf $0 "\n"; next} { if (!printed && $0 ~ /^service [A-Za-z0-9_]+Service[ ]*\{/){ printf "%s", buf; printed=1 } print }' "$NESTED_MSG_FILE" "$PROTO_FILE" > "$TMP_P" && mv "$TMP_P" "$PROTO_FILE"
+  rm -f "$NESTED_MSG_FILE"
+
+  # Add field to main entity message (message ServiceName { ... }) with next field number
+  FIELD_INSERT="${NESTED_MSG_NAME} ${FIELD_NAME_SNAKE}"
+  [ "$REPEATED_FLAG" = "repeated" ] && FIELD_INSERT="repeated ${FIELD_INSERT}"
+
+  # Next field number, never reusing numbers recorded in the lock file
+  NEXTN="$(next_field_number "$PROTO_FILE" "$SERVICE_NAME")"
+
+  TMP_P2="$PROTO_FILE.tmp"
+  awk -v entity="$SERVICE_NAME" -v line="  ${FIELD_INSERT} = ${NEXTN};" '
+    $0 ~ "^message " entity " " {print; inm=1; next}
+    inm==1 && $0 ~ /^}/ {print line; print; inm=0; next}
+    {print}
+  ' "$PROTO_FILE" > "$TMP_P2" && mv "$TMP_P2" "$PROTO_FILE"
+
+  sync_field_lock "$PROTO_FILE"
+  echo "Added nested message ${NESTED_MSG_NAME} and field ${FIELD_NAME_SNAKE} to ${PROTO_FILE}"
+
+  # Update model: add nested struct type if not exists and add field to main model struct
+  # 1) Append nested struct type at end if missing
+  if ! grep -q "type ${NESTED_MSG_NAME} struct" "$MODEL_FILE"; then
+    build_go_fields() {
+      local F
+      IFS=';' read -ra FL <<< "$(split_fields "$1")"
+      for F in "${FL[@]}"; do
+        parse_field_spec "$F" || continue
+        if parse_enum "$TYPE_RAW"; then
+          ensure_go_enum "$MODEL_FILE" "$ENUM_NAME" "$ENUM_VALUES"
+        fi
+        model_field_lines "$NAME" "$TYPE_RAW" "$IS_REPEATED"
+      done
+    }
+
+    GO_FIELDS="$(build_go_fields "$NESTED_FIELDS_RAW")"
+    {
+      echo ""
+      echo "type ${NESTED_MSG_NAME} struct {"
+      [ -n "$GO_FIELDS" ] && echo "$GO_FIELDS"
+      echo "}"
+    } >> "$MODEL_FILE"
+  fi
+
+  # 2) Add field to main model struct if missing (insert before closing brace)
+  if ! grep -q "${FIELD_NAME_CAMEL} ${NESTED_MSG_NAME}" "$MODEL_FILE"; then
+    TMP_M="$MODEL_FILE.tmp"
+    awk -v st="type ${SERVICE_NAME} struct {" -v line="\t${FIELD_NAME_CAMEL} ${NESTED_MSG_NAME} \`json:\"${FIELD_NAME_SNAKE}\" bson:\"${FIELD_NAME_SNAKE}\"\`" '
+      BEGIN{inm=0}
+      {
+        if ($0 ~ st) { inm=1; print; next }
+        if (inm==1 && $0 ~ /^}/) { print line; inm=2 }
+        print
+      }
+    ' "$MODEL_FILE" > "$TMP_M" && mv "$TMP_M" "$MODEL_FILE"
+  fi
+
+  echo "Updated model ${MODEL_FILE} with nested struct and field. Please adjust ToProto/FromProto mappings as needed."
+  echo "Don't forget to run: make proto"
+  exit 0
+fi
+
+# Change the type of a field, keeping its number: edit-field ServiceName field "type" [MessageName]
+if [ "$1" = "edit-field" ]; then
+  if [ -z "$2" ] || [ -z "$3" ] || [ -z "$4" ]; then
+    echo "Usage: $0 edit-field ServiceName field_name \"type\" [MessageName]" >&2
+    exit 1
+  fi
+
+  SERVICE_NAME="$(echo "$2" | awk '{print toupper(substr($0,1,1)) tolower(substr($0,2))}')"
+  SERVICE_NAME_LC="$(echo "$2" | tr '[:upper:]' '[:lower:]')"
+  FIELD="$3"
+  MSG_NAME="${5:-$SERVICE_NAME}"
+  PROTO_FILE="proto/${SERVICE_NAME_LC}.proto"
+  MODEL_FILE="models/${SERVICE_NAME_LC}.go"
+
+  if [ ! -f "$PROTO_FILE" ]; then
+    echo "Proto file not found: $PROTO_FILE" >&2
+    exit 1
+  fi
+  if [ "$FIELD" = "id" ] && [ "$MSG_NAME" = "$SERVICE_NAME" ]; then
+    echo "The id field of ${SERVICE_NAME} cannot be changed" >&2
+    exit 1
+  fi
+  INFO="$(proto_field_info "$PROTO_FILE" "$MSG_NAME" "$FIELD")"
+  if [ -z "$INFO" ]; then
+    echo "Field ${FIELD} not found in message ${MSG_NAME} of ${PROTO_FILE}" >&2
+    exit 1
+  fi
+  ONEOF="${INFO##* }"
+
+  parse_field_spec "${FIELD}:$4" || { echo "Invalid type '$4'" >&2; exit 1; }
+  if parse_oneof "$TYPE_RAW"; then
+    echo "A field cannot be turned into a oneof; add the oneof as a new field instead" >&2
+    exit 1
+  fi
+  sync_field_lock "$PROTO_FILE"
+
+  PREV_P="$(mktemp)"
+  cp "$PROTO_FILE" "$PREV_P"
+  ENUM_DECL=""
+  if parse_enum "$TYPE_RAW"; then
+    if [ $IS_REPEATED -eq 1 ] && [ "$MSG_NAME" = "$SERVICE_NAME" ]; then
+      echo "Repeated enum fields are not supported: '$4'" >&2
+      exit 1
+    fi
+    check_enum_name "$PROTO_FILE" "$ENUM_NAME"
+    ensure_proto_enum "$PROTO_FILE" "$ENUM_NAME" "$ENUM_VALUES"
+    ENUM_DECL="${ENUM_NAME}=${ENUM_VALUES}"
+    TYPE_NORM="$ENUM_NAME"
+  else
+    TYPE_NORM="$(normalize_type "$TYPE_RAW")"
+  fi
+  if [ "$ONEOF" != "-" ] && { [ $IS_REPEATED -eq 1 ] || ! is_scalar_type "$TYPE_NORM"; }; then
+    echo "Oneof ${ONEOF}: variant '${FIELD}' must have a scalar type" >&2
+    exit 1
+  fi
+  case "$TYPE_NORM" in
+    map\<*) [ $IS_REPEATED -eq 1 ] && { echo "Map fields cannot be repeated: '$4'" >&2; exit 1; } ;;
+  esac
+  ensure_proto_import "$PROTO_FILE" "$(proto_import_for "$TYPE_NORM")"
+  NEW_DECL="$TYPE_NORM"
+  [ $IS_REPEATED -eq 1 ] && NEW_DECL="repeated $TYPE_NORM"
+  proto_set_field "$PROTO_FILE" "$MSG_NAME" "$FIELD" "$NEW_DECL"
+  guard_proto_edit "$PROTO_FILE" "$PREV_P" || exit $?
+  sync_field_lock "$PROTO_FILE"
+  echo "Changed ${MSG_NAME}.${FIELD} to ${NEW_DECL} in ${PROTO_FILE}"
+
+  # Keep the model struct and its conversions in step with the proto
+  if [ -f "$MODEL_FILE" ] && grep -q "^type ${MSG_NAME} struct {" "$MODEL_FILE"; then
+    [ -n "$ENUM_DECL" ] && ensure_go_enum "$MODEL_FILE" "${ENUM_DECL%%=*}" "${ENUM_DECL#*=}"
+    TYPE_SPEC="$TYPE_RAW"
+    ENTITY=0
+    [ "$MSG_NAME" = "$SERVICE_NAME" ] && ENTITY=1
+    if [ "$ONEOF" != "-" ]; then
+      V_BYTES=0
+      [ "$TYPE_NORM" = "bytes" ] && V_BYTES=1
+      STRUCT_LINES="$(model_field_lines "$ONEOF" "oneof{${FIELD}:${TYPE_NORM}}" 0)"
+      model_set_field "$MODEL_FILE" "$MSG_NAME" "$(go_field_name "$FIELD")" "$ENTITY" "$STRUCT_LINES" "" "" "" "" "$V_BYTES"
+    else
+      STRUCT_LINES="$(model_field_lines "$FIELD" "$TYPE_SPEC" "$IS_REPEATED")"
+      TO_LINE="" TO_POST="" FROM_LINE="" FROM_POST=""
+      if [ $ENTITY -eq 1 ]; then
+        model_conversion to "$FIELD" "$TYPE_SPEC" "$IS_REPEATED" "$SERVICE_NAME"
+        TO_LINE="$CONV_LINE" TO_POST="$CONV_POST"
+        model_conversion from "$FIELD" "$TYPE_SPEC" "$IS_REPEATED" "$SERVICE_NAME"
+        FROM_LINE="$CONV_LINE" FROM_POST="$CONV_POST"
+        [ $IS_REPEATED -eq 0 ] && ensure_go_import "$MODEL_FILE" "$(go_import_for "$TYPE_NORM")"
+      fi
+      model_set_field "$MODEL_FILE" "$MSG_NAME" "$(go_field_name "$FIELD")" "$ENTITY" "$STRUCT_LINES" "$TO_LINE" "$TO_POST" "$FROM_LINE" "$FROM_POST"
+    fi
+    prune_go_imports "$MODEL_FILE"
+    echo "Updated ${MSG_NAME}.$(go_field_name "$FIELD") in ${MODEL_FILE}"
+  fi
+
+  echo "Don't forget to run: make proto"
+  exit 0
+fi
+
+# Remove a field and reserve its number and name: remove-field ServiceName field [MessageName]
+if [ "$1" = "remove-field" ]; then
+  if [ -z "$2" ] || [ -z "$3" ]; then
+    echo "Usage: $0 remove-field ServiceName field_name [MessageName]" >&2
+    exit 1
+  fi
+
+  SERVICE_NAME="$(echo "$2" | awk '{print toupper(substr($0,1,1)) tolower(substr($0,2))}')"
+  SERVICE_NAME_LC="$(echo "$2" | tr '[:upper:]' '[:lower:]')"
+  FIELD="$3"
+  MSG_NAME="${4:-$SERVICE_NAME}"
+  PROTO_FILE="proto/${SERVICE_NAME_LC}.proto"
+  MODEL_FILE="models/${SERVICE_NAME_LC}.go"
+
+  if [ ! -f "$PROTO_FILE" ]; then
+    echo "Proto file not found: $PROTO_FILE" >&2
+    exit 1
+  fi
+  if [ "$FIELD" = "id" ] && [ "$MSG_NAME" = "$SERVICE_NAME" ]; then
+    echo "The id field of ${SERVICE_NAME} cannot be removed" >&2
+    exit 1
+  fi
+  sync_field_lock "$PROTO_FILE"
+
+  # A oneof is removed with all of its fields
+  REMOVED_FIELDS=()
+  PREV_P="$(mktemp)"
+  cp "$PROTO_FILE" "$PREV_P"
+  if proto_has_oneof "$PROTO_FILE" "$MSG_NAME" "$FIELD"; then
+    for F in $(proto_field_table "$PROTO_FILE" | awk -v m="$MSG_NAME" '$1 == m && $2 != "@reserved" { print $2 }'); do
+      INFO="$(proto_field_info "$PROTO_FILE" "$MSG_NAME" "$F")"
+      [ "${INFO##* }" = "$FIELD" ] && REMOVED_FIELDS+=("$F")
+    done
+    proto_remove_oneof "$PROTO_FILE" "$MSG_NAME" "$FIELD"
+  elif [ -n "$(proto_field_info "$PROTO_FILE" "$MSG_NAME" "$FIELD")" ]; then
+    REMOVED_FIELDS=("$FIELD")
+    proto_set_field "$PROTO_FILE" "$MSG_NAME" "$FIELD" ""
+  else
+    rm -f "$PREV_P"
+    echo "Field ${FIELD} not found in message ${MSG_NAME} of ${PROTO_FILE}" >&2
+    exit 1
+  fi
+  # Reserve the number and name first so the guard sees the final proto
+  PREV_L="$(mktemp)"
+  cp "$(lock_file_for "$PROTO_FILE")" "$PREV_L"
+  sync_field_lock "$PROTO_FILE"
+  guard_proto_edit "$PROTO_FILE" "$PREV_P" "$PREV_L" || exit $?
+  echo "Removed ${MSG_NAME}.${FIELD} from ${PROTO_FILE}"
+
+  if [ -f "$MODEL_FILE" ] && grep -q "^type ${MSG_NAME} struct {" "$MODEL_FILE"; then
+    ENTITY=0
+    [ "$MSG_NAME" = "$SERVICE_NAME" ] && ENTITY=1
+    for F in "${REMOVED_FIELDS[@]}"; do
+      model_set_field "$MODEL_FILE" "$MSG_NAME" "$(go_field_name "$F")" "$ENTITY" "" "" "" "" "" ""
+    done
+    prune_go_imports "$MODEL_FILE"
+    echo "Removed ${FIELD} from ${MODEL_FILE}"
+  fi
+
+  echo "Documents in MongoDB keep the old value until they are rewritten."
+  echo "Don't forget to run: make proto"
+  exit 0
+fi
+
+# Remove an RPC, its stub and its generated tests: remove-rpc ServiceName RpcName
+if [ "$1" = "remove-rpc" ]; then
+  if [ -z "$2" ] || [ -z "$3" ]; then
+    echo "Usage: $0 remove-rpc ServiceName RpcName" >&2
+    exit 1
+  fi
+
+  SERVICE_NAME="$(echo "$2" | awk '{print toupper(substr($0,1,1)) tolower(substr($0,2))}')"
+  SERVICE_NAME_LC="$(echo "$2" | tr '[:upper:]' '[:lower:]')"
+  RPC_NAME="$3"
+  PROTO_FILE="proto/${SERVICE_NAME_LC}.proto"
+  GO_FILE="services/${SERVICE_NAME_LC}.go"
+  TEST_FILE="services/${SERVICE_NAME_LC}_test.go"
+
+  if [ ! -f "$PROTO_FILE" ]; then
+    echo "Proto file not found: $PROTO_FILE" >&2
+    exit 1
+  fi
+  RPC_LINE="$(proto_rpc_line "$PROTO_FILE" "${SERVICE_NAME}Service" "$RPC_NAME")"
+  if [ -z "$RPC_LINE" ]; then
+    echo "RPC ${RPC_NAME} not found in service ${SERVICE_NAME}Service of ${PROTO_FILE}" >&2
+    exit 1
+  fi
+  if ! [[ "$RPC_LINE" =~ \((stream[[:space:]]+)?([A-Za-z0-9_.]+)\)[[:space:]]*returns[[:space:]]*\((stream[[:space:]]+)?([A-Za-z0-9_.]+)\) ]]; then
+    echo "Could not parse RPC declaration: ${RPC_LINE}" >&2
+    exit 1
+  fi
+  REQ_MSG="${BASH_REMATCH[2]}"
+  RES_MSG="${BASH_REMATCH[4]}"
+  BINDINGS="$(proto_rpc_bindings "$PROTO_FILE" "${SERVICE_NAME}Service" "$RPC_NAME")"
+  sync_field_lock "$PROTO_FILE"
+
+  PREV_P="$(mktemp)"
+  cp "$PROTO_FILE" "$PREV_P"
+  proto_rewrite_rpc "$PROTO_FILE" "${SERVICE_NAME}Service" "$RPC_NAME" "" 1
+  # Drop request/response messages nothing else refers to
+  REMOVED_MSGS=()
+  for MSG in "$REQ_MSG" "$RES_MSG"; do
+    [ "$MSG" = "$SERVICE_NAME" ] && continue
+    [[ " ${REMOVED_MSGS[*]} " == *" $MSG "* ]] && continue
+    grep -q "^message ${MSG} {" "$PROTO_FILE" || continue
+    if [ "$(cat proto/*.proto | grep -c "[^A-Za-z0-9_.]${MSG}[^A-Za-z0-9_]")" -eq 1 ]; then
+      proto_remove_message "$PROTO_FILE" "$MSG"
+      REMOVED_MSGS+=("$MSG")
+    fi
+  done
+  PREV_L="$(mktemp)"
+  cp "$(lock_file_for "$PROTO_FILE")" "$PREV_L"
+  sync_field_lock "$PROTO_FILE"
+  guard_proto_edit "$PROTO_FILE" "$PREV_P" "$PREV_L" || exit $?
+  echo "Removed RPC ${RPC_NAME} from ${PROTO_FILE}"
+  for MSG in "${REMOVED_MSGS[@]}"; do
+    echo "Removed unused message ${MSG}"
+  done
+
+  if [ -f "$GO_FILE" ] && grep -q "^func (s \*${SERVICE_NAME}Service) ${RPC_NAME}(" "$GO_FILE"; then
+    TMP_G="$GO_FILE.tmp"
+    # Drop the method together with the blank line that precedes it
+    awk -v head="func (s *${SERVICE_NAME}Service) ${RPC_NAME}(" '
+      index($0, head) == 1 { skip=1; held=0; next }
+      skip { if ($0 ~ /^}/) skip=0; next }
+      held { print ""; held=0 }
+      /^$/ { held=1; next }
+      { print }
+      END { if (held) print "" }
+    ' "$GO_FILE" > "$TMP_G" && mv "$TMP_G" "$GO_FILE"
+    # Client and bidi stream stubs import io for io.EOF
+    if grep -q '^	"io"$' "$GO_FILE" && ! grep -q '[^A-Za-z0-9_.]io\.' "$GO_FILE"; then
+      grep -v '^	"io"$' "$GO_FILE" > "$TMP_G" && mv "$TMP_G" "$GO_FILE"
+    fi
+    echo "Removed ${RPC_NAME} from ${GO_FILE}"
+  fi
+
+  if [ -f "$TEST_FILE" ]; then
+    TMP_T="$TEST_FILE.tmp"
+    awk -v head="	t.Run(\"${RPC_NAME}\", func(t *testing.T) {" '
+      $0 == head { skip=1; next }
+      skip { if ($0 ~ /^\t}\)$/) skip=0; next }
+      { print }
+    ' "$TEST_FILE" > "$TMP_T" && mv "$TMP_T" "$TEST_FILE"
+    while read -r METHOD ROUTE; do
+      [ -z "$METHOD" ] && continue
+      grep -vF "$(gateway_test_entry "$METHOD" "$ROUTE")" "$TEST_FILE" > "$TMP_T" && mv "$TMP_T" "$TEST_FILE"
+    done <<< "$BINDINGS"
+    echo "Removed ${RPC_NAME} from ${TEST_FILE}"
+  fi
 
-  # Add field to main entity message (message ServiceName { ... }) with next field number
-  FIELD_INSERT="${NESTED_MSG_NAME} ${FIELD_NAME_SNAKE}"
-  [ "$REPEATED_FLAG" = "repeated" ] && FIELD_INSERT="repeated ${FIELD_INSERT}"
+  echo "Don't forget to run: make proto"
+  exit 0
+fi
 
-  # Compute next field number in shell (portable)
-  MAXN=$(awk -v entity="$SERVICE_NAME" '
-    $0 ~ "^message " entity " " {inm=1; next}
-    inm==1 && $0 ~ /^}/ { exit }
-    inm==1 && $0 ~ /=/ {
-      n=$0
-      sub(/^.*= */,"",n)
-      sub(/;.*/,"",n)
-      if (n+0>maxn) maxn=n+0
-    }
-    END { if (maxn=="") maxn=1; print maxn }
-  ' "$PROTO_FILE")
-  NEXTN=$((MAXN+1))
+# Change or remove the HTTP annotation of an RPC:
+# set-http ServiceName RpcName "http=METHOD:/path" ["body=*"]  or  set-http ServiceName RpcName none
+if [ "$1" = "set-http" ]; then
+  if [ -z "$2" ] || [ -z "$3" ] || [ -z "$4" ]; then
+    echo "Usage: $0 set-http ServiceName RpcName \"http=METHOD:/path\" [\"body=*\"]" >&2
+    echo "       $0 set-http ServiceName RpcName none" >&2
+    exit 1
+  fi
 
-  TMP_P2="$PROTO_FILE.tmp"
-  awk -v entity="$SERVICE_NAME" -v line="  ${FIELD_INSERT} = ${NEXTN};" '
-    $0 ~ "^message " entity " " {print; inm=1; next}
-    inm==1 && $0 ~ /^}/ {print line; print; inm=0; next}
-    {print}
-  ' "$PROTO_FILE" > "$TMP_P2" && mv "$TMP_P2" "$PROTO_FILE"
+  SERVICE_NAME="$(echo "$2" | awk '{print toupper(substr($0,1,1)) tolower(substr($0,2))}')"
+  SERVICE_NAME_LC="$(echo "$2" | tr '[:upper:]' '[:lower:]')"
+  RPC_NAME="$3"
+  PROTO_FILE="proto/${SERVICE_NAME_LC}.proto"
+  TEST_FILE="services/${SERVICE_NAME_LC}_test.go"
 
-  echo "Added nested message ${NESTED_MSG_NAME} and field ${FIELD_NAME_SNAKE} to ${PROTO_FILE}"
+  if [ ! -f "$PROTO_FILE" ]; then
+    echo "Proto file not found: $PROTO_FILE" >&2
+    exit 1
+  fi
+  RPC_LINE="$(proto_rpc_line "$PROTO_FILE" "${SERVICE_NAME}Service" "$RPC_NAME")"
+  if [ -z "$RPC_LINE" ]; then
+    echo "RPC ${RPC_NAME} not found in service ${SERVICE_NAME}Service of ${PROTO_FILE}" >&2
+    exit 1
+  fi
 
-  # Update model: add nested struct type if not exists and add field to main model struct
-  # 1) Append nested struct type at end if missing
-  if ! grep -q "type ${NESTED_MSG_NAME} struct" "$MODEL_FILE"; then
-    build_go_fields() {
-      local RAW="$1"; local LINES=""
-      IFS=',' read -ra FL <<< "$RAW"
-      for F in "${FL[@]}"; do
-        local T="$(echo "$F" | xargs)"; [ -z "$T" ] && continue
-        local N=""; local TY=""; local REP=0
-        N="$(echo "$T" | cut -d: -f1 | xargs)"
-        TY="$(echo "$T" | cut -d: -f2- | xargs)"
-        case "$TY" in
-          repeated\ *) REP=1; TY="${TY#repeated }" ;;
-          Repeated\ *) REP=1; TY="${TY#Repeated }" ;;
-        esac
-        # normalize type to Go type
-        local GO=""; local tn="$(echo "$TY" | tr '[:upper:]' '[:lower:]')"
-        case "$tn" in
-          string) GO="string";; bool) GO="bool";; bytes) GO="[]byte";; int32) GO="int32";; int64) GO="int64";; float) GO="float32";; double) GO="float64";; google.protobuf.timestamp|timestamp|datetime|date) GO="time.Time";;
-          *) GO="string";;
-        esac
-        if [ $REP -eq 1 ]; then GO="[]$GO"; fi
-        local CAM="$(echo "$N" | awk -F'_' '{for(i=1;i<=NF;i++){ $i=toupper(substr($i,1,1)) tolower(substr($i,2)) }}1' OFS="")" 
-        LINES+=$'\t'"${CAM} ${GO} \`json:\"${N}\" bson:\"${N}\"\`\n"
-      done
-      echo "$LINES"
-    }
+  HTTP_OPTION=""
+  HTTP_METHOD=""
+  HTTP_PATH=""
+  if [ "$4" != "none" ]; then
+    if [[ "$4" =~ ^http=([A-Za-z]+):(/.*)$ ]]; then
+      HTTP_METHOD="$(echo "${BASH_REMATCH[1]}" | tr '[:upper:]' '[:lower:]')"
+      HTTP_PATH="${BASH_REMATCH[2]}"
+    else
+      echo "Invalid HTTP spec. Expected 'http=METHOD:/path' or 'none'" >&2
+      exit 1
+    fi
+    case "$HTTP_METHOD" in
+      get|post|put|patch|delete) ;;
+      *) echo "Unsupported HTTP method '${HTTP_METHOD}'" >&2; exit 1 ;;
+    esac
+    HTTP_BODY=""
+    if [ -n "$5" ]; then
+      if [[ "$5" =~ ^body=(.*)$ ]]; then
+        HTTP_BODY="${BASH_REMATCH[1]}"
+      else
+        echo "Invalid body spec. Expected 'body=*' or 'body=data'" >&2
+        exit 1
+      fi
+    fi
+    check_stream_binding "$(rpc_stream_mode "$RPC_LINE")" "$HTTP_METHOD" "$HTTP_BODY" || exit 1
+    HTTP_OPTION="$(http_option "$HTTP_METHOD" "$HTTP_PATH" "$HTTP_BODY")"
+  fi
 
-    GO_FIELDS="$(build_go_fields "$NESTED_FIELDS_RAW")"
-    {
-      echo ""
-      echo "type ${NESTED_MSG_NAME} struct {"
-      echo -ne "${GO_FIELDS}"
-      echo "}"
-    } >> "$MODEL_FILE"
+  OLD_BINDINGS="$(proto_rpc_bindings "$PROTO_FILE" "${SERVICE_NAME}Service" "$RPC_NAME")"
+  PREV_P="$(mktemp)"
+  cp "$PROTO_FILE" "$PREV_P"
+  proto_rewrite_rpc "$PROTO_FILE" "${SERVICE_NAME}Service" "$RPC_NAME" "$HTTP_OPTION"
+  guard_proto_edit "$PROTO_FILE" "$PREV_P" || exit $?
+  if [ -n "$HTTP_OPTION" ]; then
+    echo "Set HTTP binding of ${RPC_NAME} to $(echo "$HTTP_METHOD" | tr '[:lower:]' '[:upper:]') ${HTTP_PATH}"
+  else
+    echo "Removed HTTP binding of ${RPC_NAME}"
   fi
 
-  # 2) Add field to main model struct if missing (insert before closing brace)
-  if ! grep -q "${FIELD_NAME_CAMEL} ${NESTED_MSG_NAME}" "$MODEL_FILE"; then
-    TMP_M="$MODEL_FILE.tmp"
-    awk -v st="type ${SERVICE_NAME} struct {" -v line="\t${FIELD_NAME_CAMEL} ${NESTED_MSG_NAME} \`json:\\"${FIELD_NAME_SNAKE}\\" bson:\\"${FIELD_NAME_SNAKE}\\"\`" '
-      BEGIN{inm=0}
-      {
-        if ($0 ~ st) { inm=1; print; next }
-        if (inm==1 && $0 ~ /^}/) { print line; inm=2 }
-        print
-      }
-    ' "$MODEL_FILE" > "$TMP_M" && mv "$TMP_M" "$MODEL_FILE"
+  # Point the generated gateway test at the new route
+  OLD_BINDING="$(echo "$OLD_BINDINGS" | head -n 1)"
+  if [ -f "$TEST_FILE" ] && [ -n "$OLD_BINDING" ]; then
+    OLD_ENTRY="$(gateway_test_entry ${OLD_BINDING})"
+    if grep -qF "$OLD_ENTRY" "$TEST_FILE"; then
+      TMP_T="$TEST_FILE.tmp"
+      if [ -n "$HTTP_OPTION" ]; then
+        NEW_ENTRY="$(gateway_test_entry "$HTTP_METHOD" "$HTTP_PATH")"
+        awk -v old="$OLD_ENTRY" -v new="$NEW_ENTRY" '
+          (i = index($0, old)) { $0 = substr($0, 1, i-1) new substr($0, i+length(old)) }
+          { print }
+        ' "$TEST_FILE" > "$TMP_T" && mv "$TMP_T" "$TEST_FILE"
+      else
+        grep -vF "$OLD_ENTRY" "$TEST_FILE" > "$TMP_T" && mv "$TMP_T" "$TEST_FILE"
+      fi
+      echo "Updated gateway test route in ${TEST_FILE}"
+    fi
   fi
 
-  echo "Updated model ${MODEL_FILE} with nested struct and field. Please adjust ToProto/FromProto mappings as needed."
   echo "Don't forget to run: make proto"
   exit 0
 fi
@@ -546,31 +2138,6 @@ SERVICE_NAME_LC_PLURAL="$(echo "$SERVICE_NAME_PLURAL" | tr '[:upper:]' '[:lower:
 PROTO_FILE="proto/${SERVICE_NAME_LC}.proto"
 GO_FILE="services/${SERVICE_NAME_LC}.go"
 
-# Helper to normalize field types
-normalize_type() {
-  local t="$1"
-  local tlc="$(echo "$t" | tr '[:upper:]' '[:lower:]')"
-  case "$tlc" in
-    string|bool|bytes|int32|int64|sint32|sint64|uint32|uint64|fixed32|fixed64|sfixed32|sfixed64|float|double)
-      echo "$tlc"
-      return 0
-      ;;
-    timestamp|datetime|date)
-      echo "google.protobuf.Timestamp"
-      return 0
-      ;;
-  esac
-  # If already fully qualified google.protobuf.Timestamp (any case), standardize casing
-  local tlc_lower="$(echo "$t" | tr '[:upper:]' '[:lower:]')"
-  if [ "$tlc_lower" = "google.protobuf.timestamp" ]; then
-    echo "google.protobuf.Timestamp"
-    return 0
-  fi
-  # Custom message type: ensure PascalCase first letter
-  local first="$(echo "${t:0:1}" | tr '[:lower:]' '[:upper:]')"
-  echo "${first}${t:1}"
-}
-
 # Helper to convert snake_case to camelCase
 snake_to_camel() {
   local input="$1"
@@ -595,10 +2162,12 @@ snake_to_camel() {
 }
 
 # Pre-process fields to decide imports and build message body
-TIMESTAMP_USED=0
+PROTO_IMPORTS=()
+MODEL_IMPORTS=""
+ENUM_DECLS=()
 FIELD_LINES="  string id = 1;\n"
 FIELD_NUM=2
-IFS=',' read -ra FIELDS <<< "$FIELDS_RAW"
+IFS=';' read -ra FIELDS <<< "$(split_fields "$FIELDS_RAW")"
 for FIELD in "${FIELDS[@]}"; do
   RAW_TRIMMED="$(echo "$FIELD" | xargs)"
   [ -z "$RAW_TRIMMED" ] && continue
@@ -633,9 +2202,60 @@ for FIELD in "${FIELDS[@]}"; do
     fi
   fi
 
+  if parse_enum "$TYPE_RAW"; then
+    if [ $IS_REPEATED -eq 1 ]; then
+      echo "Repeated enum fields are not supported: '$RAW_TRIMMED'" >&2
+      exit 1
+    fi
+    check_enum_name "$PROTO_FILE" "$ENUM_NAME"
+    ENUM_DECLS+=("${ENUM_NAME}=${ENUM_VALUES}")
+    TYPE_RAW="$ENUM_NAME"
+  fi
+
+  # oneof: each variant gets its own field number; the model holds one pointer per variant
+  if parse_oneof "$TYPE_RAW"; then
+    if [ $IS_REPEATED -eq 1 ]; then
+      echo "A oneof cannot be repeated: '$RAW_TRIMMED'" >&2
+      exit 1
+    fi
+    FIELD_LINES+="  oneof ${NAME} {\n"
+    for VARIANT in "${ONEOF_VARIANTS[@]}"; do
+      V_TYPE="$(normalize_type "${VARIANT#*:}")"
+      if ! is_scalar_type "$V_TYPE"; then
+        echo "Oneof ${NAME}: variant '${VARIANT}' must have a scalar type" >&2
+        exit 1
+      fi
+      FIELD_LINES+="    ${V_TYPE} ${VARIANT%%:*} = ${FIELD_NUM};\n"
+      FIELD_NUM=$((FIELD_NUM+1))
+    done
+    FIELD_LINES+="  }\n"
+    continue
+  fi
+
   TYPE_NORM="$(normalize_type "$TYPE_RAW")"
-  if [ "$TYPE_NORM" = "google.protobuf.Timestamp" ]; then
-    TIMESTAMP_USED=1
+  case "$TYPE_NORM" in
+    map\<*)
+      if [ $IS_REPEATED -eq 1 ]; then
+        echo "Map fields cannot be repeated: '$RAW_TRIMMED'" >&2
+        exit 1
+      fi
+      MAP_VALUE="${TYPE_NORM#*, }"
+      if ! is_scalar_type "${MAP_VALUE%>}"; then
+        echo "Map values must be scalar types in service models: '$RAW_TRIMMED'" >&2
+        exit 1
+      fi
+      ;;
+  esac
+  IMPORT="$(proto_import_for "$TYPE_NORM")"
+  if [ -n "$IMPORT" ] && [[ " ${PROTO_IMPORTS[*]} " != *" $IMPORT "* ]]; then
+    PROTO_IMPORTS+=("$IMPORT")
+  fi
+  # Conversion helpers the model needs (repeated fields are copied as-is)
+  if [ $IS_REPEATED -eq 0 ]; then
+    GO_IMPORT="$(go_import_for "$TYPE_NORM")"
+    if [ -n "$GO_IMPORT" ] && [[ "$MODEL_IMPORTS" != *"\"$GO_IMPORT\""* ]]; then
+      MODEL_IMPORTS+=$'\t'"\"$GO_IMPORT\""$'\n'
+    fi
   fi
 
   if [ $IS_REPEATED -eq 1 ]; then
@@ -646,15 +2266,22 @@ for FIELD in "${FIELDS[@]}"; do
   FIELD_NUM=$((FIELD_NUM+1))
 done
 
+# Keep the previous proto so a regeneration that breaks clients can be rolled back
+PREV_PROTO=""
+if [ -f "$PROTO_FILE" ]; then
+  PREV_PROTO="$(mktemp)"
+  cp "$PROTO_FILE" "$PREV_PROTO"
+fi
+
 # Start proto file
 echo 'syntax = "proto3";' > "$PROTO_FILE"
 echo '' >> "$PROTO_FILE"
 echo 'package pb;' >> "$PROTO_FILE"
 echo '' >> "$PROTO_FILE"
 echo 'import "google/api/annotations.proto";' >> "$PROTO_FILE"
-if [ $TIMESTAMP_USED -eq 1 ]; then
-  echo 'import "google/protobuf/timestamp.proto";' >> "$PROTO_FILE"
-fi
+for IMPORT in "${PROTO_IMPORTS[@]}"; do
+  echo "import \"${IMPORT}\";" >> "$PROTO_FILE"
+done
 echo "option go_package = \"${MODULE_PATH}/pb\";" >> "$PROTO_FILE"
 echo '' >> "$PROTO_FILE"
 
@@ -675,6 +2302,15 @@ echo "message Delete${SERVICE_NAME}Request { string id = 1; }" >> "$PROTO_FILE"
 echo "message Delete${SERVICE_NAME}Response { bool success = 1; }" >> "$PROTO_FILE"
 echo "message List${SERVICE_NAME_PLURAL}Request {}" >> "$PROTO_FILE"
 echo "message List${SERVICE_NAME_PLURAL}Response { repeated ${SERVICE_NAME} data = 1; }" >> "$PROTO_FILE"
+# Change events of the collection (see internal/watch)
+echo "message Watch${SERVICE_NAME}Request { string filter = 1; string resume_token = 2; }" >> "$PROTO_FILE"
+echo "message ${SERVICE_NAME}Event {" >> "$PROTO_FILE"
+echo "  enum Type { TYPE_UNSPECIFIED = 0; CREATED = 1; UPDATED = 2; DELETED = 3; }" >> "$PROTO_FILE"
+echo "  Type type = 1;" >> "$PROTO_FILE"
+echo "  string id = 2;" >> "$PROTO_FILE"
+echo "  ${SERVICE_NAME} data = 3;" >> "$PROTO_FILE"
+echo "  string resume_token = 4;" >> "$PROTO_FILE"
+echo "}" >> "$PROTO_FILE"
 echo '' >> "$PROTO_FILE"
 
 # Service definition
@@ -694,8 +2330,24 @@ echo "  }" >> "$PROTO_FILE"
 echo "  rpc List${SERVICE_NAME_PLURAL}(List${SERVICE_NAME_PLURAL}Request) returns (List${SERVICE_NAME_PLURAL}Response) {" >> "$PROTO_FILE"
 echo "    option (google.api.http) = { get: \"/v1/${SERVICE_NAME_LC_PLURAL}\" };" >> "$PROTO_FILE"
 echo "  }" >> "$PROTO_FILE"
+echo "  rpc Watch${SERVICE_NAME}(Watch${SERVICE_NAME}Request) returns (stream ${SERVICE_NAME}Event) {" >> "$PROTO_FILE"
+echo "    option (google.api.http) = { get: \"/v1/${SERVICE_NAME_LC_PLURAL}:watch\" };" >> "$PROTO_FILE"
+echo "  }" >> "$PROTO_FILE"
 echo "}" >> "$PROTO_FILE"
 echo '' >> "$PROTO_FILE"
+for DECL in "${ENUM_DECLS[@]}"; do
+  ensure_proto_enum "$PROTO_FILE" "${DECL%%=*}" "${DECL#*=}"
+done
+if [ -n "$PREV_PROTO" ]; then
+  RC=0
+  check_compat || RC=$?
+  if [ $RC -ne 0 ]; then
+    mv "$PREV_PROTO" "$PROTO_FILE"
+    exit $RC
+  fi
+  rm -f "$PREV_PROTO"
+fi
+sync_field_lock "$PROTO_FILE"
 echo "Created service proto: $PROTO_FILE"
 
 # Generate Go service stub
@@ -705,15 +2357,23 @@ package services
 
 import (
 	"context"
+	"${MODULE_PATH}/internal/watch"
 	"${MODULE_PATH}/pb"
+
+	"go.mongodb.org/mongo-driver/mongo"
 )
 
 type ${SERVICE_NAME}Service struct {
 	pb.Unimplemented${SERVICE_NAME}ServiceServer
+	${SERVICE_NAME_LC_PLURAL} *watch.Watcher // nil without a database
 }
 
-func New${SERVICE_NAME}Service() *${SERVICE_NAME}Service {
-	return &${SERVICE_NAME}Service{}
+func New${SERVICE_NAME}Service(db *mongo.Database) *${SERVICE_NAME}Service {
+	s := &${SERVICE_NAME}Service{}
+	if db != nil {
+		s.${SERVICE_NAME_LC_PLURAL} = &watch.Watcher{Collection: db.Collection("${SERVICE_NAME_LC_PLURAL}"), Entity: &pb.${SERVICE_NAME}{}}
+	}
+	return s
 }
 
 func (s *${SERVICE_NAME}Service) Create${SERVICE_NAME}(ctx context.Context, req *pb.Create${SERVICE_NAME}Request) (*pb.Create${SERVICE_NAME}Response, error) {
@@ -735,14 +2395,146 @@ func (s *${SERVICE_NAME}Service) Delete${SERVICE_NAME}(ctx context.Context, req
 func (s *${SERVICE_NAME}Service) List${SERVICE_NAME_PLURAL}(ctx context.Context, req *pb.List${SERVICE_NAME_PLURAL}Request) (*pb.List${SERVICE_NAME_PLURAL}Response, error) {
 	return &pb.List${SERVICE_NAME_PLURAL}Response{}, nil
 }
+
+// Watch${SERVICE_NAME} streams the changes to the ${SERVICE_NAME_LC_PLURAL} collection that match the
+// request's filter, as created, updated and deleted events
+func (s *${SERVICE_NAME}Service) Watch${SERVICE_NAME}(req *pb.Watch${SERVICE_NAME}Request, stream pb.${SERVICE_NAME}Service_Watch${SERVICE_NAME}Server) error {
+	return s.${SERVICE_NAME_LC_PLURAL}.Watch(stream, req.GetFilter(), req.GetResumeToken(), func(c watch.Change) error {
+		event := &pb.${SERVICE_NAME}Event{Type: pb.${SERVICE_NAME}Event_Type(c.Op), Id: c.ID, ResumeToken: c.Token}
+		event.Data, _ = c.Data.(*pb.${SERVICE_NAME})
+		return stream.Send(event)
+	})
+}
 EOF
   echo "Created Go service stub: $GO_FILE"
 else
   echo "Go service stub already exists: $GO_FILE"
 fi
 
+# Generate bufconn and gateway tests for the CRUD RPCs
+TEST_FILE="services/${SERVICE_NAME_LC}_test.go"
+if [ ! -f "$TEST_FILE" ]; then
+cat > "$TEST_FILE" <<EOF
+package services
+
+import (
+	"context"
+	"${MODULE_PATH}/pb"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/grpc-ecosystem/grpc-gateway/v2/runtime"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/status"
+	"google.golang.org/grpc/test/bufconn"
+)
+
+// dial${SERVICE_NAME}Service starts ${SERVICE_NAME}Service on an in-memory listener and returns a client connection to it.
+func dial${SERVICE_NAME}Service(t *testing.T) *grpc.ClientConn {
+	t.Helper()
+	lis := bufconn.Listen(1024 * 1024)
+	grpcServer := grpc.NewServer()
+	pb.Register${SERVICE_NAME}ServiceServer(grpcServer, New${SERVICE_NAME}Service(nil))
+	go grpcServer.Serve(lis)
+	t.Cleanup(grpcServer.Stop)
+
+	conn, err := grpc.NewClient("passthrough:///bufnet",
+		grpc.WithContextDialer(func(ctx context.Context, _ string) (net.Conn, error) {
+			return lis.DialContext(ctx)
+		}),
+		grpc.WithTransportCredentials(insecure.NewCredentials()),
+	)
+	if err != nil {
+		t.Fatalf("failed to dial bufconn: %v", err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	return conn
+}
+
+func Test${SERVICE_NAME}ServiceRPCs(t *testing.T) {
+	client := pb.New${SERVICE_NAME}ServiceClient(dial${SERVICE_NAME}Service(t))
+	ctx := context.Background()
+
+	t.Run("Create${SERVICE_NAME}", func(t *testing.T) {
+		if _, err := client.Create${SERVICE_NAME}(ctx, &pb.Create${SERVICE_NAME}Request{Data: &pb.${SERVICE_NAME}{}}); err != nil {
+			t.Errorf("Create${SERVICE_NAME} returned error: %v", err)
+		}
+	})
+	t.Run("Get${SERVICE_NAME}", func(t *testing.T) {
+		if _, err := client.Get${SERVICE_NAME}(ctx, &pb.Get${SERVICE_NAME}Request{Id: "test-id"}); err != nil {
+			t.Errorf("Get${SERVICE_NAME} returned error: %v", err)
+		}
+	})
+	t.Run("Update${SERVICE_NAME}", func(t *testing.T) {
+		if _, err := client.Update${SERVICE_NAME}(ctx, &pb.Update${SERVICE_NAME}Request{Data: &pb.${SERVICE_NAME}{Id: "test-id"}}); err != nil {
+			t.Errorf("Update${SERVICE_NAME} returned error: %v", err)
+		}
+	})
+	t.Run("Delete${SERVICE_NAME}", func(t *testing.T) {
+		if _, err := client.Delete${SERVICE_NAME}(ctx, &pb.Delete${SERVICE_NAME}Request{Id: "test-id"}); err != nil {
+			t.Errorf("Delete${SERVICE_NAME} returned error: %v", err)
+		}
+	})
+	t.Run("List${SERVICE_NAME_PLURAL}", func(t *testing.T) {
+		if _, err := client.List${SERVICE_NAME_PLURAL}(ctx, &pb.List${SERVICE_NAME_PLURAL}Request{}); err != nil {
+			t.Errorf("List${SERVICE_NAME_PLURAL} returned error: %v", err)
+		}
+	})
+	t.Run("Watch${SERVICE_NAME}", func(t *testing.T) {
+		stream, err := client.Watch${SERVICE_NAME}(ctx, &pb.Watch${SERVICE_NAME}Request{})
+		if err == nil {
+			_, err = stream.Recv()
+		}
+		if status.Code(err) != codes.FailedPrecondition {
+			t.Errorf("Watch${SERVICE_NAME} without a database = %v, want FailedPrecondition", err)
+		}
+	})
+}
+
+func Test${SERVICE_NAME}ServiceGateway(t *testing.T) {
+	mux := runtime.NewServeMux()
+	if err := pb.Register${SERVICE_NAME}ServiceHandler(context.Background(), mux, dial${SERVICE_NAME}Service(t)); err != nil {
+		t.Fatalf("failed to register gateway handler: %v", err)
+	}
+
+	tests := []struct {
+		method string
+		path   string
+		body   string
+	}{
+		{http.MethodPost, "/v1/${SERVICE_NAME_LC_PLURAL}", \`{"data":{}}\`},
+		{http.MethodGet, "/v1/${SERVICE_NAME_LC_PLURAL}/test-id", ""},
+		{http.MethodPut, "/v1/${SERVICE_NAME_LC_PLURAL}/test-id", \`{"data":{"id":"test-id"}}\`},
+		{http.MethodDelete, "/v1/${SERVICE_NAME_LC_PLURAL}/test-id", ""},
+		{http.MethodGet, "/v1/${SERVICE_NAME_LC_PLURAL}", ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.method+" "+tt.path, func(t *testing.T) {
+			req := httptest.NewRequest(tt.method, tt.path, strings.NewReader(tt.body))
+			req.Header.Set("Content-Type", "application/json")
+			rr := httptest.NewRecorder()
+			mux.ServeHTTP(rr, req)
+
+			if rr.Code != http.StatusOK {
+				t.Errorf("%s %s returned status %d: %s", tt.method, tt.path, rr.Code, rr.Body.String())
+			}
+		})
+	}
+}
+EOF
+  echo "Created Go service tests: $TEST_FILE"
+else
+  echo "Go service tests already exist: $TEST_FILE"
+fi
+
 # Generate model file
 MODEL_FILE="models/${SERVICE_NAME_LC}.go"
+mkdir -p models
 if [ ! -f "$MODEL_FILE" ]; then
 cat > "$MODEL_FILE" <<EOF
 package models
@@ -751,7 +2543,7 @@ import (
 	"time"
 	"go.mongodb.org/mongo-driver/bson/primitive"
 	"${MODULE_PATH}/pb"
-)
+${MODEL_IMPORTS})
 
 // ${SERVICE_NAME} represents the ${SERVICE_NAME_LC} entity in the database
 type ${SERVICE_NAME} struct {
@@ -759,66 +2551,10 @@ type ${SERVICE_NAME} struct {
 EOF
 
 # Add fields to model struct
-FIELD_NUM=2
-IFS=',' read -ra FIELDS <<< "$FIELDS_RAW"
+IFS=';' read -ra FIELDS <<< "$(split_fields "$FIELDS_RAW")"
 for FIELD in "${FIELDS[@]}"; do
-  RAW_TRIMMED="$(echo "$FIELD" | xargs)"
-  [ -z "$RAW_TRIMMED" ] && continue
-
-  NAME=""
-  TYPE_RAW=""
-  IS_REPEATED=0
-
-  if [[ "$RAW_TRIMMED" == *:* ]]; then
-    NAME="$(echo "$RAW_TRIMMED" | cut -d: -f1 | xargs)"
-    TYPE_RAW="$(echo "$RAW_TRIMMED" | cut -d: -f2- | xargs)"
-    case "$TYPE_RAW" in
-      repeated\ *)
-        IS_REPEATED=1
-        TYPE_RAW="${TYPE_RAW#repeated }"
-        ;;
-      Repeated\ *)
-        IS_REPEATED=1
-        TYPE_RAW="${TYPE_RAW#Repeated }"
-        ;;
-    esac
-  else
-    if [[ "$RAW_TRIMMED" =~ ^[Rr]epeated[[:space:]]+([^[:space:]]+)[[:space:]]+([a-z][A-Za-z0-9_]*)$ ]]; then
-      IS_REPEATED=1
-      TYPE_RAW="${BASH_REMATCH[1]}"
-      NAME="${BASH_REMATCH[2]}"
-    fi
-  fi
-
-  TYPE_NORM="$(normalize_type "$TYPE_RAW")"
-  
-  # Map proto types to Go types
-  GO_TYPE=""
-  case "$TYPE_NORM" in
-    string) GO_TYPE="string" ;;
-    int32) GO_TYPE="int32" ;;
-    int64) GO_TYPE="int64" ;;
-    bool) GO_TYPE="bool" ;;
-    float) GO_TYPE="float32" ;;
-    double) GO_TYPE="float64" ;;
-    bytes) GO_TYPE="[]byte" ;;
-    google.protobuf.Timestamp) GO_TYPE="time.Time" ;;
-    *) GO_TYPE="string" ;; # Default to string for custom types
-  esac
-  
-  if [ $IS_REPEATED -eq 1 ]; then
-    if [ "$GO_TYPE" = "string" ]; then
-      GO_TYPE="[]string"
-    else
-      GO_TYPE="[]$GO_TYPE"
-    fi
-  fi
-  
-  # Convert snake_case to camelCase for Go struct field name
-  FIELD_NAME="$(snake_to_camel "$NAME")"
-  # Ensure first letter is uppercase for exported field (keep camelCase)
-  FIELD_NAME="$(echo "$FIELD_NAME" | awk '{print toupper(substr($0,1,1)) substr($0,2)}')"
-  echo "	${FIELD_NAME} ${GO_TYPE} \`json:\"${NAME}\" bson:\"${NAME}\"\`" >> "$MODEL_FILE"
+  parse_field_spec "$FIELD" || continue
+  model_field_lines "$NAME" "$TYPE_RAW" "$IS_REPEATED" >> "$MODEL_FILE"
 done
 
 cat >> "$MODEL_FILE" <<EOF
@@ -841,63 +2577,20 @@ func (m *${SERVICE_NAME}) ToProto() *pb.${SERVICE_NAME} {
 		Id: m.ID,
 EOF
 
-# Add field mappings for ToProto
-FIELD_NUM=2
-IFS=',' read -ra FIELDS <<< "$FIELDS_RAW"
+# Add field mappings for ToProto; oneof wrappers and nullable values are
+# assigned after the struct literal
+TO_PROTO_POST=""
+IFS=';' read -ra FIELDS <<< "$(split_fields "$FIELDS_RAW")"
 for FIELD in "${FIELDS[@]}"; do
-  RAW_TRIMMED="$(echo "$FIELD" | xargs)"
-  [ -z "$RAW_TRIMMED" ] && continue
-
-  NAME=""
-  TYPE_RAW=""
-  IS_REPEATED=0
-
-  if [[ "$RAW_TRIMMED" == *:* ]]; then
-    NAME="$(echo "$RAW_TRIMMED" | cut -d: -f1 | xargs)"
-    TYPE_RAW="$(echo "$RAW_TRIMMED" | cut -d: -f2- | xargs)"
-    case "$TYPE_RAW" in
-      repeated\ *)
-        IS_REPEATED=1
-        TYPE_RAW="${TYPE_RAW#repeated }"
-        ;;
-      Repeated\ *)
-        IS_REPEATED=1
-        TYPE_RAW="${TYPE_RAW#Repeated }"
-        ;;
-    esac
-  else
-    if [[ "$RAW_TRIMMED" =~ ^[Rr]epeated[[:space:]]+([^[:space:]]+)[[:space:]]+([a-z][A-Za-z0-9_]*)$ ]]; then
-      IS_REPEATED=1
-      TYPE_RAW="${BASH_REMATCH[1]}"
-      NAME="${BASH_REMATCH[2]}"
-    fi
-  fi
-
-  TYPE_NORM="$(normalize_type "$TYPE_RAW")"
-  
-  # Generate field mapping
-  if [ $IS_REPEATED -eq 1 ]; then
-    FIELD_NAME="$(snake_to_camel "$NAME")"
-    FIELD_NAME="$(echo "$FIELD_NAME" | awk '{print toupper(substr($0,1,1)) substr($0,2)}')"
-    echo "		${FIELD_NAME}: m.${FIELD_NAME}," >> "$MODEL_FILE"
-  else
-    case "$TYPE_NORM" in
-      google.protobuf.Timestamp)
-        FIELD_NAME="$(snake_to_camel "$NAME")"
-        FIELD_NAME="$(echo "$FIELD_NAME" | awk '{print toupper(substr($0,1,1)) substr($0,2)}')"
-        echo "		${FIELD_NAME}: timestamppb.New(m.${FIELD_NAME})," >> "$MODEL_FILE"
-        ;;
-      *)
-        FIELD_NAME="$(snake_to_camel "$NAME")"
-        FIELD_NAME="$(echo "$FIELD_NAME" | awk '{print toupper(substr($0,1,1)) substr($0,2)}')"
-        echo "		${FIELD_NAME}: m.${FIELD_NAME}," >> "$MODEL_FILE"
-        ;;
-    esac
-  fi
+  parse_field_spec "$FIELD" || continue
+  model_conversion to "$NAME" "$TYPE_RAW" "$IS_REPEATED" "$SERVICE_NAME"
+  [ -n "$CONV_LINE" ] && echo "$CONV_LINE" >> "$MODEL_FILE"
+  TO_PROTO_POST+="$CONV_POST"
 done
 
+echo "	}" >> "$MODEL_FILE"
+printf '%b' "$TO_PROTO_POST" >> "$MODEL_FILE"
 cat >> "$MODEL_FILE" <<EOF
-	}
 	return proto
 }
 
@@ -912,65 +2605,22 @@ func ${SERVICE_NAME}FromProto(p *pb.${SERVICE_NAME}) *${SERVICE_NAME} {
 EOF
 
 # Add field mappings for FromProto
-FIELD_NUM=2
-IFS=',' read -ra FIELDS <<< "$FIELDS_RAW"
+FROM_PROTO_POST=""
+IFS=';' read -ra FIELDS <<< "$(split_fields "$FIELDS_RAW")"
 for FIELD in "${FIELDS[@]}"; do
-  RAW_TRIMMED="$(echo "$FIELD" | xargs)"
-  [ -z "$RAW_TRIMMED" ] && continue
-
-  NAME=""
-  TYPE_RAW=""
-  IS_REPEATED=0
-
-  if [[ "$RAW_TRIMMED" == *:* ]]; then
-    NAME="$(echo "$RAW_TRIMMED" | cut -d: -f1 | xargs)"
-    TYPE_RAW="$(echo "$RAW_TRIMMED" | cut -d: -f2- | xargs)"
-    case "$TYPE_RAW" in
-      repeated\ *)
-        IS_REPEATED=1
-        TYPE_RAW="${TYPE_RAW#repeated }"
-        ;;
-      Repeated\ *)
-        IS_REPEATED=1
-        TYPE_RAW="${TYPE_RAW#Repeated }"
-        ;;
-    esac
-  else
-    if [[ "$RAW_TRIMMED" =~ ^[Rr]epeated[[:space:]]+([^[:space:]]+)[[:space:]]+([a-z][A-Za-z0-9_]*)$ ]]; then
-      IS_REPEATED=1
-      TYPE_RAW="${BASH_REMATCH[1]}"
-      NAME="${BASH_REMATCH[2]}"
-    fi
-  fi
-
-  TYPE_NORM="$(normalize_type "$TYPE_RAW")"
-  
-  # Generate field mapping
-  if [ $IS_REPEATED -eq 1 ]; then
-    FIELD_NAME="$(snake_to_camel "$NAME")"
-    FIELD_NAME="$(echo "$FIELD_NAME" | awk '{print toupper(substr($0,1,1)) substr($0,2)}')"
-    echo "		${FIELD_NAME}: p.${FIELD_NAME}," >> "$MODEL_FILE"
-  else
-    case "$TYPE_NORM" in
-      google.protobuf.Timestamp)
-        FIELD_NAME="$(snake_to_camel "$NAME")"
-        FIELD_NAME="$(echo "$FIELD_NAME" | awk '{print toupper(substr($0,1,1)) substr($0,2)}')"
-        echo "		${FIELD_NAME}: p.Get${FIELD_NAME}().AsTime()," >> "$MODEL_FILE"
-        ;;
-      *)
-        FIELD_NAME="$(snake_to_camel "$NAME")"
-        FIELD_NAME="$(echo "$FIELD_NAME" | awk '{print toupper(substr($0,1,1)) substr($0,2)}')"
-        echo "		${FIELD_NAME}: p.${FIELD_NAME}," >> "$MODEL_FILE"
-        ;;
-    esac
-  fi
+  parse_field_spec "$FIELD" || continue
+  model_conversion from "$NAME" "$TYPE_RAW" "$IS_REPEATED" "$SERVICE_NAME"
+  [ -n "$CONV_LINE" ] && echo "$CONV_LINE" >> "$MODEL_FILE"
+  FROM_PROTO_POST+="$CONV_POST"
 done
 
 cat >> "$MODEL_FILE" <<EOF
 		CreatedAt: time.Now(),
 		UpdatedAt: time.Now(),
 	}
-	
+EOF
+printf '%b' "$FROM_PROTO_POST" >> "$MODEL_FILE"
+cat >> "$MODEL_FILE" <<EOF
 	return m
 }
 
@@ -979,6 +2629,9 @@ func (${SERVICE_NAME}) CollectionName() string {
 	return "${SERVICE_NAME_LC_PLURAL}"
 }
 EOF
+  for DECL in "${ENUM_DECLS[@]}"; do
+    ensure_go_enum "$MODEL_FILE" "${DECL%%=*}" "${DECL#*=}"
+  done
   echo "Created model file: $MODEL_FILE"
 else
   echo "Model file already exists: $MODEL_FILE"
@@ -986,7 +2639,7 @@ fi
 
 # Register in server/grpc.go
 GRPC_GO="server/grpc.go"
-GRPC_REG="pb.Register${SERVICE_NAME}ServiceServer(grpcServer, services.New${SERVICE_NAME}Service())"
+GRPC_REG="pb.Register${SERVICE_NAME}ServiceServer(grpcServer, services.New${SERVICE_NAME}Service(client.Database(dbName)))"
 grep -q "$GRPC_REG" "$GRPC_GO" || \
   sed -i '' "/grpcServer := grpc.NewServer()/a\\
 $GRPC_REG
@@ -0,0 +1,266 @@
+package generator
+
+import (
+	"fmt"
+	"strings"
+
+	"google.golang.org/protobuf/reflect/protoreflect"
+
+	"grpc_anotation_sample/protoset"
+)
+
+// Service describes a service declared in proto/. Name is the generator's
+// name for it (Book for BookService) and Fields lists the entity message's
+// fields in the field DSL.
+type Service struct {
+	Name     string    `json:"name"`
+	FullName string    `json:"fullName"`
+	File     string    `json:"file"`
+	Entity   string    `json:"entity,omitempty"`
+	Fields   []string  `json:"fields"`
+	RPCs     []RPC     `json:"rpcs"`
+	Messages []Message `json:"messages"`
+}
+
+// RPC describes one method of a discovered service.
+type RPC struct {
+	Name            string                 `json:"name"`
+	Request         string                 `json:"request"`
+	Response        string                 `json:"response"`
+	ClientStreaming bool                   `json:"clientStreaming,omitempty"`
+	ServerStreaming bool                   `json:"serverStreaming,omitempty"`
+	HTTP            []protoset.HTTPBinding `json:"http,omitempty"`
+}
+
+// Message describes a message used by a service's RPCs, directly or through
+// its fields. Nested lists the messages declared inside it.
+type Message struct {
+	Name   string    `json:"name"`
+	Fields []Field   `json:"fields"`
+	Nested []Message `json:"nested,omitempty"`
+}
+
+// Field is one message field. Type is the proto type name; DSL is the same
+// field in the syntax gen_service.sh accepts.
+type Field struct {
+	Name   string `json:"name"`
+	Number int32  `json:"number"`
+	Type   string `json:"type"`
+	Label  string `json:"label,omitempty"`
+	Oneof  string `json:"oneof,omitempty"`
+	DSL    string `json:"dsl"`
+}
+
+// Discover compiles the protos in protoDir and returns every service they declare.
+func Discover(protoDir string) ([]Service, error) {
+	set, err := protoset.Compile(protoDir)
+	if err != nil {
+		return nil, fmt.Errorf("failed to compile protos: %v", err)
+	}
+
+	var services []Service
+	for _, file := range set.Project() {
+		svcs := file.Services()
+		for i := 0; i < svcs.Len(); i++ {
+			services = append(services, describeService(file, svcs.Get(i)))
+		}
+	}
+	return services, nil
+}
+
+func describeService(file protoreflect.FileDescriptor, sd protoreflect.ServiceDescriptor) Service {
+	name := string(sd.Name())
+	if base := strings.TrimSuffix(name, "Service"); base != "" {
+		name = base
+	}
+	svc := Service{
+		Name:     name,
+		FullName: string(sd.FullName()),
+		File:     file.Path(),
+		Fields:   []string{},
+	}
+
+	// The entity is the message gen_service.sh names after the service
+	if entity := file.Messages().ByName(protoreflect.Name(name)); entity != nil {
+		svc.Entity = string(entity.Name())
+		svc.Fields = dslFields(entity)
+	}
+
+	seen := map[protoreflect.FullName]bool{}
+	methods := sd.Methods()
+	for i := 0; i < methods.Len(); i++ {
+		md := methods.Get(i)
+		svc.RPCs = append(svc.RPCs, RPC{
+			Name:            string(md.Name()),
+			Request:         string(md.Input().Name()),
+			Response:        string(md.Output().Name()),
+			ClientStreaming: md.IsStreamingClient(),
+			ServerStreaming: md.IsStreamingServer(),
+			HTTP:            protoset.Bindings(md),
+		})
+		svc.Messages = collectMessages(svc.Messages, md.Input(), file, seen)
+		svc.Messages = collectMessages(svc.Messages, md.Output(), file, seen)
+	}
+	return svc
+}
+
+// collectMessages appends md and the project messages its fields refer to, in
+// first-use order. Well-known and imported types outside the project are skipped.
+func collectMessages(out []Message, md protoreflect.MessageDescriptor, file protoreflect.FileDescriptor, seen map[protoreflect.FullName]bool) []Message {
+	if seen[md.FullName()] || md.ParentFile().Package() != file.Package() || md.IsMapEntry() {
+		return out
+	}
+	seen[md.FullName()] = true
+	// Nested messages are reported inside their parent
+	if _, nested := md.Parent().(protoreflect.MessageDescriptor); !nested {
+		out = append(out, describeMessage(md))
+	}
+
+	fields := md.Fields()
+	for i := 0; i < fields.Len(); i++ {
+		fd := fields.Get(i)
+		if fd.IsMap() {
+			fd = fd.MapValue()
+		}
+		if fd.Message() != nil {
+			out = collectMessages(out, fd.Message(), file, seen)
+		}
+	}
+	return out
+}
+
+func describeMessage(md protoreflect.MessageDescriptor) Message {
+	msg := Message{Name: string(md.Name()), Fields: []Field{}}
+	fields := md.Fields()
+	for i := 0; i < fields.Len(); i++ {
+		fd := fields.Get(i)
+		f := Field{
+			Name:   string(fd.Name()),
+			Number: int32(fd.Number()),
+			Type:   protoTypeName(fd),
+			DSL:    fmt.Sprintf("%s:%s", fd.Name(), dslType(fd)),
+		}
+		switch {
+		case fd.IsList():
+			f.Label = "repeated"
+		case fd.HasOptionalKeyword():
+			f.Label = "optional"
+		}
+		if oneof := fd.ContainingOneof(); oneof != nil && !oneof.IsSynthetic() {
+			f.Oneof = string(oneof.Name())
+		}
+		msg.Fields = append(msg.Fields, f)
+	}
+	nested := md.Messages()
+	for i := 0; i < nested.Len(); i++ {
+		if !nested.Get(i).IsMapEntry() {
+			msg.Nested = append(msg.Nested, describeMessage(nested.Get(i)))
+		}
+	}
+	return msg
+}
+
+// dslFields renders the entity's fields (except id) in the field DSL; oneof
+// members are grouped into a single name:oneof{a:t|b:t} entry.
+func dslFields(md protoreflect.MessageDescriptor) []string {
+	fields := []string{}
+	done := map[protoreflect.Name]bool{}
+	list := md.Fields()
+	for i := 0; i < list.Len(); i++ {
+		fd := list.Get(i)
+		if fd.Name() == "id" {
+			continue
+		}
+		oneof := fd.ContainingOneof()
+		if oneof == nil || oneof.IsSynthetic() {
+			fields = append(fields, fmt.Sprintf("%s:%s", fd.Name(), dslType(fd)))
+			continue
+		}
+		if done[oneof.Name()] {
+			continue
+		}
+		done[oneof.Name()] = true
+		var variants []string
+		for j := 0; j < oneof.Fields().Len(); j++ {
+			v := oneof.Fields().Get(j)
+			variants = append(variants, fmt.Sprintf("%s:%s", v.Name(), dslType(v)))
+		}
+		fields = append(fields, fmt.Sprintf("%s:oneof{%s}", oneof.Name(), strings.Join(variants, "|")))
+	}
+	return fields
+}
+
+// dslType renders a field's type in the field DSL gen_service.sh accepts, so the
+// fields listed by the UI can be fed back into the generator unchanged.
+func dslType(fd protoreflect.FieldDescriptor) string {
+	if fd.IsMap() {
+		return fmt.Sprintf("map<%s,%s>", scalarDSL(fd.MapKey()), scalarDSL(fd.MapValue()))
+	}
+	t := scalarDSL(fd)
+	if fd.IsList() {
+		t = "repeated " + t
+	}
+	return t
+}
+
+func scalarDSL(fd protoreflect.FieldDescriptor) string {
+	switch fd.Kind() {
+	case protoreflect.MessageKind, protoreflect.GroupKind:
+		if scalar := protoset.WrapperScalar(fd.Message().FullName()); scalar != "" {
+			return scalar + "?"
+		}
+		return messageTypeName(fd.Message())
+	case protoreflect.EnumKind:
+		ed := fd.Enum()
+		prefix := enumPrefix(string(ed.Name())) + "_"
+		var values []string
+		for i := 0; i < ed.Values().Len(); i++ {
+			v := strings.TrimPrefix(string(ed.Values().Get(i).Name()), prefix)
+			if ed.Values().Get(i).Number() != 0 {
+				values = append(values, v)
+			}
+		}
+		return fmt.Sprintf("%s{%s}", ed.Name(), strings.Join(values, ","))
+	default:
+		return fd.Kind().String()
+	}
+}
+
+// protoTypeName returns the type as written in the .proto file.
+func protoTypeName(fd protoreflect.FieldDescriptor) string {
+	if fd.IsMap() {
+		return fmt.Sprintf("map<%s, %s>", protoTypeName(fd.MapKey()), protoTypeName(fd.MapValue()))
+	}
+	switch fd.Kind() {
+	case protoreflect.MessageKind, protoreflect.GroupKind:
+		return messageTypeName(fd.Message())
+	case protoreflect.EnumKind:
+		return string(fd.Enum().Name())
+	default:
+		return fd.Kind().String()
+	}
+}
+
+// messageTypeName keeps the package for well-known types (google.protobuf.Timestamp)
+// and drops it for the project's own messages.
+func messageTypeName(md protoreflect.MessageDescriptor) string {
+	if strings.HasPrefix(string(md.FullName()), "google.") {
+		return string(md.FullName())
+	}
+	return strings.TrimPrefix(string(md.FullName()), string(md.ParentFile().Package())+".")
+}
+
+// enumPrefix returns the value prefix gen_service.sh uses for an enum: OrderStatus -> ORDER_STATUS
+func enumPrefix(name string) string {
+	var b strings.Builder
+	for i, r := range name {
+		if i > 0 && r >= 'A' && r <= 'Z' {
+			prev := name[i-1]
+			if (prev >= 'a' && prev <= 'z') || (prev >= '0' && prev <= '9') {
+				b.WriteByte('_')
+			}
+		}
+		b.WriteRune(r)
+	}
+	return strings.ToUpper(b.String())
+}
@@ -0,0 +1,121 @@
+package generator
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+const articleProto = `syntax = "proto3";
+
+package pb;
+
+import "google/api/annotations.proto";
+import "google/protobuf/duration.proto";
+import "google/protobuf/wrappers.proto";
+
+message Article {
+  string id = 1;
+  string title = 2;
+  map<string, string> labels = 3;
+  oneof payload {
+    string text = 4;
+    bytes image = 5;
+  }
+  google.protobuf.Duration ttl = 6;
+  google.protobuf.StringValue nickname = 7;
+  Status status = 8;
+  repeated string tags = 9;
+  Meta meta = 10;
+}
+
+enum Status {
+  STATUS_UNSPECIFIED = 0;
+  STATUS_DRAFT = 1;
+  STATUS_LIVE = 2;
+}
+
+message Meta {
+  message Source { string url = 1; }
+  Source source = 1;
+}
+
+message GetArticleRequest { string id = 1; }
+message GetArticleResponse { Article data = 1; }
+message WatchRequest {}
+
+service ArticleService {
+  rpc GetArticle(GetArticleRequest) returns (GetArticleResponse) {
+    option (google.api.http) = { get: "/v1/articles/{id}" };
+  }
+  rpc Watch(WatchRequest) returns (stream Article);
+}
+
+service Health {
+  rpc Check(WatchRequest) returns (WatchRequest);
+}
+`
+
+func TestDiscover(t *testing.T) {
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, "article.proto"), []byte(articleProto), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	services, err := Discover(dir)
+	if err != nil {
+		t.Fatalf("Discover: %v", err)
+	}
+	if len(services) != 2 {
+		t.Fatalf("got %d services, want 2", len(services))
+	}
+
+	article := services[0]
+	if article.Name != "Article" || article.FullName != "pb.ArticleService" || article.Entity != "Article" {
+		t.Errorf("article service = %s (%s, entity %q)", article.Name, article.FullName, article.Entity)
+	}
+	wantFields := []string{
+		"title:string",
+		"labels:map<string,string>",
+		"payload:oneof{text:string|image:bytes}",
+		"ttl:google.protobuf.Duration",
+		"nickname:string?",
+		"status:Status{DRAFT,LIVE}",
+		"tags:repeated string",
+		"meta:Meta",
+	}
+	if !reflect.DeepEqual(article.Fields, wantFields) {
+		t.Errorf("fields = %q, want %q", article.Fields, wantFields)
+	}
+
+	if len(article.RPCs) != 2 {
+		t.Fatalf("got %d RPCs, want 2", len(article.RPCs))
+	}
+	get := article.RPCs[0]
+	if get.Request != "GetArticleRequest" || get.Response != "GetArticleResponse" ||
+		len(get.HTTP) != 1 || get.HTTP[0].String() != "GET /v1/articles/{id}" {
+		t.Errorf("GetArticle = %+v", get)
+	}
+	if watch := article.RPCs[1]; !watch.ServerStreaming || watch.ClientStreaming || watch.HTTP != nil {
+		t.Errorf("Watch = %+v", watch)
+	}
+
+	var names []string
+	for _, m := range article.Messages {
+		names = append(names, m.Name)
+	}
+	wantNames := []string{"GetArticleRequest", "GetArticleResponse", "Article", "Meta", "WatchRequest"}
+	if !reflect.DeepEqual(names, wantNames) {
+		t.Errorf("messages = %q, want %q", names, wantNames)
+	}
+	meta := article.Messages[3]
+	if len(meta.Nested) != 1 || meta.Nested[0].Name != "Source" || meta.Fields[0].Type != "Meta.Source" {
+		t.Errorf("Meta = %+v", meta)
+	}
+
+	health := services[1]
+	if health.Name != "Health" || health.Entity != "" || len(health.Fields) != 0 {
+		t.Errorf("health service = %+v", health)
+	}
+}
@@ -0,0 +1,308 @@
+// Package generator validates and applies service changes through
+// gen_service.sh. The UI and the MCP server both go through it, so a change
+// is checked and run the same way whichever tool asks for it.
+package generator
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+)
+
+// ExitBreaking is the exit code gen_service.sh uses when it refuses a breaking change
+const ExitBreaking = 3
+
+// ErrBreaking is returned by Apply when gen_service.sh refused the change
+// because it would break clients of proto/baseline.binpb.
+var ErrBreaking = errors.New("change would break existing clients")
+
+// Change is one validated gen_service.sh invocation. Action names it in
+// messages ("add RPC"); Success describes the applied change. Force sets
+// FORCE=1 to override the breaking-change guard.
+type Change struct {
+	Action  string
+	Args    []string
+	Success string
+	Force   bool
+}
+
+// CreateService creates a service with an entity message of fields
+func CreateService(name, fields string) (Change, *ValidationError) {
+	if err := ValidateName("serviceName", name); err != nil {
+		return Change{}, err
+	}
+	if err := ValidateFieldList("serviceFields", fields); err != nil {
+		return Change{}, err
+	}
+	return Change{
+		Action:  "create service",
+		Args:    []string{name, fields},
+		Success: fmt.Sprintf("Service '%s' created successfully with fields: %s", name, fields),
+	}, nil
+}
+
+// RemoveService removes a service and its generated files
+func RemoveService(name string) (Change, *ValidationError) {
+	if err := ValidateName("serviceName", name); err != nil {
+		return Change{}, err
+	}
+	return Change{
+		Action:  "remove service",
+		Args:    []string{"remove", name},
+		Success: fmt.Sprintf("Service '%s' removed successfully", name),
+	}, nil
+}
+
+// AddRPC adds an RPC with request and response fields. stream is "" (or
+// "unary"), "server", "client" or "bidi". http is METHOD:/path and body, if
+// set, is "*" or a request field; a unary RPC needs http, while a streaming
+// one may go without. Server and bidi streams can only be bound to GET, where
+// the gateway serves them over a WebSocket, and client streams not at all.
+func AddRPC(service, rpc, reqFields, resFields, stream, http, body string) (Change, *ValidationError) {
+	if err := ValidateNames("serviceName", service, "rpcName", rpc); err != nil {
+		return Change{}, err
+	}
+	for _, list := range [][2]string{{"reqFields", reqFields}, {"resFields", resFields}} {
+		if err := ValidateFieldList(list[0], list[1]); err != nil {
+			return Change{}, err
+		}
+	}
+	stream = strings.ToLower(strings.TrimSpace(stream))
+	if stream == "unary" {
+		stream = ""
+	}
+	if err := ValidateStreamBinding(stream, http, body); err != nil {
+		return Change{}, err
+	}
+	args := []string{"add-rpc", service, rpc, reqFields, resFields}
+	if http != "" {
+		args = append(args, "http="+http)
+	}
+	if strings.TrimSpace(body) != "" {
+		args = append(args, "body="+body)
+	}
+	success := fmt.Sprintf("RPC '%s' added to '%s'", rpc, service)
+	if stream != "" {
+		args = append(args, "stream="+stream)
+		success = fmt.Sprintf("%s-streaming RPC '%s' added to '%s'", stream, rpc, service)
+	}
+	return Change{
+		Action:  "add RPC",
+		Args:    args,
+		Success: success,
+	}, nil
+}
+
+// AddNested adds a nested message with fields and a field of that type to the
+// service's entity; messageName overrides the generated message name.
+func AddNested(service, field, fields string, repeated bool, messageName string) (Change, *ValidationError) {
+	if err := ValidateNames("serviceName", service, "fieldName", field); err != nil {
+		return Change{}, err
+	}
+	if err := ValidateFieldList("fields", fields); err != nil {
+		return Change{}, err
+	}
+	messageName = strings.TrimSpace(messageName)
+	if messageName != "" {
+		if err := ValidateName("messageName", messageName); err != nil {
+			return Change{}, err
+		}
+	}
+	args := []string{"add-nested", service, field, fields}
+	if repeated {
+		args = append(args, "repeated")
+	}
+	if messageName != "" {
+		args = append(args, messageName)
+	}
+	return Change{
+		Action:  "add nested message",
+		Args:    args,
+		Success: "Nested message and field added",
+	}, nil
+}
+
+// EditField changes the type of a field of the entity or, if message is set,
+// of another message of the service.
+func EditField(service, field, typ, message string) (Change, *ValidationError) {
+	if err := ValidateNames("serviceName", service, "fieldName", field); err != nil {
+		return Change{}, err
+	}
+	if message != "" {
+		if err := ValidateName("message", message); err != nil {
+			return Change{}, err
+		}
+	}
+	if err := ValidateFieldType("type", typ); err != nil {
+		return Change{}, err
+	}
+	args := []string{"edit-field", service, field, typ}
+	if message != "" {
+		args = append(args, message)
+	}
+	return Change{
+		Action:  "change field type",
+		Args:    args,
+		Success: fmt.Sprintf("Field '%s' changed to %s", field, typ),
+	}, nil
+}
+
+// RenameField renames a field of the entity and adds a migration for stored documents
+func RenameField(service, field, newName string) (Change, *ValidationError) {
+	if err := ValidateNames("serviceName", service, "fieldName", field, "newName", newName); err != nil {
+		return Change{}, err
+	}
+	return Change{
+		Action:  "rename field",
+		Args:    []string{"add-migration", "rename", service, field, newName},
+		Success: fmt.Sprintf("Field '%s' renamed to '%s'", field, newName),
+	}, nil
+}
+
+// RemoveField removes a field and reserves its number
+func RemoveField(service, field, message string) (Change, *ValidationError) {
+	if err := ValidateNames("serviceName", service, "fieldName", field); err != nil {
+		return Change{}, err
+	}
+	args := []string{"remove-field", service, field}
+	if message != "" {
+		if err := ValidateName("message", message); err != nil {
+			return Change{}, err
+		}
+		args = append(args, message)
+	}
+	return Change{
+		Action:  "remove field",
+		Args:    args,
+		Success: fmt.Sprintf("Field '%s' removed and its number reserved", field),
+	}, nil
+}
+
+// RemoveRPC removes an RPC from a service
+func RemoveRPC(service, rpc string) (Change, *ValidationError) {
+	if err := ValidateNames("serviceName", service, "rpcName", rpc); err != nil {
+		return Change{}, err
+	}
+	return Change{
+		Action:  "remove RPC",
+		Args:    []string{"remove-rpc", service, rpc},
+		Success: fmt.Sprintf("RPC '%s' removed from '%s'", rpc, service),
+	}, nil
+}
+
+// SetHTTP replaces an RPC's HTTP binding; an empty method removes it.
+func SetHTTP(service, rpc, method, path, body string) (Change, *ValidationError) {
+	if err := ValidateNames("serviceName", service, "rpcName", rpc); err != nil {
+		return Change{}, err
+	}
+	if method == "" {
+		return Change{
+			Action:  "remove HTTP binding",
+			Args:    []string{"set-http", service, rpc, "none"},
+			Success: fmt.Sprintf("HTTP binding of '%s' removed", rpc),
+		}, nil
+	}
+	if path == "" {
+		return Change{}, Invalid("path", "required", "path is required with method")
+	}
+	if err := ValidateHTTP(method, path, body); err != nil {
+		return Change{}, err
+	}
+	args := []string{"set-http", service, rpc, fmt.Sprintf("http=%s:%s", method, path)}
+	if strings.TrimSpace(body) != "" {
+		args = append(args, "body="+body)
+	}
+	return Change{
+		Action:  "set HTTP binding",
+		Args:    args,
+		Success: fmt.Sprintf("HTTP binding of '%s' set to %s %s", rpc, strings.ToUpper(method), path),
+	}, nil
+}
+
+// Project is a checkout of this repository: Root holds gen_service.sh, the
+// Makefile and proto/.
+type Project struct {
+	Root string
+}
+
+// IsRoot reports whether dir contains gen_service.sh
+func IsRoot(dir string) bool {
+	info, err := os.Stat(filepath.Join(dir, "gen_service.sh"))
+	return err == nil && !info.IsDir()
+}
+
+// FindRoot looks for gen_service.sh in each of dirs and their parents
+func FindRoot(dirs ...string) (string, error) {
+	for _, dir := range dirs {
+		for {
+			if IsRoot(dir) {
+				return dir, nil
+			}
+			parent := filepath.Dir(dir)
+			if parent == dir {
+				break
+			}
+			dir = parent
+		}
+	}
+	return "", errors.New("project root not found: gen_service.sh is not in the directory or its parents")
+}
+
+// ProtoDir is the directory of the project's .proto files
+func (p Project) ProtoDir() string {
+	return filepath.Join(p.Root, "proto")
+}
+
+// Command runs gen_service.sh for c in the project root
+func (p Project) Command(ctx context.Context, c Change) *exec.Cmd {
+	cmd := exec.CommandContext(ctx, "./gen_service.sh", c.Args...)
+	cmd.Dir = p.Root
+	if c.Force {
+		cmd.Env = append(os.Environ(), "FORCE=1")
+	}
+	return cmd
+}
+
+// ProtoCommand runs `make proto` in the project root
+func (p Project) ProtoCommand(ctx context.Context) *exec.Cmd {
+	cmd := exec.CommandContext(ctx, "make", "--no-print-directory", "proto")
+	cmd.Dir = p.Root
+	return cmd
+}
+
+// IsBreaking reports whether err is gen_service.sh refusing a breaking change
+func IsBreaking(err error) bool {
+	var exitErr *exec.ExitError
+	return errors.As(err, &exitErr) && exitErr.ExitCode() == ExitBreaking
+}
+
+// Apply runs c and then regenerates the protos, returning the combined output
+// of both. A refused breaking change returns ErrBreaking.
+func (p Project) Apply(ctx context.Context, c Change) ([]byte, error) {
+	var out bytes.Buffer
+	cmd := p.Command(ctx, c)
+	cmd.Stdout, cmd.Stderr = &out, &out
+	if err := cmd.Run(); err != nil {
+		if IsBreaking(err) {
+			return out.Bytes(), ErrBreaking
+		}
+		return out.Bytes(), fmt.Errorf("failed to %s: %w", c.Action, err)
+	}
+	if err := p.Regenerate(ctx, &out); err != nil {
+		return out.Bytes(), fmt.Errorf("proto regeneration failed after %s: %w", c.Action, err)
+	}
+	return out.Bytes(), nil
+}
+
+// Regenerate runs `make proto`, writing its output to out
+func (p Project) Regenerate(ctx context.Context, out io.Writer) error {
+	cmd := p.ProtoCommand(ctx)
+	cmd.Stdout, cmd.Stderr = out, out
+	return cmd.Run()
+}
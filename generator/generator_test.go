@@ -0,0 +1,135 @@
+package generator
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// fakeProject creates a project whose gen_service.sh prints its arguments and
+// refuses "Breaking" without FORCE=1, and whose `make proto` prints "protoc".
+func fakeProject(t *testing.T) Project {
+	t.Helper()
+	root := t.TempDir()
+	script := `#!/bin/sh
+echo "gen $*"
+case "$*" in *Breaking*) [ "$FORCE" = 1 ] || { echo "json: field removed"; exit 3; } ;; esac
+case "$*" in *Broken*) echo "no such service" >&2; exit 1 ;; esac
+`
+	if err := os.WriteFile(filepath.Join(root, "gen_service.sh"), []byte(script), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(root, "Makefile"), []byte("proto:\n\t@echo protoc\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	return Project{Root: root}
+}
+
+func TestChanges(t *testing.T) {
+	tests := []struct {
+		name  string
+		build func() (Change, *ValidationError)
+		args  []string
+		field string
+	}{
+		{"create", func() (Change, *ValidationError) { return CreateService("Book", "title:string") },
+			[]string{"Book", "title:string"}, ""},
+		{"create injection", func() (Change, *ValidationError) { return CreateService("Book", "title:string;rm -rf ~") },
+			nil, "serviceFields"},
+		{"remove", func() (Change, *ValidationError) { return RemoveService("Book") },
+			[]string{"remove", "Book"}, ""},
+		{"add rpc", func() (Change, *ValidationError) {
+			return AddRPC("Book", "Search", "q:string", "books:repeated Book", "", "POST:/v1/books:search", "*")
+		}, []string{"add-rpc", "Book", "Search", "q:string", "books:repeated Book", "http=POST:/v1/books:search", "body=*"}, ""},
+		{"add rpc bad path", func() (Change, *ValidationError) {
+			return AddRPC("Book", "Search", "q:string", "n:int32", "", "GET:/v1/find&&id", "")
+		}, nil, "path"},
+		{"add server stream", func() (Change, *ValidationError) {
+			return AddRPC("Book", "Tail", "author:string", "title:string", "server", "GET:/v1/books:tail", "")
+		}, []string{"add-rpc", "Book", "Tail", "author:string", "title:string", "http=GET:/v1/books:tail", "stream=server"}, ""},
+		{"add client stream", func() (Change, *ValidationError) {
+			return AddRPC("Book", "ImportBooks", "title:string", "count:int32", "Client", "", "")
+		}, []string{"add-rpc", "Book", "ImportBooks", "title:string", "count:int32", "stream=client"}, ""},
+		{"add bidi stream bound to post", func() (Change, *ValidationError) {
+			return AddRPC("Book", "Chat", "text:string", "reply:string", "bidi", "POST:/v1/books:chat", "*")
+		}, nil, "method"},
+		{"add nested", func() (Change, *ValidationError) { return AddNested("Place", "location", "x:double", true, "Point") },
+			[]string{"add-nested", "Place", "location", "x:double", "repeated", "Point"}, ""},
+		{"add nested bad name", func() (Change, *ValidationError) { return AddNested("Place", "location", "x:double", false, "P\nEvil") },
+			nil, "messageName"},
+		{"edit field", func() (Change, *ValidationError) { return EditField("Book", "pages", "int64", "") },
+			[]string{"edit-field", "Book", "pages", "int64"}, ""},
+		{"rename field", func() (Change, *ValidationError) { return RenameField("Book", "pages", "page_count") },
+			[]string{"add-migration", "rename", "Book", "pages", "page_count"}, ""},
+		{"remove field", func() (Change, *ValidationError) { return RemoveField("Book", "pages", "Meta") },
+			[]string{"remove-field", "Book", "pages", "Meta"}, ""},
+		{"remove rpc", func() (Change, *ValidationError) { return RemoveRPC("Book", "Search`id`") },
+			nil, "rpcName"},
+		{"remove http", func() (Change, *ValidationError) { return SetHTTP("Book", "Search", "", "", "") },
+			[]string{"set-http", "Book", "Search", "none"}, ""},
+		{"set http without path", func() (Change, *ValidationError) { return SetHTTP("Book", "Search", "GET", "", "") },
+			nil, "path"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c, err := tt.build()
+			if tt.field != "" {
+				if err == nil || err.Field != tt.field {
+					t.Fatalf("error = %v, want one for %s", err, tt.field)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(c.Args, tt.args) {
+				t.Errorf("args = %q, want %q", c.Args, tt.args)
+			}
+		})
+	}
+}
+
+func TestApply(t *testing.T) {
+	p := fakeProject(t)
+	ctx := context.Background()
+
+	c, _ := CreateService("Book", "title:string")
+	out, err := p.Apply(ctx, c)
+	if err != nil || string(out) != "gen Book title:string\nprotoc\n" {
+		t.Errorf("Apply = %q, %v", out, err)
+	}
+
+	c, _ = RemoveService("Breaking")
+	out, err = p.Apply(ctx, c)
+	if !errors.Is(err, ErrBreaking) || !strings.Contains(string(out), "json: field removed") {
+		t.Errorf("Apply without force = %q, %v; want ErrBreaking", out, err)
+	}
+	c.Force = true
+	if out, err := p.Apply(ctx, c); err != nil || !strings.HasSuffix(string(out), "protoc\n") {
+		t.Errorf("Apply with force = %q, %v", out, err)
+	}
+
+	c, _ = RemoveService("Broken")
+	out, err = p.Apply(ctx, c)
+	if err == nil || errors.Is(err, ErrBreaking) || !strings.Contains(string(out), "no such service") {
+		t.Errorf("Apply of a failing change = %q, %v", out, err)
+	}
+}
+
+func TestFindRoot(t *testing.T) {
+	p := fakeProject(t)
+	nested := filepath.Join(p.Root, "ui", "static")
+	if err := os.MkdirAll(nested, 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if root, err := FindRoot(t.TempDir(), nested); err != nil || root != p.Root {
+		t.Errorf("FindRoot = %q, %v; want %q", root, err, p.Root)
+	}
+	if _, err := FindRoot(t.TempDir()); err == nil {
+		t.Error("expected an error outside a project")
+	}
+}
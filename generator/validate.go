@@ -0,0 +1,208 @@
+package generator
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// Names and field lists end up as arguments to gen_service.sh, which splices
+// them into sed and awk programs, so everything is checked here first.
+
+// MaxIdentifierLength bounds service, RPC, field and message names
+const MaxIdentifierLength = 64
+
+var (
+	identifier = regexp.MustCompile(`^[A-Za-z][A-Za-z0-9_]*$`)
+	// fieldListChars is what the field DSL needs: names, types, map<k,v>,
+	// Enum{A,in review}, oneof{a:string|b:bytes}, type? and google.protobuf.X
+	fieldListChars = regexp.MustCompile(`^[A-Za-z0-9_:,<>{}|?. -]*$`)
+	httpPath       = regexp.MustCompile(`^/[A-Za-z0-9_.~{}:*/-]*$`)
+)
+
+// protoKeywords are reserved words of the proto grammar, compared case-insensitively
+// because the generator also lower-cases names for file names and Go identifiers.
+var protoKeywords = map[string]bool{
+	"syntax": true, "edition": true, "import": true, "weak": true, "public": true,
+	"package": true, "option": true, "message": true, "enum": true, "service": true,
+	"rpc": true, "returns": true, "stream": true, "extend": true, "extensions": true,
+	"reserved": true, "to": true, "max": true, "oneof": true, "map": true,
+	"repeated": true, "optional": true, "required": true, "group": true,
+	"true": true, "false": true, "inf": true, "nan": true,
+	"double": true, "float": true, "int32": true, "int64": true, "uint32": true,
+	"uint64": true, "sint32": true, "sint64": true, "fixed32": true, "fixed64": true,
+	"sfixed32": true, "sfixed64": true, "bool": true, "string": true, "bytes": true,
+}
+
+var httpMethods = map[string]bool{"GET": true, "POST": true, "PUT": true, "PATCH": true, "DELETE": true}
+
+// streamModes are the RPC kinds add-rpc generates besides unary ("")
+var streamModes = map[string]bool{"server": true, "client": true, "bidi": true}
+
+// ValidationError describes a rejected request parameter. Code is one of
+// required, invalid_identifier, reserved_keyword, too_long, invalid_characters,
+// invalid_http_method, invalid_http_path, invalid_stream_mode,
+// invalid_http_binding or invalid_json.
+type ValidationError struct {
+	Field   string
+	Code    string
+	Message string
+}
+
+func (e *ValidationError) Error() string { return e.Message }
+
+// Invalid returns a ValidationError for field with a formatted message
+func Invalid(field, code, format string, args ...any) *ValidationError {
+	return &ValidationError{Field: field, Code: code, Message: fmt.Sprintf(format, args...)}
+}
+
+// ValidateName checks a service, RPC, field or message name; field names the
+// request parameter in the error.
+func ValidateName(field, name string) *ValidationError {
+	switch {
+	case name == "":
+		return Invalid(field, "required", "%s is required", field)
+	case len(name) > MaxIdentifierLength:
+		return Invalid(field, "too_long", "%s must be at most %d characters", field, MaxIdentifierLength)
+	case !identifier.MatchString(name):
+		return Invalid(field, "invalid_identifier", "%s %q must start with a letter and contain only letters, digits and underscores", field, name)
+	case protoKeywords[strings.ToLower(name)]:
+		return Invalid(field, "reserved_keyword", "%s %q is a reserved proto keyword", field, name)
+	}
+	return nil
+}
+
+// ValidateNames checks name/value pairs in order and returns the first error
+func ValidateNames(pairs ...string) *ValidationError {
+	for i := 0; i+1 < len(pairs); i += 2 {
+		if err := ValidateName(pairs[i], pairs[i+1]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// ValidateFieldList checks a comma-separated field list in the generator DSL:
+// only DSL characters, and every field name (including oneof variants) a valid identifier.
+func ValidateFieldList(field, list string) *ValidationError {
+	if strings.TrimSpace(list) == "" {
+		return Invalid(field, "required", "%s is required", field)
+	}
+	if !fieldListChars.MatchString(list) {
+		return Invalid(field, "invalid_characters", "%s may only contain letters, digits, spaces and _:,<>{}|?.-", field)
+	}
+	for _, entry := range splitTopLevel(list, ',') {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		if err := ValidateName(field+" name", dslFieldName(entry)); err != nil {
+			err.Message = fmt.Sprintf("%s (in %q)", err.Message, entry)
+			return err
+		}
+		// oneof{text:string|image:bytes} declares one field per variant
+		if typ := dslFieldType(entry); strings.HasPrefix(strings.ToLower(typ), "oneof") {
+			open, close := strings.Index(typ, "{"), strings.LastIndex(typ, "}")
+			if open < 0 || close < open {
+				continue
+			}
+			for _, variant := range strings.Split(typ[open+1:close], "|") {
+				name, _, _ := strings.Cut(strings.TrimSpace(variant), ":")
+				if err := ValidateName(field+" name", strings.TrimSpace(name)); err != nil {
+					err.Message = fmt.Sprintf("%s (in %q)", err.Message, entry)
+					return err
+				}
+			}
+		}
+	}
+	return nil
+}
+
+// dslFieldName returns the name of "name:type" or "repeated type name"
+func dslFieldName(entry string) string {
+	if name, _, ok := strings.Cut(entry, ":"); ok {
+		return strings.TrimSpace(name)
+	}
+	words := strings.Fields(entry)
+	return words[len(words)-1]
+}
+
+func dslFieldType(entry string) string {
+	_, typ, _ := strings.Cut(entry, ":")
+	return strings.TrimSpace(typ)
+}
+
+// splitTopLevel splits s at sep outside of <...> and {...}
+func splitTopLevel(s string, sep rune) []string {
+	var parts []string
+	depth, start := 0, 0
+	for i, c := range s {
+		switch {
+		case c == '<' || c == '{':
+			depth++
+		case (c == '>' || c == '}') && depth > 0:
+			depth--
+		case c == sep && depth == 0:
+			parts = append(parts, s[start:i])
+			start = i + 1
+		}
+	}
+	return append(parts, s[start:])
+}
+
+// ValidateFieldType checks the type part of a field, e.g. "duration" or "Kind{SMALL,LARGE}"
+func ValidateFieldType(field, typ string) *ValidationError {
+	if strings.TrimSpace(typ) == "" {
+		return Invalid(field, "required", "%s is required", field)
+	}
+	if !fieldListChars.MatchString(typ) {
+		return Invalid(field, "invalid_characters", "%s may only contain letters, digits, spaces and _:,<>{}|?.-", field)
+	}
+	return nil
+}
+
+// ValidateHTTP checks an HTTP binding: a method, a path template and an
+// optional body field ("*" or a request field name).
+func ValidateHTTP(method, path, body string) *ValidationError {
+	if !httpMethods[strings.ToUpper(method)] {
+		return Invalid("method", "invalid_http_method", "method %q must be one of GET, POST, PUT, PATCH or DELETE", method)
+	}
+	if !httpPath.MatchString(path) || strings.Contains(path, "..") || strings.Contains(path, "//") {
+		return Invalid("path", "invalid_http_path", "path %q must start with / and contain only letters, digits and _.~{}:*/-", path)
+	}
+	if body = strings.TrimSpace(body); body != "" && body != "*" {
+		return ValidateName("body", body)
+	}
+	return nil
+}
+
+// ValidateStreamBinding checks an RPC's stream mode ("" for unary, server,
+// client or bidi) and its HTTP binding http (METHOD:/path, or empty for none)
+// and body. A unary RPC needs a binding. The gateway serves server and bidi
+// streams over a WebSocket, which is opened with a GET, and cannot bind a
+// client stream.
+func ValidateStreamBinding(stream, http, body string) *ValidationError {
+	if stream != "" && !streamModes[stream] {
+		return Invalid("stream", "invalid_stream_mode", "stream %q must be one of server, client or bidi", stream)
+	}
+	if http == "" {
+		if stream == "" {
+			return Invalid("http", "required", "http is required for a unary RPC")
+		}
+		if strings.TrimSpace(body) != "" {
+			return Invalid("body", "invalid_http_binding", "body needs an HTTP binding")
+		}
+		return nil
+	}
+	method, path, _ := strings.Cut(http, ":")
+	if err := ValidateHTTP(method, path, body); err != nil {
+		return err
+	}
+	switch {
+	case stream == "client":
+		return Invalid("http", "invalid_http_binding", "a client-streaming RPC cannot have an HTTP binding")
+	case stream != "" && (!strings.EqualFold(method, "GET") || strings.TrimSpace(body) != ""):
+		return Invalid("method", "invalid_http_binding", "a %s-streaming RPC is served over a WebSocket, so it can only be bound to GET without a body", stream)
+	}
+	return nil
+}
@@ -0,0 +1,129 @@
+package generator
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestValidateName(t *testing.T) {
+	tests := []struct {
+		name string
+		code string
+	}{
+		{"Book", ""},
+		{"created_at", ""},
+		{"", "required"},
+		{"Book;rm -rf /", "invalid_identifier"},
+		{"$(touch pwned)", "invalid_identifier"},
+		{"`id`", "invalid_identifier"},
+		{"../../etc/passwd", "invalid_identifier"},
+		{"-rf", "invalid_identifier"},
+		{"_hidden", "invalid_identifier"},
+		{"Book\nmessage", "invalid_identifier"},
+		{"Bo/ok", "invalid_identifier"},
+		{"s/x/y/g", "invalid_identifier"},
+		{"Bööк", "invalid_identifier"},
+		{"message", "reserved_keyword"},
+		{"Service", "reserved_keyword"},
+		{"int32", "reserved_keyword"},
+		{strings.Repeat("a", MaxIdentifierLength+1), "too_long"},
+	}
+	for _, tt := range tests {
+		err := ValidateName("service", tt.name)
+		switch {
+		case tt.code == "" && err != nil:
+			t.Errorf("ValidateName(%q) = %v, want ok", tt.name, err)
+		case tt.code != "" && (err == nil || err.Code != tt.code):
+			t.Errorf("ValidateName(%q) = %v, want %s", tt.name, err, tt.code)
+		}
+	}
+}
+
+func TestValidateFieldList(t *testing.T) {
+	valid := []string{
+		"title:string,author:string,pages:int32",
+		"favourites:repeated string,repeated UserRef followers",
+		"status:Status{DRAFT,PUBLISHED,in review}",
+		"labels:map<string,string>,payload:oneof{text:string|image:bytes},ttl:duration,nickname:string?",
+		"due:google.protobuf.Timestamp",
+	}
+	for _, list := range valid {
+		if err := ValidateFieldList("serviceFields", list); err != nil {
+			t.Errorf("ValidateFieldList(%q) = %v", list, err)
+		}
+	}
+
+	invalidLists := map[string]string{
+		"":                                   "required",
+		"title:string;rm -rf /":              "invalid_characters",
+		"title:string' ; touch /tmp/x #":     "invalid_characters",
+		"title:$(id)":                        "invalid_characters",
+		"title:string\nmessage Evil {}":      "invalid_characters",
+		`title:string\`:                      "invalid_characters",
+		"t/itle:string":                      "invalid_characters",
+		"1title:string":                      "invalid_identifier",
+		"repeated string":                    "reserved_keyword",
+		"message:string":                     "reserved_keyword",
+		"payload:oneof{text:string|map:int}": "reserved_keyword",
+	}
+	for list, code := range invalidLists {
+		if err := ValidateFieldList("serviceFields", list); err == nil || err.Code != code {
+			t.Errorf("ValidateFieldList(%q) = %v, want %s", list, err, code)
+		}
+	}
+}
+
+func TestValidateHTTP(t *testing.T) {
+	tests := []struct {
+		method, path, body string
+		code               string
+	}{
+		{"GET", "/v1/books/{id}", "", ""},
+		{"post", "/v1/books:search", "*", ""},
+		{"PUT", "/v1/books/{data.id}", "data", ""},
+		{"TRACE", "/v1/books", "", "invalid_http_method"},
+		{"GET", "v1/books", "", "invalid_http_path"},
+		{"GET", "/v1/books|evil", "", "invalid_http_path"},
+		{"GET", "/v1/books\" }; rpc Evil", "", "invalid_http_path"},
+		{"GET", "/v1/../../etc", "", "invalid_http_path"},
+		{"POST", "/v1/books", "data; rm", "invalid_identifier"},
+	}
+	for _, tt := range tests {
+		err := ValidateHTTP(tt.method, tt.path, tt.body)
+		switch {
+		case tt.code == "" && err != nil:
+			t.Errorf("ValidateHTTP(%q, %q, %q) = %v, want ok", tt.method, tt.path, tt.body, err)
+		case tt.code != "" && (err == nil || err.Code != tt.code):
+			t.Errorf("ValidateHTTP(%q, %q, %q) = %v, want %s", tt.method, tt.path, tt.body, err, tt.code)
+		}
+	}
+}
+
+func TestValidateStreamBinding(t *testing.T) {
+	tests := []struct {
+		stream, http, body string
+		code               string
+	}{
+		{"", "POST:/v1/books:search", "*", ""},
+		{"", "", "", "required"},
+		{"server", "GET:/v1/books:tail", "", ""},
+		{"server", "", "", ""},
+		{"bidi", "GET:/v1/books:chat", "", ""},
+		{"client", "", "", ""},
+		{"sideways", "", "", "invalid_stream_mode"},
+		{"server", "POST:/v1/books:tail", "", "invalid_http_binding"},
+		{"bidi", "GET:/v1/books:chat", "*", "invalid_http_binding"},
+		{"client", "POST:/v1/books:import", "*", "invalid_http_binding"},
+		{"client", "", "*", "invalid_http_binding"},
+		{"server", "GET:/v1/../tail", "", "invalid_http_path"},
+	}
+	for _, tt := range tests {
+		err := ValidateStreamBinding(tt.stream, tt.http, tt.body)
+		switch {
+		case tt.code == "" && err != nil:
+			t.Errorf("ValidateStreamBinding(%q, %q, %q) = %v, want ok", tt.stream, tt.http, tt.body, err)
+		case tt.code != "" && (err == nil || err.Code != tt.code):
+			t.Errorf("ValidateStreamBinding(%q, %q, %q) = %v, want %s", tt.stream, tt.http, tt.body, err, tt.code)
+		}
+	}
+}
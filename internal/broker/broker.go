@@ -0,0 +1,187 @@
+// Package broker fans published values out to subscribers without letting a
+// slow subscriber hold up the publisher or the other subscribers. Each
+// subscriber has a bounded queue; when it is full the broker's Policy
+// either drops the oldest queued value or disconnects the subscriber.
+package broker
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"sync/atomic"
+)
+
+// Policy is what Publish does when a subscriber's queue is full
+type Policy int
+
+const (
+	// DropOldest discards the oldest queued value to make room; the
+	// subscriber sees a gap, counted by Dropped.
+	DropOldest Policy = iota
+	// Disconnect closes the subscription with ErrSlowConsumer
+	Disconnect
+)
+
+func (p Policy) String() string {
+	switch p {
+	case DropOldest:
+		return "drop-oldest"
+	case Disconnect:
+		return "disconnect"
+	}
+	return fmt.Sprintf("Policy(%d)", int(p))
+}
+
+// ParsePolicy parses "drop-oldest" or "disconnect"
+func ParsePolicy(s string) (Policy, error) {
+	switch strings.ToLower(strings.TrimSpace(s)) {
+	case "drop-oldest":
+		return DropOldest, nil
+	case "disconnect":
+		return Disconnect, nil
+	}
+	return 0, fmt.Errorf("unknown overflow policy %q (want drop-oldest or disconnect)", s)
+}
+
+var (
+	// ErrSlowConsumer ends a subscription that fell a full queue behind
+	// under the Disconnect policy.
+	ErrSlowConsumer = errors.New("broker: subscriber too slow")
+	// ErrClosed ends the subscriptions of a closed broker
+	ErrClosed = errors.New("broker: closed")
+)
+
+// DefaultQueueSize is used when Options.QueueSize is not positive
+const DefaultQueueSize = 64
+
+// Options configure a Broker
+type Options struct {
+	QueueSize int
+	Policy    Policy
+}
+
+// Broker delivers each published value to every current subscriber. The
+// zero value is not usable; call New.
+//
+// Subscribers only see values published after they subscribe. Callers that
+// send subscribers a snapshot of some state first should take the snapshot
+// and subscribe under the same lock that guards changing the state and
+// publishing the change, so each change is either in the snapshot or
+// delivered, never both or neither.
+type Broker[T any] struct {
+	opts Options
+
+	mu     sync.Mutex
+	subs   map[*Subscription[T]]struct{}
+	closed bool
+}
+
+// New returns a broker with the given options
+func New[T any](opts Options) *Broker[T] {
+	if opts.QueueSize <= 0 {
+		opts.QueueSize = DefaultQueueSize
+	}
+	return &Broker[T]{opts: opts, subs: map[*Subscription[T]]struct{}{}}
+}
+
+// Subscription receives the values published to a broker on C
+type Subscription[T any] struct {
+	b       *Broker[T]
+	ch      chan T
+	err     error // set under b.mu before ch is closed
+	dropped atomic.Uint64
+}
+
+// Subscribe adds a subscriber. After a closed broker, it returns a
+// subscription that is already closed with ErrClosed.
+func (b *Broker[T]) Subscribe() *Subscription[T] {
+	s := &Subscription[T]{b: b, ch: make(chan T, b.opts.QueueSize)}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.closed {
+		s.err = ErrClosed
+		close(s.ch)
+		return s
+	}
+	b.subs[s] = struct{}{}
+	return s
+}
+
+// Publish queues v for every subscriber without blocking
+func (b *Broker[T]) Publish(v T) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	for s := range b.subs {
+		select {
+		case s.ch <- v:
+			continue
+		default:
+		}
+		switch b.opts.Policy {
+		case DropOldest:
+			select {
+			case <-s.ch:
+				s.dropped.Add(1)
+			default: // drained by the subscriber meanwhile
+			}
+			// Cannot block: only publishers send, and they hold b.mu
+			s.ch <- v
+		case Disconnect:
+			b.remove(s, ErrSlowConsumer)
+		}
+	}
+}
+
+// Len returns the number of subscribers
+func (b *Broker[T]) Len() int {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return len(b.subs)
+}
+
+// Close ends every subscription with ErrClosed
+func (b *Broker[T]) Close() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.closed = true
+	for s := range b.subs {
+		b.remove(s, ErrClosed)
+	}
+}
+
+// remove must be called with b.mu held
+func (b *Broker[T]) remove(s *Subscription[T], err error) {
+	if _, ok := b.subs[s]; !ok {
+		return
+	}
+	delete(b.subs, s)
+	s.err = err
+	close(s.ch)
+}
+
+// C delivers the published values in order. It is closed when the
+// subscription ends; Err then tells why.
+func (s *Subscription[T]) C() <-chan T {
+	return s.ch
+}
+
+// Err returns ErrSlowConsumer or ErrClosed once C is closed by the broker,
+// and nil while the subscription is open or after Close.
+func (s *Subscription[T]) Err() error {
+	s.b.mu.Lock()
+	defer s.b.mu.Unlock()
+	return s.err
+}
+
+// Dropped returns how many values DropOldest discarded for s
+func (s *Subscription[T]) Dropped() uint64 {
+	return s.dropped.Load()
+}
+
+// Close unsubscribes; it is safe to call more than once
+func (s *Subscription[T]) Close() {
+	s.b.mu.Lock()
+	defer s.b.mu.Unlock()
+	s.b.remove(s, nil)
+}
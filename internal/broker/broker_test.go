@@ -0,0 +1,225 @@
+package broker
+
+import (
+	"errors"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// receive reads n values from s, failing if they do not arrive promptly
+func receive(t *testing.T, s *Subscription[int], n int) []int {
+	t.Helper()
+	var got []int
+	for len(got) < n {
+		select {
+		case v, ok := <-s.C():
+			if !ok {
+				t.Fatalf("subscription closed after %v: %v", got, s.Err())
+			}
+			got = append(got, v)
+		case <-time.After(time.Second):
+			t.Fatalf("received %v, want %d values", got, n)
+		}
+	}
+	return got
+}
+
+func TestPublish(t *testing.T) {
+	b := New[int](Options{})
+	early := b.Subscribe()
+	b.Publish(1)
+	late := b.Subscribe()
+	b.Publish(2)
+	b.Publish(3)
+
+	if got := receive(t, early, 3); got[0] != 1 || got[1] != 2 || got[2] != 3 {
+		t.Errorf("early subscriber got %v", got)
+	}
+	if got := receive(t, late, 2); got[0] != 2 || got[1] != 3 {
+		t.Errorf("late subscriber got %v, want only what followed Subscribe", got)
+	}
+
+	early.Close()
+	early.Close()
+	if _, ok := <-early.C(); ok || early.Err() != nil || b.Len() != 1 {
+		t.Errorf("after Close: Err = %v, Len = %d", early.Err(), b.Len())
+	}
+}
+
+func TestDropOldest(t *testing.T) {
+	b := New[int](Options{QueueSize: 2, Policy: DropOldest})
+	s := b.Subscribe()
+	for i := 1; i <= 5; i++ {
+		b.Publish(i)
+	}
+	if got := receive(t, s, 2); got[0] != 4 || got[1] != 5 {
+		t.Errorf("got %v, want the newest [4 5]", got)
+	}
+	if s.Dropped() != 3 {
+		t.Errorf("Dropped = %d, want 3", s.Dropped())
+	}
+}
+
+func TestDisconnect(t *testing.T) {
+	b := New[int](Options{QueueSize: 1, Policy: Disconnect})
+	slow := b.Subscribe()
+	fast := b.Subscribe()
+
+	b.Publish(1)
+	receive(t, fast, 1)
+	b.Publish(2)
+
+	if v := <-slow.C(); v != 1 {
+		t.Errorf("slow subscriber got %d, want the queued 1", v)
+	}
+	if _, ok := <-slow.C(); ok || !errors.Is(slow.Err(), ErrSlowConsumer) {
+		t.Errorf("slow subscriber Err = %v, want ErrSlowConsumer", slow.Err())
+	}
+	if got := receive(t, fast, 1); got[0] != 2 || fast.Err() != nil {
+		t.Errorf("fast subscriber got %v, Err = %v", got, fast.Err())
+	}
+	if b.Len() != 1 {
+		t.Errorf("Len = %d, want 1", b.Len())
+	}
+}
+
+// A subscriber that never reads must not hold up Publish under either policy
+func TestPublishDoesNotBlock(t *testing.T) {
+	for _, p := range []Policy{DropOldest, Disconnect} {
+		b := New[int](Options{QueueSize: 4, Policy: p})
+		b.Subscribe()
+		done := make(chan struct{})
+		go func() {
+			for i := 0; i < 10000; i++ {
+				b.Publish(i)
+			}
+			close(done)
+		}()
+		select {
+		case <-done:
+		case <-time.After(5 * time.Second):
+			t.Fatalf("%v: Publish blocked on a stalled subscriber", p)
+		}
+	}
+}
+
+func TestClose(t *testing.T) {
+	b := New[int](Options{})
+	s := b.Subscribe()
+	b.Close()
+	if _, ok := <-s.C(); ok || !errors.Is(s.Err(), ErrClosed) {
+		t.Errorf("Err = %v, want ErrClosed", s.Err())
+	}
+	after := b.Subscribe()
+	if _, ok := <-after.C(); ok || !errors.Is(after.Err(), ErrClosed) {
+		t.Errorf("Subscribe after Close: Err = %v, want ErrClosed", after.Err())
+	}
+	b.Publish(1) // no subscribers left; must not panic
+}
+
+// TestConcurrent runs publishers, readers and churning subscribers together
+// for the race detector. Every value reaches a reader or is counted as
+// dropped.
+func TestConcurrent(t *testing.T) {
+	const publishers, perPublisher = 4, 500
+	b := New[int](Options{QueueSize: 8, Policy: DropOldest})
+
+	var readers sync.WaitGroup
+	counts := make([]int, 4)
+	subs := make([]*Subscription[int], len(counts))
+	for i := range subs {
+		subs[i] = b.Subscribe()
+		readers.Add(1)
+		go func(i int) {
+			defer readers.Done()
+			for range subs[i].C() {
+				counts[i]++
+			}
+		}(i)
+	}
+
+	var wg sync.WaitGroup
+	for p := 0; p < publishers; p++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := 0; i < perPublisher; i++ {
+				b.Publish(i)
+			}
+		}()
+	}
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		for i := 0; i < 100; i++ {
+			b.Subscribe().Close()
+		}
+	}()
+	wg.Wait()
+	b.Close()
+	readers.Wait()
+
+	for i, s := range subs {
+		if got := counts[i] + int(s.Dropped()); got != publishers*perPublisher {
+			t.Errorf("subscriber %d: received %d + dropped %d, want %d", i, counts[i], s.Dropped(), publishers*perPublisher)
+		}
+	}
+}
+
+func TestParsePolicy(t *testing.T) {
+	for s, want := range map[string]Policy{"drop-oldest": DropOldest, " Disconnect": Disconnect} {
+		if p, err := ParsePolicy(s); err != nil || p != want {
+			t.Errorf("ParsePolicy(%q) = %v, %v", s, p, err)
+		}
+		if want.String() != strings.TrimSpace(strings.ToLower(s)) {
+			t.Errorf("%v.String() = %q", want, want.String())
+		}
+	}
+	if _, err := ParsePolicy("block"); err == nil {
+		t.Error("ParsePolicy(block) succeeded")
+	}
+}
+
+func TestLog(t *testing.T) {
+	l := NewLog[string](3)
+	if entries, ok := l.Since(0); !ok || len(entries) != 0 {
+		t.Errorf("empty Since(0) = %v, %v", entries, ok)
+	}
+	for i, v := range []string{"a", "b", "c", "d"} {
+		l.Append(uint64(i+1), v)
+	}
+
+	tests := []struct {
+		since uint64
+		want  string
+		ok    bool
+	}{
+		{0, "", false}, // a was evicted
+		{1, "bcd", true},
+		{3, "d", true},
+		{4, "", true},
+		{5, "", false}, // ahead of the log
+	}
+	for _, tt := range tests {
+		entries, ok := l.Since(tt.since)
+		var got string
+		for i, e := range entries {
+			if e.Seq != tt.since+uint64(i)+1 {
+				t.Errorf("Since(%d)[%d].Seq = %d", tt.since, i, e.Seq)
+			}
+			got += e.Value
+		}
+		if got != tt.want || ok != tt.ok {
+			t.Errorf("Since(%d) = %q, %v; want %q, %v", tt.since, got, ok, tt.want, tt.ok)
+		}
+	}
+
+	defer func() {
+		if recover() == nil {
+			t.Error("Append out of sequence did not panic")
+		}
+	}()
+	l.Append(6, "f")
+}
@@ -0,0 +1,59 @@
+package broker
+
+import (
+	"fmt"
+	"sync"
+)
+
+// Entry is a value in a Log with its sequence number
+type Entry[T any] struct {
+	Seq   uint64
+	Value T
+}
+
+// Log keeps the most recent values published under consecutive sequence
+// numbers starting at 1, so that a subscriber that reconnects can catch up
+// on what it missed. Older entries are evicted once it holds size of them.
+type Log[T any] struct {
+	mu      sync.Mutex
+	size    int
+	entries []Entry[T]
+	last    uint64
+}
+
+// NewLog returns an empty log holding at most size entries
+func NewLog[T any](size int) *Log[T] {
+	if size <= 0 {
+		size = DefaultQueueSize
+	}
+	return &Log[T]{size: size}
+}
+
+// Append adds v as entry seq, which must follow the last one
+func (l *Log[T]) Append(seq uint64, v T) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if seq != l.last+1 {
+		panic(fmt.Sprintf("broker: Log.Append(%d) after %d", seq, l.last))
+	}
+	if len(l.entries) == l.size {
+		l.entries = append(l.entries[:0], l.entries[1:]...)
+	}
+	l.entries = append(l.entries, Entry[T]{Seq: seq, Value: v})
+	l.last = seq
+}
+
+// Since returns the entries after seq. It reports false when the log no
+// longer holds all of them, or seq is ahead of the last entry.
+func (l *Log[T]) Since(seq uint64) ([]Entry[T], bool) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if seq > l.last {
+		return nil, false
+	}
+	first := l.last + 1 - uint64(len(l.entries))
+	if seq+1 < first {
+		return nil, false
+	}
+	return append([]Entry[T](nil), l.entries[seq+1-first:]...), true
+}
@@ -0,0 +1,38 @@
+// Package bus carries events between the instances of a service, so that
+// the clients of one replica see changes made through another. Its Bus
+// interface follows NATS: messages are published to a subject and handed
+// to the handlers subscribed to it. Hub is an in-process stand-in, and Mongo
+// shares messages through a collection's change stream.
+//
+// A connection never receives what it published itself, as with NATS's
+// NoEcho option: a service applies its own changes directly and takes only
+// those of the other instances from the bus.
+package bus
+
+// Msg is a message as received
+type Msg struct {
+	Subject string
+	Data    []byte
+}
+
+// Handler receives the messages of a subscription. A subscription's handler
+// is called from one goroutine, in the order the messages were published,
+// so a slow handler holds up the messages after it.
+type Handler func(msg *Msg)
+
+// Bus is a connection to an event bus
+type Bus interface {
+	// Publish sends data to the subscribers of subject on every other
+	// connection. A nil error means the bus has accepted the message.
+	Publish(subject string, data []byte) error
+	// Subscribe calls handler with each message that other connections
+	// publish to subject from now on
+	Subscribe(subject string, handler Handler) (Subscription, error)
+	// Close ends every subscription of the connection
+	Close() error
+}
+
+// Subscription is a Subscribe that can be ended
+type Subscription interface {
+	Unsubscribe() error
+}
@@ -0,0 +1,148 @@
+package bus
+
+import (
+	"errors"
+	"sync"
+)
+
+// ErrClosed is returned by a connection after Close
+var ErrClosed = errors.New("bus: connection closed")
+
+// Hub is an in-process stand-in for a NATS server. Its connections share
+// messages within one process: the default for a single instance, and a
+// way to run several instances of a service side by side in tests.
+type Hub struct {
+	mu   sync.Mutex
+	subs map[string]map[*localSub]struct{} // by subject
+}
+
+// NewHub returns a hub without connections
+func NewHub() *Hub {
+	return &Hub{subs: map[string]map[*localSub]struct{}{}}
+}
+
+// Connect returns a new connection to h
+func (h *Hub) Connect() Bus {
+	return &localConn{hub: h, subs: map[*localSub]struct{}{}}
+}
+
+type localConn struct {
+	hub *Hub
+
+	mu     sync.Mutex // guards subs and closed
+	subs   map[*localSub]struct{}
+	closed bool
+}
+
+// localSub queues its messages without a bound, so Publish never waits for
+// a handler, and hands them to the handler from its own goroutine
+type localSub struct {
+	conn    *localConn
+	subject string
+	handler Handler
+
+	mu      sync.Mutex
+	queue   []*Msg
+	ready   chan struct{} // signalled when queue is no longer empty
+	done    chan struct{}
+	stopped bool
+}
+
+func (c *localConn) Publish(subject string, data []byte) error {
+	c.mu.Lock()
+	closed := c.closed
+	c.mu.Unlock()
+	if closed {
+		return ErrClosed
+	}
+	c.hub.mu.Lock()
+	defer c.hub.mu.Unlock()
+	for s := range c.hub.subs[subject] {
+		if s.conn != c {
+			s.push(&Msg{Subject: subject, Data: append([]byte(nil), data...)})
+		}
+	}
+	return nil
+}
+
+func (c *localConn) Subscribe(subject string, handler Handler) (Subscription, error) {
+	s := &localSub{conn: c, subject: subject, handler: handler, ready: make(chan struct{}, 1), done: make(chan struct{})}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.closed {
+		return nil, ErrClosed
+	}
+	c.subs[s] = struct{}{}
+	c.hub.mu.Lock()
+	if c.hub.subs[subject] == nil {
+		c.hub.subs[subject] = map[*localSub]struct{}{}
+	}
+	c.hub.subs[subject][s] = struct{}{}
+	c.hub.mu.Unlock()
+	go s.run()
+	return s, nil
+}
+
+func (c *localConn) Close() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.closed = true
+	for s := range c.subs {
+		s.stop()
+	}
+	return nil
+}
+
+func (s *localSub) push(msg *Msg) {
+	s.mu.Lock()
+	s.queue = append(s.queue, msg)
+	s.mu.Unlock()
+	select {
+	case s.ready <- struct{}{}:
+	default: // already signalled
+	}
+}
+
+func (s *localSub) run() {
+	for {
+		select {
+		case <-s.done:
+			return
+		case <-s.ready:
+		}
+		s.mu.Lock()
+		msgs := s.queue
+		s.queue = nil
+		s.mu.Unlock()
+		for _, msg := range msgs {
+			select {
+			case <-s.done:
+				return
+			default:
+			}
+			s.handler(msg)
+		}
+	}
+}
+
+// stop must be called with s.conn.mu held
+func (s *localSub) stop() {
+	if s.stopped {
+		return
+	}
+	s.stopped = true
+	delete(s.conn.subs, s)
+	s.conn.hub.mu.Lock()
+	delete(s.conn.hub.subs[s.subject], s)
+	s.conn.hub.mu.Unlock()
+	close(s.done)
+}
+
+// Unsubscribe stops the handler being called; a call already running
+// finishes
+func (s *localSub) Unsubscribe() error {
+	s.conn.mu.Lock()
+	defer s.conn.mu.Unlock()
+	s.stop()
+	return nil
+}
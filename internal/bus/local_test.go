@@ -0,0 +1,96 @@
+package bus
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+// collect subscribes to subject on c and returns the data it receives
+func collect(t *testing.T, c Bus, subject string) (<-chan string, Subscription) {
+	t.Helper()
+	got := make(chan string, 16)
+	sub, err := c.Subscribe(subject, func(msg *Msg) { got <- string(msg.Data) })
+	if err != nil {
+		t.Fatalf("Subscribe returned error: %v", err)
+	}
+	return got, sub
+}
+
+func expect(t *testing.T, got <-chan string, want ...string) {
+	t.Helper()
+	for _, w := range want {
+		select {
+		case g := <-got:
+			if g != w {
+				t.Errorf("received %q, want %q", g, w)
+			}
+		case <-time.After(time.Second):
+			t.Fatalf("nothing received, want %q", w)
+		}
+	}
+	select {
+	case g := <-got:
+		t.Errorf("received %q, want nothing more", g)
+	case <-time.After(20 * time.Millisecond):
+	}
+}
+
+func TestHub(t *testing.T) {
+	hub := NewHub()
+	a, b := hub.Connect(), hub.Connect()
+	fromA, _ := collect(t, a, "todo")
+	fromB, subB := collect(t, b, "todo")
+	other, _ := collect(t, b, "book")
+
+	for _, data := range []string{"1", "2", "3"} {
+		if err := a.Publish("todo", []byte(data)); err != nil {
+			t.Fatalf("Publish returned error: %v", err)
+		}
+	}
+	expect(t, fromB, "1", "2", "3")
+	expect(t, fromA) // no echo
+	expect(t, other)
+
+	subB.Unsubscribe()
+	subB.Unsubscribe()
+	b.Publish("todo", []byte("4"))
+	a.Publish("todo", []byte("5"))
+	expect(t, fromA, "4")
+	expect(t, fromB)
+
+	a.Close()
+	if err := a.Publish("todo", nil); !errors.Is(err, ErrClosed) {
+		t.Errorf("Publish after Close = %v, want ErrClosed", err)
+	}
+	if _, err := a.Subscribe("todo", func(*Msg) {}); !errors.Is(err, ErrClosed) {
+		t.Errorf("Subscribe after Close = %v, want ErrClosed", err)
+	}
+	b.Publish("todo", []byte("6"))
+	expect(t, fromA)
+}
+
+func TestHubSlowHandler(t *testing.T) {
+	hub := NewHub()
+	a, b := hub.Connect(), hub.Connect()
+	release := make(chan struct{})
+	got := make(chan string, 16)
+	b.Subscribe("todo", func(msg *Msg) {
+		<-release
+		got <- string(msg.Data)
+	})
+	done := make(chan struct{})
+	go func() {
+		for _, data := range []string{"1", "2", "3"} {
+			a.Publish("todo", []byte(data))
+		}
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("Publish waited for a blocked handler")
+	}
+	close(release)
+	expect(t, got, "1", "2", "3")
+}
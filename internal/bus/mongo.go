@@ -0,0 +1,144 @@
+package bus
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"log"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+const (
+	// mongoRetention is how long published messages stay in the collection,
+	// long enough for a subscriber to resume after a short outage
+	mongoRetention = time.Hour
+	mongoTimeout   = 5 * time.Second
+	// mongoRetry is how long a subscriber waits before reopening a failed
+	// change stream
+	mongoRetry = time.Second
+)
+
+// mongoMessage is a published message as stored
+type mongoMessage struct {
+	Subject string    `bson:"subject"`
+	Data    []byte    `bson:"data"`
+	Origin  string    `bson:"origin"` // the publishing connection
+	At      time.Time `bson:"at"`
+}
+
+// Mongo is a bus whose messages are documents inserted into a collection
+// and received through its change stream. Change streams need a replica
+// set or a sharded cluster; a standalone server fails Subscribe. Messages
+// expire from the collection after an hour.
+type Mongo struct {
+	coll   *mongo.Collection
+	origin string
+	ctx    context.Context // cancelled by Close, ending the change streams
+	cancel context.CancelFunc
+}
+
+// NewMongo connects to the bus in coll, creating the index that expires its
+// messages
+func NewMongo(ctx context.Context, coll *mongo.Collection) (*Mongo, error) {
+	_, err := coll.Indexes().CreateOne(ctx, mongo.IndexModel{
+		Keys:    bson.D{{Key: "at", Value: 1}},
+		Options: options.Index().SetExpireAfterSeconds(int32(mongoRetention.Seconds())),
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to index %s: %w", coll.Name(), err)
+	}
+	origin := make([]byte, 8)
+	rand.Read(origin)
+	m := &Mongo{coll: coll, origin: hex.EncodeToString(origin)}
+	m.ctx, m.cancel = context.WithCancel(context.Background())
+	return m, nil
+}
+
+func (m *Mongo) Publish(subject string, data []byte) error {
+	if m.ctx.Err() != nil {
+		return ErrClosed
+	}
+	ctx, cancel := context.WithTimeout(m.ctx, mongoTimeout)
+	defer cancel()
+	_, err := m.coll.InsertOne(ctx, mongoMessage{Subject: subject, Data: data, Origin: m.origin, At: time.Now()})
+	return err
+}
+
+// Subscribe opens a change stream on the inserts of other connections to
+// subject. When the stream fails it is reopened where it left off.
+func (m *Mongo) Subscribe(subject string, handler Handler) (Subscription, error) {
+	if m.ctx.Err() != nil {
+		return nil, ErrClosed
+	}
+	pipeline := mongo.Pipeline{{{Key: "$match", Value: bson.D{
+		{Key: "operationType", Value: "insert"},
+		{Key: "fullDocument.subject", Value: subject},
+		{Key: "fullDocument.origin", Value: bson.D{{Key: "$ne", Value: m.origin}}},
+	}}}}
+	ctx, cancel := context.WithCancel(m.ctx)
+	stream, err := m.coll.Watch(ctx, pipeline)
+	if err != nil {
+		cancel()
+		return nil, fmt.Errorf("failed to watch %s: %w", m.coll.Name(), err)
+	}
+	go m.tail(ctx, stream, pipeline, handler)
+	return unsubscribeFunc(cancel), nil
+}
+
+// tail hands the messages of stream to handler until ctx is done
+func (m *Mongo) tail(ctx context.Context, stream *mongo.ChangeStream, pipeline mongo.Pipeline, handler Handler) {
+	for {
+		for stream.Next(ctx) {
+			var change struct {
+				FullDocument mongoMessage `bson:"fullDocument"`
+			}
+			if err := stream.Decode(&change); err != nil {
+				log.Printf("bus: skipping undecodable message: %v", err)
+				continue
+			}
+			handler(&Msg{Subject: change.FullDocument.Subject, Data: change.FullDocument.Data})
+		}
+		token := stream.ResumeToken()
+		if ctx.Err() == nil {
+			log.Printf("bus: change stream on %s failed: %v; reopening", m.coll.Name(), stream.Err())
+		}
+		stream.Close(context.Background())
+		for ctx.Err() == nil {
+			select {
+			case <-ctx.Done():
+				return
+			case <-time.After(mongoRetry):
+			}
+			opts := options.ChangeStream()
+			if token != nil {
+				opts.SetResumeAfter(token)
+			}
+			reopened, err := m.coll.Watch(ctx, pipeline, opts)
+			if err == nil {
+				stream = reopened
+				break
+			}
+			log.Printf("bus: reopening change stream on %s failed: %v; retrying", m.coll.Name(), err)
+		}
+		if ctx.Err() != nil {
+			return
+		}
+	}
+}
+
+func (m *Mongo) Close() error {
+	m.cancel()
+	return nil
+}
+
+type unsubscribeFunc func()
+
+func (f unsubscribeFunc) Unsubscribe() error {
+	f()
+	return nil
+}
@@ -0,0 +1,302 @@
+package handler
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"grpc_anotation_sample/protoset"
+	"io"
+	"log"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/gorilla/websocket"
+	"github.com/grpc-ecosystem/grpc-gateway/v2/runtime"
+	"github.com/grpc-ecosystem/grpc-gateway/v2/utilities"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"google.golang.org/protobuf/reflect/protoregistry"
+	"google.golang.org/protobuf/types/dynamicpb"
+)
+
+// streamRoute is a streaming RPC served over WebSockets at the path of one of
+// its HTTP bindings
+type streamRoute struct {
+	method   protoreflect.MethodDescriptor
+	template string
+	path     *regexp.Regexp
+	fields   []string // the request fields bound in the path, one per group of path
+}
+
+func newStreamRoute(md protoreflect.MethodDescriptor, template string) streamRoute {
+	path, fields := compileTemplate(template)
+	return streamRoute{method: md, template: template, path: path, fields: fields}
+}
+
+// pathVar matches a variable of a path template: {field} or {field=pattern}
+var pathVar = regexp.MustCompile(`\{([^}=]+)(?:=([^}]*))?\}`)
+
+// compileTemplate returns a regexp matching the escaped paths of an HTTP
+// binding's template, with a group for each variable, and the fields the
+// variables are bound to.
+func compileTemplate(template string) (*regexp.Regexp, []string) {
+	var expr strings.Builder
+	var fields []string
+	expr.WriteString("^")
+	last := 0
+	for _, m := range pathVar.FindAllStringSubmatchIndex(template, -1) {
+		expr.WriteString(regexp.QuoteMeta(template[last:m[0]]))
+		fields = append(fields, template[m[2]:m[3]])
+		pattern := "*"
+		if m[4] >= 0 {
+			pattern = template[m[4]:m[5]]
+		}
+		expr.WriteString("(" + segmentsExpr(pattern) + ")")
+		last = m[1]
+	}
+	expr.WriteString(regexp.QuoteMeta(template[last:]) + "$")
+	return regexp.MustCompile(expr.String()), fields
+}
+
+// segmentsExpr translates the pattern of a variable, such as shelves/*
+func segmentsExpr(pattern string) string {
+	segments := strings.Split(pattern, "/")
+	for i, s := range segments {
+		switch s {
+		case "*":
+			segments[i] = "[^/]+"
+		case "**":
+			segments[i] = ".+"
+		default:
+			segments[i] = regexp.QuoteMeta(s)
+		}
+	}
+	return strings.Join(segments, "/")
+}
+
+type streamProxy struct {
+	conn   *grpc.ClientConn
+	mux    *runtime.ServeMux
+	routes []streamRoute
+	opts   StreamOptions
+}
+
+// StreamProxy serves the server-streaming and bidi RPCs of files over
+// WebSockets at the paths of their HTTP bindings, and server streams as
+// Server-Sent Events to GET requests that accept text/event-stream (see
+// serveEvents). Every other request is passed to mux. Over a WebSocket
+// responses are sent as protojson text messages, and the socket is closed
+// when the stream ends.
+//
+// A server stream's request is read from the path and query as by the
+// gateway. On a bidi stream each text message from the client is a
+// request, and an empty message ends them. Headers are forwarded as gRPC
+// metadata the way the gateway forwards them, and closing the socket
+// cancels the call.
+func StreamProxy(conn *grpc.ClientConn, mux *runtime.ServeMux, files []protoreflect.FileDescriptor, opts StreamOptions) http.Handler {
+	p := &streamProxy{conn: conn, mux: mux, opts: opts}
+	for _, fd := range files {
+		services := fd.Services()
+		for i := 0; i < services.Len(); i++ {
+			methods := services.Get(i).Methods()
+			for j := 0; j < methods.Len(); j++ {
+				md := methods.Get(j)
+				if !md.IsStreamingServer() {
+					continue
+				}
+				for _, b := range protoset.Bindings(md) {
+					p.routes = append(p.routes, newStreamRoute(md, b.Path))
+				}
+			}
+		}
+	}
+	return p
+}
+
+func (p *streamProxy) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	upgrade, events := websocket.IsWebSocketUpgrade(r), r.Method == http.MethodGet && acceptsEventStream(r)
+	if upgrade || events {
+		for _, route := range p.routes {
+			m := route.path.FindStringSubmatch(r.URL.EscapedPath())
+			switch {
+			case m == nil:
+			case upgrade:
+				p.proxy(w, r, route, m[1:])
+				return
+			case !route.method.IsStreamingClient():
+				p.serveEvents(w, r, route, m[1:])
+				return
+			}
+		}
+	}
+	p.mux.ServeHTTP(w, r)
+}
+
+// newMessage returns an empty md, of its generated type when that is linked in
+func newMessage(md protoreflect.MessageDescriptor) proto.Message {
+	if mt, err := protoregistry.GlobalTypes.FindMessageByName(md.FullName()); err == nil {
+		return mt.New().Interface()
+	}
+	return dynamicpb.NewMessage(md)
+}
+
+// serverRequest reads the request of a server stream from the path values
+// and the query
+func serverRequest(r *http.Request, route streamRoute, values []string) (proto.Message, error) {
+	req := newMessage(route.method.Input())
+	var bound [][]string
+	for i, field := range route.fields {
+		v, err := url.PathUnescape(values[i])
+		if err == nil {
+			err = runtime.PopulateFieldFromPath(req, field, v)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("invalid %s: %v", field, err)
+		}
+		bound = append(bound, strings.Split(field, "."))
+	}
+	if err := runtime.PopulateQueryParameters(req, r.URL.Query(), utilities.NewDoubleArray(bound)); err != nil {
+		return nil, err
+	}
+	return req, nil
+}
+
+func (p *streamProxy) proxy(w http.ResponseWriter, r *http.Request, route streamRoute, values []string) {
+	md := route.method
+	fullMethod := fmt.Sprintf("/%s/%s", md.Parent().FullName(), md.Name())
+	bidi := md.IsStreamingClient()
+	var req proto.Message
+	if !bidi {
+		var err error
+		if req, err = serverRequest(r, route, values); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+	}
+	ctx, err := runtime.AnnotateContext(r.Context(), p.mux, r, fullMethod, runtime.WithHTTPPathPattern(route.template))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	ws, err := upgrader.Upgrade(w, r, nil)
+	if err != nil {
+		log.Printf("failed to upgrade to websocket: %v", err)
+		return
+	}
+	defer ws.Close()
+	stopPings := keepAlive(ws, p.opts.PingInterval)
+	defer stopPings()
+
+	desc := &grpc.StreamDesc{StreamName: string(md.Name()), ServerStreams: true, ClientStreams: bidi}
+	stream, err := p.conn.NewStream(ctx, desc, fullMethod)
+	if err != nil {
+		closeWithStatus(ws, err)
+		return
+	}
+	if !bidi {
+		// Failures are reported by RecvMsg
+		if stream.SendMsg(req) == nil {
+			stream.CloseSend()
+		}
+	}
+	go relayStream(ctx, ws, stream, md.Output())
+
+	for {
+		kind, msg, err := ws.ReadMessage()
+		if err != nil {
+			if websocket.IsUnexpectedCloseError(err, websocket.CloseNormalClosure, websocket.CloseGoingAway, websocket.CloseAbnormalClosure) {
+				log.Printf("error reading from websocket: %v", err)
+			}
+			return
+		}
+		if !bidi || kind != websocket.TextMessage {
+			continue
+		}
+		if len(msg) == 0 {
+			stream.CloseSend()
+			continue
+		}
+		in := newMessage(md.Input())
+		if err := protojson.Unmarshal(msg, in); err != nil {
+			closeWithStatus(ws, status.Errorf(codes.InvalidArgument, "invalid %s: %v", md.Input().FullName(), err))
+			return
+		}
+		// After a failure the stream's status is reported by the relay
+		stream.SendMsg(in)
+	}
+}
+
+// relayStream writes the responses of stream to ws until it ends, then
+// closes ws with its status
+func relayStream(ctx context.Context, ws *websocket.Conn, stream grpc.ClientStream, md protoreflect.MessageDescriptor) {
+	for {
+		msg := newMessage(md)
+		if err := stream.RecvMsg(msg); err != nil {
+			if ctx.Err() != nil {
+				return // the client has gone
+			}
+			closeWithStatus(ws, err)
+			return
+		}
+		b, err := protojson.Marshal(msg)
+		if err == nil {
+			err = ws.WriteMessage(websocket.TextMessage, b)
+		}
+		if err != nil {
+			log.Printf("failed to relay %s: %v", md.FullName(), err)
+			return
+		}
+	}
+}
+
+// maxCloseReason is the most a close frame can hold after its code
+const maxCloseReason = 123
+
+// statusCloseBase plus a gRPC code is the close code of a stream that ended
+// with it, unless a standard close code says the same
+const statusCloseBase = 4000
+
+// closeCode returns the WebSocket close code for a stream that ended with
+// err: 1000 when it ended normally (nil or io.EOF), 1011 for an internal
+// error, 1013 when the server is unavailable, and otherwise 4000 plus the
+// gRPC status code, e.g. 4005 for NotFound or 4016 for Unauthenticated.
+func closeCode(err error) int {
+	if err == nil || errors.Is(err, io.EOF) {
+		return websocket.CloseNormalClosure
+	}
+	switch code := status.Code(err); code {
+	case codes.Internal, codes.Unknown, codes.DataLoss:
+		return websocket.CloseInternalServerErr
+	case codes.Unavailable:
+		return websocket.CloseTryAgainLater
+	default:
+		return statusCloseBase + int(code)
+	}
+}
+
+// closeWithStatus sends the close frame for the end of a stream, with the
+// code from closeCode and the status message, truncated to fit, as the
+// reason.
+func closeWithStatus(ws *websocket.Conn, err error) {
+	code, reason := closeCode(err), ""
+	if code != websocket.CloseNormalClosure {
+		reason = status.Convert(err).Message()
+	}
+	for len(reason) > maxCloseReason {
+		_, size := utf8.DecodeLastRuneInString(reason)
+		reason = reason[:len(reason)-size]
+	}
+	msg := websocket.FormatCloseMessage(code, reason)
+	ws.WriteControl(websocket.CloseMessage, msg, time.Now().Add(writeWait))
+}
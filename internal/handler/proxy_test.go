@@ -0,0 +1,248 @@
+package handler
+
+import (
+	"context"
+	"encoding/base64"
+	"errors"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"github.com/grpc-ecosystem/grpc-gateway/v2/runtime"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	testpb "google.golang.org/grpc/interop/grpc_testing"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"google.golang.org/grpc/test/bufconn"
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"google.golang.org/protobuf/reflect/protoregistry"
+)
+
+func TestCompileTemplate(t *testing.T) {
+	tests := []struct {
+		template, path string
+		want           []string // the values of the variables, nil if path does not match
+	}{
+		{"/v1/todos/stream", "/v1/todos/stream", []string{}},
+		{"/v1/todos/stream", "/v1/todos/stream/x", nil},
+		{"/v1/books/{id}", "/v1/books/42", []string{"42"}},
+		{"/v1/books/{id}", "/v1/books/4/2", nil},
+		{"/v1/{name=shelves/*}/books", "/v1/shelves/a/books", []string{"shelves/a"}},
+		{"/v1/{name=files/**}", "/v1/files/a/b/c", []string{"files/a/b/c"}},
+		{"/v1/todos/{id}:watch", "/v1/todos/7:watch", []string{"7"}},
+		{"/v1/todos/{id}:watch", "/v1/todos/7xwatch", nil},
+	}
+	for _, tt := range tests {
+		re, _ := compileTemplate(tt.template)
+		m := re.FindStringSubmatch(tt.path)
+		if (m == nil) != (tt.want == nil) || m != nil && strings.Join(m[1:], ",") != strings.Join(tt.want, ",") {
+			t.Errorf("%s on %s = %q, want %q", tt.template, tt.path, m, tt.want)
+		}
+	}
+	if _, fields := compileTemplate("/v1/{shelf.id}/books/{id=*}"); strings.Join(fields, ",") != "shelf.id,id" {
+		t.Errorf("fields = %q", fields)
+	}
+}
+
+// echoServer streams back what it is sent. StreamingOutputCall sends the
+// response_status message, the payload and the authorization metadata, or
+// fails with the response_status code; a payload of "wait" closes started
+// and holds the stream open until the client goes, then closes cancelled.
+type echoServer struct {
+	testpb.UnimplementedTestServiceServer
+	started, cancelled chan struct{}
+}
+
+func echo(body string) *testpb.StreamingOutputCallResponse {
+	return &testpb.StreamingOutputCallResponse{Payload: &testpb.Payload{Body: []byte(body)}}
+}
+
+func (s *echoServer) StreamingOutputCall(req *testpb.StreamingOutputCallRequest, stream testpb.TestService_StreamingOutputCallServer) error {
+	if code := req.GetResponseStatus().GetCode(); code != 0 {
+		return status.Error(codes.Code(code), "echo failed")
+	}
+	if string(req.GetPayload().GetBody()) == "wait" {
+		close(s.started)
+		<-stream.Context().Done()
+		close(s.cancelled)
+		return stream.Context().Err()
+	}
+	md, _ := metadata.FromIncomingContext(stream.Context())
+	for _, body := range []string{req.GetResponseStatus().GetMessage(), string(req.GetPayload().GetBody()), strings.Join(md.Get("authorization"), ",")} {
+		if err := stream.Send(echo(body)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (s *echoServer) FullDuplexCall(stream testpb.TestService_FullDuplexCallServer) error {
+	for {
+		req, err := stream.Recv()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		if err := stream.Send(echo(string(req.GetPayload().GetBody()))); err != nil {
+			return err
+		}
+	}
+}
+
+// serveProxy serves the echo server's streams through a stream proxy
+func serveProxy(t *testing.T, echo *echoServer) *httptest.Server {
+	t.Helper()
+	lis := bufconn.Listen(1024 * 1024)
+	grpcServer := grpc.NewServer()
+	testpb.RegisterTestServiceServer(grpcServer, echo)
+	go grpcServer.Serve(lis)
+	t.Cleanup(grpcServer.Stop)
+	conn, err := grpc.NewClient("passthrough:///bufnet",
+		grpc.WithContextDialer(func(ctx context.Context, _ string) (net.Conn, error) {
+			return lis.DialContext(ctx)
+		}),
+		grpc.WithTransportCredentials(insecure.NewCredentials()),
+	)
+	if err != nil {
+		t.Fatalf("failed to dial bufconn: %v", err)
+	}
+	t.Cleanup(func() { conn.Close() })
+
+	d, err := protoregistry.GlobalFiles.FindDescriptorByName("grpc.testing.TestService")
+	if err != nil {
+		t.Fatal(err)
+	}
+	methods := d.(protoreflect.ServiceDescriptor).Methods()
+	// The test service has no HTTP bindings, so give its streams some
+	proxy := &streamProxy{conn: conn, mux: runtime.NewServeMux(), routes: []streamRoute{
+		newStreamRoute(methods.ByName("StreamingOutputCall"), "/v1/echo/{response_status.message=msgs/*}"),
+		newStreamRoute(methods.ByName("FullDuplexCall"), "/v1/duplex"),
+	}}
+	srv := httptest.NewServer(proxy)
+	t.Cleanup(srv.Close)
+	return srv
+}
+
+func dialProxy(t *testing.T, srv *httptest.Server, path string, header http.Header) *websocket.Conn {
+	t.Helper()
+	ws, _, err := websocket.DefaultDialer.Dial("ws"+strings.TrimPrefix(srv.URL, "http")+path, header)
+	if err != nil {
+		t.Fatalf("failed to dial %s: %v", path, err)
+	}
+	t.Cleanup(func() { ws.Close() })
+	return ws
+}
+
+// readEchoes reads responses until the socket is closed and returns their
+// bodies and the close error
+func readEchoes(t *testing.T, ws *websocket.Conn) ([]string, error) {
+	t.Helper()
+	var bodies []string
+	for {
+		ws.SetReadDeadline(time.Now().Add(5 * time.Second))
+		_, b, err := ws.ReadMessage()
+		if err != nil {
+			return bodies, err
+		}
+		resp := &testpb.StreamingOutputCallResponse{}
+		if err := protojson.Unmarshal(b, resp); err != nil {
+			t.Fatalf("response %s: %v", b, err)
+		}
+		bodies = append(bodies, string(resp.GetPayload().GetBody()))
+	}
+}
+
+func TestStreamProxyServerStream(t *testing.T) {
+	srv := serveProxy(t, &echoServer{})
+	query := url.Values{"payload.body": {base64.StdEncoding.EncodeToString([]byte("from query"))}}
+	ws := dialProxy(t, srv, "/v1/echo/msgs/from%20path?"+query.Encode(), http.Header{"Authorization": {"Bearer token"}})
+
+	bodies, err := readEchoes(t, ws)
+	if strings.Join(bodies, "|") != "msgs/from path|from query|Bearer token" {
+		t.Errorf("responses = %q", bodies)
+	}
+	if !websocket.IsCloseError(err, websocket.CloseNormalClosure) {
+		t.Errorf("end of stream = %v, want a normal closure", err)
+	}
+
+	ws = dialProxy(t, srv, "/v1/echo/msgs/x?response_status.code=5", nil)
+	if _, err := readEchoes(t, ws); !websocket.IsCloseError(err, statusCloseBase+int(codes.NotFound)) || !strings.Contains(err.Error(), "echo failed") {
+		t.Errorf("failed stream = %v, want its status in a close frame", err)
+	}
+}
+
+func TestStreamProxyBidi(t *testing.T) {
+	ws := dialProxy(t, serveProxy(t, &echoServer{}), "/v1/duplex", nil)
+	for _, body := range []string{"one", "two"} {
+		req := `{"payload":{"body":"` + base64.StdEncoding.EncodeToString([]byte(body)) + `"}}`
+		if err := ws.WriteMessage(websocket.TextMessage, []byte(req)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	ws.WriteMessage(websocket.TextMessage, nil) // end the requests
+	bodies, err := readEchoes(t, ws)
+	if strings.Join(bodies, "|") != "one|two" || !websocket.IsCloseError(err, websocket.CloseNormalClosure) {
+		t.Errorf("responses = %q, %v", bodies, err)
+	}
+
+	ws = dialProxy(t, serveProxy(t, &echoServer{}), "/v1/duplex", nil)
+	ws.WriteMessage(websocket.TextMessage, []byte(`{"payload":7}`))
+	if _, err := readEchoes(t, ws); !websocket.IsCloseError(err, statusCloseBase+int(codes.InvalidArgument)) {
+		t.Errorf("invalid request = %v, want a close frame with code 4003", err)
+	}
+}
+
+func TestStreamProxyCancel(t *testing.T) {
+	echo := &echoServer{started: make(chan struct{}), cancelled: make(chan struct{})}
+	srv := serveProxy(t, echo)
+	ws := dialProxy(t, srv, "/v1/echo/msgs/x?payload.body="+base64.URLEncoding.EncodeToString([]byte("wait")), nil)
+	<-echo.started
+	ws.Close()
+	select {
+	case <-echo.cancelled:
+	case <-time.After(5 * time.Second):
+		t.Fatal("the stream outlived the socket")
+	}
+
+	// Requests that are not upgrades go to the gateway
+	resp, err := http.Get(srv.URL + "/v1/echo/msgs/x")
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusNotFound {
+		t.Errorf("plain GET = %d, want the empty gateway's 404", resp.StatusCode)
+	}
+}
+
+func TestCloseCode(t *testing.T) {
+	tests := []struct {
+		err  error
+		want int
+	}{
+		{nil, websocket.CloseNormalClosure},
+		{io.EOF, websocket.CloseNormalClosure},
+		{status.Error(codes.Internal, ""), websocket.CloseInternalServerErr},
+		{errors.New("not a status"), websocket.CloseInternalServerErr},
+		{status.Error(codes.Unavailable, ""), websocket.CloseTryAgainLater},
+		{status.Error(codes.NotFound, ""), 4005},
+		{status.Error(codes.PermissionDenied, ""), 4007},
+		{status.Error(codes.Unauthenticated, ""), 4016},
+	}
+	for _, tt := range tests {
+		if got := closeCode(tt.err); got != tt.want {
+			t.Errorf("closeCode(%v) = %d, want %d", tt.err, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,160 @@
+package handler
+
+import (
+	"fmt"
+	"io"
+	"log"
+	"mime"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/grpc-ecosystem/grpc-gateway/v2/runtime"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protoreflect"
+)
+
+// resumeTokenField names the request and response fields through which a
+// stream can be resumed with Last-Event-ID
+const resumeTokenField = "resume_token"
+
+// acceptsEventStream reports whether r asks for Server-Sent Events
+func acceptsEventStream(r *http.Request) bool {
+	for _, accept := range strings.Split(r.Header.Get("Accept"), ",") {
+		if mt, _, err := mime.ParseMediaType(accept); err == nil && mt == "text/event-stream" {
+			return true
+		}
+	}
+	return false
+}
+
+// resumeFields returns the resume_token string fields of md's request and
+// response, or nils when it has not got both
+func resumeFields(md protoreflect.MethodDescriptor) (req, resp protoreflect.FieldDescriptor) {
+	stringField := func(msg protoreflect.MessageDescriptor) protoreflect.FieldDescriptor {
+		fd := msg.Fields().ByName(resumeTokenField)
+		if fd == nil || fd.Kind() != protoreflect.StringKind || fd.IsList() {
+			return nil
+		}
+		return fd
+	}
+	req, resp = stringField(md.Input()), stringField(md.Output())
+	if req == nil || resp == nil {
+		return nil, nil
+	}
+	return req, resp
+}
+
+// serveEvents relays a server stream as Server-Sent Events: each response is
+// a message event with protojson data, and a status event with the
+// google.rpc.Status of the stream ends it. When the RPC has resume_token
+// fields, as StreamTodos does, each event's id is the response's token and
+// a Last-Event-ID header sets the request's, so EventSource resumes where it
+// left off. A stream that fails before its headers is answered as the
+// gateway answers a failed call, which stops EventSource reconnecting.
+func (p *streamProxy) serveEvents(w http.ResponseWriter, r *http.Request, route streamRoute, values []string) {
+	md := route.method
+	fullMethod := fmt.Sprintf("/%s/%s", md.Parent().FullName(), md.Name())
+	_, marshaler := runtime.MarshalerForRequest(p.mux, r)
+	fail := func(err error) { runtime.HTTPError(r.Context(), p.mux, marshaler, w, r, err) }
+
+	req, err := serverRequest(r, route, values)
+	if err != nil {
+		fail(status.Error(codes.InvalidArgument, err.Error()))
+		return
+	}
+	reqToken, respToken := resumeFields(md)
+	if id := r.Header.Get("Last-Event-ID"); id != "" && reqToken != nil {
+		req.ProtoReflect().Set(reqToken, protoreflect.ValueOfString(id))
+	}
+	ctx, err := runtime.AnnotateContext(r.Context(), p.mux, r, fullMethod, runtime.WithHTTPPathPattern(route.template))
+	if err != nil {
+		fail(err)
+		return
+	}
+
+	desc := &grpc.StreamDesc{StreamName: string(md.Name()), ServerStreams: true}
+	stream, err := p.conn.NewStream(ctx, desc, fullMethod)
+	if err == nil && stream.SendMsg(req) == nil {
+		err = stream.CloseSend()
+	}
+	if err != nil {
+		fail(err)
+		return
+	}
+	// Without headers the stream is already over
+	if header, _ := stream.Header(); header == nil {
+		if err := stream.RecvMsg(newMessage(md.Output())); err != io.EOF {
+			fail(err)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("X-Accel-Buffering", "no") // stop nginx holding events back
+	w.WriteHeader(http.StatusOK)
+	rc := http.NewResponseController(w)
+	rc.Flush()
+
+	msgs, end := make(chan proto.Message), make(chan error, 1)
+	go func() {
+		for {
+			msg := newMessage(md.Output())
+			if err := stream.RecvMsg(msg); err != nil {
+				end <- err
+				return
+			}
+			select {
+			case msgs <- msg:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+
+	// Comments keep idle connections open through proxies
+	var pings <-chan time.Time
+	if p.opts.PingInterval > 0 {
+		ticker := time.NewTicker(p.opts.PingInterval)
+		defer ticker.Stop()
+		pings = ticker.C
+	}
+	for {
+		var event string
+		select {
+		case <-ctx.Done():
+			return
+		case <-pings:
+			event = ": ping\n\n"
+		case msg := <-msgs:
+			b, err := protojson.Marshal(msg)
+			if err != nil {
+				log.Printf("failed to marshal %s: %v", md.Output().FullName(), err)
+				return
+			}
+			if respToken != nil {
+				event = "id: " + msg.ProtoReflect().Get(respToken).String() + "\n"
+			}
+			event += "data: " + string(b) + "\n\n"
+		case err := <-end:
+			if err == io.EOF {
+				err = nil
+			}
+			b, _ := protojson.Marshal(status.Convert(err).Proto())
+			fmt.Fprintf(w, "event: status\ndata: %s\n\n", b)
+			rc.Flush()
+			return
+		}
+		if _, err := io.WriteString(w, event); err != nil {
+			return
+		}
+		rc.Flush()
+	}
+}
@@ -0,0 +1,143 @@
+package handler
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"grpc_anotation_sample/pb"
+	"grpc_anotation_sample/services"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/grpc-ecosystem/grpc-gateway/v2/runtime"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/test/bufconn"
+	"google.golang.org/protobuf/reflect/protoreflect"
+)
+
+// sseEvent is an event as sent: its fields by name
+type sseEvent map[string]string
+
+// getEvents requests path as Server-Sent Events. The stream is read until it
+// ends or n events arrive, whichever is first.
+func getEvents(t *testing.T, url string, header http.Header, n int) (*http.Response, []sseEvent) {
+	t.Helper()
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	req, _ := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	req.Header = header.Clone()
+	if req.Header == nil {
+		req.Header = http.Header{}
+	}
+	req.Header.Set("Accept", "text/event-stream")
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("GET %s: %v", url, err)
+	}
+	defer resp.Body.Close()
+	if resp.Header.Get("Content-Type") != "text/event-stream" {
+		return resp, nil
+	}
+
+	var events []sseEvent
+	event := sseEvent{}
+	lines := bufio.NewScanner(resp.Body)
+	for len(events) < n && lines.Scan() {
+		line := lines.Text()
+		if line == "" {
+			events, event = append(events, event), sseEvent{}
+			continue
+		}
+		name, value, _ := strings.Cut(line, ": ")
+		event[name] += value
+	}
+	return resp, events
+}
+
+func TestStreamProxyEvents(t *testing.T) {
+	srv := serveProxy(t, &echoServer{})
+
+	resp, events := getEvents(t, srv.URL+"/v1/echo/msgs/a", http.Header{"Authorization": {"Bearer token"}}, 10)
+	var got []string
+	for _, e := range events {
+		// protojson varies its spacing, so compare the data as re-encoded
+		var data any
+		json.Unmarshal([]byte(e["data"]), &data)
+		b, _ := json.Marshal(data)
+		got = append(got, e["event"]+" "+string(b))
+	}
+	want := []string{
+		` {"payload":{"body":"bXNncy9h"}}`, // msgs/a
+		` {"payload":{}}`,
+		` {"payload":{"body":"QmVhcmVyIHRva2Vu"}}`, // Bearer token
+		`status {}`,
+	}
+	if resp.StatusCode != http.StatusOK || strings.Join(got, "\n") != strings.Join(want, "\n") {
+		t.Errorf("events = %d %q, want %q", resp.StatusCode, got, want)
+	}
+	for _, e := range events {
+		if _, ok := e["id"]; ok {
+			t.Errorf("event %v has an id, but the RPC cannot resume", e)
+		}
+	}
+
+	// A stream that fails at once is answered like a failed call
+	resp, _ = getEvents(t, srv.URL+"/v1/echo/msgs/a?response_status.code=5", nil, 1)
+	if resp.StatusCode != http.StatusNotFound {
+		t.Errorf("failed stream = %d, want 404", resp.StatusCode)
+	}
+	resp, _ = getEvents(t, srv.URL+"/v1/duplex", nil, 1)
+	if resp.StatusCode != http.StatusNotFound {
+		t.Errorf("bidi stream as events = %d, want the gateway's 404", resp.StatusCode)
+	}
+}
+
+func TestStreamProxyEventsResume(t *testing.T) {
+	lis := bufconn.Listen(1024 * 1024)
+	grpcServer := grpc.NewServer()
+	svc := services.NewTodoService(services.TodoStreamOptions{})
+	pb.RegisterTodoServiceServer(grpcServer, svc)
+	go grpcServer.Serve(lis)
+	t.Cleanup(grpcServer.Stop)
+	conn, err := grpc.NewClient("passthrough:///bufnet",
+		grpc.WithContextDialer(func(ctx context.Context, _ string) (net.Conn, error) {
+			return lis.DialContext(ctx)
+		}),
+		grpc.WithTransportCredentials(insecure.NewCredentials()),
+	)
+	if err != nil {
+		t.Fatalf("failed to dial bufconn: %v", err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	srv := httptest.NewServer(StreamProxy(conn, runtime.NewServeMux(), []protoreflect.FileDescriptor{pb.File_todo_proto}, StreamOptions{}))
+	t.Cleanup(srv.Close)
+
+	for _, title := range []string{"a", "b", "c"} {
+		svc.CreateTodo(context.Background(), &pb.CreateTodoRequest{Title: title})
+	}
+	title := func(e sseEvent) string {
+		var event struct{ Todo struct{ Title string } }
+		json.Unmarshal([]byte(e["data"]), &event)
+		return event.Todo.Title
+	}
+
+	_, events := getEvents(t, srv.URL+"/v1/todos/stream", nil, 1)
+	if len(events) != 1 || title(events[0]) != "a" || events[0]["id"] == "" {
+		t.Fatalf("events = %v, want the first todo with an id", events)
+	}
+	// EventSource reconnects with the id of the last event it received
+	_, resumed := getEvents(t, srv.URL+"/v1/todos/stream", http.Header{"Last-Event-ID": {events[0]["id"]}}, 2)
+	if len(resumed) != 2 || title(resumed[0]) != "b" || title(resumed[1]) != "c" {
+		t.Errorf("resumed events = %v, want b and c", resumed)
+	}
+
+	resp, _ := getEvents(t, srv.URL+"/v1/todos/stream", http.Header{"Last-Event-ID": {"nonsense"}}, 1)
+	if resp.StatusCode != http.StatusBadRequest {
+		t.Errorf("resume from a bad id = %d, want 400", resp.StatusCode)
+	}
+}
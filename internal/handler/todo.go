@@ -2,13 +2,22 @@ package handler
 
 import (
 	"context"
+	"encoding/json"
 	"grpc_anotation_sample/pb"
 	"io"
 	"log"
 	"net/http"
+	"sync"
+	"time"
 
 	"github.com/gorilla/websocket"
+	"github.com/grpc-ecosystem/grpc-gateway/v2/runtime"
 	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/types/known/emptypb"
 )
 
 var upgrader = websocket.Upgrader{
@@ -17,45 +26,326 @@ var upgrader = websocket.Upgrader{
 	},
 }
 
-func TodoStreamHandler(w http.ResponseWriter, r *http.Request, conn *grpc.ClientConn) {
+// writeWait bounds writing a control frame
+const writeWait = time.Second
+
+// StreamOptions configure the WebSocket streams. The server pings the client
+// every PingInterval and drops a socket that has not answered within two
+// intervals; zero turns pings off.
+type StreamOptions struct {
+	PingInterval time.Duration
+}
+
+// commandTimeout bounds the RPC of a command
+const commandTimeout = 10 * time.Second
+
+// todoCommand is a frame sent by the client. Params is the protojson request
+// of the command's RPC.
+type todoCommand struct {
+	CorrelationID string          `json:"correlationId"`
+	Command       string          `json:"command"`
+	Params        json.RawMessage `json:"params"`
+}
+
+// todoReply answers a command with its correlation id, and either the
+// protojson response of its RPC or its google.rpc.Status.
+type todoReply struct {
+	CorrelationID string          `json:"correlationId"`
+	Result        json.RawMessage `json:"result,omitempty"`
+	Error         json.RawMessage `json:"error,omitempty"`
+}
+
+// invalidCommand answers a frame that is not a command, or one without a
+// correlation id, with the google.rpc.Status of the problem
+type invalidCommand struct {
+	Error json.RawMessage `json:"invalidCommand"`
+}
+
+// TodoStreamHandler bridges a WebSocket to TodoService. It relays StreamTodos
+// as protojson TodoEvents, starting with a resume_token query parameter as in
+// StreamTodosRequest, and runs the commands the client sends:
+//
+//	create      CreateTodoRequest
+//	complete    CompleteTodoRequest
+//	delete      DeleteTodoRequest
+//	subscribe   StreamTodosRequest, replacing the current stream
+//	unsubscribe no params; stops the stream
+//
+// Each command is answered by a frame with its correlationId. Events never
+// have one, which tells them from replies. A frame that is not a command
+// with a correlationId is answered by an invalidCommand frame.
+//
+// The RPCs carry the request's headers as metadata, as mux forwards them,
+// and are cancelled when the socket closes.
+func TodoStreamHandler(w http.ResponseWriter, r *http.Request, conn *grpc.ClientConn, mux *runtime.ServeMux, opts StreamOptions) {
+	ctx, err := runtime.AnnotateContext(r.Context(), mux, r, pb.TodoService_StreamTodos_FullMethodName, runtime.WithHTTPPathPattern("/v1/todos/stream"))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
 	ws, err := upgrader.Upgrade(w, r, nil)
 	if err != nil {
 		log.Printf("failed to upgrade to websocket: %v", err)
 		return
 	}
-	defer ws.Close()
+	stopPings := keepAlive(ws, opts.PingInterval)
+	defer stopPings()
 
-	client := pb.NewTodoServiceClient(conn)
-	stream, err := client.StreamTodos(context.Background(), &pb.StreamTodosRequest{})
+	s := &todoSocket{ws: ws, client: pb.NewTodoServiceClient(conn)}
+	s.ctx, s.end = context.WithCancel(ctx)
+	defer s.close()
+	relay, err := s.subscribe("", &pb.StreamTodosRequest{ResumeToken: r.URL.Query().Get("resume_token")})
 	if err != nil {
+		// Tell the client why, e.g. an expired resume token
 		log.Printf("failed to create todo stream: %v", err)
+		closeWithStatus(ws, err)
 		return
 	}
+	relay()
 
-	go func() {
-		for {
-			todo, err := stream.Recv()
-			if err == io.EOF {
-				return
+	for {
+		kind, msg, err := ws.ReadMessage()
+		if err != nil {
+			if websocket.IsUnexpectedCloseError(err, websocket.CloseGoingAway, websocket.CloseAbnormalClosure) {
+				log.Printf("error reading from websocket: %v", err)
 			}
-			if err != nil {
-				log.Printf("failed to receive todo from stream: %v", err)
+			break
+		}
+		if kind == websocket.TextMessage {
+			s.handle(msg)
+		}
+	}
+}
+
+// todoSocket is a WebSocket bridged to TodoService. Commands run one at a
+// time, in the order received, while events are relayed alongside.
+type todoSocket struct {
+	ws     *websocket.Conn
+	client pb.TodoServiceClient
+	ctx    context.Context // the parent of every RPC; done once the socket closes
+	end    context.CancelFunc
+	relays sync.WaitGroup
+
+	// mu serializes writes to ws, which allows one writer, and guards cancel
+	mu     sync.Mutex
+	cancel context.CancelFunc // ends the current subscription
+}
+
+// close cancels the socket's RPCs, then closes it, which fails a write the
+// relay may be blocked in, and waits for the relay to return
+func (s *todoSocket) close() {
+	s.end()
+	s.ws.Close()
+	s.relays.Wait()
+}
+
+// handle runs a command and writes its reply
+func (s *todoSocket) handle(msg []byte) {
+	var cmd todoCommand
+	if err := json.Unmarshal(msg, &cmd); err != nil {
+		s.invalid(status.Errorf(codes.InvalidArgument, "malformed command: %v", err))
+		return
+	}
+	if cmd.CorrelationID == "" {
+		s.invalid(status.Error(codes.InvalidArgument, "command has no correlationId"))
+		return
+	}
+	ctx, cancel := context.WithTimeout(s.ctx, commandTimeout)
+	defer cancel()
+
+	var resp proto.Message
+	var err error
+	switch cmd.Command {
+	case "create":
+		resp, err = call(ctx, cmd.Params, s.client.CreateTodo)
+	case "complete":
+		resp, err = call(ctx, cmd.Params, s.client.CompleteTodo)
+	case "delete":
+		resp, err = call(ctx, cmd.Params, s.client.DeleteTodo)
+	case "subscribe":
+		req := &pb.StreamTodosRequest{}
+		if err = unmarshalParams(cmd.Params, req); err != nil {
+			break
+		}
+		var relay func()
+		if relay, err = s.subscribe(cmd.CorrelationID, req); err == nil {
+			resp = &emptypb.Empty{}
+			defer relay() // after the reply, so that it comes before the events
+		}
+	case "unsubscribe":
+		s.unsubscribe()
+		resp = &emptypb.Empty{}
+	default:
+		err = status.Errorf(codes.InvalidArgument, "unknown command %q (want create, complete, delete, subscribe or unsubscribe)", cmd.Command)
+	}
+	s.reply(cmd.CorrelationID, resp, err)
+}
+
+// call runs a unary RPC with its request read from params
+func call[Req any, PReq interface {
+	*Req
+	proto.Message
+}, Resp proto.Message](ctx context.Context, params json.RawMessage, rpc func(context.Context, PReq, ...grpc.CallOption) (Resp, error)) (proto.Message, error) {
+	req := PReq(new(Req))
+	if err := unmarshalParams(params, req); err != nil {
+		return nil, err
+	}
+	return rpc(ctx, req)
+}
+
+func unmarshalParams(params json.RawMessage, req proto.Message) error {
+	if len(params) == 0 {
+		return nil
+	}
+	if err := protojson.Unmarshal(params, req); err != nil {
+		return status.Errorf(codes.InvalidArgument, "invalid params: %v", err)
+	}
+	return nil
+}
+
+// reply writes the answer to the command with the given correlation id
+func (s *todoSocket) reply(correlationID string, resp proto.Message, err error) {
+	r := todoReply{CorrelationID: correlationID}
+	if err != nil {
+		r.Error = statusJSON(err)
+	} else if r.Result, err = protojson.Marshal(resp); err != nil {
+		r.Error, _ = protojson.Marshal(status.Newf(codes.Internal, "failed to marshal response: %v", err).Proto())
+	}
+	b, _ := json.Marshal(r)
+	s.write(nil, b)
+}
+
+// invalid writes the invalidCommand frame for a frame that is not a command
+func (s *todoSocket) invalid(err error) {
+	b, _ := json.Marshal(invalidCommand{Error: statusJSON(err)})
+	s.write(nil, b)
+}
+
+// statusJSON is the protojson google.rpc.Status of err
+func statusJSON(err error) json.RawMessage {
+	b, _ := protojson.Marshal(status.Convert(err).Proto())
+	return b
+}
+
+// write sends a text frame. A frame of the subscription ctx is dropped once
+// it has ended, so a replaced subscription cannot send after its successor.
+func (s *todoSocket) write(ctx context.Context, b []byte) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if ctx != nil && ctx.Err() != nil {
+		return ctx.Err()
+	}
+	return s.ws.WriteMessage(websocket.TextMessage, b)
+}
+
+// subscribe ends the current subscription and opens a stream for req,
+// returning once the stream has started or failed. The returned function
+// starts relaying it. Errors of a stream that fails later are reported in a
+// second reply to the command that opened it; those of the initial stream,
+// which has no correlation id, close the socket.
+func (s *todoSocket) subscribe(correlationID string, req *pb.StreamTodosRequest) (relay func(), err error) {
+	s.unsubscribe()
+	ctx, cancel := context.WithCancel(s.ctx)
+	stream, err := s.client.StreamTodos(ctx, req)
+	if err == nil {
+		err = started(stream)
+	}
+	if err != nil {
+		cancel()
+		return nil, err
+	}
+	s.mu.Lock()
+	s.cancel = cancel
+	s.mu.Unlock()
+	return func() {
+		s.relays.Add(1)
+		go func() {
+			defer s.relays.Done()
+			s.relay(ctx, correlationID, stream)
+		}()
+	}, nil
+}
+
+// started waits for the headers StreamTodos sends once the stream is open,
+// and returns the error of a stream that failed before, such as an expired
+// resume token
+func started(stream pb.TodoService_StreamTodosClient) error {
+	md, err := stream.Header()
+	if err != nil || md != nil {
+		return err
+	}
+	// The stream ended without headers; Recv returns its status
+	if _, err := stream.Recv(); err != io.EOF {
+		return err
+	}
+	return nil
+}
+
+func (s *todoSocket) unsubscribe() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.cancel != nil {
+		s.cancel()
+		s.cancel = nil
+	}
+}
+
+func (s *todoSocket) relay(ctx context.Context, correlationID string, stream pb.TodoService_StreamTodosClient) {
+	for {
+		event, err := stream.Recv()
+		if err == io.EOF || ctx.Err() != nil {
+			return
+		}
+		if err != nil {
+			log.Printf("failed to receive todo from stream: %v", err)
+			if correlationID != "" {
+				s.reply(correlationID, nil, err)
 				return
 			}
-			if err := ws.WriteJSON(todo); err != nil {
+			// Tell the client why, e.g. an expired resume token
+			closeWithStatus(s.ws, err)
+			return
+		}
+		b, err := protojson.Marshal(event)
+		if err != nil {
+			log.Printf("failed to marshal todo event: %v", err)
+			return
+		}
+		if err := s.write(ctx, b); err != nil {
+			if ctx.Err() == nil {
 				log.Printf("failed to write todo to websocket: %v", err)
-				return
 			}
+			return
 		}
-	}()
+	}
+}
 
-	for {
-		_, _, err := ws.ReadMessage()
-		if err != nil {
-			if websocket.IsUnexpectedCloseError(err, websocket.CloseGoingAway, websocket.CloseAbnormalClosure) {
-				log.Printf("error reading from websocket: %v", err)
+// keepAlive pings ws every interval until the returned function is called,
+// and makes reads fail once the client has been silent for two intervals.
+// It must be called before ws is read from.
+func keepAlive(ws *websocket.Conn, interval time.Duration) (stop func()) {
+	if interval <= 0 {
+		return func() {}
+	}
+	extend := func(string) error { return ws.SetReadDeadline(time.Now().Add(2 * interval)) }
+	extend("")
+	ws.SetPongHandler(extend)
+
+	done := make(chan struct{})
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-done:
+				return
+			case <-ticker.C:
+				// WriteControl may be called alongside the relay's writes
+				if err := ws.WriteControl(websocket.PingMessage, nil, time.Now().Add(writeWait)); err != nil {
+					return
+				}
 			}
-			break
 		}
-	}
+	}()
+	return func() { close(done) }
 }
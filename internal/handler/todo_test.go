@@ -0,0 +1,203 @@
+package handler
+
+import (
+	"context"
+	"encoding/json"
+	"grpc_anotation_sample/pb"
+	"grpc_anotation_sample/services"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"github.com/grpc-ecosystem/grpc-gateway/v2/runtime"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/test/bufconn"
+)
+
+// dialTodoSocket serves a TodoService behind TodoStreamHandler and opens a
+// WebSocket to it with the given query string and headers.
+func dialTodoSocket(t *testing.T, query string, header http.Header, opts ...grpc.ServerOption) *websocket.Conn {
+	t.Helper()
+	lis := bufconn.Listen(1024 * 1024)
+	grpcServer := grpc.NewServer(opts...)
+	pb.RegisterTodoServiceServer(grpcServer, services.NewTodoService(services.TodoStreamOptions{}))
+	go grpcServer.Serve(lis)
+	t.Cleanup(grpcServer.Stop)
+	conn, err := grpc.NewClient("passthrough:///bufnet",
+		grpc.WithContextDialer(func(ctx context.Context, _ string) (net.Conn, error) {
+			return lis.DialContext(ctx)
+		}),
+		grpc.WithTransportCredentials(insecure.NewCredentials()),
+	)
+	if err != nil {
+		t.Fatalf("failed to dial bufconn: %v", err)
+	}
+	t.Cleanup(func() { conn.Close() })
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		TodoStreamHandler(w, r, conn, runtime.NewServeMux(), StreamOptions{})
+	}))
+	t.Cleanup(srv.Close)
+	ws, _, err := websocket.DefaultDialer.Dial("ws"+strings.TrimPrefix(srv.URL, "http")+query, header)
+	if err != nil {
+		t.Fatalf("failed to dial websocket: %v", err)
+	}
+	t.Cleanup(func() { ws.Close() })
+	return ws
+}
+
+// frame is a reply or an event as received, both JSON objects
+type frame map[string]any
+
+func send(t *testing.T, ws *websocket.Conn, cmd string) {
+	t.Helper()
+	if err := ws.WriteMessage(websocket.TextMessage, []byte(cmd)); err != nil {
+		t.Fatalf("failed to send %s: %v", cmd, err)
+	}
+}
+
+func receive(t *testing.T, ws *websocket.Conn) frame {
+	t.Helper()
+	ws.SetReadDeadline(time.Now().Add(5 * time.Second))
+	_, b, err := ws.ReadMessage()
+	if err != nil {
+		t.Fatalf("failed to read frame: %v", err)
+	}
+	var f frame
+	if err := json.Unmarshal(b, &f); err != nil {
+		t.Fatalf("frame %s is not JSON: %v", b, err)
+	}
+	return f
+}
+
+func (f frame) get(path string) any {
+	var v any = map[string]any(f)
+	for _, key := range strings.Split(path, ".") {
+		m, _ := v.(map[string]any)
+		v = m[key]
+	}
+	return v
+}
+
+func TestTodoStreamCommands(t *testing.T) {
+	ws := dialTodoSocket(t, "", nil)
+
+	send(t, ws, `{"correlationId":"1","command":"create","params":{"title":"Buy milk"}}`)
+	// The reply and the event of the new todo may come in either order
+	var id string
+	for range 2 {
+		f := receive(t, ws)
+		switch {
+		case f.get("correlationId") == "1":
+			id, _ = f.get("result.todo.id").(string)
+		case f.get("type") == "CREATED":
+			if f.get("todo.title") != "Buy milk" {
+				t.Errorf("event = %v, want the new todo", f)
+			}
+		default:
+			t.Fatalf("unexpected frame %v", f)
+		}
+	}
+	if id == "" {
+		t.Fatal("create reply has no todo id")
+	}
+
+	tests := []struct {
+		name, cmd, path string
+		want            any
+	}{
+		{"complete missing", `{"correlationId":"2","command":"complete","params":{"id":"missing"}}`, "error.code", float64(5)},
+		{"bad params", `{"correlationId":"3","command":"delete","params":{"nope":1}}`, "error.code", float64(3)},
+		{"unknown command", `{"correlationId":"4","command":"rename"}`, "error.code", float64(3)},
+		{"malformed", `not json`, "invalidCommand.code", float64(3)},
+		{"no correlation id", `{"command":"create","params":{"title":"Lost"}}`, "invalidCommand.code", float64(3)},
+		{"subscribe", `{"correlationId":"5","command":"subscribe","params":{"types":["COMPLETED"]}}`, "result", map[string]any{}},
+	}
+	for _, tt := range tests {
+		send(t, ws, tt.cmd)
+		f := receive(t, ws)
+		if got := f.get(tt.path); !jsonEqual(got, tt.want) {
+			t.Errorf("%s: reply %v has %s = %v, want %v", tt.name, f, tt.path, got, tt.want)
+		}
+	}
+
+	// The new subscription only sends completions
+	send(t, ws, `{"correlationId":"6","command":"create","params":{"title":"Walk dog"}}`)
+	if f := receive(t, ws); f.get("correlationId") != "6" {
+		t.Fatalf("frame = %v, want the create reply alone", f)
+	}
+	send(t, ws, `{"correlationId":"7","command":"complete","params":{"id":"`+id+`"}}`)
+	got := map[any]bool{}
+	for range 2 {
+		f := receive(t, ws)
+		got[f.get("correlationId")], got[f.get("type")] = true, true
+	}
+	if !got["7"] || !got["COMPLETED"] {
+		t.Errorf("frames = %v, want the complete reply and the completion", got)
+	}
+}
+
+func TestTodoStreamSubscribeError(t *testing.T) {
+	ws := dialTodoSocket(t, "", nil)
+
+	// A stream that fails to start is the command's only reply, and the
+	// socket stays open for the next one
+	send(t, ws, `{"correlationId":"1","command":"subscribe","params":{"resumeToken":"nonsense"}}`)
+	if f := receive(t, ws); f.get("correlationId") != "1" || f.get("result") != nil || f.get("error.code") != float64(3) {
+		t.Fatalf("frame = %v, want the stream's InvalidArgument alone", f)
+	}
+	send(t, ws, `{"correlationId":"2","command":"unsubscribe"}`)
+	if f := receive(t, ws); f.get("correlationId") != "2" || f.get("error") != nil {
+		t.Errorf("frame = %v, want the unsubscribe result", f)
+	}
+}
+
+func TestTodoStreamInitialError(t *testing.T) {
+	ws := dialTodoSocket(t, "?resume_token=nonsense", nil)
+	ws.SetReadDeadline(time.Now().Add(5 * time.Second))
+	_, _, err := ws.ReadMessage()
+	if !websocket.IsCloseError(err, statusCloseBase+int(codes.InvalidArgument)) {
+		t.Errorf("read = %v, want a close frame with code 4003", err)
+	}
+}
+
+func TestTodoStreamContext(t *testing.T) {
+	// The interceptor sees each StreamTodos call's metadata and its end
+	auth, done := make(chan string, 1), make(chan struct{})
+	intercept := func(srv any, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+		md, _ := metadata.FromIncomingContext(ss.Context())
+		auth <- strings.Join(md.Get("authorization"), ",")
+		err := handler(srv, ss)
+		close(done)
+		return err
+	}
+	ws := dialTodoSocket(t, "", http.Header{"Authorization": {"Bearer token"}}, grpc.StreamInterceptor(intercept))
+
+	select {
+	case got := <-auth:
+		if got != "Bearer token" {
+			t.Errorf("authorization = %q, want the request's", got)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("the stream was not opened")
+	}
+	ws.Close()
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("the stream outlived the socket")
+	}
+}
+
+func jsonEqual(a, b any) bool {
+	x, _ := json.Marshal(a)
+	y, _ := json.Marshal(b)
+	return string(x) == string(y)
+}
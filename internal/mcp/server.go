@@ -0,0 +1,324 @@
+// Package mcp is a minimal Model Context Protocol server: JSON-RPC 2.0 over
+// newline-delimited stdio, serving tools only.
+package mcp
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"sync"
+)
+
+// ProtocolVersion is the MCP revision the server implements. Clients asking
+// for another revision are answered with this one, as the spec requires.
+const ProtocolVersion = "2025-06-18"
+
+// JSON-RPC error codes
+const (
+	codeParseError     = -32700
+	codeInvalidRequest = -32600
+	codeMethodNotFound = -32601
+	codeInvalidParams  = -32602
+)
+
+// maxMessageSize bounds one line of input
+const maxMessageSize = 16 << 20
+
+// Tool is a callable tool. InputSchema is a JSON Schema object describing the
+// arguments, which Handler receives undecoded; OutputSchema, if set, describes
+// the structured content of successful results.
+type Tool struct {
+	Name         string           `json:"name"`
+	Title        string           `json:"title,omitempty"`
+	Description  string           `json:"description"`
+	InputSchema  json.RawMessage  `json:"inputSchema"`
+	OutputSchema json.RawMessage  `json:"outputSchema,omitempty"`
+	Annotations  *ToolAnnotations `json:"annotations,omitempty"`
+
+	Handler func(ctx context.Context, args json.RawMessage) *Result `json:"-"`
+}
+
+// ToolAnnotations are hints about a tool's behaviour for clients deciding
+// whether to ask before calling it.
+type ToolAnnotations struct {
+	ReadOnlyHint    bool  `json:"readOnlyHint,omitempty"`
+	DestructiveHint *bool `json:"destructiveHint,omitempty"`
+	IdempotentHint  bool  `json:"idempotentHint,omitempty"`
+}
+
+// Content is one item of a tool result; only text is produced
+type Content struct {
+	Type string `json:"type"`
+	Text string `json:"text"`
+}
+
+// Result is the outcome of a tool call. IsError marks a failure the model
+// should see (as opposed to a protocol error); Structured, if set, is also
+// sent as structuredContent.
+type Result struct {
+	Content    []Content `json:"content"`
+	Structured any       `json:"structuredContent,omitempty"`
+	IsError    bool      `json:"isError,omitempty"`
+}
+
+// Text returns a successful result with a formatted text message
+func Text(format string, args ...any) *Result {
+	return &Result{Content: []Content{{Type: "text", Text: fmt.Sprintf(format, args...)}}}
+}
+
+// Errorf returns a failed result with a formatted text message
+func Errorf(format string, args ...any) *Result {
+	r := Text(format, args...)
+	r.IsError = true
+	return r
+}
+
+// Server answers MCP requests for a set of tools, which may change while it
+// serves. Tool calls run concurrently, other requests in order;
+// notifications/cancelled cancels the matching call's context.
+type Server struct {
+	Name         string
+	Version      string
+	Instructions string
+	Log          *log.Logger
+
+	toolsMu sync.RWMutex
+	tools   []Tool
+	index   map[string]int
+
+	mu       sync.Mutex
+	enc      *json.Encoder
+	inFlight map[string]context.CancelFunc
+}
+
+// NewServer returns a server that introduces itself as name and version
+func NewServer(name, version string) *Server {
+	return &Server{
+		Name:     name,
+		Version:  version,
+		Log:      log.New(io.Discard, "", 0),
+		index:    map[string]int{},
+		inFlight: map[string]context.CancelFunc{},
+	}
+}
+
+// AddTool registers t, replacing a tool of the same name
+func (s *Server) AddTool(t Tool) {
+	s.toolsMu.Lock()
+	defer s.toolsMu.Unlock()
+	if i, ok := s.index[t.Name]; ok {
+		s.tools[i] = t
+		return
+	}
+	s.index[t.Name] = len(s.tools)
+	s.tools = append(s.tools, t)
+}
+
+// RemoveTools unregisters the tools for which drop returns true
+func (s *Server) RemoveTools(drop func(Tool) bool) {
+	s.toolsMu.Lock()
+	defer s.toolsMu.Unlock()
+	kept := s.tools[:0]
+	s.index = map[string]int{}
+	for _, t := range s.tools {
+		if !drop(t) {
+			s.index[t.Name] = len(kept)
+			kept = append(kept, t)
+		}
+	}
+	clear(s.tools[len(kept):])
+	s.tools = kept
+}
+
+// ToolsChanged tells the client to list the tools again. It does nothing
+// before Serve has started.
+func (s *Server) ToolsChanged() {
+	s.notifyClient("notifications/tools/list_changed")
+}
+
+func (s *Server) notifyClient(method string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.enc == nil {
+		return
+	}
+	if err := s.enc.Encode(map[string]string{"jsonrpc": "2.0", "method": method}); err != nil {
+		s.Log.Printf("write notification: %v", err)
+	}
+}
+
+func (s *Server) tool(name string) (Tool, bool) {
+	s.toolsMu.RLock()
+	defer s.toolsMu.RUnlock()
+	i, ok := s.index[name]
+	if !ok {
+		return Tool{}, false
+	}
+	return s.tools[i], true
+}
+
+type request struct {
+	JSONRPC string          `json:"jsonrpc"`
+	ID      json.RawMessage `json:"id,omitempty"`
+	Method  string          `json:"method"`
+	Params  json.RawMessage `json:"params,omitempty"`
+}
+
+type response struct {
+	JSONRPC string          `json:"jsonrpc"`
+	ID      json.RawMessage `json:"id"`
+	Result  any             `json:"result,omitempty"`
+	Error   *rpcError       `json:"error,omitempty"`
+}
+
+type rpcError struct {
+	Code    int    `json:"code"`
+	Message string `json:"message"`
+}
+
+// Serve reads requests from r and writes responses to w until r is exhausted,
+// then waits for calls in progress. Cancelling ctx cancels every call.
+func (s *Server) Serve(ctx context.Context, r io.Reader, w io.Writer) error {
+	s.mu.Lock()
+	s.enc = json.NewEncoder(w)
+	s.mu.Unlock()
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	var wg sync.WaitGroup
+	defer wg.Wait()
+
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 0, 64<<10), maxMessageSize)
+	for scanner.Scan() {
+		line := scanner.Bytes()
+		if len(line) == 0 {
+			continue
+		}
+		var req request
+		if err := json.Unmarshal(line, &req); err != nil {
+			s.send(response{ID: json.RawMessage("null"), Error: &rpcError{codeParseError, "parse error: " + err.Error()}})
+			continue
+		}
+		if req.JSONRPC != "2.0" || req.Method == "" {
+			s.send(response{ID: idOrNull(req.ID), Error: &rpcError{codeInvalidRequest, "invalid request"}})
+			continue
+		}
+		if len(req.ID) == 0 {
+			s.notify(req)
+			continue
+		}
+		if req.Method != "tools/call" {
+			result, rerr := s.handle(ctx, req)
+			s.send(response{ID: req.ID, Result: result, Error: rerr})
+			continue
+		}
+
+		callCtx, callCancel := context.WithCancel(ctx)
+		s.mu.Lock()
+		s.inFlight[string(req.ID)] = callCancel
+		s.mu.Unlock()
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			result, rerr := s.handle(callCtx, req)
+			s.mu.Lock()
+			delete(s.inFlight, string(req.ID))
+			s.mu.Unlock()
+			callCancel()
+			s.send(response{ID: req.ID, Result: result, Error: rerr})
+		}()
+	}
+	return scanner.Err()
+}
+
+func idOrNull(id json.RawMessage) json.RawMessage {
+	if len(id) == 0 {
+		return json.RawMessage("null")
+	}
+	return id
+}
+
+func (s *Server) send(resp response) {
+	resp.JSONRPC = "2.0"
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if err := s.enc.Encode(resp); err != nil {
+		s.Log.Printf("write response: %v", err)
+	}
+}
+
+// notify handles a notification, which gets no response
+func (s *Server) notify(req request) {
+	switch req.Method {
+	case "notifications/cancelled":
+		var p struct {
+			RequestID json.RawMessage `json:"requestId"`
+		}
+		if json.Unmarshal(req.Params, &p) == nil {
+			s.mu.Lock()
+			if cancel, ok := s.inFlight[string(p.RequestID)]; ok {
+				cancel()
+			}
+			s.mu.Unlock()
+		}
+	case "notifications/initialized":
+	default:
+		s.Log.Printf("ignoring notification %s", req.Method)
+	}
+}
+
+func (s *Server) handle(ctx context.Context, req request) (any, *rpcError) {
+	switch req.Method {
+	case "initialize":
+		var p struct {
+			ProtocolVersion string `json:"protocolVersion"`
+			ClientInfo      struct {
+				Name    string `json:"name"`
+				Version string `json:"version"`
+			} `json:"clientInfo"`
+		}
+		if len(req.Params) > 0 {
+			if err := json.Unmarshal(req.Params, &p); err != nil {
+				return nil, &rpcError{codeInvalidParams, "invalid initialize params: " + err.Error()}
+			}
+		}
+		s.Log.Printf("client %s %s (protocol %s)", p.ClientInfo.Name, p.ClientInfo.Version, p.ProtocolVersion)
+		result := map[string]any{
+			"protocolVersion": ProtocolVersion,
+			"capabilities":    map[string]any{"tools": map[string]any{"listChanged": true}},
+			"serverInfo":      map[string]string{"name": s.Name, "version": s.Version},
+		}
+		if s.Instructions != "" {
+			result["instructions"] = s.Instructions
+		}
+		return result, nil
+	case "ping":
+		return struct{}{}, nil
+	case "tools/list":
+		s.toolsMu.RLock()
+		defer s.toolsMu.RUnlock()
+		return map[string]any{"tools": append([]Tool{}, s.tools...)}, nil
+	case "tools/call":
+		var p struct {
+			Name      string          `json:"name"`
+			Arguments json.RawMessage `json:"arguments"`
+		}
+		if err := json.Unmarshal(req.Params, &p); err != nil {
+			return nil, &rpcError{codeInvalidParams, "invalid tools/call params: " + err.Error()}
+		}
+		tool, ok := s.tool(p.Name)
+		if !ok {
+			return nil, &rpcError{codeInvalidParams, fmt.Sprintf("unknown tool %q", p.Name)}
+		}
+		if len(p.Arguments) == 0 || string(p.Arguments) == "null" {
+			p.Arguments = json.RawMessage("{}")
+		}
+		s.Log.Printf("call %s %s", p.Name, p.Arguments)
+		return tool.Handler(ctx, p.Arguments), nil
+	}
+	return nil, &rpcError{codeMethodNotFound, fmt.Sprintf("method %s not found", req.Method)}
+}
@@ -0,0 +1,190 @@
+package mcp
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"io"
+	"strings"
+	"testing"
+	"time"
+)
+
+// session runs s over pipes and returns a function that sends one line and,
+// unless it is a notification, returns the decoded response.
+func session(t *testing.T, s *Server) func(line string) map[string]any {
+	t.Helper()
+	inR, inW := io.Pipe()
+	outR, outW := io.Pipe()
+	done := make(chan error, 1)
+	go func() {
+		done <- s.Serve(context.Background(), inR, outW)
+		outW.Close()
+	}()
+	t.Cleanup(func() {
+		inW.Close()
+		if err := <-done; err != nil {
+			t.Errorf("Serve: %v", err)
+		}
+	})
+
+	lines := bufio.NewScanner(outR)
+	return func(line string) map[string]any {
+		t.Helper()
+		if _, err := io.WriteString(inW, line+"\n"); err != nil {
+			t.Fatal(err)
+		}
+		if strings.Contains(line, `"notifications/`) {
+			return nil
+		}
+		if !lines.Scan() {
+			t.Fatalf("no response to %s", line)
+		}
+		var resp map[string]any
+		if err := json.Unmarshal(lines.Bytes(), &resp); err != nil {
+			t.Fatalf("response %s: %v", lines.Text(), err)
+		}
+		return resp
+	}
+}
+
+func echoServer() *Server {
+	s := NewServer("test", "1.2.3")
+	s.AddTool(Tool{
+		Name:        "echo",
+		Description: "Echo the text argument",
+		InputSchema: json.RawMessage(`{"type":"object","properties":{"text":{"type":"string"}}}`),
+		Handler: func(ctx context.Context, args json.RawMessage) *Result {
+			var a struct{ Text string }
+			json.Unmarshal(args, &a)
+			if a.Text == "" {
+				return Errorf("text is required")
+			}
+			return Text("%s", a.Text)
+		},
+	})
+	s.AddTool(Tool{
+		Name:        "wait",
+		Description: "Block until cancelled",
+		InputSchema: json.RawMessage(`{"type":"object"}`),
+		Handler: func(ctx context.Context, _ json.RawMessage) *Result {
+			select {
+			case <-ctx.Done():
+				return Errorf("cancelled")
+			case <-time.After(5 * time.Second):
+				return Text("done")
+			}
+		},
+	})
+	return s
+}
+
+func TestInitializeAndList(t *testing.T) {
+	send := session(t, echoServer())
+
+	resp := send(`{"jsonrpc":"2.0","id":1,"method":"initialize","params":{"protocolVersion":"2024-11-05","capabilities":{},"clientInfo":{"name":"t","version":"0"}}}`)
+	result := resp["result"].(map[string]any)
+	if result["protocolVersion"] != ProtocolVersion || result["serverInfo"].(map[string]any)["version"] != "1.2.3" {
+		t.Errorf("initialize = %v", resp)
+	}
+	if _, ok := result["capabilities"].(map[string]any)["tools"]; !ok {
+		t.Errorf("capabilities = %v, want tools", result["capabilities"])
+	}
+	send(`{"jsonrpc":"2.0","method":"notifications/initialized"}`)
+
+	resp = send(`{"jsonrpc":"2.0","id":"two","method":"tools/list"}`)
+	if resp["id"] != "two" {
+		t.Errorf("id = %v, want two", resp["id"])
+	}
+	tools := resp["result"].(map[string]any)["tools"].([]any)
+	if len(tools) != 2 || tools[0].(map[string]any)["name"] != "echo" || tools[0].(map[string]any)["inputSchema"] == nil {
+		t.Errorf("tools = %v", tools)
+	}
+}
+
+func TestCallTool(t *testing.T) {
+	send := session(t, echoServer())
+
+	resp := send(`{"jsonrpc":"2.0","id":1,"method":"tools/call","params":{"name":"echo","arguments":{"text":"hi"}}}`)
+	result := resp["result"].(map[string]any)
+	content := result["content"].([]any)[0].(map[string]any)
+	if content["type"] != "text" || content["text"] != "hi" || result["isError"] != nil {
+		t.Errorf("echo = %v", resp)
+	}
+
+	resp = send(`{"jsonrpc":"2.0","id":2,"method":"tools/call","params":{"name":"echo"}}`)
+	if resp["result"].(map[string]any)["isError"] != true {
+		t.Errorf("echo without text = %v, want isError", resp)
+	}
+
+	tests := []struct {
+		line string
+		code float64
+	}{
+		{`{"jsonrpc":"2.0","id":3,"method":"tools/call","params":{"name":"nope"}}`, codeInvalidParams},
+		{`{"jsonrpc":"2.0","id":4,"method":"resources/list"}`, codeMethodNotFound},
+		{`{"jsonrpc":"2.0","id":5`, codeParseError},
+		{`{"id":6,"method":"ping"}`, codeInvalidRequest},
+	}
+	for _, tt := range tests {
+		resp := send(tt.line)
+		if e, ok := resp["error"].(map[string]any); !ok || e["code"] != tt.code {
+			t.Errorf("%s = %v, want error %v", tt.line, resp, tt.code)
+		}
+	}
+
+	if resp := send(`{"jsonrpc":"2.0","id":7,"method":"ping"}`); resp["error"] != nil || resp["result"] == nil {
+		t.Errorf("ping = %v", resp)
+	}
+}
+
+func TestCancel(t *testing.T) {
+	inR, inW := io.Pipe()
+	outR, outW := io.Pipe()
+	go echoServer().Serve(context.Background(), inR, outW)
+	defer inW.Close()
+
+	io.WriteString(inW, `{"jsonrpc":"2.0","id":9,"method":"tools/call","params":{"name":"wait"}}`+"\n")
+	io.WriteString(inW, `{"jsonrpc":"2.0","method":"notifications/cancelled","params":{"requestId":9}}`+"\n")
+
+	lines := bufio.NewScanner(outR)
+	if !lines.Scan() {
+		t.Fatal("no response")
+	}
+	if !strings.Contains(lines.Text(), `"id":9`) || !strings.Contains(lines.Text(), "cancelled") {
+		t.Errorf("response = %s, want the cancelled call", lines.Text())
+	}
+}
+
+func TestToolsChanged(t *testing.T) {
+	s := echoServer()
+	s.ToolsChanged() // not serving yet: dropped
+	inR, inW := io.Pipe()
+	outR, outW := io.Pipe()
+	go s.Serve(context.Background(), inR, outW)
+	defer inW.Close()
+	lines := bufio.NewScanner(outR)
+
+	// A ping makes sure Serve has started before the notification
+	io.WriteString(inW, `{"jsonrpc":"2.0","id":1,"method":"ping"}`+"\n")
+	if !lines.Scan() || !strings.Contains(lines.Text(), `"id":1`) {
+		t.Fatalf("ping = %s", lines.Text())
+	}
+
+	go func() {
+		s.RemoveTools(func(t Tool) bool { return t.Name == "wait" })
+		s.ToolsChanged()
+	}()
+	if !lines.Scan() || lines.Text() != `{"jsonrpc":"2.0","method":"notifications/tools/list_changed"}` {
+		t.Fatalf("notification = %s", lines.Text())
+	}
+
+	io.WriteString(inW, `{"jsonrpc":"2.0","id":2,"method":"tools/list"}`+"\n")
+	if !lines.Scan() || strings.Contains(lines.Text(), `"wait"`) || !strings.Contains(lines.Text(), `"echo"`) {
+		t.Errorf("tools/list after removal = %s", lines.Text())
+	}
+	io.WriteString(inW, `{"jsonrpc":"2.0","id":3,"method":"tools/call","params":{"name":"wait"}}`+"\n")
+	if !lines.Scan() || !strings.Contains(lines.Text(), `"code":-32602`) {
+		t.Errorf("call of a removed tool = %s", lines.Text())
+	}
+}
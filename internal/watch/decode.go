@@ -0,0 +1,300 @@
+package watch
+
+import (
+	"grpc_anotation_sample/protoset"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/bsontype"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"google.golang.org/protobuf/types/known/durationpb"
+	"google.golang.org/protobuf/types/known/structpb"
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+// Decode fills msg from a document stored the way the generated models
+// store it: fields under their proto names, id as _id, enums by name
+// without their prefix, timestamps as dates and durations as nanoseconds.
+// Fields that are missing, or stored as something else, are left unset.
+func Decode(doc bson.Raw, msg protoreflect.Message) {
+	decode(doc, msg, "_id")
+}
+
+// decode fills msg from doc, where its id field is stored as idKey
+func decode(doc bson.Raw, msg protoreflect.Message, idKey string) {
+	fields := msg.Descriptor().Fields()
+	for i := 0; i < fields.Len(); i++ {
+		fd := fields.Get(i)
+		key := string(fd.Name())
+		if key == "id" {
+			key = idKey
+		}
+		rv, err := doc.LookupErr(key)
+		if err != nil || rv.Type == bsontype.Null {
+			continue
+		}
+		switch {
+		case fd.IsList():
+			arr, ok := rv.ArrayOK()
+			if !ok {
+				continue
+			}
+			values, _ := arr.Values()
+			list := msg.Mutable(fd).List()
+			for _, v := range values {
+				if pv, ok := value(fd, v, list.NewElement); ok {
+					list.Append(pv)
+				}
+			}
+		case fd.IsMap():
+			sub, ok := rv.DocumentOK()
+			if !ok {
+				continue
+			}
+			elems, _ := sub.Elements()
+			m := msg.Mutable(fd).Map()
+			for _, e := range elems {
+				key, ok := mapKey(fd.MapKey(), e.Key())
+				if !ok {
+					continue
+				}
+				if pv, ok := value(fd.MapValue(), e.Value(), m.NewValue); ok {
+					m.Set(key, pv)
+				}
+			}
+		default:
+			if pv, ok := value(fd, rv, func() protoreflect.Value { return msg.NewField(fd) }); ok {
+				msg.Set(fd, pv)
+			}
+		}
+	}
+}
+
+// value converts a stored value of (an element of) fd; newMessage returns
+// an empty message to fill for a message field
+func value(fd protoreflect.FieldDescriptor, rv bson.RawValue, newMessage func() protoreflect.Value) (protoreflect.Value, bool) {
+	switch fd.Kind() {
+	case protoreflect.StringKind:
+		if s, ok := rv.StringValueOK(); ok {
+			return protoreflect.ValueOfString(s), true
+		}
+		if id, ok := rv.ObjectIDOK(); ok {
+			return protoreflect.ValueOfString(id.Hex()), true
+		}
+	case protoreflect.BoolKind:
+		if b, ok := rv.BooleanOK(); ok {
+			return protoreflect.ValueOfBool(b), true
+		}
+	case protoreflect.BytesKind:
+		if _, data, ok := rv.BinaryOK(); ok {
+			return protoreflect.ValueOfBytes(data), true
+		}
+	case protoreflect.EnumKind:
+		if s, ok := rv.StringValueOK(); ok {
+			if v := enumValue(fd.Enum(), s); v != nil {
+				return protoreflect.ValueOfEnum(v.Number()), true
+			}
+		}
+	case protoreflect.Int32Kind, protoreflect.Sint32Kind, protoreflect.Sfixed32Kind:
+		if n, ok := rv.AsInt64OK(); ok {
+			return protoreflect.ValueOfInt32(int32(n)), true
+		}
+	case protoreflect.Int64Kind, protoreflect.Sint64Kind, protoreflect.Sfixed64Kind:
+		if n, ok := rv.AsInt64OK(); ok {
+			return protoreflect.ValueOfInt64(n), true
+		}
+	case protoreflect.Uint32Kind, protoreflect.Fixed32Kind:
+		if n, ok := rv.AsInt64OK(); ok {
+			return protoreflect.ValueOfUint32(uint32(n)), true
+		}
+	case protoreflect.Uint64Kind, protoreflect.Fixed64Kind:
+		if n, ok := rv.AsInt64OK(); ok {
+			return protoreflect.ValueOfUint64(uint64(n)), true
+		}
+	case protoreflect.FloatKind, protoreflect.DoubleKind:
+		f, ok := rv.DoubleOK()
+		if !ok {
+			var n int64
+			if n, ok = rv.AsInt64OK(); ok {
+				f = float64(n)
+			}
+		}
+		if ok && fd.Kind() == protoreflect.FloatKind {
+			return protoreflect.ValueOfFloat32(float32(f)), true
+		}
+		if ok {
+			return protoreflect.ValueOfFloat64(f), true
+		}
+	case protoreflect.MessageKind:
+		return messageValue(fd.Message(), rv, newMessage)
+	}
+	return protoreflect.Value{}, false
+}
+
+func messageValue(md protoreflect.MessageDescriptor, rv bson.RawValue, newMessage func() protoreflect.Value) (protoreflect.Value, bool) {
+	switch md.FullName() {
+	case "google.protobuf.Timestamp":
+		if t, ok := rv.TimeOK(); ok {
+			return ofMessage(newMessage, timestamppb.New(t).ProtoReflect())
+		}
+		return protoreflect.Value{}, false
+	case "google.protobuf.Duration":
+		if n, ok := rv.AsInt64OK(); ok {
+			return ofMessage(newMessage, durationpb.New(time.Duration(n)).ProtoReflect())
+		}
+		return protoreflect.Value{}, false
+	case "google.protobuf.Struct":
+		var m map[string]any
+		if rv.Type != bsontype.EmbeddedDocument || bson.Unmarshal(rv.Value, &m) != nil {
+			return protoreflect.Value{}, false
+		}
+		s, err := structpb.NewStruct(jsonValues(m).(map[string]any))
+		if err != nil {
+			return protoreflect.Value{}, false
+		}
+		return ofMessage(newMessage, s.ProtoReflect())
+	}
+	if wrapped := wrappedValue(md); wrapped != nil {
+		pv, ok := value(wrapped, rv, nil)
+		if !ok {
+			return protoreflect.Value{}, false
+		}
+		v := newMessage()
+		v.Message().Set(wrapped, pv)
+		return v, true
+	}
+	doc, ok := rv.DocumentOK()
+	if !ok {
+		return protoreflect.Value{}, false
+	}
+	v := newMessage()
+	decode(doc, v.Message(), "id")
+	return v, true
+}
+
+// ofMessage copies src into a new message from newMessage, which may be
+// of a different implementation of the same type
+func ofMessage(newMessage func() protoreflect.Value, src protoreflect.Message) (protoreflect.Value, bool) {
+	b, err := proto.Marshal(src.Interface())
+	if err != nil {
+		return protoreflect.Value{}, false
+	}
+	v := newMessage()
+	if err := proto.Unmarshal(b, v.Message().Interface()); err != nil {
+		return protoreflect.Value{}, false
+	}
+	return v, true
+}
+
+// jsonValues converts what bson unmarshals into a map to the JSON types
+// structpb accepts
+func jsonValues(v any) any {
+	switch v := v.(type) {
+	case map[string]any:
+		for k, e := range v {
+			v[k] = jsonValues(e)
+		}
+		return v
+	case bson.M:
+		return jsonValues(map[string]any(v))
+	case bson.D:
+		m := make(map[string]any, len(v))
+		for _, e := range v {
+			m[e.Key] = e.Value
+		}
+		return jsonValues(m)
+	case bson.A:
+		for i, e := range v {
+			v[i] = jsonValues(e)
+		}
+		return []any(v)
+	case int32:
+		return float64(v)
+	case int64:
+		return float64(v)
+	case time.Time:
+		return v.Format(time.RFC3339Nano)
+	case string, bool, float64, nil:
+		return v
+	}
+	return nil
+}
+
+// mapKey parses a map key, which is stored as a document key
+func mapKey(fd protoreflect.FieldDescriptor, key string) (protoreflect.MapKey, bool) {
+	var v protoreflect.Value
+	var err error
+	switch fd.Kind() {
+	case protoreflect.StringKind:
+		v = protoreflect.ValueOfString(key)
+	case protoreflect.BoolKind:
+		var b bool
+		b, err = strconv.ParseBool(key)
+		v = protoreflect.ValueOfBool(b)
+	case protoreflect.Int32Kind, protoreflect.Sint32Kind, protoreflect.Sfixed32Kind:
+		var n int64
+		n, err = strconv.ParseInt(key, 10, 32)
+		v = protoreflect.ValueOfInt32(int32(n))
+	case protoreflect.Int64Kind, protoreflect.Sint64Kind, protoreflect.Sfixed64Kind:
+		var n int64
+		n, err = strconv.ParseInt(key, 10, 64)
+		v = protoreflect.ValueOfInt64(n)
+	case protoreflect.Uint32Kind, protoreflect.Fixed32Kind:
+		var n uint64
+		n, err = strconv.ParseUint(key, 10, 32)
+		v = protoreflect.ValueOfUint32(uint32(n))
+	case protoreflect.Uint64Kind, protoreflect.Fixed64Kind:
+		var n uint64
+		n, err = strconv.ParseUint(key, 10, 64)
+		v = protoreflect.ValueOfUint64(n)
+	default:
+		return protoreflect.MapKey{}, false
+	}
+	return v.MapKey(), err == nil
+}
+
+// isWellKnown reports whether md is stored as a value rather than a
+// document of its fields
+func isWellKnown(md protoreflect.MessageDescriptor) bool {
+	return md.ParentFile().Package() == "google.protobuf"
+}
+
+// wrappedValue returns the value field of a google.protobuf wrapper such
+// as StringValue, or nil for any other message
+func wrappedValue(md protoreflect.MessageDescriptor) protoreflect.FieldDescriptor {
+	if protoset.WrapperScalar(md.FullName()) == "" {
+		return nil
+	}
+	return md.Fields().ByName("value")
+}
+
+// enumPrefix is the prefix of the value names of ed, as the generator
+// declares them: OrderStatus values start with ORDER_STATUS_
+func enumPrefix(ed protoreflect.EnumDescriptor) string {
+	var b strings.Builder
+	for i, r := range string(ed.Name()) {
+		if unicode.IsUpper(r) && i > 0 {
+			b.WriteByte('_')
+		}
+		b.WriteRune(unicode.ToUpper(r))
+	}
+	return b.String() + "_"
+}
+
+// storedEnumName returns the name under which the value called name is
+// stored: without the enum's prefix
+func storedEnumName(ed protoreflect.EnumDescriptor, name string) string {
+	return strings.TrimPrefix(name, enumPrefix(ed))
+}
+
+// enumValue finds a value of ed by its name, with or without the prefix
+func enumValue(ed protoreflect.EnumDescriptor, name string) protoreflect.EnumValueDescriptor {
+	if v := ed.Values().ByName(protoreflect.Name(enumPrefix(ed) + name)); v != nil {
+		return v
+	}
+	return ed.Values().ByName(protoreflect.Name(name))
+}
@@ -0,0 +1,112 @@
+package watch
+
+import (
+	"encoding/json"
+	"grpc_anotation_sample/pb"
+	"maps"
+	"reflect"
+	"slices"
+	"testing"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/types/dynamicpb"
+)
+
+func TestDecode(t *testing.T) {
+	published := time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)
+	doc, err := bson.Marshal(bson.D{
+		{Key: "_id", Value: "item-1"},
+		{Key: "title", Value: "Dune"},
+		{Key: "pages", Value: int64(412)},
+		{Key: "price", Value: int32(9)},
+		{Key: "active", Value: true},
+		{Key: "status", Value: "SHIPPED"},
+		{Key: "tags", Value: bson.A{"sci-fi", 7, "classic"}},
+		{Key: "counts", Value: bson.D{{Key: "views", Value: int64(3)}}},
+		{Key: "address", Value: bson.D{{Key: "id", Value: "a1"}, {Key: "city", Value: "Oslo"}}},
+		{Key: "history", Value: bson.A{bson.D{{Key: "city", Value: "Rome"}}}},
+		{Key: "published", Value: published},
+		{Key: "ttl", Value: int64(time.Hour)},
+		{Key: "attrs", Value: bson.D{{Key: "n", Value: int32(1)}, {Key: "tags", Value: bson.A{"x"}}}},
+		{Key: "nickname", Value: "bob"},
+		{Key: "blob", Value: []byte("hi")},
+		{Key: "size", Value: int64(5)},
+		{Key: "created_at", Value: published}, // not a field of the entity
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	msg := dynamicpb.NewMessage(itemDescriptor(t))
+	Decode(doc, msg)
+
+	got, _ := protojson.Marshal(msg)
+	want := `{"id":"item-1","title":"Dune","pages":412,"price":9,"active":true,"status":"ORDER_STATUS_SHIPPED",` +
+		`"tags":["sci-fi","classic"],"counts":{"views":"3"},"address":{"id":"a1","city":"Oslo"},"history":[{"city":"Rome"}],` +
+		`"published":"2024-01-02T03:04:05Z","ttl":"3600s","attrs":{"n":1,"tags":["x"]},"nickname":"bob","blob":"aGk=","size":"5"}`
+	if !jsonEqual(got, want) {
+		t.Errorf("Decode = %s\nwant %s", got, want)
+	}
+}
+
+func TestDecodeGenerated(t *testing.T) {
+	id := primitive.NewObjectID()
+	doc, _ := bson.Marshal(bson.D{{Key: "_id", Value: id}, {Key: "title", Value: "Dune"}, {Key: "pages", Value: "many"}})
+	book := &pb.Book{}
+	Decode(doc, book.ProtoReflect())
+	if want := (&pb.Book{Id: id.Hex(), Title: "Dune"}); !proto.Equal(book, want) {
+		t.Errorf("Decode = %v, want %v, without the pages stored as a string", book, want)
+	}
+}
+
+func TestDiff(t *testing.T) {
+	at := func(s int) time.Time { return time.Unix(int64(s), 0) }
+	v := func(id string, updated int) version {
+		return version{id: bson.RawValue{Type: bson.TypeString, Value: bsoncoreString(id)}, updated: at(updated)}
+	}
+	seen := map[string]version{"a": v("a", 1), "b": v("b", 1), "c": v("c", 1)}
+	// f has no updated_at, and g was created after the ids were read
+	ids := map[string]bson.RawValue{}
+	for _, id := range []string{"a", "b", "d", "f"} {
+		ids[id] = v(id, 0).id
+	}
+	recent := []version{v("a", 1), v("b", 3), v("d", 2), v("g", 4)}
+
+	changed, deleted := diff(seen, recent, ids)
+	var got []string
+	for _, c := range changed {
+		op := "updated"
+		if c.isNew {
+			op = "created"
+		}
+		got = append(got, idString(c.id)+" "+op)
+	}
+	if want := []string{"f created", "d created", "b updated", "g created"}; !slices.Equal(got, want) {
+		t.Errorf("changed = %q, want %q in update order", got, want)
+	}
+	if !slices.Equal(deleted, []string{"c"}) {
+		t.Errorf("deleted = %q, want [c]", deleted)
+	}
+	if got := slices.Sorted(maps.Keys(seen)); !slices.Equal(got, []string{"a", "b", "d", "f", "g"}) {
+		t.Errorf("seen = %q after diff", got)
+	}
+	if changed, deleted := diff(seen, recent, ids); len(changed) != 0 || len(deleted) != 0 {
+		t.Errorf("second diff = %v, %q; want nothing new", changed, deleted)
+	}
+}
+
+func bsoncoreString(s string) []byte {
+	_, b, _ := bson.MarshalValue(s)
+	return b
+}
+
+func jsonEqual(a []byte, b string) bool {
+	var x, y any
+	if json.Unmarshal(a, &x) != nil || json.Unmarshal([]byte(b), &y) != nil {
+		return false
+	}
+	return reflect.DeepEqual(x, y)
+}
@@ -0,0 +1,406 @@
+package watch
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"google.golang.org/protobuf/reflect/protoreflect"
+)
+
+// Filter is a parsed filter expression, such as
+//
+//	author = "Tolkien" AND (pages > 300 OR title ~ "ring")
+//
+// A comparison is a field path, an operator (=, !=, <, <=, >, >=, or ~ for
+// a case-insensitive substring) and a string, number, true, false or null.
+// Comparisons combine with AND, OR, NOT and parentheses. Paths are proto
+// field names: nested fields and map entries are reached with dots, and
+// enums and timestamps are compared with their names and RFC 3339 strings.
+type Filter struct {
+	root node
+}
+
+type node interface {
+	query(prefix string) bson.D
+}
+
+type (
+	andNode []node
+	orNode  []node
+	notNode struct{ n node }
+	cmpNode struct {
+		path  string // in the stored document, without a prefix
+		op    string
+		value any
+	}
+)
+
+func (n andNode) query(prefix string) bson.D { return bson.D{{Key: "$and", Value: queries(n, prefix)}} }
+func (n orNode) query(prefix string) bson.D  { return bson.D{{Key: "$or", Value: queries(n, prefix)}} }
+func (n notNode) query(prefix string) bson.D {
+	return bson.D{{Key: "$nor", Value: bson.A{n.n.query(prefix)}}}
+}
+
+func queries(nodes []node, prefix string) bson.A {
+	a := make(bson.A, len(nodes))
+	for i, n := range nodes {
+		a[i] = n.query(prefix)
+	}
+	return a
+}
+
+var mongoOps = map[string]string{"=": "$eq", "!=": "$ne", "<": "$lt", "<=": "$lte", ">": "$gt", ">=": "$gte"}
+
+func (n cmpNode) query(prefix string) bson.D {
+	if n.op == "~" {
+		pattern := "(?i)" + regexp.QuoteMeta(n.value.(string))
+		return bson.D{{Key: prefix + n.path, Value: bson.D{{Key: "$regex", Value: pattern}}}}
+	}
+	return bson.D{{Key: prefix + n.path, Value: bson.D{{Key: mongoOps[n.op], Value: n.value}}}}
+}
+
+// Query returns the filter as a MongoDB query on documents whose fields
+// are under prefix, e.g. "fullDocument." in a change stream. An empty
+// filter matches every document.
+func (f *Filter) Query(prefix string) bson.D {
+	if f == nil || f.root == nil {
+		return bson.D{}
+	}
+	return f.root.query(prefix)
+}
+
+// ParseFilter parses expr, checking its paths and values against the
+// fields of entity. An empty expr is an empty filter.
+func ParseFilter(expr string, entity protoreflect.MessageDescriptor) (*Filter, error) {
+	tokens, err := lex(expr)
+	if err != nil {
+		return nil, err
+	}
+	p := &parser{tokens: tokens, entity: entity}
+	if len(tokens) == 0 {
+		return &Filter{}, nil
+	}
+	root, err := p.or()
+	if err != nil {
+		return nil, err
+	}
+	if p.pos < len(p.tokens) {
+		return nil, fmt.Errorf("unexpected %s", p.tokens[p.pos])
+	}
+	return &Filter{root: root}, nil
+}
+
+type tokenKind int
+
+const (
+	identToken tokenKind = iota
+	stringToken
+	numberToken
+	opToken
+	punctToken // ( or )
+)
+
+type token struct {
+	kind tokenKind
+	text string // a string token's text is unquoted
+}
+
+func (t token) String() string {
+	if t.kind == stringToken {
+		return strconv.Quote(t.text)
+	}
+	return fmt.Sprintf("%q", t.text)
+}
+
+func lex(s string) ([]token, error) {
+	var tokens []token
+	for i := 0; i < len(s); {
+		c := s[i]
+		switch {
+		case c == ' ' || c == '\t' || c == '\n' || c == '\r':
+			i++
+		case c == '(' || c == ')':
+			tokens = append(tokens, token{punctToken, string(c)})
+			i++
+		case c == '"' || c == '\'':
+			end := i + 1
+			for end < len(s) && s[end] != c {
+				if s[end] == '\\' {
+					end++
+				}
+				end++
+			}
+			if end >= len(s) {
+				return nil, fmt.Errorf("unterminated string at %d", i)
+			}
+			text := s[i+1 : end]
+			if c == '"' {
+				var err error
+				if text, err = strconv.Unquote(s[i : end+1]); err != nil {
+					return nil, fmt.Errorf("invalid string at %d: %v", i, err)
+				}
+			}
+			tokens = append(tokens, token{stringToken, text})
+			i = end + 1
+		case strings.ContainsRune("=!<>~", rune(c)):
+			op := string(c)
+			if i+1 < len(s) && s[i+1] == '=' {
+				op += "="
+			}
+			if _, ok := mongoOps[op]; !ok && op != "~" && op != "==" {
+				return nil, fmt.Errorf("unknown operator %q at %d", op, i)
+			}
+			i += len(op)
+			if op == "==" {
+				op = "="
+			}
+			tokens = append(tokens, token{opToken, op})
+		case c == '-' || c == '.' || c >= '0' && c <= '9':
+			end := i + 1
+			for end < len(s) && strings.ContainsRune("0123456789.eE+-", rune(s[end])) {
+				end++
+			}
+			tokens = append(tokens, token{numberToken, s[i:end]})
+			i = end
+		case c == '_' || unicode.IsLetter(rune(c)):
+			end := i + 1
+			for end < len(s) && (s[end] == '_' || s[end] == '.' || unicode.IsLetter(rune(s[end])) || unicode.IsDigit(rune(s[end]))) {
+				end++
+			}
+			tokens = append(tokens, token{identToken, s[i:end]})
+			i = end
+		default:
+			return nil, fmt.Errorf("unexpected %q at %d", c, i)
+		}
+	}
+	return tokens, nil
+}
+
+type parser struct {
+	tokens []token
+	pos    int
+	entity protoreflect.MessageDescriptor
+}
+
+// keyword consumes the next token if it is the keyword word, in any case
+func (p *parser) keyword(word string) bool {
+	if p.pos < len(p.tokens) && p.tokens[p.pos].kind == identToken && strings.EqualFold(p.tokens[p.pos].text, word) {
+		p.pos++
+		return true
+	}
+	return false
+}
+
+func (p *parser) punct(c string) bool {
+	if p.pos < len(p.tokens) && p.tokens[p.pos].kind == punctToken && p.tokens[p.pos].text == c {
+		p.pos++
+		return true
+	}
+	return false
+}
+
+func (p *parser) next() (token, error) {
+	if p.pos >= len(p.tokens) {
+		return token{}, fmt.Errorf("unexpected end of filter")
+	}
+	p.pos++
+	return p.tokens[p.pos-1], nil
+}
+
+func (p *parser) or() (node, error) {
+	return p.list("OR", p.and, func(n []node) node { return orNode(n) })
+}
+
+func (p *parser) and() (node, error) {
+	return p.list("AND", p.not, func(n []node) node { return andNode(n) })
+}
+
+// list parses operands separated by the keyword sep
+func (p *parser) list(sep string, operand func() (node, error), join func([]node) node) (node, error) {
+	n, err := operand()
+	if err != nil {
+		return nil, err
+	}
+	nodes := []node{n}
+	for p.keyword(sep) {
+		if n, err = operand(); err != nil {
+			return nil, err
+		}
+		nodes = append(nodes, n)
+	}
+	if len(nodes) == 1 {
+		return nodes[0], nil
+	}
+	return join(nodes), nil
+}
+
+func (p *parser) not() (node, error) {
+	if p.keyword("NOT") {
+		n, err := p.not()
+		if err != nil {
+			return nil, err
+		}
+		return notNode{n}, nil
+	}
+	if p.punct("(") {
+		n, err := p.or()
+		if err != nil {
+			return nil, err
+		}
+		if !p.punct(")") {
+			return nil, fmt.Errorf("missing )")
+		}
+		return n, nil
+	}
+	return p.comparison()
+}
+
+func (p *parser) comparison() (node, error) {
+	path, err := p.next()
+	if err != nil {
+		return nil, err
+	}
+	if path.kind != identToken {
+		return nil, fmt.Errorf("expected a field, got %s", path)
+	}
+	fd, stored, err := resolvePath(p.entity, path.text)
+	if err != nil {
+		return nil, err
+	}
+	op, err := p.next()
+	if err != nil {
+		return nil, err
+	}
+	if op.kind != opToken {
+		return nil, fmt.Errorf("expected an operator after %s, got %s", path.text, op)
+	}
+	lit, err := p.next()
+	if err != nil {
+		return nil, err
+	}
+	value, err := literal(fd, lit)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path.text, err)
+	}
+	if op.text == "~" {
+		if _, ok := value.(string); !ok {
+			return nil, fmt.Errorf("%s: ~ needs a string field and value", path.text)
+		}
+	}
+	return cmpNode{path: stored, op: op.text, value: value}, nil
+}
+
+// resolvePath finds the field at the end of a dotted path of proto field
+// names and returns it with the path as stored: id at the top is _id, and
+// the segment after a map field is a key.
+func resolvePath(entity protoreflect.MessageDescriptor, path string) (protoreflect.FieldDescriptor, string, error) {
+	msg := entity
+	var fd protoreflect.FieldDescriptor
+	segments := strings.Split(path, ".")
+	stored := make([]string, len(segments))
+	for i := 0; i < len(segments); i++ {
+		if msg == nil {
+			return nil, "", fmt.Errorf("%s: %s has no fields", path, strings.Join(segments[:i], "."))
+		}
+		fd = msg.Fields().ByName(protoreflect.Name(segments[i]))
+		if fd == nil {
+			fd = msg.Fields().ByJSONName(segments[i])
+		}
+		if fd == nil {
+			return nil, "", fmt.Errorf("unknown field %s", path)
+		}
+		stored[i] = string(fd.Name())
+		if i == 0 && fd.Name() == "id" {
+			stored[i] = "_id"
+		}
+		msg = nil
+		switch {
+		case fd.IsMap():
+			if i+1 == len(segments) {
+				return nil, "", fmt.Errorf("%s: a map is compared by its keys, e.g. %s.key", path, path)
+			}
+			i++
+			stored[i] = segments[i]
+			fd = fd.MapValue()
+			if fd.Kind() == protoreflect.MessageKind && !isWellKnown(fd.Message()) {
+				msg = fd.Message()
+			}
+		case fd.Kind() == protoreflect.MessageKind && !isWellKnown(fd.Message()):
+			msg = fd.Message()
+		}
+	}
+	return fd, strings.Join(stored, "."), nil
+}
+
+// literal converts a value token to what is stored for fd
+func literal(fd protoreflect.FieldDescriptor, t token) (any, error) {
+	if t.kind == identToken && t.text == "null" {
+		return nil, nil
+	}
+	kind := fd.Kind()
+	if kind == protoreflect.MessageKind {
+		switch fd.Message().FullName() {
+		case "google.protobuf.Timestamp":
+			if t.kind != stringToken {
+				return nil, fmt.Errorf("want an RFC 3339 time, got %s", t)
+			}
+			ts, err := time.Parse(time.RFC3339Nano, t.text)
+			if err != nil {
+				return nil, fmt.Errorf("want an RFC 3339 time: %v", err)
+			}
+			return ts, nil
+		case "google.protobuf.Duration":
+			if t.kind != stringToken {
+				return nil, fmt.Errorf("want a duration such as \"1h30m\", got %s", t)
+			}
+			d, err := time.ParseDuration(t.text)
+			if err != nil {
+				return nil, err
+			}
+			return int64(d), nil
+		}
+		if wrapped := wrappedValue(fd.Message()); wrapped != nil {
+			return literal(wrapped, t)
+		}
+		return nil, fmt.Errorf("a message is only compared with null")
+	}
+
+	switch kind {
+	case protoreflect.StringKind:
+		if t.kind == stringToken {
+			return t.text, nil
+		}
+	case protoreflect.BoolKind:
+		if t.kind == identToken && (t.text == "true" || t.text == "false") {
+			return t.text == "true", nil
+		}
+	case protoreflect.EnumKind:
+		if t.kind == stringToken {
+			ed := fd.Enum()
+			name := storedEnumName(ed, t.text)
+			if enumValue(ed, name) == nil {
+				return nil, fmt.Errorf("%s is not a %s value", t, ed.Name())
+			}
+			return name, nil
+		}
+	case protoreflect.BytesKind:
+		return nil, fmt.Errorf("bytes fields are only compared with null")
+	default: // numbers
+		if t.kind == numberToken {
+			if n, err := strconv.ParseInt(t.text, 10, 64); err == nil {
+				return n, nil
+			}
+			f, err := strconv.ParseFloat(t.text, 64)
+			if err != nil {
+				return nil, fmt.Errorf("invalid number %s", t)
+			}
+			return f, nil
+		}
+	}
+	return nil, fmt.Errorf("%s does not fit a %s field", t, kind)
+}
@@ -0,0 +1,147 @@
+package watch
+
+import (
+	"encoding/json"
+	"grpc_anotation_sample/protoset"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"google.golang.org/protobuf/reflect/protoreflect"
+)
+
+// itemProto declares an entity with a field of every kind the generator
+// emits
+const itemProto = `syntax = "proto3";
+package watchtest;
+
+import "google/protobuf/timestamp.proto";
+import "google/protobuf/duration.proto";
+import "google/protobuf/struct.proto";
+import "google/protobuf/wrappers.proto";
+
+enum OrderStatus {
+  ORDER_STATUS_UNSPECIFIED = 0;
+  ORDER_STATUS_PENDING = 1;
+  ORDER_STATUS_SHIPPED = 2;
+}
+
+message Address {
+  string id = 1;
+  string city = 2;
+}
+
+message Item {
+  string id = 1;
+  string title = 2;
+  int32 pages = 3;
+  double price = 4;
+  bool active = 5;
+  OrderStatus status = 6;
+  repeated string tags = 7;
+  map<string, int64> counts = 8;
+  Address address = 9;
+  repeated Address history = 10;
+  google.protobuf.Timestamp published = 11;
+  google.protobuf.Duration ttl = 12;
+  google.protobuf.Struct attrs = 13;
+  google.protobuf.StringValue nickname = 14;
+  bytes blob = 15;
+  oneof payload {
+    string text = 16;
+    int64 size = 17;
+  }
+}
+`
+
+// itemDescriptor compiles itemProto
+func itemDescriptor(t *testing.T) protoreflect.MessageDescriptor {
+	t.Helper()
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, "item.proto"), []byte(itemProto), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	set, err := protoset.Compile(dir)
+	if err != nil {
+		t.Fatalf("Compile returned error: %v", err)
+	}
+	d, err := set.Files.FindDescriptorByName("watchtest.Item")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return d.(protoreflect.MessageDescriptor)
+}
+
+// extJSON renders a query as relaxed extended JSON, to compare it
+func extJSON(t *testing.T, q bson.D) string {
+	t.Helper()
+	b, err := bson.MarshalExtJSON(q, false, false)
+	if err != nil {
+		t.Fatalf("MarshalExtJSON(%v): %v", q, err)
+	}
+	var v any
+	json.Unmarshal(b, &v)
+	b, _ = json.Marshal(v)
+	return string(b)
+}
+
+func TestParseFilter(t *testing.T) {
+	item := itemDescriptor(t)
+	tests := []struct {
+		expr, want string
+	}{
+		{``, `{}`},
+		{`title = "Dune"`, `{"fullDocument.title":{"$eq":"Dune"}}`},
+		{`title == 'Dune'`, `{"fullDocument.title":{"$eq":"Dune"}}`},
+		{`id != "a1"`, `{"fullDocument._id":{"$ne":"a1"}}`},
+		{`pages >= 300 and price < 9.5`, `{"$and":[{"fullDocument.pages":{"$gte":300}},{"fullDocument.price":{"$lt":9.5}}]}`},
+		{`active = true OR NOT (pages <= -1)`, `{"$or":[{"fullDocument.active":{"$eq":true}},{"$nor":[{"fullDocument.pages":{"$lte":-1}}]}]}`},
+		{`active = false or pages = 2 AND price = 3`, `{"$or":[{"fullDocument.active":{"$eq":false}},{"$and":[{"fullDocument.pages":{"$eq":2}},{"fullDocument.price":{"$eq":3}}]}]}`},
+		{`status = "SHIPPED"`, `{"fullDocument.status":{"$eq":"SHIPPED"}}`},
+		{`status = "ORDER_STATUS_PENDING"`, `{"fullDocument.status":{"$eq":"PENDING"}}`},
+		{`status = "LOST"`, ``},
+		{`title ~ "a.b"`, `{"fullDocument.title":{"$regex":"(?i)a\\.b"}}`},
+		{`pages ~ "3"`, ``},
+		{`tags = "sci-fi"`, `{"fullDocument.tags":{"$eq":"sci-fi"}}`},
+		{`counts.views > 10`, `{"fullDocument.counts.views":{"$gt":10}}`},
+		{`counts > 10`, ``},
+		{`address.city = "Oslo"`, `{"fullDocument.address.city":{"$eq":"Oslo"}}`},
+		{`address.id = "x"`, `{"fullDocument.address.id":{"$eq":"x"}}`},
+		{`address = null`, `{"fullDocument.address":{"$eq":null}}`},
+		{`address = "Oslo"`, ``},
+		{`published > "2024-01-02T03:04:05Z"`, `{"fullDocument.published":{"$gt":{"$date":"2024-01-02T03:04:05Z"}}}`},
+		{`published > "yesterday"`, ``},
+		{`ttl < "1h"`, `{"fullDocument.ttl":{"$lt":3600000000000}}`},
+		{`nickname = "bob"`, `{"fullDocument.nickname":{"$eq":"bob"}}`},
+		{`text = "hi" AND size > 2`, `{"$and":[{"fullDocument.text":{"$eq":"hi"}},{"fullDocument.size":{"$gt":2}}]}`},
+		{`pages = "300"`, ``},
+		{`nope = 1`, ``},
+		{`title.x = 1`, ``},
+		{`title = `, ``},
+		{`title "Dune"`, ``},
+		{`(title = "Dune"`, ``},
+		{`title = "Dune")`, ``},
+		{`title =! "Dune"`, ``},
+		{`title = "Dune`, ``},
+	}
+	for _, tt := range tests {
+		f, err := ParseFilter(tt.expr, item)
+		switch {
+		case tt.want == "" && err == nil:
+			t.Errorf("ParseFilter(%q) = %s, want an error", tt.expr, extJSON(t, f.Query("fullDocument.")))
+		case tt.want != "" && err != nil:
+			t.Errorf("ParseFilter(%q) returned error: %v", tt.expr, err)
+		case tt.want != "":
+			if got := extJSON(t, f.Query("fullDocument.")); got != tt.want {
+				t.Errorf("ParseFilter(%q) = %s, want %s", tt.expr, got, tt.want)
+			}
+		}
+	}
+
+	f, _ := ParseFilter(`title = "Dune"`, item)
+	if got := extJSON(t, f.Query("")); !strings.HasPrefix(got, `{"title"`) {
+		t.Errorf("Query without a prefix = %s", got)
+	}
+}
@@ -0,0 +1,416 @@
+// Package watch streams the changes to a MongoDB collection as typed
+// created, updated and deleted events. It backs the generated
+// Watch<Entity> RPCs: it follows the collection's change stream, or polls
+// it on a standalone server, which has no change streams.
+//
+// Every change carries a resume token. A stream opened with it sends the
+// changes after that one: exactly, from a change stream that still holds
+// them, and at least once when polling.
+package watch
+
+import (
+	"cmp"
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/proto"
+)
+
+// Op is the kind of a change. Its values are those of the Type enum of the
+// generated <Entity>Event messages.
+type Op int32
+
+const (
+	Created Op = 1
+	Updated Op = 2
+	Deleted Op = 3
+)
+
+func (op Op) String() string {
+	switch op {
+	case Created:
+		return "CREATED"
+	case Updated:
+		return "UPDATED"
+	case Deleted:
+		return "DELETED"
+	}
+	return fmt.Sprintf("Op(%d)", int32(op))
+}
+
+// Change is a change to one document
+type Change struct {
+	Op Op
+	ID string
+	// Data is the entity after the change, of the Watcher's Entity type;
+	// nil for Deleted
+	Data  proto.Message
+	Token string
+}
+
+// DefaultPollInterval is how often a collection is polled when the
+// Watcher does not say
+const DefaultPollInterval = 2 * time.Second
+
+// Collection is the part of a *mongo.Collection a Watcher uses
+type Collection interface {
+	Name() string
+	Find(ctx context.Context, filter any, opts ...*options.FindOptions) (*mongo.Cursor, error)
+	Watch(ctx context.Context, pipeline any, opts ...*options.ChangeStreamOptions) (*mongo.ChangeStream, error)
+}
+
+// Watcher watches the documents of Collection, which are decoded into
+// messages like Entity as by Decode.
+type Watcher struct {
+	Collection   Collection
+	Entity       proto.Message
+	PollInterval time.Duration
+}
+
+// Server error codes for a server without change streams, and for a
+// resume token older than the oplog
+const (
+	codeChangeStreamsUnsupported = 40573
+	codeHistoryLost              = 286
+)
+
+// pollLookback is how far before the last poll a poll looks for updated
+// documents, so that one stamped just before another but saved just after
+// it is still found
+const pollLookback = time.Second
+
+// Token prefixes tell the two kinds of resume token apart
+const (
+	changeStreamToken = "c."
+	pollToken         = "p."
+)
+
+// Watch sends the changes to the collection that match filter (see
+// ParseFilter), after the change of token when one is given, until the
+// stream's context is done. Deletions match any filter, since a deleted
+// document is gone. Headers are sent once the changes are being watched.
+//
+// The error is a status: InvalidArgument for a bad filter or token,
+// OutOfRange for a token the server no longer holds the changes after,
+// and Unavailable when the database fails.
+func (w *Watcher) Watch(stream grpc.ServerStream, filter, token string, send func(Change) error) error {
+	if w == nil || w.Collection == nil {
+		return status.Error(codes.FailedPrecondition, "no database to watch")
+	}
+	f, err := ParseFilter(filter, w.Entity.ProtoReflect().Descriptor())
+	if err != nil {
+		return status.Errorf(codes.InvalidArgument, "invalid filter: %v", err)
+	}
+	if token != "" && !strings.HasPrefix(token, changeStreamToken) && !strings.HasPrefix(token, pollToken) {
+		return status.Errorf(codes.InvalidArgument, "malformed resume token %q", token)
+	}
+	if strings.HasPrefix(token, pollToken) {
+		return w.poll(stream, f, token, send)
+	}
+
+	ctx := stream.Context()
+	cs, err := w.open(ctx, f, token)
+	var se mongo.ServerError
+	if errors.As(err, &se) && se.HasErrorCode(codeChangeStreamsUnsupported) {
+		if token != "" {
+			return status.Error(codes.InvalidArgument, "resume token is from a change stream, which the server no longer has")
+		}
+		return w.poll(stream, f, "", send)
+	}
+	if err != nil {
+		return streamError(err)
+	}
+	defer cs.Close(context.Background())
+	if err := stream.SendHeader(nil); err != nil {
+		return err
+	}
+
+	for cs.Next(ctx) {
+		var event struct {
+			OperationType string   `bson:"operationType"`
+			DocumentKey   bson.Raw `bson:"documentKey"`
+			FullDocument  bson.Raw `bson:"fullDocument"`
+		}
+		if err := cs.Decode(&event); err != nil {
+			return status.Errorf(codes.Internal, "undecodable change: %v", err)
+		}
+		change := Change{ID: idString(event.DocumentKey.Lookup("_id")), Token: changeStreamToken + cs.ResumeToken().Lookup("_data").StringValue()}
+		switch event.OperationType {
+		case "insert":
+			change.Op = Created
+		case "update", "replace":
+			if event.FullDocument == nil {
+				continue // deleted since; its deletion follows
+			}
+			change.Op = Updated
+		case "delete":
+			change.Op = Deleted
+		default: // drop, rename, dropDatabase or invalidate
+			return status.Errorf(codes.Aborted, "collection %s went away (%s)", w.Collection.Name(), event.OperationType)
+		}
+		if event.FullDocument != nil {
+			change.Data = w.decode(event.FullDocument)
+		}
+		if err := send(change); err != nil {
+			return err
+		}
+	}
+	if ctx.Err() != nil {
+		return nil
+	}
+	return streamError(cs.Err())
+}
+
+// open opens a change stream on the changes matching f, after token
+func (w *Watcher) open(ctx context.Context, f *Filter, token string) (*mongo.ChangeStream, error) {
+	match := bson.D{{Key: "$or", Value: bson.A{
+		bson.D{{Key: "operationType", Value: bson.D{{Key: "$nin", Value: bson.A{"insert", "update", "replace"}}}}},
+		bson.D{{Key: "$and", Value: bson.A{
+			bson.D{{Key: "operationType", Value: bson.D{{Key: "$in", Value: bson.A{"insert", "update", "replace"}}}}},
+			f.Query("fullDocument."),
+		}}},
+	}}}
+	opts := options.ChangeStream().SetFullDocument(options.UpdateLookup)
+	if token != "" {
+		opts.SetResumeAfter(bson.D{{Key: "_data", Value: strings.TrimPrefix(token, changeStreamToken)}})
+	}
+	return w.Collection.Watch(ctx, mongo.Pipeline{{{Key: "$match", Value: match}}}, opts)
+}
+
+// streamError maps a failed change stream to a status
+func streamError(err error) error {
+	var se mongo.ServerError
+	if errors.As(err, &se) && se.HasErrorCode(codeHistoryLost) {
+		return status.Error(codes.OutOfRange, "resume token expired; reconnect without it")
+	}
+	return status.Errorf(codes.Unavailable, "change stream failed: %v", err)
+}
+
+func (w *Watcher) decode(doc bson.Raw) proto.Message {
+	msg := w.Entity.ProtoReflect().New()
+	Decode(doc, msg)
+	return msg.Interface()
+}
+
+// idString returns a document id as a string: hex for an ObjectID
+func idString(rv bson.RawValue) string {
+	if id, ok := rv.ObjectIDOK(); ok {
+		return id.Hex()
+	}
+	if s, ok := rv.StringValueOK(); ok {
+		return s
+	}
+	return rv.String()
+}
+
+// version is what polling keeps of a document to tell whether it changed
+type version struct {
+	id      bson.RawValue
+	created time.Time
+	updated time.Time
+	isNew   bool // created since the last poll
+}
+
+// poll sends the changes a poll of the collection finds, every
+// PollInterval. A document is created when its id is new, updated when its
+// updated_at changes and deleted when its id is gone, so updates are only
+// seen to documents that keep updated_at, as the generated models do.
+// Each poll reads the documents updated since shortly before the last one,
+// which an index on updated_at keeps cheap, and the ids of all documents,
+// to find those deleted; only opening the stream reads every version.
+//
+// A poll token holds the time the poll that found the change looked back
+// to. Resuming from it sends the documents updated since then, again
+// perhaps, but not the deletions.
+func (w *Watcher) poll(stream grpc.ServerStream, f *Filter, token string, send func(Change) error) error {
+	ctx := stream.Context()
+	interval := w.PollInterval
+	if interval <= 0 {
+		interval = DefaultPollInterval
+	}
+	var since time.Time
+	if token != "" {
+		nanos, err := strconv.ParseInt(strings.TrimPrefix(token, pollToken), 36, 64)
+		if err != nil {
+			return status.Errorf(codes.InvalidArgument, "malformed resume token %q", token)
+		}
+		since = time.Unix(0, nanos)
+	}
+	last := time.Now()
+	versions, err := w.versions(ctx, time.Time{})
+	if err != nil {
+		return status.Errorf(codes.Unavailable, "failed to poll %s: %v", w.Collection.Name(), err)
+	}
+	seen := map[string]version{}
+	for _, v := range versions {
+		seen[idString(v.id)] = v
+	}
+	if err := stream.SendHeader(nil); err != nil {
+		return err
+	}
+	if token != "" {
+		var missed []version
+		for _, v := range versions {
+			if !v.updated.Before(since) {
+				v.isNew = !v.created.Before(since)
+				missed = append(missed, v)
+			}
+		}
+		slices.SortFunc(missed, func(a, b version) int { return a.updated.Compare(b.updated) })
+		if err := w.sendPolled(ctx, f, since, missed, nil, send); err != nil {
+			return err
+		}
+	}
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-ticker.C:
+		}
+		now, from := time.Now(), last.Add(-pollLookback)
+		// Ids first, so a document created in between is in recent
+		ids, err := w.ids(ctx)
+		var recent []version
+		if err == nil {
+			recent, err = w.versions(ctx, from)
+		}
+		if err != nil {
+			if ctx.Err() != nil {
+				return nil
+			}
+			return status.Errorf(codes.Unavailable, "failed to poll %s: %v", w.Collection.Name(), err)
+		}
+		changed, deleted := diff(seen, recent, ids)
+		if err := w.sendPolled(ctx, f, from, changed, deleted, send); err != nil {
+			return err
+		}
+		last = now
+	}
+}
+
+// versions returns the version of each document updated since, or of
+// every document when since is zero
+func (w *Watcher) versions(ctx context.Context, since time.Time) ([]version, error) {
+	query := bson.D{}
+	if !since.IsZero() {
+		query = bson.D{{Key: "updated_at", Value: bson.D{{Key: "$gte", Value: since}}}}
+	}
+	projection := bson.D{{Key: "_id", Value: 1}, {Key: "created_at", Value: 1}, {Key: "updated_at", Value: 1}}
+	cursor, err := w.Collection.Find(ctx, query, options.Find().SetProjection(projection))
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+	var versions []version
+	for cursor.Next(ctx) {
+		v := version{id: cursor.Current.Lookup("_id")}
+		v.created, _ = cursor.Current.Lookup("created_at").TimeOK()
+		v.updated, _ = cursor.Current.Lookup("updated_at").TimeOK()
+		versions = append(versions, v)
+	}
+	return versions, cursor.Err()
+}
+
+// ids returns the id of every document, by its string form
+func (w *Watcher) ids(ctx context.Context) (map[string]bson.RawValue, error) {
+	cursor, err := w.Collection.Find(ctx, bson.D{}, options.Find().SetProjection(bson.D{{Key: "_id", Value: 1}}))
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+	ids := map[string]bson.RawValue{}
+	for cursor.Next(ctx) {
+		id := cursor.Current.Lookup("_id")
+		ids[idString(id)] = id
+	}
+	return ids, cursor.Err()
+}
+
+// diff returns the documents of recent, and of ids, that are new or
+// updated since seen, by when they were updated, and the ids of seen that
+// are gone from both; it then brings seen up to date. ids was read before
+// recent, so a document in recent alone was created in between.
+func diff(seen map[string]version, recent []version, ids map[string]bson.RawValue) (changed []version, deleted []string) {
+	inRecent := map[string]bool{}
+	for _, v := range recent {
+		inRecent[idString(v.id)] = true
+	}
+	for id := range seen {
+		if _, ok := ids[id]; !ok && !inRecent[id] {
+			deleted = append(deleted, id)
+			delete(seen, id)
+		}
+	}
+	for _, v := range recent {
+		id := idString(v.id)
+		p, ok := seen[id]
+		if !ok || !p.updated.Equal(v.updated) {
+			seen[id] = v
+			v.isNew = !ok
+			changed = append(changed, v)
+		}
+	}
+	// Documents without updated_at are only found by their id
+	for id, rv := range ids {
+		if _, ok := seen[id]; !ok {
+			seen[id] = version{id: rv}
+			changed = append(changed, version{id: rv, isNew: true})
+		}
+	}
+	slices.SortFunc(changed, func(a, b version) int {
+		return cmp.Or(a.updated.Compare(b.updated), strings.Compare(idString(a.id), idString(b.id)))
+	})
+	slices.Sort(deleted)
+	return changed, deleted
+}
+
+// sendPolled sends the changed documents that match f and the deletions,
+// with a token resuming from since
+func (w *Watcher) sendPolled(ctx context.Context, f *Filter, since time.Time, changed []version, deleted []string, send func(Change) error) error {
+	token := pollToken + strconv.FormatInt(since.UnixNano(), 36)
+	if len(changed) > 0 {
+		ids, isNew := make(bson.A, len(changed)), map[string]bool{}
+		for i, v := range changed {
+			ids[i] = v.id
+			isNew[idString(v.id)] = v.isNew
+		}
+		query := bson.D{{Key: "$and", Value: bson.A{bson.D{{Key: "_id", Value: bson.D{{Key: "$in", Value: ids}}}}, f.Query("")}}}
+		cursor, err := w.Collection.Find(ctx, query, options.Find().SetSort(bson.D{{Key: "updated_at", Value: 1}}))
+		if err != nil {
+			return status.Errorf(codes.Unavailable, "failed to poll %s: %v", w.Collection.Name(), err)
+		}
+		defer cursor.Close(ctx)
+		for cursor.Next(ctx) {
+			change := Change{Op: Updated, ID: idString(cursor.Current.Lookup("_id")), Data: w.decode(cursor.Current), Token: token}
+			if isNew[change.ID] {
+				change.Op = Created
+			}
+			if err := send(change); err != nil {
+				return err
+			}
+		}
+		if err := cursor.Err(); err != nil && ctx.Err() == nil {
+			return status.Errorf(codes.Unavailable, "failed to poll %s: %v", w.Collection.Name(), err)
+		}
+	}
+	for _, id := range deleted {
+		if err := send(Change{Op: Deleted, ID: id, Token: token}); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,351 @@
+package watch
+
+import (
+	"cmp"
+	"context"
+	"errors"
+	"grpc_anotation_sample/pb"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+// memCollection keeps documents in memory, like a standalone server
+// without change streams. Find understands the queries a Watcher makes:
+// $and, $or, $nor, $in, $regex and comparisons of strings and times,
+// sorted by one field.
+type memCollection struct {
+	mu   sync.Mutex
+	docs map[string]bson.D
+	// fullScans counts the reads of every document's version
+	fullScans int
+}
+
+func newMemCollection() *memCollection {
+	return &memCollection{docs: map[string]bson.D{}}
+}
+
+// put saves a book stamped as created at created and updated at updated
+func (c *memCollection) put(id, title string, created, updated time.Time) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.docs[id] = bson.D{{Key: "_id", Value: id}, {Key: "title", Value: title}, {Key: "created_at", Value: created}, {Key: "updated_at", Value: updated}}
+}
+
+func (c *memCollection) remove(id string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	delete(c.docs, id)
+}
+
+func (c *memCollection) Name() string { return "books" }
+
+func (c *memCollection) Watch(context.Context, any, ...*options.ChangeStreamOptions) (*mongo.ChangeStream, error) {
+	return nil, mongo.CommandError{Code: codeChangeStreamsUnsupported, Message: "The $changeStream stage is only supported on replica sets"}
+}
+
+func (c *memCollection) Find(_ context.Context, filter any, opts ...*options.FindOptions) (*mongo.Cursor, error) {
+	query, err := bson.Marshal(filter)
+	if err != nil {
+		return nil, err
+	}
+	o := options.MergeFindOptions(opts...)
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if len(bson.Raw(query)) == 5 && o.Projection != nil && len(o.Projection.(bson.D)) > 1 {
+		c.fullScans++
+	}
+	var found []bson.Raw
+	for _, d := range c.docs {
+		doc, _ := bson.Marshal(d)
+		if matches(doc, query) {
+			found = append(found, doc)
+		}
+	}
+	slices.SortFunc(found, func(a, b bson.Raw) int {
+		return strings.Compare(a.Lookup("_id").StringValue(), b.Lookup("_id").StringValue())
+	})
+	if o.Sort != nil {
+		key := o.Sort.(bson.D)[0].Key
+		slices.SortStableFunc(found, func(a, b bson.Raw) int { n, _ := compare(a.Lookup(key), b.Lookup(key)); return n })
+	}
+	docs := make([]any, len(found))
+	for i, doc := range found {
+		docs[i] = doc
+	}
+	return mongo.NewCursorFromDocuments(docs, nil, nil)
+}
+
+func matches(doc, query bson.Raw) bool {
+	elems, _ := query.Elements()
+	for _, e := range elems {
+		var subs []bson.Raw
+		if arr, ok := e.Value().ArrayOK(); ok {
+			values, _ := arr.Values()
+			for _, v := range values {
+				subs = append(subs, v.Document())
+			}
+		}
+		match := func(q bson.Raw) bool { return matches(doc, q) }
+		var ok bool
+		switch e.Key() {
+		case "$and":
+			ok = !slices.ContainsFunc(subs, func(q bson.Raw) bool { return !match(q) })
+		case "$or":
+			ok = slices.ContainsFunc(subs, match)
+		case "$nor":
+			ok = !slices.ContainsFunc(subs, match)
+		default:
+			ok = matchField(doc.Lookup(strings.Split(e.Key(), ".")...), e.Value().Document())
+		}
+		if !ok {
+			return false
+		}
+	}
+	return true
+}
+
+func matchField(v bson.RawValue, cond bson.Raw) bool {
+	elems, _ := cond.Elements()
+	for _, e := range elems {
+		n, ok := compare(v, e.Value())
+		var match bool
+		switch e.Key() {
+		case "$eq":
+			match = ok && n == 0
+		case "$ne":
+			match = !ok || n != 0
+		case "$gt":
+			match = ok && n > 0
+		case "$gte":
+			match = ok && n >= 0
+		case "$lt":
+			match = ok && n < 0
+		case "$lte":
+			match = ok && n <= 0
+		case "$in":
+			values, _ := e.Value().Array().Values()
+			match = slices.ContainsFunc(values, func(x bson.RawValue) bool { n, ok := compare(v, x); return ok && n == 0 })
+		case "$regex":
+			s, isString := v.StringValueOK()
+			match = isString && regexp.MustCompile(e.Value().StringValue()).MatchString(s)
+		}
+		if !match {
+			return false
+		}
+	}
+	return true
+}
+
+// compare orders two values of the same kind
+func compare(a, b bson.RawValue) (int, bool) {
+	if x, ok := a.StringValueOK(); ok {
+		y, ok := b.StringValueOK()
+		return strings.Compare(x, y), ok
+	}
+	if x, ok := a.DateTimeOK(); ok {
+		y, ok := b.DateTimeOK()
+		return cmp.Compare(x, y), ok
+	}
+	return 0, false
+}
+
+// testStream records when headers are sent
+type testStream struct {
+	grpc.ServerStream
+	ctx    context.Context
+	header chan struct{}
+}
+
+func newTestStream(ctx context.Context) *testStream {
+	return &testStream{ctx: ctx, header: make(chan struct{})}
+}
+
+func (s *testStream) Context() context.Context { return s.ctx }
+
+func (s *testStream) SendHeader(metadata.MD) error {
+	close(s.header)
+	return nil
+}
+
+// startWatch runs w.Watch until the test ends, returning the changes it
+// sends once it has sent headers
+func startWatch(t *testing.T, w *Watcher, filter, token string) <-chan Change {
+	t.Helper()
+	ctx, cancel := context.WithCancel(context.Background())
+	stream := newTestStream(ctx)
+	changes, done := make(chan Change, 16), make(chan error, 1)
+	go func() {
+		done <- w.Watch(stream, filter, token, func(c Change) error {
+			changes <- c
+			return nil
+		})
+	}()
+	t.Cleanup(func() {
+		cancel()
+		if err := <-done; err != nil {
+			t.Errorf("Watch = %v after the stream ended", err)
+		}
+	})
+	select {
+	case <-stream.header:
+	case err := <-done:
+		t.Fatalf("Watch = %v before sending headers", err)
+	case <-time.After(5 * time.Second):
+		t.Fatal("Watch sent no headers")
+	}
+	return changes
+}
+
+// next returns the next change, which must have op and id
+func next(t *testing.T, changes <-chan Change, op Op, id string) Change {
+	t.Helper()
+	select {
+	case c := <-changes:
+		if c.Op != op || c.ID != id {
+			t.Fatalf("change = %v %s, want %v %s", c.Op, c.ID, op, id)
+		}
+		if !strings.HasPrefix(c.Token, pollToken) {
+			t.Errorf("token = %q, want a poll token", c.Token)
+		}
+		return c
+	case <-time.After(5 * time.Second):
+		t.Fatalf("no change, want %v %s", op, id)
+		return Change{}
+	}
+}
+
+func title(c Change) string { return c.Data.(*pb.Book).GetTitle() }
+
+func TestWatchPolls(t *testing.T) {
+	coll := newMemCollection()
+	now := time.Now()
+	coll.put("a", "Dune", now, now)
+	w := &Watcher{Collection: coll, Entity: &pb.Book{}, PollInterval: 10 * time.Millisecond}
+	changes := startWatch(t, w, `title ~ "dune"`, "")
+
+	coll.put("b", "Dune Messiah", time.Now(), time.Now())
+	if c := next(t, changes, Created, "b"); title(c) != "Dune Messiah" {
+		t.Errorf("created title = %q", title(c))
+	}
+	// Emma does not match the filter, so the next change is Dune's update
+	coll.put("x", "Emma", time.Now(), time.Now())
+	coll.put("a", "Dune (revised)", now, time.Now())
+	if c := next(t, changes, Updated, "a"); title(c) != "Dune (revised)" {
+		t.Errorf("updated title = %q", title(c))
+	}
+	coll.remove("b")
+	if c := next(t, changes, Deleted, "b"); c.Data != nil {
+		t.Errorf("deletion data = %v, want none", c.Data)
+	}
+
+	// Polls after the first read only the ids of every document
+	time.Sleep(50 * time.Millisecond)
+	coll.mu.Lock()
+	defer coll.mu.Unlock()
+	if coll.fullScans != 1 {
+		t.Errorf("read every version %d times, want once", coll.fullScans)
+	}
+}
+
+func TestWatchResumesFromPollToken(t *testing.T) {
+	coll := newMemCollection()
+	now := time.Now()
+	coll.put("a", "Dune", now.Add(-time.Hour), now.Add(-time.Hour))
+	coll.put("b", "Emma", now.Add(-time.Hour), now.Add(-time.Second))
+	coll.put("c", "Ulysses", now.Add(-2*time.Second), now.Add(-2*time.Second))
+	w := &Watcher{Collection: coll, Entity: &pb.Book{}, PollInterval: 10 * time.Millisecond}
+	token := pollToken + strconv.FormatInt(now.Add(-time.Minute).UnixNano(), 36)
+	changes := startWatch(t, w, "", token)
+
+	// The documents changed since the token, in update order, then what
+	// changes after
+	next(t, changes, Created, "c")
+	next(t, changes, Updated, "b")
+	coll.put("d", "Walden", time.Now(), time.Now())
+	next(t, changes, Created, "d")
+}
+
+func TestWatchRefuses(t *testing.T) {
+	tests := []struct {
+		name    string
+		w       *Watcher
+		filter  string
+		token   string
+		want    codes.Code
+		wantMsg string
+	}{
+		{name: "no database", w: &Watcher{Entity: &pb.Book{}}, want: codes.FailedPrecondition},
+		{name: "bad filter", filter: "nope = 1", want: codes.InvalidArgument, wantMsg: "invalid filter"},
+		{name: "unknown token", token: "x.1", want: codes.InvalidArgument, wantMsg: "malformed resume token"},
+		{name: "malformed poll token", token: "p.!", want: codes.InvalidArgument, wantMsg: "malformed resume token"},
+		{name: "change stream token without change streams", token: "c.8263", want: codes.InvalidArgument, wantMsg: "no longer has"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := tt.w
+			if w == nil {
+				w = &Watcher{Collection: newMemCollection(), Entity: &pb.Book{}}
+			}
+			ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+			defer cancel()
+			err := w.Watch(newTestStream(ctx), tt.filter, tt.token, func(Change) error { return nil })
+			if status.Code(err) != tt.want || !strings.Contains(err.Error(), tt.wantMsg) {
+				t.Errorf("Watch = %v, want %v containing %q", err, tt.want, tt.wantMsg)
+			}
+		})
+	}
+}
+
+func TestSendPolled(t *testing.T) {
+	coll := newMemCollection()
+	at := func(s int) time.Time { return time.Unix(int64(s), 0) }
+	coll.put("a", "Dune", at(1), at(3))
+	coll.put("b", "Dune Messiah", at(2), at(2))
+	coll.put("x", "Emma", at(2), at(2))
+	w := &Watcher{Collection: coll, Entity: &pb.Book{}}
+	f, err := ParseFilter(`title ~ "dune"`, w.Entity.ProtoReflect().Descriptor())
+	if err != nil {
+		t.Fatal(err)
+	}
+	id := func(s string) bson.RawValue { return bson.RawValue{Type: bson.TypeString, Value: bsoncoreString(s)} }
+	changed := []version{{id: id("a")}, {id: id("b"), isNew: true}, {id: id("x"), isNew: true}}
+	since := at(1)
+
+	var got []string
+	err = w.sendPolled(context.Background(), f, since, changed, []string{"gone"}, func(c Change) error {
+		if want := pollToken + strconv.FormatInt(since.UnixNano(), 36); c.Token != want {
+			t.Errorf("token = %q, want %q", c.Token, want)
+		}
+		got = append(got, c.Op.String()+" "+c.ID)
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("sendPolled = %v", err)
+	}
+	if want := []string{"CREATED b", "UPDATED a", "DELETED gone"}; !slices.Equal(got, want) {
+		t.Errorf("sent %q, want %q: matching changes by update, then deletions", got, want)
+	}
+
+	sendErr := errors.New("client gone")
+	calls := 0
+	err = w.sendPolled(context.Background(), f, since, changed, []string{"gone"}, func(Change) error {
+		calls++
+		return sendErr
+	})
+	if !errors.Is(err, sendErr) || calls != 1 {
+		t.Errorf("sendPolled = %v after %d sends, want the send error after one", err, calls)
+	}
+}
@@ -311,6 +311,10 @@ async def generate_service(service_name: str, fields: str) -> str:
         fields: Comma-separated field definitions in format "name:type,name2:type2"
                Supported types: string, int32, int64, bool, float, double, timestamp
                For repeated fields: "repeated type name" or "name:repeated type"
+               For enums: "status:Status{DRAFT,PUBLISHED}"
+               For maps: "labels:map<string,string>"
+               For oneofs: "payload:oneof{text:string|image:bytes}"
+               Also: duration, struct, and "type?" for nullable scalars
     
     Examples:
         - generate_service("User", "name:string,email:string,age:int32")
@@ -492,6 +496,19 @@ Supported protobuf field types:
 3. **Timestamp fields:** `created_at:timestamp`
    - Automatically maps to google.protobuf.Timestamp
 
+4. **Enum fields:** `status:Status{DRAFT,PUBLISHED}`
+   - Declares `enum Status` with a `STATUS_UNSPECIFIED = 0` zero value
+   - Maps to a string-backed Go type in the model
+
+5. **Map fields:** `labels:map<string,string>`
+   - Map values must be scalars; maps to a Go map in the model
+
+6. **Oneof fields:** `payload:oneof{text:string|image:bytes}`
+   - Each variant becomes a pointer field in the model; set at most one
+
+7. **Well-known types:** `ttl:duration`, `attrs:struct`, `nickname:string?`
+   - Map to google.protobuf.Duration, Struct and wrapper types (nullable scalars)
+
 ## Service Examples
 
 ### User Service
@@ -0,0 +1,81 @@
+// Package migrations holds MongoDB data migrations. Files in this package are
+// generated by `gen_service.sh add-migration` and applied by cmd/migrate.
+package migrations
+
+import (
+	"context"
+	"fmt"
+	"sort"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// Func performs one direction of a migration against the application database.
+type Func func(ctx context.Context, db *mongo.Database) error
+
+// Migration is a single, ordered change to stored documents. IDs start with a
+// UTC timestamp so lexical order is application order.
+type Migration struct {
+	ID          string
+	Description string
+	Up          Func
+	// Down reverts Up; nil marks the migration as irreversible.
+	Down Func
+}
+
+var registry = map[string]Migration{}
+
+// Register adds a migration; generated files call it from init.
+func Register(m Migration) {
+	if m.ID == "" || m.Up == nil {
+		panic("migrations: migration needs an ID and an Up func")
+	}
+	if _, dup := registry[m.ID]; dup {
+		panic(fmt.Sprintf("migrations: duplicate migration %q", m.ID))
+	}
+	registry[m.ID] = m
+}
+
+// All returns every registered migration sorted by ID.
+func All() []Migration {
+	all := make([]Migration, 0, len(registry))
+	for _, m := range registry {
+		all = append(all, m)
+	}
+	sort.Slice(all, func(i, j int) bool { return all[i].ID < all[j].ID })
+	return all
+}
+
+// Backfill sets field to value on every document of collection that lacks it.
+func Backfill(collection, field string, value interface{}) Func {
+	return func(ctx context.Context, db *mongo.Database) error {
+		_, err := db.Collection(collection).UpdateMany(ctx,
+			bson.M{field: bson.M{"$exists": false}},
+			bson.M{"$set": bson.M{field: value}},
+		)
+		return err
+	}
+}
+
+// Unset removes field from every document of collection.
+func Unset(collection, field string) Func {
+	return func(ctx context.Context, db *mongo.Database) error {
+		_, err := db.Collection(collection).UpdateMany(ctx,
+			bson.M{field: bson.M{"$exists": true}},
+			bson.M{"$unset": bson.M{field: ""}},
+		)
+		return err
+	}
+}
+
+// Rename moves field from to field to on every document of collection.
+func Rename(collection, from, to string) Func {
+	return func(ctx context.Context, db *mongo.Database) error {
+		_, err := db.Collection(collection).UpdateMany(ctx,
+			bson.M{from: bson.M{"$exists": true}},
+			bson.M{"$rename": bson.M{from: to}},
+		)
+		return err
+	}
+}
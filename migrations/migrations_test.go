@@ -0,0 +1,38 @@
+package migrations
+
+import (
+	"context"
+	"testing"
+
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+func TestAllSortedByID(t *testing.T) {
+	saved := registry
+	defer func() { registry = saved }()
+	registry = map[string]Migration{}
+
+	noop := func(context.Context, *mongo.Database) error { return nil }
+	Register(Migration{ID: "20250102000000_second", Up: noop})
+	Register(Migration{ID: "20250101000000_first", Up: noop})
+
+	all := All()
+	if len(all) != 2 || all[0].ID != "20250101000000_first" || all[1].ID != "20250102000000_second" {
+		t.Errorf("All() returned migrations out of order: %v", all)
+	}
+}
+
+func TestRegisterRejectsDuplicates(t *testing.T) {
+	saved := registry
+	defer func() { registry = saved }()
+	registry = map[string]Migration{}
+
+	noop := func(context.Context, *mongo.Database) error { return nil }
+	Register(Migration{ID: "20250101000000_first", Up: noop})
+	defer func() {
+		if recover() == nil {
+			t.Error("Register did not panic on a duplicate ID")
+		}
+	}()
+	Register(Migration{ID: "20250101000000_first", Up: noop})
+}
@@ -0,0 +1,115 @@
+package migrations
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// HistoryCollection records which migrations have been applied.
+const HistoryCollection = "schema_migrations"
+
+type record struct {
+	ID        string    `bson:"_id"`
+	AppliedAt time.Time `bson:"applied_at"`
+}
+
+// Status reports whether a migration has been applied.
+type Status struct {
+	Migration
+	Applied   bool
+	AppliedAt time.Time
+}
+
+// Runner applies registered migrations to a database.
+type Runner struct {
+	db         *mongo.Database
+	migrations []Migration
+}
+
+func NewRunner(db *mongo.Database) *Runner {
+	return &Runner{db: db, migrations: All()}
+}
+
+func (r *Runner) applied(ctx context.Context) (map[string]time.Time, error) {
+	cur, err := r.db.Collection(HistoryCollection).Find(ctx, bson.M{})
+	if err != nil {
+		return nil, err
+	}
+	var records []record
+	if err := cur.All(ctx, &records); err != nil {
+		return nil, err
+	}
+	applied := make(map[string]time.Time, len(records))
+	for _, rec := range records {
+		applied[rec.ID] = rec.AppliedAt
+	}
+	return applied, nil
+}
+
+// Status lists every registered migration in order with its applied state.
+func (r *Runner) Status(ctx context.Context) ([]Status, error) {
+	applied, err := r.applied(ctx)
+	if err != nil {
+		return nil, err
+	}
+	statuses := make([]Status, 0, len(r.migrations))
+	for _, m := range r.migrations {
+		at, ok := applied[m.ID]
+		statuses = append(statuses, Status{Migration: m, Applied: ok, AppliedAt: at})
+	}
+	return statuses, nil
+}
+
+// Up applies all pending migrations in order and returns the IDs it ran.
+func (r *Runner) Up(ctx context.Context) ([]string, error) {
+	applied, err := r.applied(ctx)
+	if err != nil {
+		return nil, err
+	}
+	var ran []string
+	for _, m := range r.migrations {
+		if _, ok := applied[m.ID]; ok {
+			continue
+		}
+		if err := m.Up(ctx, r.db); err != nil {
+			return ran, fmt.Errorf("migration %s: %w", m.ID, err)
+		}
+		rec := record{ID: m.ID, AppliedAt: time.Now().UTC()}
+		if _, err := r.db.Collection(HistoryCollection).InsertOne(ctx, rec); err != nil {
+			return ran, fmt.Errorf("record migration %s: %w", m.ID, err)
+		}
+		ran = append(ran, m.ID)
+	}
+	return ran, nil
+}
+
+// Down reverts the last steps applied migrations, newest first.
+func (r *Runner) Down(ctx context.Context, steps int) ([]string, error) {
+	applied, err := r.applied(ctx)
+	if err != nil {
+		return nil, err
+	}
+	var reverted []string
+	for i := len(r.migrations) - 1; i >= 0 && len(reverted) < steps; i-- {
+		m := r.migrations[i]
+		if _, ok := applied[m.ID]; !ok {
+			continue
+		}
+		if m.Down == nil {
+			return reverted, fmt.Errorf("migration %s is irreversible", m.ID)
+		}
+		if err := m.Down(ctx, r.db); err != nil {
+			return reverted, fmt.Errorf("revert migration %s: %w", m.ID, err)
+		}
+		if _, err := r.db.Collection(HistoryCollection).DeleteOne(ctx, bson.M{"_id": m.ID}); err != nil {
+			return reverted, fmt.Errorf("unrecord migration %s: %w", m.ID, err)
+		}
+		reverted = append(reverted, m.ID)
+	}
+	return reverted, nil
+}
+
@@ -0,0 +1,333 @@
+// Package openapi builds an OpenAPI 3.1 document for the REST API that
+// grpc-gateway serves from the google.api.http bindings of a set of proto
+// files. Schemas follow protojson, as in the console package.
+package openapi
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+
+	"google.golang.org/protobuf/reflect/protoreflect"
+
+	"grpc_anotation_sample/console"
+	"grpc_anotation_sample/protoset"
+)
+
+// Version is the OpenAPI revision of the documents built here
+const Version = "3.1.0"
+
+// statusSchema is google.rpc.Status as the gateway writes it for errors
+const statusSchema = "google.rpc.Status"
+
+// Document is an OpenAPI document. Schemas are JSON Schema objects as built
+// by console.SchemaRefs.
+type Document struct {
+	OpenAPI    string                           `json:"openapi"`
+	Info       Info                             `json:"info"`
+	Servers    []Server                         `json:"servers,omitempty"`
+	Tags       []Tag                            `json:"tags,omitempty"`
+	Paths      map[string]map[string]*Operation `json:"paths"`
+	Components Components                       `json:"components"`
+	Security   []map[string][]string            `json:"security,omitempty"`
+}
+
+type Info struct {
+	Title       string `json:"title"`
+	Description string `json:"description,omitempty"`
+	Version     string `json:"version"`
+}
+
+type Server struct {
+	URL         string `json:"url"`
+	Description string `json:"description,omitempty"`
+}
+
+type Tag struct {
+	Name        string `json:"name"`
+	Description string `json:"description,omitempty"`
+}
+
+type Components struct {
+	Schemas         map[string]map[string]any  `json:"schemas"`
+	Responses       map[string]*Response       `json:"responses,omitempty"`
+	SecuritySchemes map[string]*SecurityScheme `json:"securitySchemes,omitempty"`
+}
+
+type SecurityScheme struct {
+	Type        string `json:"type"`
+	Scheme      string `json:"scheme,omitempty"`
+	Description string `json:"description,omitempty"`
+}
+
+// Operation is one HTTP binding of an RPC. OperationID is Service_Method,
+// with the binding's index appended for additional bindings.
+type Operation struct {
+	OperationID string               `json:"operationId"`
+	Summary     string               `json:"summary,omitempty"`
+	Description string               `json:"description,omitempty"`
+	Tags        []string             `json:"tags,omitempty"`
+	Parameters  []*Parameter         `json:"parameters,omitempty"`
+	RequestBody *RequestBody         `json:"requestBody,omitempty"`
+	Responses   map[string]*Response `json:"responses"`
+}
+
+type Parameter struct {
+	Name        string         `json:"name"`
+	In          string         `json:"in"`
+	Description string         `json:"description,omitempty"`
+	Required    bool           `json:"required,omitempty"`
+	Schema      map[string]any `json:"schema"`
+}
+
+type RequestBody struct {
+	Required bool                  `json:"required"`
+	Content  map[string]*MediaType `json:"content"`
+}
+
+// Response is a response, or a reference to one of the document's
+// components when Ref is set.
+type Response struct {
+	Ref         string                `json:"$ref,omitempty"`
+	Description string                `json:"description,omitempty"`
+	Content     map[string]*MediaType `json:"content,omitempty"`
+}
+
+type MediaType struct {
+	Schema map[string]any `json:"schema"`
+}
+
+// Build returns the document for the services of files, sorted by path so
+// the output is stable. Error responses use google.rpc.Status, and a bearer
+// token may be sent with any operation; the gateway forwards the
+// Authorization header as gRPC metadata.
+func Build(files []protoreflect.FileDescriptor, info Info) *Document {
+	doc := &Document{
+		OpenAPI: Version,
+		Info:    info,
+		Paths:   map[string]map[string]*Operation{},
+		Components: Components{
+			Schemas: map[string]map[string]any{},
+			Responses: map[string]*Response{
+				"Error": {
+					Description: "The gRPC status of a failed call, mapped to an HTTP status by the gateway (e.g. InvalidArgument is 400, NotFound 404).",
+					Content:     jsonContent(schemaRef(statusSchema)),
+				},
+			},
+			SecuritySchemes: map[string]*SecurityScheme{
+				"bearerAuth": {
+					Type:        "http",
+					Scheme:      "bearer",
+					Description: "Forwarded to the gRPC server as the authorization metadata.",
+				},
+			},
+		},
+		// Authentication is optional: {} allows anonymous calls
+		Security: []map[string][]string{{}, {"bearerAuth": {}}},
+	}
+	b := &builder{doc: doc}
+	b.addStatus()
+
+	files = append([]protoreflect.FileDescriptor(nil), files...)
+	sort.Slice(files, func(i, j int) bool { return files[i].Path() < files[j].Path() })
+	for _, file := range files {
+		svcs := file.Services()
+		for i := 0; i < svcs.Len(); i++ {
+			b.service(svcs.Get(i))
+		}
+	}
+	return doc
+}
+
+type builder struct {
+	doc *Document
+}
+
+func schemaRef(name string) map[string]any {
+	return map[string]any{"$ref": "#/components/schemas/" + name}
+}
+
+func jsonContent(schema map[string]any) map[string]*MediaType {
+	return map[string]*MediaType{"application/json": {Schema: schema}}
+}
+
+// ref adds md and the messages it uses to the components and returns a
+// reference to it.
+func (b *builder) ref(md protoreflect.MessageDescriptor) map[string]any {
+	name := string(md.FullName())
+	if _, ok := b.doc.Components.Schemas[name]; !ok {
+		b.doc.Components.Schemas[name] = nil // reserve the name for recursive messages
+		b.doc.Components.Schemas[name] = console.SchemaRefs(md, b.ref)
+	}
+	return schemaRef(name)
+}
+
+// addStatus defines google.rpc.Status without needing its descriptor, which
+// the project's files do not import.
+func (b *builder) addStatus() {
+	b.doc.Components.Schemas[statusSchema] = map[string]any{
+		"type":        "object",
+		"description": "The error model of gRPC, as returned by the gateway.",
+		"properties": map[string]any{
+			"code":    map[string]any{"type": "integer", "description": "The gRPC status code, e.g. 3 for InvalidArgument."},
+			"message": map[string]any{"type": "string"},
+			"details": map[string]any{
+				"type":  "array",
+				"items": map[string]any{"type": "object", "properties": map[string]any{"@type": map[string]any{"type": "string"}}, "required": []string{"@type"}},
+			},
+		},
+	}
+}
+
+func (b *builder) service(sd protoreflect.ServiceDescriptor) {
+	var bound bool
+	methods := sd.Methods()
+	for i := 0; i < methods.Len(); i++ {
+		md := methods.Get(i)
+		for n, binding := range protoset.Bindings(md) {
+			id := fmt.Sprintf("%s_%s", sd.Name(), md.Name())
+			if n > 0 {
+				id += fmt.Sprint(n + 1)
+			}
+			path, op := b.operation(id, md, binding)
+			op.Tags = []string{string(sd.Name())}
+			if b.doc.Paths[path] == nil {
+				b.doc.Paths[path] = map[string]*Operation{}
+			}
+			b.doc.Paths[path][strings.ToLower(binding.Method)] = op
+			bound = true
+		}
+	}
+	if bound {
+		b.doc.Tags = append(b.doc.Tags, Tag{Name: string(sd.Name()), Description: console.Comment(sd)})
+	}
+}
+
+// pathParam matches a variable of a path template: {field} or {field=pattern}
+var pathParam = regexp.MustCompile(`\{([^}=]+)(=[^}]*)?\}`)
+
+// operation returns the OpenAPI path and operation for one binding of md.
+// Fields bound in the path are path parameters; the body is the request
+// message, or one field of it, and the other fields are query parameters
+// when the body is not the whole message.
+func (b *builder) operation(id string, md protoreflect.MethodDescriptor, binding protoset.HTTPBinding) (string, *Operation) {
+	op := &Operation{
+		OperationID: id,
+		Responses: map[string]*Response{
+			"200":     b.success(md),
+			"default": {Ref: "#/components/responses/Error"},
+		},
+	}
+	if c := console.Comment(md); c != "" {
+		op.Summary, _, _ = strings.Cut(c, "\n")
+		op.Description = c
+	}
+
+	inPath := map[string]bool{}
+	for _, m := range pathParam.FindAllStringSubmatch(binding.Path, -1) {
+		name := m[1]
+		inPath[name] = true
+		p := &Parameter{Name: name, In: "path", Required: true, Schema: map[string]any{"type": "string"}}
+		if fd := fieldByPath(md.Input(), name); fd != nil {
+			p.Schema, p.Description = console.FieldSchema(fd), console.Comment(fd)
+		}
+		op.Parameters = append(op.Parameters, p)
+	}
+	path := pathParam.ReplaceAllString(binding.Path, "{$1}")
+
+	switch binding.Body {
+	case "":
+		op.Parameters = append(op.Parameters, queryParams(md.Input(), "", inPath, 0)...)
+	case "*":
+		op.RequestBody = &RequestBody{Required: true, Content: jsonContent(b.ref(md.Input()))}
+	default:
+		fd := md.Input().Fields().ByName(protoreflect.Name(binding.Body))
+		if fd != nil {
+			schema := console.SchemaRefs(md.Input(), b.ref)["properties"].(map[string]any)[fd.JSONName()].(map[string]any)
+			op.RequestBody = &RequestBody{Required: true, Content: jsonContent(schema)}
+		}
+		inPath[binding.Body] = true
+		op.Parameters = append(op.Parameters, queryParams(md.Input(), "", inPath, 0)...)
+	}
+	return path, op
+}
+
+// success describes the response of md. Server streams are written by the
+// gateway as newline-delimited JSON objects holding a result or an error.
+func (b *builder) success(md protoreflect.MethodDescriptor) *Response {
+	if !md.IsStreamingServer() {
+		return &Response{Description: "A successful response.", Content: jsonContent(b.ref(md.Output()))}
+	}
+	chunk := map[string]any{
+		"type": "object",
+		"properties": map[string]any{
+			"result": b.ref(md.Output()),
+			"error":  schemaRef(statusSchema),
+		},
+	}
+	return &Response{
+		Description: fmt.Sprintf("A stream of %s messages, one JSON object per line.", md.Output().Name()),
+		Content:     jsonContent(chunk),
+	}
+}
+
+// maxQueryDepth bounds the nested messages flattened into query parameters
+const maxQueryDepth = 3
+
+// queryWellKnown are the well-known types the gateway parses from a query
+// string: the wrappers and those with a string form.
+var queryWellKnown = map[protoreflect.FullName]bool{
+	"google.protobuf.Timestamp": true, "google.protobuf.Duration": true, "google.protobuf.FieldMask": true,
+	"google.protobuf.DoubleValue": true, "google.protobuf.FloatValue": true,
+	"google.protobuf.Int64Value": true, "google.protobuf.UInt64Value": true,
+	"google.protobuf.Int32Value": true, "google.protobuf.UInt32Value": true,
+	"google.protobuf.BoolValue": true, "google.protobuf.StringValue": true, "google.protobuf.BytesValue": true,
+}
+
+// queryParams returns the fields of md not bound elsewhere as query
+// parameters. Fields of nested messages are named with dots, as the gateway
+// expects; maps and repeated messages cannot be sent in a query.
+func queryParams(md protoreflect.MessageDescriptor, prefix string, bound map[string]bool, depth int) []*Parameter {
+	var params []*Parameter
+	fields := md.Fields()
+	for i := 0; i < fields.Len(); i++ {
+		fd := fields.Get(i)
+		name := prefix + string(fd.Name())
+		if bound[name] || fd.IsMap() {
+			continue
+		}
+		if msg := fd.Message(); msg != nil {
+			if msg.ParentFile().Package() != "google.protobuf" {
+				if !fd.IsList() && depth < maxQueryDepth {
+					params = append(params, queryParams(msg, name+".", bound, depth+1)...)
+				}
+				continue
+			}
+			if !queryWellKnown[msg.FullName()] {
+				continue
+			}
+		}
+		schema := console.FieldSchema(fd)
+		if fd.IsList() {
+			schema = map[string]any{"type": "array", "items": schema}
+		}
+		params = append(params, &Parameter{Name: name, In: "query", Description: console.Comment(fd), Schema: schema})
+	}
+	return params
+}
+
+// fieldByPath resolves a dotted field path such as data.id in md
+func fieldByPath(md protoreflect.MessageDescriptor, path string) protoreflect.FieldDescriptor {
+	var fd protoreflect.FieldDescriptor
+	for _, name := range strings.Split(path, ".") {
+		if md == nil {
+			return nil
+		}
+		if fd = md.Fields().ByName(protoreflect.Name(name)); fd == nil {
+			return nil
+		}
+		md = fd.Message()
+	}
+	return fd
+}
@@ -0,0 +1,162 @@
+package openapi
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"grpc_anotation_sample/protoset"
+)
+
+const shelfProto = `syntax = "proto3";
+
+package pb;
+
+import "google/api/annotations.proto";
+import "google/protobuf/field_mask.proto";
+import "google/protobuf/struct.proto";
+
+// A shelf of books
+message Shelf {
+  string name = 1;
+  repeated Shelf children = 2;
+  Filter filter = 3;
+}
+
+message Filter {
+  string author = 1;
+  int64 min_pages = 2;
+}
+
+message GetShelfRequest {
+  string name = 1; // Resource name, e.g. shelves/1
+  Filter filter = 2;
+  google.protobuf.FieldMask read_mask = 3;
+  google.protobuf.Struct extra = 4;
+  repeated string tags = 5;
+}
+
+message UpdateShelfRequest {
+  Shelf shelf = 1;
+  google.protobuf.FieldMask update_mask = 2;
+}
+
+// Manages shelves
+service ShelfService {
+  // Gets a shelf.
+  // Children are included.
+  rpc GetShelf(GetShelfRequest) returns (Shelf) {
+    option (google.api.http) = {
+      get: "/v1/{name=shelves/*}"
+      additional_bindings { get: "/v1/shelf/{name}" }
+    };
+  }
+  rpc UpdateShelf(UpdateShelfRequest) returns (Shelf) {
+    option (google.api.http) = { patch: "/v1/shelves/{shelf.name}" body: "shelf" };
+  }
+  rpc WatchShelves(GetShelfRequest) returns (stream Shelf) {
+    option (google.api.http) = { get: "/v1/shelves:watch" };
+  }
+  rpc Internal(GetShelfRequest) returns (Shelf);
+}
+`
+
+func build(t *testing.T) *Document {
+	t.Helper()
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, "shelf.proto"), []byte(shelfProto), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	set, err := protoset.Compile(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return Build(set.Project(), Info{Title: "test", Version: "v1"})
+}
+
+func paramNames(op *Operation) string {
+	var names []string
+	for _, p := range op.Parameters {
+		names = append(names, p.In+":"+p.Name)
+	}
+	return strings.Join(names, ",")
+}
+
+func TestBuild(t *testing.T) {
+	doc := build(t)
+
+	get := doc.Paths["/v1/{name}"]["get"]
+	if get == nil || get.OperationID != "ShelfService_GetShelf" {
+		t.Fatalf("paths = %v", doc.Paths)
+	}
+	if get.Summary != "Gets a shelf." || get.Description != "Gets a shelf.\nChildren are included." {
+		t.Errorf("summary = %q, description = %q", get.Summary, get.Description)
+	}
+	// Nested messages are flattened with dots; Struct cannot be sent in a query
+	if got, want := paramNames(get), "path:name,query:filter.author,query:filter.min_pages,query:read_mask,query:tags"; got != want {
+		t.Errorf("GetShelf parameters = %s, want %s", got, want)
+	}
+	if get.Parameters[0].Description != "Resource name, e.g. shelves/1" || get.Parameters[4].Schema["type"] != "array" {
+		t.Errorf("GetShelf parameters = %+v, %+v", get.Parameters[0], get.Parameters[4])
+	}
+	if extra := doc.Paths["/v1/shelf/{name}"]["get"]; extra == nil || extra.OperationID != "ShelfService_GetShelf2" {
+		t.Errorf("additional binding = %+v", extra)
+	}
+
+	update := doc.Paths["/v1/shelves/{shelf.name}"]["patch"]
+	if got, want := paramNames(update), "path:shelf.name,query:update_mask"; got != want {
+		t.Errorf("UpdateShelf parameters = %s, want %s", got, want)
+	}
+	if ref := update.RequestBody.Content["application/json"].Schema["$ref"]; ref != "#/components/schemas/pb.Shelf" {
+		t.Errorf("UpdateShelf body = %v", update.RequestBody.Content["application/json"].Schema)
+	}
+
+	watch := doc.Paths["/v1/shelves:watch"]["get"].Responses["200"]
+	if props := watch.Content["application/json"].Schema["properties"].(map[string]any); props["result"] == nil || props["error"] == nil {
+		t.Errorf("stream response = %v", watch.Content["application/json"].Schema)
+	}
+
+	// Recursive messages refer to themselves
+	shelf := doc.Components.Schemas["pb.Shelf"]
+	children := shelf["properties"].(map[string]any)["children"].(map[string]any)
+	if children["items"].(map[string]any)["$ref"] != "#/components/schemas/pb.Shelf" || shelf["description"] != "A shelf of books" {
+		t.Errorf("pb.Shelf = %v", shelf)
+	}
+	if len(doc.Tags) != 1 || doc.Tags[0].Description != "Manages shelves" {
+		t.Errorf("tags = %+v", doc.Tags)
+	}
+}
+
+// TestRefsResolve checks that every $ref in the document names a component
+func TestRefsResolve(t *testing.T) {
+	b, err := json.Marshal(build(t))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var doc map[string]any
+	json.Unmarshal(b, &doc)
+	components := doc["components"].(map[string]any)
+
+	var walk func(v any)
+	walk = func(v any) {
+		switch v := v.(type) {
+		case map[string]any:
+			if ref, ok := v["$ref"].(string); ok {
+				parts := strings.Split(strings.TrimPrefix(ref, "#/components/"), "/")
+				if group, _ := components[parts[0]].(map[string]any); len(parts) != 2 || group[parts[1]] == nil {
+					t.Errorf("unresolved $ref %s", ref)
+				}
+			}
+			for _, e := range v {
+				walk(e)
+			}
+		case []any:
+			for _, e := range v {
+				walk(e)
+			}
+		}
+	}
+	walk(doc)
+}
@@ -22,6 +22,58 @@ const (
 	_ = protoimpl.EnforceVersion(protoimpl.MaxVersion - 20)
 )
 
+type BookEvent_Type int32
+
+const (
+	BookEvent_TYPE_UNSPECIFIED BookEvent_Type = 0
+	BookEvent_CREATED          BookEvent_Type = 1
+	BookEvent_UPDATED          BookEvent_Type = 2
+	BookEvent_DELETED          BookEvent_Type = 3
+)
+
+// Enum value maps for BookEvent_Type.
+var (
+	BookEvent_Type_name = map[int32]string{
+		0: "TYPE_UNSPECIFIED",
+		1: "CREATED",
+		2: "UPDATED",
+		3: "DELETED",
+	}
+	BookEvent_Type_value = map[string]int32{
+		"TYPE_UNSPECIFIED": 0,
+		"CREATED":          1,
+		"UPDATED":          2,
+		"DELETED":          3,
+	}
+)
+
+func (x BookEvent_Type) Enum() *BookEvent_Type {
+	p := new(BookEvent_Type)
+	*p = x
+	return p
+}
+
+func (x BookEvent_Type) String() string {
+	return protoimpl.X.EnumStringOf(x.Descriptor(), protoreflect.EnumNumber(x))
+}
+
+func (BookEvent_Type) Descriptor() protoreflect.EnumDescriptor {
+	return file_book_proto_enumTypes[0].Descriptor()
+}
+
+func (BookEvent_Type) Type() protoreflect.EnumType {
+	return &file_book_proto_enumTypes[0]
+}
+
+func (x BookEvent_Type) Number() protoreflect.EnumNumber {
+	return protoreflect.EnumNumber(x)
+}
+
+// Deprecated: Use BookEvent_Type.Descriptor instead.
+func (BookEvent_Type) EnumDescriptor() ([]byte, []int) {
+	return file_book_proto_rawDescGZIP(), []int{12, 0}
+}
+
 type Book struct {
 	state         protoimpl.MessageState `protogen:"open.v1"`
 	Id            string                 `protobuf:"bytes,1,opt,name=id,proto3" json:"id,omitempty"`
@@ -522,6 +574,126 @@ func (x *ListBooksResponse) GetData() []*Book {
 	return nil
 }
 
+type WatchBookRequest struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Filter        string                 `protobuf:"bytes,1,opt,name=filter,proto3" json:"filter,omitempty"`
+	ResumeToken   string                 `protobuf:"bytes,2,opt,name=resume_token,json=resumeToken,proto3" json:"resume_token,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *WatchBookRequest) Reset() {
+	*x = WatchBookRequest{}
+	mi := &file_book_proto_msgTypes[11]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *WatchBookRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*WatchBookRequest) ProtoMessage() {}
+
+func (x *WatchBookRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_book_proto_msgTypes[11]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use WatchBookRequest.ProtoReflect.Descriptor instead.
+func (*WatchBookRequest) Descriptor() ([]byte, []int) {
+	return file_book_proto_rawDescGZIP(), []int{11}
+}
+
+func (x *WatchBookRequest) GetFilter() string {
+	if x != nil {
+		return x.Filter
+	}
+	return ""
+}
+
+func (x *WatchBookRequest) GetResumeToken() string {
+	if x != nil {
+		return x.ResumeToken
+	}
+	return ""
+}
+
+type BookEvent struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Type          BookEvent_Type         `protobuf:"varint,1,opt,name=type,proto3,enum=pb.BookEvent_Type" json:"type,omitempty"`
+	Id            string                 `protobuf:"bytes,2,opt,name=id,proto3" json:"id,omitempty"`
+	Data          *Book                  `protobuf:"bytes,3,opt,name=data,proto3" json:"data,omitempty"`
+	ResumeToken   string                 `protobuf:"bytes,4,opt,name=resume_token,json=resumeToken,proto3" json:"resume_token,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *BookEvent) Reset() {
+	*x = BookEvent{}
+	mi := &file_book_proto_msgTypes[12]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *BookEvent) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*BookEvent) ProtoMessage() {}
+
+func (x *BookEvent) ProtoReflect() protoreflect.Message {
+	mi := &file_book_proto_msgTypes[12]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use BookEvent.ProtoReflect.Descriptor instead.
+func (*BookEvent) Descriptor() ([]byte, []int) {
+	return file_book_proto_rawDescGZIP(), []int{12}
+}
+
+func (x *BookEvent) GetType() BookEvent_Type {
+	if x != nil {
+		return x.Type
+	}
+	return BookEvent_TYPE_UNSPECIFIED
+}
+
+func (x *BookEvent) GetId() string {
+	if x != nil {
+		return x.Id
+	}
+	return ""
+}
+
+func (x *BookEvent) GetData() *Book {
+	if x != nil {
+		return x.Data
+	}
+	return nil
+}
+
+func (x *BookEvent) GetResumeToken() string {
+	if x != nil {
+		return x.ResumeToken
+	}
+	return ""
+}
+
 var File_book_proto protoreflect.FileDescriptor
 
 const file_book_proto_rawDesc = "" +
@@ -551,7 +723,20 @@ const file_book_proto_rawDesc = "" +
 	"\asuccess\x18\x01 \x01(\bR\asuccess\"\x12\n" +
 	"\x10ListBooksRequest\"1\n" +
 	"\x11ListBooksResponse\x12\x1c\n" +
-	"\x04data\x18\x01 \x03(\v2\b.pb.BookR\x04data2\xab\x03\n" +
+	"\x04data\x18\x01 \x03(\v2\b.pb.BookR\x04data\"M\n" +
+	"\x10WatchBookRequest\x12\x16\n" +
+	"\x06filter\x18\x01 \x01(\tR\x06filter\x12!\n" +
+	"\fresume_token\x18\x02 \x01(\tR\vresumeToken\"\xc9\x01\n" +
+	"\tBookEvent\x12&\n" +
+	"\x04type\x18\x01 \x01(\x0e2\x12.pb.BookEvent.TypeR\x04type\x12\x0e\n" +
+	"\x02id\x18\x02 \x01(\tR\x02id\x12\x1c\n" +
+	"\x04data\x18\x03 \x01(\v2\b.pb.BookR\x04data\x12!\n" +
+	"\fresume_token\x18\x04 \x01(\tR\vresumeToken\"C\n" +
+	"\x04Type\x12\x14\n" +
+	"\x10TYPE_UNSPECIFIED\x10\x00\x12\v\n" +
+	"\aCREATED\x10\x01\x12\v\n" +
+	"\aUPDATED\x10\x02\x12\v\n" +
+	"\aDELETED\x10\x032\xf8\x03\n" +
 	"\vBookService\x12Q\n" +
 	"\n" +
 	"CreateBook\x12\x15.pb.CreateBookRequest\x1a\x16.pb.CreateBookResponse\"\x14\x82\xd3\xe4\x93\x02\x0e:\x01*\"\t/v1/books\x12J\n" +
@@ -560,7 +745,8 @@ const file_book_proto_rawDesc = "" +
 	"UpdateBook\x12\x15.pb.UpdateBookRequest\x1a\x16.pb.UpdateBookResponse\"\x1e\x82\xd3\xe4\x93\x02\x18:\x01*\x1a\x13/v1/books/{data.id}\x12S\n" +
 	"\n" +
 	"DeleteBook\x12\x15.pb.DeleteBookRequest\x1a\x16.pb.DeleteBookResponse\"\x16\x82\xd3\xe4\x93\x02\x10*\x0e/v1/books/{id}\x12K\n" +
-	"\tListBooks\x12\x14.pb.ListBooksRequest\x1a\x15.pb.ListBooksResponse\"\x11\x82\xd3\xe4\x93\x02\v\x12\t/v1/booksB\x1aZ\x18grpc_anotation_sample/pbb\x06proto3"
+	"\tListBooks\x12\x14.pb.ListBooksRequest\x1a\x15.pb.ListBooksResponse\"\x11\x82\xd3\xe4\x93\x02\v\x12\t/v1/books\x12K\n" +
+	"\tWatchBook\x12\x14.pb.WatchBookRequest\x1a\r.pb.BookEvent\"\x17\x82\xd3\xe4\x93\x02\x11\x12\x0f/v1/books:watch0\x01B\x1aZ\x18grpc_anotation_sample/pbb\x06proto3"
 
 var (
 	file_book_proto_rawDescOnce sync.Once
@@ -574,42 +760,50 @@ func file_book_proto_rawDescGZIP() []byte {
 	return file_book_proto_rawDescData
 }
 
-var file_book_proto_msgTypes = make([]protoimpl.MessageInfo, 11)
+var file_book_proto_enumTypes = make([]protoimpl.EnumInfo, 1)
+var file_book_proto_msgTypes = make([]protoimpl.MessageInfo, 13)
 var file_book_proto_goTypes = []any{
-	(*Book)(nil),               // 0: pb.Book
-	(*CreateBookRequest)(nil),  // 1: pb.CreateBookRequest
-	(*CreateBookResponse)(nil), // 2: pb.CreateBookResponse
-	(*GetBookRequest)(nil),     // 3: pb.GetBookRequest
-	(*GetBookResponse)(nil),    // 4: pb.GetBookResponse
-	(*UpdateBookRequest)(nil),  // 5: pb.UpdateBookRequest
-	(*UpdateBookResponse)(nil), // 6: pb.UpdateBookResponse
-	(*DeleteBookRequest)(nil),  // 7: pb.DeleteBookRequest
-	(*DeleteBookResponse)(nil), // 8: pb.DeleteBookResponse
-	(*ListBooksRequest)(nil),   // 9: pb.ListBooksRequest
-	(*ListBooksResponse)(nil),  // 10: pb.ListBooksResponse
+	(BookEvent_Type)(0),        // 0: pb.BookEvent.Type
+	(*Book)(nil),               // 1: pb.Book
+	(*CreateBookRequest)(nil),  // 2: pb.CreateBookRequest
+	(*CreateBookResponse)(nil), // 3: pb.CreateBookResponse
+	(*GetBookRequest)(nil),     // 4: pb.GetBookRequest
+	(*GetBookResponse)(nil),    // 5: pb.GetBookResponse
+	(*UpdateBookRequest)(nil),  // 6: pb.UpdateBookRequest
+	(*UpdateBookResponse)(nil), // 7: pb.UpdateBookResponse
+	(*DeleteBookRequest)(nil),  // 8: pb.DeleteBookRequest
+	(*DeleteBookResponse)(nil), // 9: pb.DeleteBookResponse
+	(*ListBooksRequest)(nil),   // 10: pb.ListBooksRequest
+	(*ListBooksResponse)(nil),  // 11: pb.ListBooksResponse
+	(*WatchBookRequest)(nil),   // 12: pb.WatchBookRequest
+	(*BookEvent)(nil),          // 13: pb.BookEvent
 }
 var file_book_proto_depIdxs = []int32{
-	0,  // 0: pb.CreateBookRequest.data:type_name -> pb.Book
-	0,  // 1: pb.CreateBookResponse.data:type_name -> pb.Book
-	0,  // 2: pb.GetBookResponse.data:type_name -> pb.Book
-	0,  // 3: pb.UpdateBookRequest.data:type_name -> pb.Book
-	0,  // 4: pb.UpdateBookResponse.data:type_name -> pb.Book
-	0,  // 5: pb.ListBooksResponse.data:type_name -> pb.Book
-	1,  // 6: pb.BookService.CreateBook:input_type -> pb.CreateBookRequest
-	3,  // 7: pb.BookService.GetBook:input_type -> pb.GetBookRequest
-	5,  // 8: pb.BookService.UpdateBook:input_type -> pb.UpdateBookRequest
-	7,  // 9: pb.BookService.DeleteBook:input_type -> pb.DeleteBookRequest
-	9,  // 10: pb.BookService.ListBooks:input_type -> pb.ListBooksRequest
-	2,  // 11: pb.BookService.CreateBook:output_type -> pb.CreateBookResponse
-	4,  // 12: pb.BookService.GetBook:output_type -> pb.GetBookResponse
-	6,  // 13: pb.BookService.UpdateBook:output_type -> pb.UpdateBookResponse
-	8,  // 14: pb.BookService.DeleteBook:output_type -> pb.DeleteBookResponse
-	10, // 15: pb.BookService.ListBooks:output_type -> pb.ListBooksResponse
-	11, // [11:16] is the sub-list for method output_type
-	6,  // [6:11] is the sub-list for method input_type
-	6,  // [6:6] is the sub-list for extension type_name
-	6,  // [6:6] is the sub-list for extension extendee
-	0,  // [0:6] is the sub-list for field type_name
+	1,  // 0: pb.CreateBookRequest.data:type_name -> pb.Book
+	1,  // 1: pb.CreateBookResponse.data:type_name -> pb.Book
+	1,  // 2: pb.GetBookResponse.data:type_name -> pb.Book
+	1,  // 3: pb.UpdateBookRequest.data:type_name -> pb.Book
+	1,  // 4: pb.UpdateBookResponse.data:type_name -> pb.Book
+	1,  // 5: pb.ListBooksResponse.data:type_name -> pb.Book
+	0,  // 6: pb.BookEvent.type:type_name -> pb.BookEvent.Type
+	1,  // 7: pb.BookEvent.data:type_name -> pb.Book
+	2,  // 8: pb.BookService.CreateBook:input_type -> pb.CreateBookRequest
+	4,  // 9: pb.BookService.GetBook:input_type -> pb.GetBookRequest
+	6,  // 10: pb.BookService.UpdateBook:input_type -> pb.UpdateBookRequest
+	8,  // 11: pb.BookService.DeleteBook:input_type -> pb.DeleteBookRequest
+	10, // 12: pb.BookService.ListBooks:input_type -> pb.ListBooksRequest
+	12, // 13: pb.BookService.WatchBook:input_type -> pb.WatchBookRequest
+	3,  // 14: pb.BookService.CreateBook:output_type -> pb.CreateBookResponse
+	5,  // 15: pb.BookService.GetBook:output_type -> pb.GetBookResponse
+	7,  // 16: pb.BookService.UpdateBook:output_type -> pb.UpdateBookResponse
+	9,  // 17: pb.BookService.DeleteBook:output_type -> pb.DeleteBookResponse
+	11, // 18: pb.BookService.ListBooks:output_type -> pb.ListBooksResponse
+	13, // 19: pb.BookService.WatchBook:output_type -> pb.BookEvent
+	14, // [14:20] is the sub-list for method output_type
+	8,  // [8:14] is the sub-list for method input_type
+	8,  // [8:8] is the sub-list for extension type_name
+	8,  // [8:8] is the sub-list for extension extendee
+	0,  // [0:8] is the sub-list for field type_name
 }
 
 func init() { file_book_proto_init() }
@@ -622,13 +816,14 @@ func file_book_proto_init() {
 		File: protoimpl.DescBuilder{
 			GoPackagePath: reflect.TypeOf(x{}).PkgPath(),
 			RawDescriptor: unsafe.Slice(unsafe.StringData(file_book_proto_rawDesc), len(file_book_proto_rawDesc)),
-			NumEnums:      0,
-			NumMessages:   11,
+			NumEnums:      1,
+			NumMessages:   13,
 			NumExtensions: 0,
 			NumServices:   1,
 		},
 		GoTypes:           file_book_proto_goTypes,
 		DependencyIndexes: file_book_proto_depIdxs,
+		EnumInfos:         file_book_proto_enumTypes,
 		MessageInfos:      file_book_proto_msgTypes,
 	}.Build()
 	File_book_proto = out.File
@@ -24,6 +24,7 @@ const (
 	BookService_UpdateBook_FullMethodName = "/pb.BookService/UpdateBook"
 	BookService_DeleteBook_FullMethodName = "/pb.BookService/DeleteBook"
 	BookService_ListBooks_FullMethodName  = "/pb.BookService/ListBooks"
+	BookService_WatchBook_FullMethodName  = "/pb.BookService/WatchBook"
 )
 
 // BookServiceClient is the client API for BookService service.
@@ -35,6 +36,7 @@ type BookServiceClient interface {
 	UpdateBook(ctx context.Context, in *UpdateBookRequest, opts ...grpc.CallOption) (*UpdateBookResponse, error)
 	DeleteBook(ctx context.Context, in *DeleteBookRequest, opts ...grpc.CallOption) (*DeleteBookResponse, error)
 	ListBooks(ctx context.Context, in *ListBooksRequest, opts ...grpc.CallOption) (*ListBooksResponse, error)
+	WatchBook(ctx context.Context, in *WatchBookRequest, opts ...grpc.CallOption) (grpc.ServerStreamingClient[BookEvent], error)
 }
 
 type bookServiceClient struct {
@@ -95,6 +97,25 @@ func (c *bookServiceClient) ListBooks(ctx context.Context, in *ListBooksRequest,
 	return out, nil
 }
 
+func (c *bookServiceClient) WatchBook(ctx context.Context, in *WatchBookRequest, opts ...grpc.CallOption) (grpc.ServerStreamingClient[BookEvent], error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	stream, err := c.cc.NewStream(ctx, &BookService_ServiceDesc.Streams[0], BookService_WatchBook_FullMethodName, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	x := &grpc.GenericClientStream[WatchBookRequest, BookEvent]{ClientStream: stream}
+	if err := x.ClientStream.SendMsg(in); err != nil {
+		return nil, err
+	}
+	if err := x.ClientStream.CloseSend(); err != nil {
+		return nil, err
+	}
+	return x, nil
+}
+
+// This type alias is provided for backwards compatibility with existing code that references the prior non-generic stream type by name.
+type BookService_WatchBookClient = grpc.ServerStreamingClient[BookEvent]
+
 // BookServiceServer is the server API for BookService service.
 // All implementations must embed UnimplementedBookServiceServer
 // for forward compatibility.
@@ -104,6 +125,7 @@ type BookServiceServer interface {
 	UpdateBook(context.Context, *UpdateBookRequest) (*UpdateBookResponse, error)
 	DeleteBook(context.Context, *DeleteBookRequest) (*DeleteBookResponse, error)
 	ListBooks(context.Context, *ListBooksRequest) (*ListBooksResponse, error)
+	WatchBook(*WatchBookRequest, grpc.ServerStreamingServer[BookEvent]) error
 	mustEmbedUnimplementedBookServiceServer()
 }
 
@@ -129,6 +151,9 @@ func (UnimplementedBookServiceServer) DeleteBook(context.Context, *DeleteBookReq
 func (UnimplementedBookServiceServer) ListBooks(context.Context, *ListBooksRequest) (*ListBooksResponse, error) {
 	return nil, status.Errorf(codes.Unimplemented, "method ListBooks not implemented")
 }
+func (UnimplementedBookServiceServer) WatchBook(*WatchBookRequest, grpc.ServerStreamingServer[BookEvent]) error {
+	return status.Errorf(codes.Unimplemented, "method WatchBook not implemented")
+}
 func (UnimplementedBookServiceServer) mustEmbedUnimplementedBookServiceServer() {}
 func (UnimplementedBookServiceServer) testEmbeddedByValue()                     {}
 
@@ -240,6 +265,17 @@ func _BookService_ListBooks_Handler(srv interface{}, ctx context.Context, dec fu
 	return interceptor(ctx, in, info, handler)
 }
 
+func _BookService_WatchBook_Handler(srv interface{}, stream grpc.ServerStream) error {
+	m := new(WatchBookRequest)
+	if err := stream.RecvMsg(m); err != nil {
+		return err
+	}
+	return srv.(BookServiceServer).WatchBook(m, &grpc.GenericServerStream[WatchBookRequest, BookEvent]{ServerStream: stream})
+}
+
+// This type alias is provided for backwards compatibility with existing code that references the prior non-generic stream type by name.
+type BookService_WatchBookServer = grpc.ServerStreamingServer[BookEvent]
+
 // BookService_ServiceDesc is the grpc.ServiceDesc for BookService service.
 // It's only intended for direct use with grpc.RegisterService,
 // and not to be introspected or modified (even as a copy)
@@ -268,6 +304,12 @@ var BookService_ServiceDesc = grpc.ServiceDesc{
 			Handler:    _BookService_ListBooks_Handler,
 		},
 	},
-	Streams:  []grpc.StreamDesc{},
+	Streams: []grpc.StreamDesc{
+		{
+			StreamName:    "WatchBook",
+			Handler:       _BookService_WatchBook_Handler,
+			ServerStreams: true,
+		},
+	},
 	Metadata: "book.proto",
 }
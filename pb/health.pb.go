@@ -177,11 +177,11 @@ const file_health_proto_rawDesc = "" +
 	"\aUNKNOWN\x10\x00\x12\v\n" +
 	"\aSERVING\x10\x01\x12\x0f\n" +
 	"\vNOT_SERVING\x10\x02\x12\x13\n" +
-	"\x0fSERVICE_UNKNOWN\x10\x032\x92\x01\n" +
+	"\x0fSERVICE_UNKNOWN\x10\x032\xac\x01\n" +
 	"\x06Health\x12L\n" +
 	"\x05Check\x12\x16.pb.HealthCheckRequest\x1a\x17.pb.HealthCheckResponse\"\x12\x82\xd3\xe4\x93\x02\f\x12\n" +
-	"/v1/health\x12:\n" +
-	"\x05Watch\x12\x16.pb.HealthCheckRequest\x1a\x17.pb.HealthCheckResponse0\x01B\x1aZ\x18grpc_anotation_sample/pbb\x06proto3"
+	"/v1/health\x12T\n" +
+	"\x05Watch\x12\x16.pb.HealthCheckRequest\x1a\x17.pb.HealthCheckResponse\"\x18\x82\xd3\xe4\x93\x02\x12\x12\x10/v1/health/watch0\x01B\x1aZ\x18grpc_anotation_sample/pbb\x06proto3"
 
 var (
 	file_health_proto_rawDescOnce sync.Once
@@ -10,6 +10,7 @@ import (
 	_ "google.golang.org/genproto/googleapis/api/annotations"
 	protoreflect "google.golang.org/protobuf/reflect/protoreflect"
 	protoimpl "google.golang.org/protobuf/runtime/protoimpl"
+	timestamppb "google.golang.org/protobuf/types/known/timestamppb"
 	reflect "reflect"
 	sync "sync"
 	unsafe "unsafe"
@@ -22,6 +23,58 @@ const (
 	_ = protoimpl.EnforceVersion(protoimpl.MaxVersion - 20)
 )
 
+type TodoEvent_Type int32
+
+const (
+	TodoEvent_TYPE_UNSPECIFIED TodoEvent_Type = 0 // Heartbeats
+	TodoEvent_CREATED          TodoEvent_Type = 1
+	TodoEvent_COMPLETED        TodoEvent_Type = 2
+	TodoEvent_DELETED          TodoEvent_Type = 3
+)
+
+// Enum value maps for TodoEvent_Type.
+var (
+	TodoEvent_Type_name = map[int32]string{
+		0: "TYPE_UNSPECIFIED",
+		1: "CREATED",
+		2: "COMPLETED",
+		3: "DELETED",
+	}
+	TodoEvent_Type_value = map[string]int32{
+		"TYPE_UNSPECIFIED": 0,
+		"CREATED":          1,
+		"COMPLETED":        2,
+		"DELETED":          3,
+	}
+)
+
+func (x TodoEvent_Type) Enum() *TodoEvent_Type {
+	p := new(TodoEvent_Type)
+	*p = x
+	return p
+}
+
+func (x TodoEvent_Type) String() string {
+	return protoimpl.X.EnumStringOf(x.Descriptor(), protoreflect.EnumNumber(x))
+}
+
+func (TodoEvent_Type) Descriptor() protoreflect.EnumDescriptor {
+	return file_todo_proto_enumTypes[0].Descriptor()
+}
+
+func (TodoEvent_Type) Type() protoreflect.EnumType {
+	return &file_todo_proto_enumTypes[0]
+}
+
+func (x TodoEvent_Type) Number() protoreflect.EnumNumber {
+	return protoreflect.EnumNumber(x)
+}
+
+// Deprecated: Use TodoEvent_Type.Descriptor instead.
+func (TodoEvent_Type) EnumDescriptor() ([]byte, []int) {
+	return file_todo_proto_rawDescGZIP(), []int{8, 0}
+}
+
 type Todo struct {
 	state         protoimpl.MessageState `protogen:"open.v1"`
 	Id            string                 `protobuf:"bytes,1,opt,name=id,proto3" json:"id,omitempty"`
@@ -170,15 +223,354 @@ func (x *CreateTodoResponse) GetTodo() *Todo {
 	return nil
 }
 
-type StreamTodosRequest struct {
+type CompleteTodoRequest struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Id            string                 `protobuf:"bytes,1,opt,name=id,proto3" json:"id,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *CompleteTodoRequest) Reset() {
+	*x = CompleteTodoRequest{}
+	mi := &file_todo_proto_msgTypes[3]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *CompleteTodoRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*CompleteTodoRequest) ProtoMessage() {}
+
+func (x *CompleteTodoRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_todo_proto_msgTypes[3]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use CompleteTodoRequest.ProtoReflect.Descriptor instead.
+func (*CompleteTodoRequest) Descriptor() ([]byte, []int) {
+	return file_todo_proto_rawDescGZIP(), []int{3}
+}
+
+func (x *CompleteTodoRequest) GetId() string {
+	if x != nil {
+		return x.Id
+	}
+	return ""
+}
+
+type CompleteTodoResponse struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Todo          *Todo                  `protobuf:"bytes,1,opt,name=todo,proto3" json:"todo,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *CompleteTodoResponse) Reset() {
+	*x = CompleteTodoResponse{}
+	mi := &file_todo_proto_msgTypes[4]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *CompleteTodoResponse) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*CompleteTodoResponse) ProtoMessage() {}
+
+func (x *CompleteTodoResponse) ProtoReflect() protoreflect.Message {
+	mi := &file_todo_proto_msgTypes[4]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use CompleteTodoResponse.ProtoReflect.Descriptor instead.
+func (*CompleteTodoResponse) Descriptor() ([]byte, []int) {
+	return file_todo_proto_rawDescGZIP(), []int{4}
+}
+
+func (x *CompleteTodoResponse) GetTodo() *Todo {
+	if x != nil {
+		return x.Todo
+	}
+	return nil
+}
+
+type DeleteTodoRequest struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Id            string                 `protobuf:"bytes,1,opt,name=id,proto3" json:"id,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *DeleteTodoRequest) Reset() {
+	*x = DeleteTodoRequest{}
+	mi := &file_todo_proto_msgTypes[5]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *DeleteTodoRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*DeleteTodoRequest) ProtoMessage() {}
+
+func (x *DeleteTodoRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_todo_proto_msgTypes[5]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use DeleteTodoRequest.ProtoReflect.Descriptor instead.
+func (*DeleteTodoRequest) Descriptor() ([]byte, []int) {
+	return file_todo_proto_rawDescGZIP(), []int{5}
+}
+
+func (x *DeleteTodoRequest) GetId() string {
+	if x != nil {
+		return x.Id
+	}
+	return ""
+}
+
+type DeleteTodoResponse struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Success       bool                   `protobuf:"varint,1,opt,name=success,proto3" json:"success,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *DeleteTodoResponse) Reset() {
+	*x = DeleteTodoResponse{}
+	mi := &file_todo_proto_msgTypes[6]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *DeleteTodoResponse) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*DeleteTodoResponse) ProtoMessage() {}
+
+func (x *DeleteTodoResponse) ProtoReflect() protoreflect.Message {
+	mi := &file_todo_proto_msgTypes[6]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use DeleteTodoResponse.ProtoReflect.Descriptor instead.
+func (*DeleteTodoResponse) Descriptor() ([]byte, []int) {
+	return file_todo_proto_rawDescGZIP(), []int{6}
+}
+
+func (x *DeleteTodoResponse) GetSuccess() bool {
+	if x != nil {
+		return x.Success
+	}
+	return false
+}
+
+// Sent on an idle stream so clients and proxies can tell it is alive
+type Heartbeat struct {
 	state         protoimpl.MessageState `protogen:"open.v1"`
+	Time          *timestamppb.Timestamp `protobuf:"bytes,1,opt,name=time,proto3" json:"time,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *Heartbeat) Reset() {
+	*x = Heartbeat{}
+	mi := &file_todo_proto_msgTypes[7]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *Heartbeat) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*Heartbeat) ProtoMessage() {}
+
+func (x *Heartbeat) ProtoReflect() protoreflect.Message {
+	mi := &file_todo_proto_msgTypes[7]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use Heartbeat.ProtoReflect.Descriptor instead.
+func (*Heartbeat) Descriptor() ([]byte, []int) {
+	return file_todo_proto_rawDescGZIP(), []int{7}
+}
+
+func (x *Heartbeat) GetTime() *timestamppb.Timestamp {
+	if x != nil {
+		return x.Time
+	}
+	return nil
+}
+
+// An event of StreamTodos: a todo changed, or a heartbeat. Ids increase by
+// one with every change; a heartbeat has the id of the event before it.
+type TodoEvent struct {
+	state protoimpl.MessageState `protogen:"open.v1"`
+	Id    uint64                 `protobuf:"varint,1,opt,name=id,proto3" json:"id,omitempty"`
+	// Pass as StreamTodosRequest.resume_token to continue after this event
+	ResumeToken string `protobuf:"bytes,2,opt,name=resume_token,json=resumeToken,proto3" json:"resume_token,omitempty"`
+	// Types that are valid to be assigned to Payload:
+	//
+	//	*TodoEvent_Todo
+	//	*TodoEvent_Heartbeat
+	Payload       isTodoEvent_Payload `protobuf_oneof:"payload"`
+	Type          TodoEvent_Type      `protobuf:"varint,5,opt,name=type,proto3,enum=pb.TodoEvent_Type" json:"type,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *TodoEvent) Reset() {
+	*x = TodoEvent{}
+	mi := &file_todo_proto_msgTypes[8]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *TodoEvent) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*TodoEvent) ProtoMessage() {}
+
+func (x *TodoEvent) ProtoReflect() protoreflect.Message {
+	mi := &file_todo_proto_msgTypes[8]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use TodoEvent.ProtoReflect.Descriptor instead.
+func (*TodoEvent) Descriptor() ([]byte, []int) {
+	return file_todo_proto_rawDescGZIP(), []int{8}
+}
+
+func (x *TodoEvent) GetId() uint64 {
+	if x != nil {
+		return x.Id
+	}
+	return 0
+}
+
+func (x *TodoEvent) GetResumeToken() string {
+	if x != nil {
+		return x.ResumeToken
+	}
+	return ""
+}
+
+func (x *TodoEvent) GetPayload() isTodoEvent_Payload {
+	if x != nil {
+		return x.Payload
+	}
+	return nil
+}
+
+func (x *TodoEvent) GetTodo() *Todo {
+	if x != nil {
+		if x, ok := x.Payload.(*TodoEvent_Todo); ok {
+			return x.Todo
+		}
+	}
+	return nil
+}
+
+func (x *TodoEvent) GetHeartbeat() *Heartbeat {
+	if x != nil {
+		if x, ok := x.Payload.(*TodoEvent_Heartbeat); ok {
+			return x.Heartbeat
+		}
+	}
+	return nil
+}
+
+func (x *TodoEvent) GetType() TodoEvent_Type {
+	if x != nil {
+		return x.Type
+	}
+	return TodoEvent_TYPE_UNSPECIFIED
+}
+
+type isTodoEvent_Payload interface {
+	isTodoEvent_Payload()
+}
+
+type TodoEvent_Todo struct {
+	// The todo as of the change; a deleted todo as it was
+	Todo *Todo `protobuf:"bytes,3,opt,name=todo,proto3,oneof"`
+}
+
+type TodoEvent_Heartbeat struct {
+	Heartbeat *Heartbeat `protobuf:"bytes,4,opt,name=heartbeat,proto3,oneof"`
+}
+
+func (*TodoEvent_Todo) isTodoEvent_Payload() {}
+
+func (*TodoEvent_Heartbeat) isTodoEvent_Payload() {}
+
+type StreamTodosRequest struct {
+	state protoimpl.MessageState `protogen:"open.v1"`
+	// The resume_token of the last event received: only the events after it
+	// are sent. Without it the current todos are sent first, each as the last
+	// event that changed it.
+	ResumeToken string `protobuf:"bytes,1,opt,name=resume_token,json=resumeToken,proto3" json:"resume_token,omitempty"`
+	// Only send events of these types; all of them when empty
+	Types []TodoEvent_Type `protobuf:"varint,2,rep,packed,name=types,proto3,enum=pb.TodoEvent_Type" json:"types,omitempty"`
+	// Only send events for todos whose title contains this, ignoring case
+	TitleContains string `protobuf:"bytes,3,opt,name=title_contains,json=titleContains,proto3" json:"title_contains,omitempty"`
 	unknownFields protoimpl.UnknownFields
 	sizeCache     protoimpl.SizeCache
 }
 
 func (x *StreamTodosRequest) Reset() {
 	*x = StreamTodosRequest{}
-	mi := &file_todo_proto_msgTypes[3]
+	mi := &file_todo_proto_msgTypes[9]
 	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
 	ms.StoreMessageInfo(mi)
 }
@@ -190,7 +582,7 @@ func (x *StreamTodosRequest) String() string {
 func (*StreamTodosRequest) ProtoMessage() {}
 
 func (x *StreamTodosRequest) ProtoReflect() protoreflect.Message {
-	mi := &file_todo_proto_msgTypes[3]
+	mi := &file_todo_proto_msgTypes[9]
 	if x != nil {
 		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
 		if ms.LoadMessageInfo() == nil {
@@ -203,7 +595,28 @@ func (x *StreamTodosRequest) ProtoReflect() protoreflect.Message {
 
 // Deprecated: Use StreamTodosRequest.ProtoReflect.Descriptor instead.
 func (*StreamTodosRequest) Descriptor() ([]byte, []int) {
-	return file_todo_proto_rawDescGZIP(), []int{3}
+	return file_todo_proto_rawDescGZIP(), []int{9}
+}
+
+func (x *StreamTodosRequest) GetResumeToken() string {
+	if x != nil {
+		return x.ResumeToken
+	}
+	return ""
+}
+
+func (x *StreamTodosRequest) GetTypes() []TodoEvent_Type {
+	if x != nil {
+		return x.Types
+	}
+	return nil
+}
+
+func (x *StreamTodosRequest) GetTitleContains() string {
+	if x != nil {
+		return x.TitleContains
+	}
+	return ""
 }
 
 var File_todo_proto protoreflect.FileDescriptor
@@ -211,7 +624,7 @@ var File_todo_proto protoreflect.FileDescriptor
 const file_todo_proto_rawDesc = "" +
 	"\n" +
 	"\n" +
-	"todo.proto\x12\x02pb\x1a\x1cgoogle/api/annotations.proto\"J\n" +
+	"todo.proto\x12\x02pb\x1a\x1cgoogle/api/annotations.proto\x1a\x1fgoogle/protobuf/timestamp.proto\"J\n" +
 	"\x04Todo\x12\x0e\n" +
 	"\x02id\x18\x01 \x01(\tR\x02id\x12\x14\n" +
 	"\x05title\x18\x02 \x01(\tR\x05title\x12\x1c\n" +
@@ -219,12 +632,40 @@ const file_todo_proto_rawDesc = "" +
 	"\x11CreateTodoRequest\x12\x14\n" +
 	"\x05title\x18\x01 \x01(\tR\x05title\"2\n" +
 	"\x12CreateTodoResponse\x12\x1c\n" +
-	"\x04todo\x18\x01 \x01(\v2\b.pb.TodoR\x04todo\"\x14\n" +
-	"\x12StreamTodosRequest2\xad\x01\n" +
+	"\x04todo\x18\x01 \x01(\v2\b.pb.TodoR\x04todo\"%\n" +
+	"\x13CompleteTodoRequest\x12\x0e\n" +
+	"\x02id\x18\x01 \x01(\tR\x02id\"4\n" +
+	"\x14CompleteTodoResponse\x12\x1c\n" +
+	"\x04todo\x18\x01 \x01(\v2\b.pb.TodoR\x04todo\"#\n" +
+	"\x11DeleteTodoRequest\x12\x0e\n" +
+	"\x02id\x18\x01 \x01(\tR\x02id\".\n" +
+	"\x12DeleteTodoResponse\x12\x18\n" +
+	"\asuccess\x18\x01 \x01(\bR\asuccess\";\n" +
+	"\tHeartbeat\x12.\n" +
+	"\x04time\x18\x01 \x01(\v2\x1a.google.protobuf.TimestampR\x04time\"\x87\x02\n" +
+	"\tTodoEvent\x12\x0e\n" +
+	"\x02id\x18\x01 \x01(\x04R\x02id\x12!\n" +
+	"\fresume_token\x18\x02 \x01(\tR\vresumeToken\x12\x1e\n" +
+	"\x04todo\x18\x03 \x01(\v2\b.pb.TodoH\x00R\x04todo\x12-\n" +
+	"\theartbeat\x18\x04 \x01(\v2\r.pb.HeartbeatH\x00R\theartbeat\x12&\n" +
+	"\x04type\x18\x05 \x01(\x0e2\x12.pb.TodoEvent.TypeR\x04type\"E\n" +
+	"\x04Type\x12\x14\n" +
+	"\x10TYPE_UNSPECIFIED\x10\x00\x12\v\n" +
+	"\aCREATED\x10\x01\x12\r\n" +
+	"\tCOMPLETED\x10\x02\x12\v\n" +
+	"\aDELETED\x10\x03B\t\n" +
+	"\apayload\"\x88\x01\n" +
+	"\x12StreamTodosRequest\x12!\n" +
+	"\fresume_token\x18\x01 \x01(\tR\vresumeToken\x12(\n" +
+	"\x05types\x18\x02 \x03(\x0e2\x12.pb.TodoEvent.TypeR\x05types\x12%\n" +
+	"\x0etitle_contains\x18\x03 \x01(\tR\rtitleContains2\xeb\x02\n" +
 	"\vTodoService\x12Q\n" +
 	"\n" +
-	"CreateTodo\x12\x15.pb.CreateTodoRequest\x1a\x16.pb.CreateTodoResponse\"\x14\x82\xd3\xe4\x93\x02\x0e:\x01*\"\t/v1/todos\x12K\n" +
-	"\vStreamTodos\x12\x16.pb.StreamTodosRequest\x1a\b.pb.Todo\"\x18\x82\xd3\xe4\x93\x02\x12\x12\x10/v1/todos/stream0\x01B\x1aZ\x18grpc_anotation_sample/pbb\x06proto3"
+	"CreateTodo\x12\x15.pb.CreateTodoRequest\x1a\x16.pb.CreateTodoResponse\"\x14\x82\xd3\xe4\x93\x02\x0e:\x01*\"\t/v1/todos\x12b\n" +
+	"\fCompleteTodo\x12\x17.pb.CompleteTodoRequest\x1a\x18.pb.CompleteTodoResponse\"\x1f\x82\xd3\xe4\x93\x02\x19\"\x17/v1/todos/{id}:complete\x12S\n" +
+	"\n" +
+	"DeleteTodo\x12\x15.pb.DeleteTodoRequest\x1a\x16.pb.DeleteTodoResponse\"\x16\x82\xd3\xe4\x93\x02\x10*\x0e/v1/todos/{id}\x12P\n" +
+	"\vStreamTodos\x12\x16.pb.StreamTodosRequest\x1a\r.pb.TodoEvent\"\x18\x82\xd3\xe4\x93\x02\x12\x12\x10/v1/todos/stream0\x01B\x1aZ\x18grpc_anotation_sample/pbb\x06proto3"
 
 var (
 	file_todo_proto_rawDescOnce sync.Once
@@ -238,24 +679,43 @@ func file_todo_proto_rawDescGZIP() []byte {
 	return file_todo_proto_rawDescData
 }
 
-var file_todo_proto_msgTypes = make([]protoimpl.MessageInfo, 4)
+var file_todo_proto_enumTypes = make([]protoimpl.EnumInfo, 1)
+var file_todo_proto_msgTypes = make([]protoimpl.MessageInfo, 10)
 var file_todo_proto_goTypes = []any{
-	(*Todo)(nil),               // 0: pb.Todo
-	(*CreateTodoRequest)(nil),  // 1: pb.CreateTodoRequest
-	(*CreateTodoResponse)(nil), // 2: pb.CreateTodoResponse
-	(*StreamTodosRequest)(nil), // 3: pb.StreamTodosRequest
+	(TodoEvent_Type)(0),           // 0: pb.TodoEvent.Type
+	(*Todo)(nil),                  // 1: pb.Todo
+	(*CreateTodoRequest)(nil),     // 2: pb.CreateTodoRequest
+	(*CreateTodoResponse)(nil),    // 3: pb.CreateTodoResponse
+	(*CompleteTodoRequest)(nil),   // 4: pb.CompleteTodoRequest
+	(*CompleteTodoResponse)(nil),  // 5: pb.CompleteTodoResponse
+	(*DeleteTodoRequest)(nil),     // 6: pb.DeleteTodoRequest
+	(*DeleteTodoResponse)(nil),    // 7: pb.DeleteTodoResponse
+	(*Heartbeat)(nil),             // 8: pb.Heartbeat
+	(*TodoEvent)(nil),             // 9: pb.TodoEvent
+	(*StreamTodosRequest)(nil),    // 10: pb.StreamTodosRequest
+	(*timestamppb.Timestamp)(nil), // 11: google.protobuf.Timestamp
 }
 var file_todo_proto_depIdxs = []int32{
-	0, // 0: pb.CreateTodoResponse.todo:type_name -> pb.Todo
-	1, // 1: pb.TodoService.CreateTodo:input_type -> pb.CreateTodoRequest
-	3, // 2: pb.TodoService.StreamTodos:input_type -> pb.StreamTodosRequest
-	2, // 3: pb.TodoService.CreateTodo:output_type -> pb.CreateTodoResponse
-	0, // 4: pb.TodoService.StreamTodos:output_type -> pb.Todo
-	3, // [3:5] is the sub-list for method output_type
-	1, // [1:3] is the sub-list for method input_type
-	1, // [1:1] is the sub-list for extension type_name
-	1, // [1:1] is the sub-list for extension extendee
-	0, // [0:1] is the sub-list for field type_name
+	1,  // 0: pb.CreateTodoResponse.todo:type_name -> pb.Todo
+	1,  // 1: pb.CompleteTodoResponse.todo:type_name -> pb.Todo
+	11, // 2: pb.Heartbeat.time:type_name -> google.protobuf.Timestamp
+	1,  // 3: pb.TodoEvent.todo:type_name -> pb.Todo
+	8,  // 4: pb.TodoEvent.heartbeat:type_name -> pb.Heartbeat
+	0,  // 5: pb.TodoEvent.type:type_name -> pb.TodoEvent.Type
+	0,  // 6: pb.StreamTodosRequest.types:type_name -> pb.TodoEvent.Type
+	2,  // 7: pb.TodoService.CreateTodo:input_type -> pb.CreateTodoRequest
+	4,  // 8: pb.TodoService.CompleteTodo:input_type -> pb.CompleteTodoRequest
+	6,  // 9: pb.TodoService.DeleteTodo:input_type -> pb.DeleteTodoRequest
+	10, // 10: pb.TodoService.StreamTodos:input_type -> pb.StreamTodosRequest
+	3,  // 11: pb.TodoService.CreateTodo:output_type -> pb.CreateTodoResponse
+	5,  // 12: pb.TodoService.CompleteTodo:output_type -> pb.CompleteTodoResponse
+	7,  // 13: pb.TodoService.DeleteTodo:output_type -> pb.DeleteTodoResponse
+	9,  // 14: pb.TodoService.StreamTodos:output_type -> pb.TodoEvent
+	11, // [11:15] is the sub-list for method output_type
+	7,  // [7:11] is the sub-list for method input_type
+	7,  // [7:7] is the sub-list for extension type_name
+	7,  // [7:7] is the sub-list for extension extendee
+	0,  // [0:7] is the sub-list for field type_name
 }
 
 func init() { file_todo_proto_init() }
@@ -263,18 +723,23 @@ func file_todo_proto_init() {
 	if File_todo_proto != nil {
 		return
 	}
+	file_todo_proto_msgTypes[8].OneofWrappers = []any{
+		(*TodoEvent_Todo)(nil),
+		(*TodoEvent_Heartbeat)(nil),
+	}
 	type x struct{}
 	out := protoimpl.TypeBuilder{
 		File: protoimpl.DescBuilder{
 			GoPackagePath: reflect.TypeOf(x{}).PkgPath(),
 			RawDescriptor: unsafe.Slice(unsafe.StringData(file_todo_proto_rawDesc), len(file_todo_proto_rawDesc)),
-			NumEnums:      0,
-			NumMessages:   4,
+			NumEnums:      1,
+			NumMessages:   10,
 			NumExtensions: 0,
 			NumServices:   1,
 		},
 		GoTypes:           file_todo_proto_goTypes,
 		DependencyIndexes: file_todo_proto_depIdxs,
+		EnumInfos:         file_todo_proto_enumTypes,
 		MessageInfos:      file_todo_proto_msgTypes,
 	}.Build()
 	File_todo_proto = out.File
@@ -0,0 +1,263 @@
+package protoset
+
+import (
+	"fmt"
+	"sort"
+
+	"google.golang.org/protobuf/reflect/protoreflect"
+)
+
+// Kind classifies which clients a change breaks.
+type Kind string
+
+const (
+	// Wire changes break binary gRPC clients built from the old protos.
+	Wire Kind = "wire"
+	// JSON changes break REST/JSON clients of the gateway.
+	JSON Kind = "json"
+)
+
+// Change is one incompatibility between a baseline and the current protos.
+type Change struct {
+	Kind    Kind   `json:"kind"`
+	File    string `json:"file"`
+	Element string `json:"element"`
+	Message string `json:"message"`
+}
+
+func (c Change) String() string {
+	return fmt.Sprintf("%s: %s: %s: %s", c.Kind, c.File, c.Element, c.Message)
+}
+
+// Compare reports the changes from base to cur that break existing clients.
+// Additions are always compatible and are not reported.
+func Compare(base, cur *Set) []Change {
+	c := &comparer{cur: cur}
+	for _, f := range base.Project() {
+		c.file = f.Path()
+		c.messages(f.Messages())
+		c.enums(f.Enums())
+		services := f.Services()
+		for i := 0; i < services.Len(); i++ {
+			c.service(services.Get(i))
+		}
+	}
+	sort.SliceStable(c.changes, func(i, j int) bool {
+		a, b := c.changes[i], c.changes[j]
+		if a.File != b.File {
+			return a.File < b.File
+		}
+		return a.Element < b.Element
+	})
+	return c.changes
+}
+
+type comparer struct {
+	cur     *Set
+	file    string
+	changes []Change
+}
+
+func (c *comparer) add(kind Kind, element protoreflect.FullName, format string, args ...interface{}) {
+	c.changes = append(c.changes, Change{Kind: kind, File: c.file, Element: string(element), Message: fmt.Sprintf(format, args...)})
+}
+
+func (c *comparer) find(name protoreflect.FullName) protoreflect.Descriptor {
+	d, err := c.cur.Files.FindDescriptorByName(name)
+	if err != nil {
+		return nil
+	}
+	return d
+}
+
+func (c *comparer) messages(msgs protoreflect.MessageDescriptors) {
+	for i := 0; i < msgs.Len(); i++ {
+		c.message(msgs.Get(i))
+	}
+}
+
+func (c *comparer) enums(enums protoreflect.EnumDescriptors) {
+	for i := 0; i < enums.Len(); i++ {
+		c.enum(enums.Get(i))
+	}
+}
+
+func (c *comparer) message(old protoreflect.MessageDescriptor) {
+	if old.IsMapEntry() {
+		return
+	}
+	cur, ok := c.find(old.FullName()).(protoreflect.MessageDescriptor)
+	if !ok {
+		c.add(Wire, old.FullName(), "message was removed")
+		return
+	}
+	oldFields, curFields := old.Fields(), cur.Fields()
+	for i := 0; i < oldFields.Len(); i++ {
+		of := oldFields.Get(i)
+		cf := curFields.ByNumber(of.Number())
+		if cf == nil {
+			c.add(JSON, of.FullName(), "field %d was removed", of.Number())
+			if !reserved(cur, of) {
+				c.add(Wire, of.FullName(), "field %d was removed without reserving its number", of.Number())
+			}
+			if byName := curFields.ByName(of.Name()); byName != nil {
+				c.add(Wire, of.FullName(), "field number changed from %d to %d", of.Number(), byName.Number())
+			}
+			continue
+		}
+		c.field(of, cf)
+	}
+	c.messages(old.Messages())
+	c.enums(old.Enums())
+}
+
+// reserved reports whether cur reserves both the number and the name of the removed field.
+func reserved(cur protoreflect.MessageDescriptor, removed protoreflect.FieldDescriptor) bool {
+	return cur.ReservedRanges().Has(removed.Number()) && cur.ReservedNames().Has(removed.Name())
+}
+
+func (c *comparer) field(old, cur protoreflect.FieldDescriptor) {
+	if old.Name() != cur.Name() {
+		c.add(JSON, old.FullName(), "field %d was renamed to %q", old.Number(), cur.Name())
+	}
+	if old.JSONName() != cur.JSONName() && old.Name() == cur.Name() {
+		c.add(JSON, old.FullName(), "JSON name changed from %q to %q", old.JSONName(), cur.JSONName())
+	}
+	if old.Cardinality() != cur.Cardinality() {
+		c.add(Wire, old.FullName(), "cardinality changed from %s to %s", old.Cardinality(), cur.Cardinality())
+	}
+	if oldType, curType := typeName(old), typeName(cur); oldType != curType {
+		if !wireCompatible(old, cur) {
+			c.add(Wire, old.FullName(), "type changed from %s to %s", oldType, curType)
+		}
+		c.add(JSON, old.FullName(), "type changed from %s to %s", oldType, curType)
+	}
+	oldOneof, curOneof := oneofName(old), oneofName(cur)
+	if oldOneof != curOneof {
+		c.add(Wire, old.FullName(), "moved from oneof %q to oneof %q", oldOneof, curOneof)
+	}
+}
+
+func oneofName(f protoreflect.FieldDescriptor) string {
+	if o := f.ContainingOneof(); o != nil && !o.IsSynthetic() {
+		return string(o.Name())
+	}
+	return ""
+}
+
+func typeName(f protoreflect.FieldDescriptor) string {
+	if f.IsMap() {
+		return fmt.Sprintf("map<%s, %s>", typeName(f.MapKey()), typeName(f.MapValue()))
+	}
+	switch f.Kind() {
+	case protoreflect.MessageKind, protoreflect.GroupKind:
+		return string(f.Message().FullName())
+	case protoreflect.EnumKind:
+		return string(f.Enum().FullName())
+	}
+	return f.Kind().String()
+}
+
+// wireCompatible reports whether two scalar kinds share an encoding, as
+// listed under "Updating A Message Type" in the protobuf language guide.
+func wireCompatible(old, cur protoreflect.FieldDescriptor) bool {
+	groups := [][]protoreflect.Kind{
+		{protoreflect.Int32Kind, protoreflect.Uint32Kind, protoreflect.Int64Kind, protoreflect.Uint64Kind, protoreflect.BoolKind},
+		{protoreflect.Sint32Kind, protoreflect.Sint64Kind},
+		{protoreflect.Fixed32Kind, protoreflect.Sfixed32Kind},
+		{protoreflect.Fixed64Kind, protoreflect.Sfixed64Kind},
+		{protoreflect.StringKind, protoreflect.BytesKind},
+	}
+	if old.IsMap() || cur.IsMap() {
+		return false
+	}
+	for _, g := range groups {
+		if kindIn(old.Kind(), g) && kindIn(cur.Kind(), g) {
+			return true
+		}
+	}
+	return false
+}
+
+func kindIn(k protoreflect.Kind, kinds []protoreflect.Kind) bool {
+	for _, x := range kinds {
+		if k == x {
+			return true
+		}
+	}
+	return false
+}
+
+func (c *comparer) enum(old protoreflect.EnumDescriptor) {
+	cur, ok := c.find(old.FullName()).(protoreflect.EnumDescriptor)
+	if !ok {
+		c.add(Wire, old.FullName(), "enum was removed")
+		return
+	}
+	oldValues, curValues := old.Values(), cur.Values()
+	for i := 0; i < oldValues.Len(); i++ {
+		ov := oldValues.Get(i)
+		cv := curValues.ByNumber(ov.Number())
+		switch {
+		case cv == nil:
+			c.add(Wire, ov.FullName(), "enum value %d was removed", ov.Number())
+			c.add(JSON, ov.FullName(), "enum value %d was removed", ov.Number())
+		case cv.Name() != ov.Name():
+			c.add(JSON, ov.FullName(), "enum value %d was renamed to %q", ov.Number(), cv.Name())
+		}
+	}
+}
+
+func (c *comparer) service(old protoreflect.ServiceDescriptor) {
+	cur, ok := c.find(old.FullName()).(protoreflect.ServiceDescriptor)
+	if !ok {
+		c.add(Wire, old.FullName(), "service was removed")
+		return
+	}
+	oldMethods := old.Methods()
+	for i := 0; i < oldMethods.Len(); i++ {
+		om := oldMethods.Get(i)
+		cm := cur.Methods().ByName(om.Name())
+		if cm == nil {
+			c.add(Wire, om.FullName(), "RPC was removed")
+			if len(Bindings(om)) > 0 {
+				c.add(JSON, om.FullName(), "HTTP binding %s was removed", Bindings(om)[0])
+			}
+			continue
+		}
+		if om.Input().FullName() != cm.Input().FullName() {
+			c.add(Wire, om.FullName(), "request type changed from %s to %s", om.Input().FullName(), cm.Input().FullName())
+		}
+		if om.Output().FullName() != cm.Output().FullName() {
+			c.add(Wire, om.FullName(), "response type changed from %s to %s", om.Output().FullName(), cm.Output().FullName())
+		}
+		if om.IsStreamingClient() != cm.IsStreamingClient() || om.IsStreamingServer() != cm.IsStreamingServer() {
+			c.add(Wire, om.FullName(), "streaming mode changed from %s to %s", streamingMode(om), streamingMode(cm))
+		}
+		c.bindings(om, cm)
+	}
+}
+
+func (c *comparer) bindings(old, cur protoreflect.MethodDescriptor) {
+	curBindings := map[HTTPBinding]bool{}
+	for _, b := range Bindings(cur) {
+		curBindings[b] = true
+	}
+	for _, b := range Bindings(old) {
+		if !curBindings[b] {
+			c.add(JSON, old.FullName(), "HTTP binding %s was removed or changed", b)
+		}
+	}
+}
+
+func streamingMode(m protoreflect.MethodDescriptor) string {
+	switch {
+	case m.IsStreamingClient() && m.IsStreamingServer():
+		return "bidi"
+	case m.IsStreamingClient():
+		return "client"
+	case m.IsStreamingServer():
+		return "server"
+	}
+	return "unary"
+}
@@ -0,0 +1,65 @@
+package protoset
+
+import (
+	"strings"
+
+	"google.golang.org/genproto/googleapis/api/annotations"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"google.golang.org/protobuf/types/descriptorpb"
+)
+
+// HTTPBinding is one google.api.http mapping of an RPC.
+type HTTPBinding struct {
+	Method string `json:"method"`
+	Path   string `json:"path"`
+	Body   string `json:"body,omitempty"`
+}
+
+func (b HTTPBinding) String() string {
+	s := b.Method + " " + b.Path
+	if b.Body != "" {
+		s += " body=" + b.Body
+	}
+	return s
+}
+
+// Bindings returns the HTTP mappings declared on md, primary binding first.
+func Bindings(md protoreflect.MethodDescriptor) []HTTPBinding {
+	opts, ok := md.Options().(*descriptorpb.MethodOptions)
+	if !ok || opts == nil || !proto.HasExtension(opts, annotations.E_Http) {
+		return nil
+	}
+	rule, ok := proto.GetExtension(opts, annotations.E_Http).(*annotations.HttpRule)
+	if !ok || rule == nil {
+		return nil
+	}
+	var bindings []HTTPBinding
+	for _, r := range append([]*annotations.HttpRule{rule}, rule.GetAdditionalBindings()...) {
+		if b, ok := binding(r); ok {
+			bindings = append(bindings, b)
+		}
+	}
+	return bindings
+}
+
+func binding(r *annotations.HttpRule) (HTTPBinding, bool) {
+	b := HTTPBinding{Body: r.GetBody()}
+	switch p := r.GetPattern().(type) {
+	case *annotations.HttpRule_Get:
+		b.Method, b.Path = "GET", p.Get
+	case *annotations.HttpRule_Put:
+		b.Method, b.Path = "PUT", p.Put
+	case *annotations.HttpRule_Post:
+		b.Method, b.Path = "POST", p.Post
+	case *annotations.HttpRule_Delete:
+		b.Method, b.Path = "DELETE", p.Delete
+	case *annotations.HttpRule_Patch:
+		b.Method, b.Path = "PATCH", p.Patch
+	case *annotations.HttpRule_Custom:
+		b.Method, b.Path = strings.ToUpper(p.Custom.GetKind()), p.Custom.GetPath()
+	default:
+		return b, false
+	}
+	return b, true
+}
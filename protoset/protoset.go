@@ -0,0 +1,177 @@
+// Package protoset compiles the project's proto/ directory into descriptors
+// without protoc, for tooling that needs to inspect services and messages.
+package protoset
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/bufbuild/protocompile"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protodesc"
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"google.golang.org/protobuf/reflect/protoregistry"
+	"google.golang.org/protobuf/types/descriptorpb"
+)
+
+// Set is a linked set of proto files. Names lists the project's own files
+// (those at the top of the proto directory); Files also holds their imports.
+type Set struct {
+	Files *protoregistry.Files
+	Names []string
+}
+
+// Compile parses and links every .proto file directly inside dir. Imports are
+// resolved against dir, then importPaths, then the protobuf well-known types
+// and any file linked into this binary (such as google/api/annotations.proto).
+func Compile(dir string, importPaths ...string) (*Set, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read proto directory: %w", err)
+	}
+	var names []string
+	for _, e := range entries {
+		if !e.IsDir() && strings.HasSuffix(e.Name(), ".proto") {
+			names = append(names, e.Name())
+		}
+	}
+	sort.Strings(names)
+
+	compiler := protocompile.Compiler{
+		Resolver: protocompile.WithStandardImports(protocompile.CompositeResolver{
+			&protocompile.SourceResolver{ImportPaths: append([]string{dir}, importPaths...)},
+			protocompile.ResolverFunc(linkedFile),
+		}),
+		SourceInfoMode: protocompile.SourceInfoStandard,
+	}
+	linked, err := compiler.Compile(context.Background(), names...)
+	if err != nil {
+		return nil, err
+	}
+
+	// Round-trip through descriptor protos so options carry concrete
+	// extension types (e.g. google.api.http) from the global registry.
+	fds := &descriptorpb.FileDescriptorSet{}
+	seen := map[string]bool{}
+	for _, f := range linked {
+		appendFile(fds, f, seen)
+	}
+	return fromFileDescriptorSet(fds)
+}
+
+// linkedFile resolves imports from the descriptors registered by generated Go code.
+func linkedFile(path string) (protocompile.SearchResult, error) {
+	fd, err := protoregistry.GlobalFiles.FindFileByPath(path)
+	if err != nil {
+		return protocompile.SearchResult{}, err
+	}
+	return protocompile.SearchResult{Desc: fd}, nil
+}
+
+// appendFile adds f after its dependencies so the set can be linked in order.
+func appendFile(fds *descriptorpb.FileDescriptorSet, f protoreflect.FileDescriptor, seen map[string]bool) {
+	if seen[f.Path()] {
+		return
+	}
+	seen[f.Path()] = true
+	imports := f.Imports()
+	for i := 0; i < imports.Len(); i++ {
+		appendFile(fds, imports.Get(i).FileDescriptor, seen)
+	}
+	fds.File = append(fds.File, protodesc.ToFileDescriptorProto(f))
+}
+
+func fromFileDescriptorSet(fds *descriptorpb.FileDescriptorSet) (*Set, error) {
+	// Re-marshal so options are decoded against the global types registry.
+	b, err := proto.MarshalOptions{Deterministic: true}.Marshal(fds)
+	if err != nil {
+		return nil, err
+	}
+	decoded := &descriptorpb.FileDescriptorSet{}
+	if err := proto.Unmarshal(b, decoded); err != nil {
+		return nil, err
+	}
+	files, err := protodesc.NewFiles(decoded)
+	if err != nil {
+		return nil, err
+	}
+	set := &Set{Files: files}
+	for _, f := range decoded.File {
+		if !strings.Contains(f.GetName(), "/") {
+			set.Names = append(set.Names, f.GetName())
+		}
+	}
+	sort.Strings(set.Names)
+	return set, nil
+}
+
+// FileDescriptorSet returns the set with every file placed after its imports.
+func (s *Set) FileDescriptorSet() *descriptorpb.FileDescriptorSet {
+	fds := &descriptorpb.FileDescriptorSet{}
+	seen := map[string]bool{}
+	for _, name := range s.Names {
+		if f, err := s.Files.FindFileByPath(name); err == nil {
+			appendFile(fds, f, seen)
+		}
+	}
+	return fds
+}
+
+// Project returns the descriptors of the project's own files in name order.
+func (s *Set) Project() []protoreflect.FileDescriptor {
+	var files []protoreflect.FileDescriptor
+	for _, name := range s.Names {
+		if f, err := s.Files.FindFileByPath(name); err == nil {
+			files = append(files, f)
+		}
+	}
+	return files
+}
+
+// Load reads a binary FileDescriptorSet written by Save.
+func Load(path string) (*Set, error) {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	fds := &descriptorpb.FileDescriptorSet{}
+	if err := proto.Unmarshal(b, fds); err != nil {
+		return nil, fmt.Errorf("invalid descriptor set %s: %w", path, err)
+	}
+	return fromFileDescriptorSet(fds)
+}
+
+// Save writes the set as a binary FileDescriptorSet.
+func (s *Set) Save(path string) error {
+	b, err := proto.MarshalOptions{Deterministic: true}.Marshal(s.FileDescriptorSet())
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return err
+	}
+	return os.WriteFile(path, b, 0o644)
+}
+
+// wrapperScalars maps google.protobuf wrapper messages to the scalar they wrap
+var wrapperScalars = map[protoreflect.FullName]string{
+	"google.protobuf.DoubleValue": "double",
+	"google.protobuf.FloatValue":  "float",
+	"google.protobuf.Int64Value":  "int64",
+	"google.protobuf.UInt64Value": "uint64",
+	"google.protobuf.Int32Value":  "int32",
+	"google.protobuf.UInt32Value": "uint32",
+	"google.protobuf.BoolValue":   "bool",
+	"google.protobuf.StringValue": "string",
+	"google.protobuf.BytesValue":  "bytes",
+}
+
+// WrapperScalar returns the scalar a google.protobuf wrapper message such as
+// StringValue holds, or "" for any other message.
+func WrapperScalar(name protoreflect.FullName) string {
+	return wrapperScalars[name]
+}
@@ -0,0 +1,150 @@
+package protoset
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"google.golang.org/protobuf/reflect/protoreflect"
+)
+
+func TestCompileProjectProtos(t *testing.T) {
+	set, err := Compile("../proto")
+	if err != nil {
+		t.Fatalf("Compile returned error: %v", err)
+	}
+	if len(set.Project()) == 0 {
+		t.Fatal("expected project files")
+	}
+	md, err := set.Files.FindDescriptorByName("pb.BookService.GetBook")
+	if err != nil {
+		t.Fatalf("GetBook not found: %v", err)
+	}
+	bindings := Bindings(md.(protoreflect.MethodDescriptor))
+	if len(bindings) != 1 || bindings[0].Method != "GET" || bindings[0].Path != "/v1/books/{id}" {
+		t.Errorf("unexpected GetBook bindings: %v", bindings)
+	}
+}
+
+func TestSaveLoadRoundTrip(t *testing.T) {
+	set, err := Compile("../proto")
+	if err != nil {
+		t.Fatalf("Compile returned error: %v", err)
+	}
+	path := filepath.Join(t.TempDir(), "baseline.binpb")
+	if err := set.Save(path); err != nil {
+		t.Fatalf("Save returned error: %v", err)
+	}
+	loaded, err := Load(path)
+	if err != nil {
+		t.Fatalf("Load returned error: %v", err)
+	}
+	if changes := Compare(loaded, set); len(changes) != 0 {
+		t.Errorf("expected no changes after round trip, got %v", changes)
+	}
+}
+
+const baseProto = `syntax = "proto3";
+package pb;
+import "google/api/annotations.proto";
+
+service ItemService {
+  rpc GetItem(GetItemRequest) returns (Item) {
+    option (google.api.http) = { get: "/v1/items/{id}" };
+  }
+  rpc DropItem(GetItemRequest) returns (Item);
+}
+
+enum Color {
+  COLOR_UNSPECIFIED = 0;
+  COLOR_RED = 1;
+}
+
+message GetItemRequest { string id = 1; }
+
+message Item {
+  string id = 1;
+  string name = 2;
+  int32 count = 3;
+  Color color = 4;
+}
+`
+
+func TestCompare(t *testing.T) {
+	tests := []struct {
+		name  string
+		edit  func(string) string
+		wants []string // "kind element" pairs expected in the report
+	}{
+		{"unchanged", func(s string) string { return s }, nil},
+		{"field added", func(s string) string {
+			return strings.Replace(s, "Color color = 4;", "Color color = 4;\n  string note = 5;", 1)
+		}, nil},
+		{"field type changed", func(s string) string {
+			return strings.Replace(s, "string name = 2;", "int64 name = 2;", 1)
+		}, []string{"wire pb.Item.name", "json pb.Item.name"}},
+		{"compatible type change", func(s string) string {
+			return strings.Replace(s, "int32 count = 3;", "int64 count = 3;", 1)
+		}, []string{"json pb.Item.count"}},
+		{"field removed without reserve", func(s string) string {
+			return strings.Replace(s, "string name = 2;", "", 1)
+		}, []string{"wire pb.Item.name", "json pb.Item.name"}},
+		{"field removed and reserved", func(s string) string {
+			return strings.Replace(s, "string name = 2;", `reserved 2; reserved "name";`, 1)
+		}, []string{"json pb.Item.name"}},
+		{"field renamed", func(s string) string {
+			return strings.Replace(s, "string name = 2;", "string title = 2;", 1)
+		}, []string{"json pb.Item.name"}},
+		{"rpc removed", func(s string) string {
+			return strings.Replace(s, "rpc DropItem(GetItemRequest) returns (Item);", "", 1)
+		}, []string{"wire pb.ItemService.DropItem"}},
+		{"http path changed", func(s string) string {
+			return strings.Replace(s, "/v1/items/{id}", "/v2/items/{id}", 1)
+		}, []string{"json pb.ItemService.GetItem"}},
+		{"enum value removed", func(s string) string {
+			return strings.Replace(s, "COLOR_RED = 1;", "", 1)
+		}, []string{"wire pb.COLOR_RED", "json pb.COLOR_RED"}},
+	}
+
+	base := compileSource(t, baseProto)
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			changes := Compare(base, compileSource(t, tt.edit(baseProto)))
+			var got []string
+			for _, c := range changes {
+				got = append(got, string(c.Kind)+" "+c.Element)
+			}
+			for _, want := range tt.wants {
+				if !contains(got, want) {
+					t.Errorf("missing %q in %v", want, got)
+				}
+			}
+			if len(tt.wants) == 0 && len(changes) != 0 {
+				t.Errorf("expected no changes, got %v", changes)
+			}
+		})
+	}
+}
+
+func compileSource(t *testing.T, src string) *Set {
+	t.Helper()
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, "item.proto"), []byte(src), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	set, err := Compile(dir)
+	if err != nil {
+		t.Fatalf("Compile returned error: %v", err)
+	}
+	return set
+}
+
+func contains(list []string, s string) bool {
+	for _, v := range list {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
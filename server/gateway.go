@@ -8,7 +8,9 @@ import (
 	"log"
 	"net/http"
 	"strings"
+	"time"
 
+	"github.com/gorilla/websocket"
 	"github.com/grpc-ecosystem/grpc-gateway/v2/runtime"
 	"google.golang.org/grpc"
 	"google.golang.org/grpc/credentials/insecure"
@@ -19,8 +21,12 @@ func StartGatewayServer(grpcPort, gatewayAddress string) error {
 	ctx, cancel := context.WithCancel(ctx)
 	defer cancel()
 
-	mux := runtime.NewServeMux()
-	opts := []grpc.DialOption{grpc.WithTransportCredentials(insecure.NewCredentials())}
+	mux := runtime.NewServeMux(runtime.WithIncomingHeaderMatcher(incomingHeader))
+	opts := []grpc.DialOption{
+		grpc.WithTransportCredentials(insecure.NewCredentials()),
+		grpc.WithUnaryInterceptor(validateEnums),
+		grpc.WithStreamInterceptor(validateStreamEnums),
+	}
 	ip := fmt.Sprintf("%s%s", gatewayAddress, grpcPort)
 	conn, err := grpc.NewClient(ip, opts...)
 	if err != nil {
@@ -56,22 +62,64 @@ func StartGatewayServer(grpcPort, gatewayAddress string) error {
 		return err
 	}
 
-	// Serve the swagger-ui
 	httpMux := http.NewServeMux()
-	httpMux.Handle("/", mux)
+	// Serve the OpenAPI document with Swagger UI and Redoc
+	spec, err := openAPIHandler()
+	if err != nil {
+		return err
+	}
+	httpMux.HandleFunc("GET /openapi.json", spec)
+	httpMux.HandleFunc("GET /docs", docsHandler("swagger.html"))
+	httpMux.HandleFunc("GET /docs/redoc", docsHandler("redoc.html"))
+	// WS_PING_INTERVAL (default 30s; 0 turns pings off) keeps idle sockets open
+	// through proxies
+	pingInterval, err := durationEnv("WS_PING_INTERVAL", 30*time.Second)
+	if err != nil {
+		return err
+	}
+	streamOpts := handler.StreamOptions{PingInterval: pingInterval}
+	// Every annotated streaming RPC is also served over WebSockets and
+	// Server-Sent Events
+	streams := handler.StreamProxy(conn, mux, projectFiles(), streamOpts)
+	httpMux.Handle("/", streams)
 	httpMux.HandleFunc("/v1/todos/stream", func(w http.ResponseWriter, r *http.Request) {
-		handler.TodoStreamHandler(w, r, conn)
+		if !websocket.IsWebSocketUpgrade(r) {
+			streams.ServeHTTP(w, r)
+			return
+		}
+		handler.TodoStreamHandler(w, r, conn, mux, streamOpts)
 	})
 	// Add HTTP health check endpoint
-	httpMux.HandleFunc("/healthz", func(w http.ResponseWriter, r *http.Request) {
-		w.WriteHeader(http.StatusOK)
-		w.Write([]byte("ok"))
-	})
+	httpMux.HandleFunc("/healthz", healthzHandler)
 
 	log.Printf("HTTP gateway server listening at %v", gatewayAddress+":8080")
 	return http.ListenAndServe(gatewayAddress+":8080", allowCORS(httpMux))
 }
 
+// traceHeaders are passed to the gRPC server under their own names, so traces
+// continue across the gateway
+var traceHeaders = map[string]bool{
+	"traceparent":  true,
+	"tracestate":   true,
+	"x-request-id": true,
+	"b3":           true,
+}
+
+// incomingHeader picks the request headers forwarded as gRPC metadata: trace
+// headers as they are, and the rest as grpc-gateway does by default.
+func incomingHeader(key string) (string, bool) {
+	if k := strings.ToLower(key); traceHeaders[k] || strings.HasPrefix(k, "x-b3-") {
+		return k, true
+	}
+	return runtime.DefaultHeaderMatcher(key)
+}
+
+// healthzHandler answers liveness probes with 200 OK and body 'ok'.
+func healthzHandler(w http.ResponseWriter, _ *http.Request) {
+	w.WriteHeader(http.StatusOK)
+	w.Write([]byte("ok"))
+}
+
 func allowCORS(h http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		// if origin := r.Header.Get("Origin"); origin != "" {
@@ -7,10 +7,7 @@ import (
 )
 
 func TestHealthzEndpoint(t *testing.T) {
-	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		w.WriteHeader(http.StatusOK)
-		w.Write([]byte("ok"))
-	})
+	handler := http.HandlerFunc(healthzHandler)
 
 	req := httptest.NewRequest("GET", "/healthz", nil)
 	rr := httptest.NewRecorder()
@@ -23,3 +20,22 @@ func TestHealthzEndpoint(t *testing.T) {
 		t.Errorf("handler returned unexpected body: got %v want %v", rr.Body.String(), "ok")
 	}
 }
+
+func TestIncomingHeader(t *testing.T) {
+	tests := []struct {
+		header, key string
+		ok          bool
+	}{
+		{"Traceparent", "traceparent", true},
+		{"X-B3-Traceid", "x-b3-traceid", true},
+		{"X-Request-Id", "x-request-id", true},
+		{"Authorization", "grpcgateway-Authorization", true},
+		{"Grpc-Metadata-Tenant", "Tenant", true},
+		{"X-Custom", "", false},
+	}
+	for _, tt := range tests {
+		if key, ok := incomingHeader(tt.header); key != tt.key || ok != tt.ok {
+			t.Errorf("incomingHeader(%q) = %q, %v; want %q, %v", tt.header, key, ok, tt.key, tt.ok)
+		}
+	}
+}
@@ -2,25 +2,25 @@ package server
 
 import (
 	"context"
+	"fmt"
+	"grpc_anotation_sample/internal/broker"
+	"grpc_anotation_sample/internal/bus"
 	"grpc_anotation_sample/pb"
 	"grpc_anotation_sample/services"
 	"log"
 	"net"
 	"os"
+	"strconv"
+	"time"
 
-	"github.com/joho/godotenv"
 	"go.mongodb.org/mongo-driver/mongo"
 	"go.mongodb.org/mongo-driver/mongo/options"
 	"google.golang.org/grpc"
 )
 
+// StartGRPCServer serves the services on port; the environment (see .env)
+// must be loaded first
 func StartGRPCServer(port string) error {
-	//load env
-	err := godotenv.Load()
-	if err != nil {
-		log.Printf("Failed to load env: %v", err)
-		return err
-	}
 	mongoUrl := os.Getenv("MONGO_URL")
 	dbName := os.Getenv("DB_NAME")
 	//load mongo client
@@ -43,10 +43,27 @@ func StartGRPCServer(port string) error {
 	// 	return err
 	// }
 
+	todoStream, err := todoStreamOptions()
+	if err != nil {
+		log.Printf("Invalid todo stream settings: %v", err)
+		return err
+	}
+
 	grpcServer := grpc.NewServer()
 	pb.RegisterBookServiceServer(grpcServer, services.NewBookService(client, dbName))
 
-	pb.RegisterTodoServiceServer(grpcServer, services.NewTodoService())
+	todos := services.NewTodoService(todoStream)
+	events, err := eventBus(client.Database(dbName))
+	if err != nil {
+		log.Printf("Failed to connect to the event bus: %v", err)
+		return err
+	}
+	defer events.Close()
+	if err := todos.Connect(events); err != nil {
+		log.Printf("Failed to connect to the event bus: %v", err)
+		return err
+	}
+	pb.RegisterTodoServiceServer(grpcServer, todos)
 	pb.RegisterHealthServer(grpcServer, services.NewHealthService())
 	err = grpcServer.Serve(lis)
 	if err != nil {
@@ -56,6 +73,75 @@ func StartGRPCServer(port string) error {
 	return nil
 }
 
+// todoStreamOptions reads the StreamTodos settings from
+// TODO_STREAM_QUEUE_SIZE (default 64), TODO_STREAM_OVERFLOW (disconnect,
+// the default, or drop-oldest) and TODO_STREAM_HEARTBEAT (a duration such
+// as 15s, default 30s; 0 turns heartbeats off).
+func todoStreamOptions() (services.TodoStreamOptions, error) {
+	opts := services.TodoStreamOptions{
+		Queue:     broker.Options{QueueSize: broker.DefaultQueueSize, Policy: broker.Disconnect},
+		Heartbeat: services.DefaultHeartbeat,
+	}
+	if v := os.Getenv("TODO_STREAM_QUEUE_SIZE"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n <= 0 {
+			return opts, fmt.Errorf("TODO_STREAM_QUEUE_SIZE must be a positive integer, got %q", v)
+		}
+		opts.Queue.QueueSize = n
+	}
+	if v := os.Getenv("TODO_STREAM_OVERFLOW"); v != "" {
+		p, err := broker.ParsePolicy(v)
+		if err != nil {
+			return opts, fmt.Errorf("TODO_STREAM_OVERFLOW: %w", err)
+		}
+		opts.Queue.Policy = p
+	}
+	heartbeat, err := durationEnv("TODO_STREAM_HEARTBEAT", services.DefaultHeartbeat)
+	if err != nil {
+		return opts, err
+	}
+	opts.Heartbeat = heartbeat
+	if heartbeat == 0 {
+		opts.Heartbeat = -1
+	}
+	return opts, nil
+}
+
+// eventBus returns the bus named by EVENT_BUS: memory (the default) keeps
+// events in this process, and mongo shares them with the other instances
+// through the change stream of db's collection EVENT_BUS_COLLECTION
+// (default events), which needs a replica set.
+func eventBus(db *mongo.Database) (bus.Bus, error) {
+	switch kind := os.Getenv("EVENT_BUS"); kind {
+	case "", "memory":
+		return bus.NewHub().Connect(), nil
+	case "mongo":
+		name := os.Getenv("EVENT_BUS_COLLECTION")
+		if name == "" {
+			name = "events"
+		}
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+		return bus.NewMongo(ctx, db.Collection(name))
+	default:
+		return nil, fmt.Errorf("EVENT_BUS must be memory or mongo, got %q", kind)
+	}
+}
+
+// durationEnv reads a non-negative duration such as 30s from the
+// environment variable name, or returns def when it is unset.
+func durationEnv(name string, def time.Duration) (time.Duration, error) {
+	v := os.Getenv(name)
+	if v == "" {
+		return def, nil
+	}
+	d, err := time.ParseDuration(v)
+	if err != nil || d < 0 {
+		return 0, fmt.Errorf("%s must be a duration such as 30s, got %q", name, v)
+	}
+	return d, nil
+}
+
 // func CallClient(ip string) (*grpc.ClientConn, error) {
 // 	cc, err := grpc.NewClient(ip, grpc.WithTransportCredentials(insecure.NewCredentials()))
 // 	if err != nil {
@@ -0,0 +1,75 @@
+package server
+
+import (
+	"embed"
+	"encoding/json"
+	"net/http"
+
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"google.golang.org/protobuf/reflect/protoregistry"
+
+	"grpc_anotation_sample/openapi"
+)
+
+// The docs pages load Swagger UI and Redoc from their CDNs
+//
+//go:embed docs/*.html
+var docs embed.FS
+
+// openAPIDocument describes the REST API of the services compiled into the
+// binary, so it always matches the registered gateway handlers.
+func openAPIDocument() ([]byte, error) {
+	doc := openapi.Build(projectFiles(), openapi.Info{
+		Title:       "grpc_anotation_sample",
+		Description: "REST API served by grpc-gateway in front of the gRPC services.",
+		Version:     "v1",
+	})
+
+	// Routes served by the gateway itself rather than through grpc-gateway
+	doc.Paths["/healthz"] = map[string]*openapi.Operation{"get": {
+		OperationID: "healthz",
+		Summary:     "Liveness probe",
+		Responses: map[string]*openapi.Response{"200": {
+			Description: "The gateway is up.",
+			Content:     map[string]*openapi.MediaType{"text/plain": {Schema: map[string]any{"type": "string", "const": "ok"}}},
+		}},
+	}}
+	if op := doc.Paths["/v1/todos/stream"]["get"]; op != nil {
+		op.Description = "Upgrade the connection to a WebSocket to receive each TodoEvent as a JSON text message, or accept text/event-stream to receive them as Server-Sent Events. Pass the resumeToken of the last event received as resume_token, or as Last-Event-ID to the event stream, to continue after it. An idle stream receives heartbeat events in place of todos. Over the WebSocket the client may send create, complete, delete, subscribe and unsubscribe commands, each answered with its correlationId."
+		op.Responses["101"] = &openapi.Response{Description: "Switching to the WebSocket protocol."}
+		op.Responses["200"].Content["text/event-stream"] = &openapi.MediaType{Schema: map[string]any{
+			"type":        "string",
+			"description": "A message event per TodoEvent with its resumeToken as the id, and a final status event holding a google.rpc.Status.",
+		}}
+	}
+	return json.MarshalIndent(doc, "", "  ")
+}
+
+// projectFiles are the proto files of the services compiled into the binary
+func projectFiles() []protoreflect.FileDescriptor {
+	var files []protoreflect.FileDescriptor
+	protoregistry.GlobalFiles.RangeFilesByPackage("pb", func(fd protoreflect.FileDescriptor) bool {
+		files = append(files, fd)
+		return true
+	})
+	return files
+}
+
+// openAPIHandler serves the document at /openapi.json
+func openAPIHandler() (http.HandlerFunc, error) {
+	body, err := openAPIDocument()
+	if err != nil {
+		return nil, err
+	}
+	return func(w http.ResponseWriter, _ *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.Write(body)
+	}, nil
+}
+
+// docsHandler serves one of the embedded docs pages
+func docsHandler(page string) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		http.ServeFileFS(w, r, docs, "docs/"+page)
+	}
+}
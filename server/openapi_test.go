@@ -0,0 +1,70 @@
+package server
+
+import (
+	"encoding/json"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestOpenAPIHandler(t *testing.T) {
+	handler, err := openAPIHandler()
+	if err != nil {
+		t.Fatal(err)
+	}
+	rr := httptest.NewRecorder()
+	handler(rr, httptest.NewRequest("GET", "/openapi.json", nil))
+	if ct := rr.Header().Get("Content-Type"); ct != "application/json" {
+		t.Errorf("Content-Type = %q", ct)
+	}
+
+	var doc struct {
+		OpenAPI string
+		Paths   map[string]map[string]struct {
+			OperationID string
+			Responses   map[string]any
+		}
+		Components struct {
+			Schemas         map[string]any
+			SecuritySchemes map[string]any
+		}
+	}
+	if err := json.Unmarshal(rr.Body.Bytes(), &doc); err != nil {
+		t.Fatal(err)
+	}
+	if doc.OpenAPI != "3.1.0" {
+		t.Errorf("openapi = %q", doc.OpenAPI)
+	}
+	// Every service compiled into the binary is merged into one document
+	for path, want := range map[string]string{
+		"/v1/books/{id}":   "BookService_GetBook",
+		"/v1/todos":        "TodoService_CreateTodo",
+		"/v1/health":       "Health_Check",
+		"/healthz":         "healthz",
+		"/v1/todos/stream": "TodoService_StreamTodos",
+	} {
+		var ids []string
+		for _, op := range doc.Paths[path] {
+			ids = append(ids, op.OperationID)
+		}
+		if !strings.Contains(strings.Join(ids, ","), want) {
+			t.Errorf("%s operations = %v, want %s", path, ids, want)
+		}
+	}
+	if _, ok := doc.Paths["/v1/todos/stream"]["get"].Responses["101"]; !ok {
+		t.Errorf("stream responses = %v, want a WebSocket upgrade", doc.Paths["/v1/todos/stream"]["get"].Responses)
+	}
+	if doc.Components.Schemas["google.rpc.Status"] == nil || doc.Components.SecuritySchemes["bearerAuth"] == nil {
+		t.Errorf("components = %+v", doc.Components)
+	}
+}
+
+func TestDocsHandler(t *testing.T) {
+	for page, want := range map[string]string{"swagger.html": "SwaggerUIBundle", "redoc.html": "<redoc"} {
+		rr := httptest.NewRecorder()
+		docsHandler(page)(rr, httptest.NewRequest("GET", "/docs", nil))
+		if rr.Code != 200 || !strings.Contains(rr.Body.String(), want) || !strings.Contains(rr.Body.String(), "/openapi.json") {
+			t.Errorf("%s = %d %s", page, rr.Code, rr.Body.String())
+		}
+	}
+}
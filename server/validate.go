@@ -0,0 +1,112 @@
+package server
+
+import (
+	"context"
+	"fmt"
+	"sync"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protoreflect"
+)
+
+// validateEnums rejects gateway requests carrying enum numbers the proto does
+// not declare. protojson accepts any number for an open enum (e.g. "status": 7),
+// so this catches values that would otherwise reach the services unchecked.
+func validateEnums(ctx context.Context, method string, req, reply interface{}, cc *grpc.ClientConn, invoker grpc.UnaryInvoker, opts ...grpc.CallOption) error {
+	if m, ok := req.(proto.Message); ok {
+		if err := checkEnums(m.ProtoReflect()); err != nil {
+			return status.Error(codes.InvalidArgument, err.Error())
+		}
+	}
+	return invoker(ctx, method, req, reply, cc, opts...)
+}
+
+// validateStreamEnums does the same for each request sent on a stream, such
+// as those of the WebSocket and Server-Sent Events proxies. A request with an
+// undeclared value is not sent: the stream is cancelled, and both SendMsg and
+// the RecvMsg waiting on the stream fail with InvalidArgument.
+func validateStreamEnums(ctx context.Context, desc *grpc.StreamDesc, cc *grpc.ClientConn, method string, streamer grpc.Streamer, opts ...grpc.CallOption) (grpc.ClientStream, error) {
+	ctx, cancel := context.WithCancel(ctx)
+	cs, err := streamer(ctx, desc, cc, method, opts...)
+	if err != nil {
+		cancel()
+		return nil, err
+	}
+	return &enumCheckedStream{ClientStream: cs, cancel: cancel}, nil
+}
+
+type enumCheckedStream struct {
+	grpc.ClientStream
+	cancel context.CancelFunc
+
+	mu  sync.Mutex
+	err error // the rejection of an invalid request
+}
+
+func (s *enumCheckedStream) SendMsg(m any) error {
+	if msg, ok := m.(proto.Message); ok {
+		if err := checkEnums(msg.ProtoReflect()); err != nil {
+			s.mu.Lock()
+			if s.err == nil {
+				s.err = status.Error(codes.InvalidArgument, err.Error())
+			}
+			err := s.err
+			s.mu.Unlock()
+			s.cancel()
+			return err
+		}
+	}
+	return s.ClientStream.SendMsg(m)
+}
+
+func (s *enumCheckedStream) RecvMsg(m any) error {
+	err := s.ClientStream.RecvMsg(m)
+	if err == nil {
+		return nil
+	}
+	s.cancel()
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.err != nil {
+		return s.err
+	}
+	return err
+}
+
+// checkEnums walks m and its nested messages looking for undeclared enum values.
+func checkEnums(m protoreflect.Message) error {
+	var err error
+	m.Range(func(fd protoreflect.FieldDescriptor, v protoreflect.Value) bool {
+		switch {
+		case fd.IsMap():
+			v.Map().Range(func(_ protoreflect.MapKey, mv protoreflect.Value) bool {
+				err = checkValue(fd.MapValue(), mv)
+				return err == nil
+			})
+		case fd.IsList():
+			list := v.List()
+			for i := 0; i < list.Len() && err == nil; i++ {
+				err = checkValue(fd, list.Get(i))
+			}
+		default:
+			err = checkValue(fd, v)
+		}
+		return err == nil
+	})
+	return err
+}
+
+func checkValue(fd protoreflect.FieldDescriptor, v protoreflect.Value) error {
+	switch fd.Kind() {
+	case protoreflect.EnumKind:
+		if fd.Enum().Values().ByNumber(v.Enum()) == nil {
+			return fmt.Errorf("invalid value %d for enum %s in field %s", v.Enum(), fd.Enum().FullName(), fd.FullName())
+		}
+	case protoreflect.MessageKind, protoreflect.GroupKind:
+		return checkEnums(v.Message())
+	}
+	return nil
+}
@@ -0,0 +1,99 @@
+package server
+
+import (
+	"context"
+	"testing"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/descriptorpb"
+)
+
+func TestValidateEnums(t *testing.T) {
+	invoked := false
+	invoker := func(context.Context, string, interface{}, interface{}, *grpc.ClientConn, ...grpc.CallOption) error {
+		invoked = true
+		return nil
+	}
+
+	tests := []struct {
+		name string
+		req  *descriptorpb.DescriptorProto
+		code codes.Code
+	}{
+		{"declared value", &descriptorpb.DescriptorProto{Field: []*descriptorpb.FieldDescriptorProto{
+			{Type: descriptorpb.FieldDescriptorProto_TYPE_STRING.Enum()},
+		}}, codes.OK},
+		{"undeclared value in nested message", &descriptorpb.DescriptorProto{Field: []*descriptorpb.FieldDescriptorProto{
+			{Type: descriptorpb.FieldDescriptorProto_Type(99).Enum()},
+		}}, codes.InvalidArgument},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			invoked = false
+			err := validateEnums(context.Background(), "/test.Service/Method", tt.req, nil, nil, invoker)
+			if got := status.Code(err); got != tt.code {
+				t.Fatalf("got code %v, want %v (err: %v)", got, tt.code, err)
+			}
+			if invoked != (tt.code == codes.OK) {
+				t.Errorf("invoker called = %v, want %v", invoked, tt.code == codes.OK)
+			}
+		})
+	}
+}
+
+// blockingStream is a server stream that never answers until its context ends
+type blockingStream struct {
+	grpc.ClientStream
+	ctx  context.Context
+	sent int
+}
+
+func (s *blockingStream) SendMsg(any) error { s.sent++; return nil }
+func (s *blockingStream) CloseSend() error  { return nil }
+
+func (s *blockingStream) RecvMsg(any) error {
+	<-s.ctx.Done()
+	return status.FromContextError(s.ctx.Err()).Err()
+}
+
+func TestValidateStreamEnums(t *testing.T) {
+	var inner *blockingStream
+	streamer := func(ctx context.Context, _ *grpc.StreamDesc, _ *grpc.ClientConn, _ string, _ ...grpc.CallOption) (grpc.ClientStream, error) {
+		inner = &blockingStream{ctx: ctx}
+		return inner, nil
+	}
+	open := func(t *testing.T) grpc.ClientStream {
+		t.Helper()
+		cs, err := validateStreamEnums(context.Background(), &grpc.StreamDesc{ServerStreams: true}, nil, "/test.Service/Stream", streamer)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return cs
+	}
+
+	t.Run("declared value", func(t *testing.T) {
+		cs := open(t)
+		req := &descriptorpb.FieldDescriptorProto{Type: descriptorpb.FieldDescriptorProto_TYPE_STRING.Enum()}
+		if err := cs.SendMsg(req); err != nil || inner.sent != 1 {
+			t.Fatalf("SendMsg = %v, sent %d", err, inner.sent)
+		}
+	})
+
+	t.Run("undeclared value", func(t *testing.T) {
+		cs := open(t)
+		req := &descriptorpb.FieldDescriptorProto{Type: descriptorpb.FieldDescriptorProto_Type(99).Enum()}
+		if err := cs.SendMsg(req); status.Code(err) != codes.InvalidArgument {
+			t.Fatalf("SendMsg = %v, want InvalidArgument", err)
+		}
+		if inner.sent != 0 {
+			t.Error("invalid request was sent")
+		}
+		// The stream is cancelled, so a receive does not wait for a request
+		// that never comes
+		if err := cs.RecvMsg(&descriptorpb.FieldDescriptorProto{}); status.Code(err) != codes.InvalidArgument {
+			t.Fatalf("RecvMsg = %v, want InvalidArgument", err)
+		}
+	})
+}
@@ -2,6 +2,7 @@ package services
 
 import (
 	"context"
+	"grpc_anotation_sample/internal/watch"
 	"grpc_anotation_sample/pb"
 
 	"go.mongodb.org/mongo-driver/mongo"
@@ -9,10 +10,15 @@ import (
 
 type BookService struct {
 	pb.UnimplementedBookServiceServer
+	books *watch.Watcher // nil without a database
 }
 
 func NewBookService(Client *mongo.Client, dbName string) *BookService {
-	return &BookService{}
+	s := &BookService{}
+	if Client != nil {
+		s.books = &watch.Watcher{Collection: Client.Database(dbName).Collection("books"), Entity: &pb.Book{}}
+	}
+	return s
 }
 
 func (s *BookService) CreateBook(ctx context.Context, req *pb.CreateBookRequest) (*pb.CreateBookResponse, error) {
@@ -34,3 +40,13 @@ func (s *BookService) DeleteBook(ctx context.Context, req *pb.DeleteBookRequest)
 func (s *BookService) ListBooks(ctx context.Context, req *pb.ListBooksRequest) (*pb.ListBooksResponse, error) {
 	return &pb.ListBooksResponse{}, nil
 }
+
+// WatchBook streams the changes to the books collection that match the
+// request's filter, as created, updated and deleted events
+func (s *BookService) WatchBook(req *pb.WatchBookRequest, stream pb.BookService_WatchBookServer) error {
+	return s.books.Watch(stream, req.GetFilter(), req.GetResumeToken(), func(c watch.Change) error {
+		event := &pb.BookEvent{Type: pb.BookEvent_Type(c.Op), Id: c.ID, ResumeToken: c.Token}
+		event.Data, _ = c.Data.(*pb.Book)
+		return stream.Send(event)
+	})
+}
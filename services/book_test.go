@@ -0,0 +1,111 @@
+package services
+
+import (
+	"context"
+	"grpc_anotation_sample/pb"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/grpc-ecosystem/grpc-gateway/v2/runtime"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/status"
+	"google.golang.org/grpc/test/bufconn"
+)
+
+// dialBookService starts BookService on an in-memory listener and returns a client connection to it.
+func dialBookService(t *testing.T) *grpc.ClientConn {
+	t.Helper()
+	lis := bufconn.Listen(1024 * 1024)
+	grpcServer := grpc.NewServer()
+	pb.RegisterBookServiceServer(grpcServer, NewBookService(nil, ""))
+	go grpcServer.Serve(lis)
+	t.Cleanup(grpcServer.Stop)
+
+	conn, err := grpc.NewClient("passthrough:///bufnet",
+		grpc.WithContextDialer(func(ctx context.Context, _ string) (net.Conn, error) {
+			return lis.DialContext(ctx)
+		}),
+		grpc.WithTransportCredentials(insecure.NewCredentials()),
+	)
+	if err != nil {
+		t.Fatalf("failed to dial bufconn: %v", err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	return conn
+}
+
+func TestBookServiceRPCs(t *testing.T) {
+	client := pb.NewBookServiceClient(dialBookService(t))
+	ctx := context.Background()
+
+	t.Run("CreateBook", func(t *testing.T) {
+		if _, err := client.CreateBook(ctx, &pb.CreateBookRequest{Data: &pb.Book{}}); err != nil {
+			t.Errorf("CreateBook returned error: %v", err)
+		}
+	})
+	t.Run("GetBook", func(t *testing.T) {
+		if _, err := client.GetBook(ctx, &pb.GetBookRequest{Id: "test-id"}); err != nil {
+			t.Errorf("GetBook returned error: %v", err)
+		}
+	})
+	t.Run("UpdateBook", func(t *testing.T) {
+		if _, err := client.UpdateBook(ctx, &pb.UpdateBookRequest{Data: &pb.Book{Id: "test-id"}}); err != nil {
+			t.Errorf("UpdateBook returned error: %v", err)
+		}
+	})
+	t.Run("DeleteBook", func(t *testing.T) {
+		if _, err := client.DeleteBook(ctx, &pb.DeleteBookRequest{Id: "test-id"}); err != nil {
+			t.Errorf("DeleteBook returned error: %v", err)
+		}
+	})
+	t.Run("ListBooks", func(t *testing.T) {
+		if _, err := client.ListBooks(ctx, &pb.ListBooksRequest{}); err != nil {
+			t.Errorf("ListBooks returned error: %v", err)
+		}
+	})
+	t.Run("WatchBook", func(t *testing.T) {
+		stream, err := client.WatchBook(ctx, &pb.WatchBookRequest{})
+		if err == nil {
+			_, err = stream.Recv()
+		}
+		if status.Code(err) != codes.FailedPrecondition {
+			t.Errorf("WatchBook without a database = %v, want FailedPrecondition", err)
+		}
+	})
+}
+
+func TestBookServiceGateway(t *testing.T) {
+	mux := runtime.NewServeMux()
+	if err := pb.RegisterBookServiceHandler(context.Background(), mux, dialBookService(t)); err != nil {
+		t.Fatalf("failed to register gateway handler: %v", err)
+	}
+
+	tests := []struct {
+		method string
+		path   string
+		body   string
+	}{
+		{http.MethodPost, "/v1/books", `{"data":{}}`},
+		{http.MethodGet, "/v1/books/test-id", ""},
+		{http.MethodPut, "/v1/books/test-id", `{"data":{"id":"test-id"}}`},
+		{http.MethodDelete, "/v1/books/test-id", ""},
+		{http.MethodGet, "/v1/books", ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.method+" "+tt.path, func(t *testing.T) {
+			req := httptest.NewRequest(tt.method, tt.path, strings.NewReader(tt.body))
+			req.Header.Set("Content-Type", "application/json")
+			rr := httptest.NewRecorder()
+			mux.ServeHTTP(rr, req)
+
+			if rr.Code != http.StatusOK {
+				t.Errorf("%s %s returned status %d: %s", tt.method, tt.path, rr.Code, rr.Body.String())
+			}
+		})
+	}
+}
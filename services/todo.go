@@ -1,94 +1,367 @@
 package services
 
 import (
+	"cmp"
 	"context"
+	"errors"
+	"fmt"
+	"grpc_anotation_sample/internal/broker"
+	"grpc_anotation_sample/internal/bus"
 	"grpc_anotation_sample/pb"
 	"log"
+	"maps"
+	"slices"
+	"strconv"
+	"strings"
 	"sync"
 	"time"
 
 	"github.com/google/uuid"
 	"go.mongodb.org/mongo-driver/mongo"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/types/known/timestamppb"
 )
 
+// todoEventLogSize is how many events a StreamTodos client can resume across
+const todoEventLogSize = 1024
+
+// DefaultHeartbeat is how long a StreamTodos stream may be idle before a
+// heartbeat is sent
+const DefaultHeartbeat = 30 * time.Second
+
+// todoSubject is the bus subject on which instances share todo changes
+const todoSubject = "todo.changes"
+
+// TodoStreamOptions configure StreamTodos. Queue sets how many todos each
+// stream may fall behind and what happens when one does; a stream idle for
+// Heartbeat gets a heartbeat event, and none when it is negative.
+type TodoStreamOptions struct {
+	Queue     broker.Options
+	Heartbeat time.Duration
+}
+
+// TodoService keeps todos in memory and streams the events that change them
+// to StreamTodos clients through a broker, so a slow client never blocks the
+// other RPCs. Recent events are kept in a log for clients that resume.
+//
+// Once connected to a bus, each instance shares its changes with the others
+// and applies theirs, so every instance holds the same todos and streams
+// every change. Event ids and resume tokens stay local to an instance.
 type TodoService struct {
 	pb.UnimplementedTodoServiceServer
-	mu      sync.Mutex
-	todos   []*pb.Todo
-	streams []chan *pb.Todo
-	Client  *mongo.Client
+	// changeMu orders changes made here, so the bus carries them in the order
+	// they are made without mu being held while it accepts one
+	changeMu sync.Mutex
+	// mu guards todos, lastID and bus, and orders publishing against
+	// snapshot-and-subscribe
+	mu     sync.Mutex
+	bus    bus.Bus
+	todos  map[string]*pb.TodoEvent // the last event that changed each current todo
+	lastID uint64
+	events *broker.Log[*pb.TodoEvent]
+	// epoch tells this process's resume tokens from those of earlier ones,
+	// whose event ids are meaningless after a restart
+	epoch     string
+	changed   *broker.Broker[*pb.TodoEvent]
+	heartbeat time.Duration
+	Client    *mongo.Client
 }
 
-func NewTodoService() *TodoService {
+// NewTodoService returns an empty service; a zero stream.Heartbeat means
+// DefaultHeartbeat.
+func NewTodoService(stream TodoStreamOptions) *TodoService {
+	if stream.Heartbeat == 0 {
+		stream.Heartbeat = DefaultHeartbeat
+	}
 	return &TodoService{
-		todos:   []*pb.Todo{},
-		streams: []chan *pb.Todo{},
+		todos:     map[string]*pb.TodoEvent{},
+		events:    broker.NewLog[*pb.TodoEvent](todoEventLogSize),
+		epoch:     strconv.FormatInt(time.Now().UnixNano(), 36),
+		changed:   broker.New[*pb.TodoEvent](stream.Queue),
+		heartbeat: stream.Heartbeat,
 	}
 }
 
-func (s *TodoService) CreateTodo(ctx context.Context, req *pb.CreateTodoRequest) (*pb.CreateTodoResponse, error) {
+// Connect shares the service's todo changes with the other instances on b,
+// and applies theirs. Changes made before are not shared.
+func (s *TodoService) Connect(b bus.Bus) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, err := b.Subscribe(todoSubject, s.receive); err != nil {
+		return fmt.Errorf("failed to subscribe to %s: %w", todoSubject, err)
+	}
+	s.bus = b
+	return nil
+}
+
+// receive applies a change from another instance. Changes arrive in the
+// order their instance made them, and one that no longer applies here,
+// such as completing a todo deleted meanwhile, is ignored.
+func (s *TodoService) receive(msg *bus.Msg) {
+	event := &pb.TodoEvent{}
+	if err := proto.Unmarshal(msg.Data, event); err != nil {
+		log.Printf("Ignoring malformed todo change: %v", err)
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.applies(event.GetType(), event.GetTodo()) {
+		s.publish(event.GetType(), event.GetTodo())
+	}
+}
+
+// applies returns whether a change to todo still applies to the current
+// todos. Must be called with s.mu held.
+func (s *TodoService) applies(typ pb.TodoEvent_Type, todo *pb.Todo) bool {
+	current, ok := s.todos[todo.GetId()]
+	switch typ {
+	case pb.TodoEvent_CREATED:
+		return !ok
+	case pb.TodoEvent_COMPLETED:
+		return ok && !current.GetTodo().GetCompleted()
+	case pb.TodoEvent_DELETED:
+		return ok
+	}
+	return false
+}
+
+// current returns the last event that changed the todo with id
+func (s *TodoService) current(id string) (*pb.TodoEvent, bool) {
 	s.mu.Lock()
 	defer s.mu.Unlock()
+	event, ok := s.todos[id]
+	return event, ok
+}
+
+func (s *TodoService) resumeToken(id uint64) string {
+	return fmt.Sprintf("%s.%d", s.epoch, id)
+}
+
+// change shares a change to todo on the bus, then publishes it here; when
+// the bus fails, the change is not made. Must be called with s.changeMu
+// held, so the bus carries changes in the order they are made. s.mu is only
+// taken once the bus has accepted the change, so a slow bus holds up other
+// changes made here but not streams or changes from other instances. One of
+// those may meanwhile delete the todo, and then the change fails NotFound.
+func (s *TodoService) change(typ pb.TodoEvent_Type, todo *pb.Todo) error {
+	s.mu.Lock()
+	sharer := s.bus
+	s.mu.Unlock()
+	if sharer != nil {
+		b, err := proto.Marshal(&pb.TodoEvent{Type: typ, Payload: &pb.TodoEvent_Todo{Todo: todo}})
+		if err == nil {
+			err = sharer.Publish(todoSubject, b)
+		}
+		if err != nil {
+			return status.Errorf(codes.Unavailable, "failed to share the todo change: %v", err)
+		}
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if !s.applies(typ, todo) {
+		return status.Errorf(codes.NotFound, "todo %q not found", todo.GetId())
+	}
+	s.publish(typ, todo)
+	return nil
+}
+
+// publish records a change to todo and sends it to the streams. Must be
+// called with s.mu held.
+func (s *TodoService) publish(typ pb.TodoEvent_Type, todo *pb.Todo) {
+	s.lastID++
+	event := &pb.TodoEvent{
+		Id:          s.lastID,
+		ResumeToken: s.resumeToken(s.lastID),
+		Payload:     &pb.TodoEvent_Todo{Todo: todo},
+		Type:        typ,
+	}
+	if typ == pb.TodoEvent_DELETED {
+		delete(s.todos, todo.GetId())
+	} else {
+		s.todos[todo.GetId()] = event
+	}
+	s.events.Append(event.Id, event)
+	s.changed.Publish(event)
+}
+
+func (s *TodoService) CreateTodo(ctx context.Context, req *pb.CreateTodoRequest) (*pb.CreateTodoResponse, error) {
+	s.changeMu.Lock()
+	defer s.changeMu.Unlock()
 
 	todo := &pb.Todo{
 		Id:        uuid.New().String(),
 		Title:     req.GetTitle(),
 		Completed: false,
 	}
-	s.todos = append(s.todos, todo)
-
-	for _, stream := range s.streams {
-		stream <- todo
+	if err := s.change(pb.TodoEvent_CREATED, todo); err != nil {
+		return nil, err
 	}
 
 	return &pb.CreateTodoResponse{Todo: todo}, nil
 }
 
+// CompleteTodo marks a todo completed; completing it again changes nothing
+func (s *TodoService) CompleteTodo(ctx context.Context, req *pb.CompleteTodoRequest) (*pb.CompleteTodoResponse, error) {
+	s.changeMu.Lock()
+	defer s.changeMu.Unlock()
+
+	current, ok := s.current(req.GetId())
+	if !ok {
+		return nil, status.Errorf(codes.NotFound, "todo %q not found", req.GetId())
+	}
+	if current.GetTodo().GetCompleted() {
+		return &pb.CompleteTodoResponse{Todo: current.GetTodo()}, nil
+	}
+	// Events already sent hold the old todo, so change a copy
+	todo := proto.Clone(current.GetTodo()).(*pb.Todo)
+	todo.Completed = true
+	if err := s.change(pb.TodoEvent_COMPLETED, todo); err != nil {
+		return nil, err
+	}
+
+	return &pb.CompleteTodoResponse{Todo: todo}, nil
+}
+
+func (s *TodoService) DeleteTodo(ctx context.Context, req *pb.DeleteTodoRequest) (*pb.DeleteTodoResponse, error) {
+	s.changeMu.Lock()
+	defer s.changeMu.Unlock()
+
+	current, ok := s.current(req.GetId())
+	if !ok {
+		return nil, status.Errorf(codes.NotFound, "todo %q not found", req.GetId())
+	}
+	if err := s.change(pb.TodoEvent_DELETED, current.GetTodo()); err != nil {
+		return nil, err
+	}
+
+	return &pb.DeleteTodoResponse{Success: true}, nil
+}
+
 func (s *TodoService) StreamTodos(req *pb.StreamTodosRequest, stream pb.TodoService_StreamTodosServer) error {
+	// Take the backlog and subscribe together so each event is sent exactly once
 	s.mu.Lock()
-	ch := make(chan *pb.Todo, 10) // Buffered channel
-	s.streams = append(s.streams, ch)
+	backlog, err := s.backlog(req.GetResumeToken())
+	if err != nil {
+		s.mu.Unlock()
+		return err
+	}
+	sub := s.changed.Subscribe()
+	// The backlog runs up to lastID; heartbeats resume from the last event sent
+	position := s.lastID
 	s.mu.Unlock()
 
 	defer func() {
-		s.mu.Lock()
-		// Remove the channel from the streams slice
-		for i, c := range s.streams {
-			if c == ch {
-				s.streams = append(s.streams[:i], s.streams[i+1:]...)
-				break
-			}
-		}
-		close(ch)
-		s.mu.Unlock()
+		sub.Close()
 		log.Println("Closing stream")
 	}()
+	// Send headers now, so clients learn the stream is open before its
+	// first event
+	if err := stream.SendHeader(nil); err != nil {
+		return err
+	}
 
-	// Send existing todos
-	for _, todo := range s.todos {
-		if err := stream.Send(todo); err != nil {
+	match := todoFilter(req)
+	for _, event := range backlog {
+		if !match(event) {
+			continue
+		}
+		if err := stream.Send(event); err != nil {
 			log.Printf("Error sending existing todo to stream: %v", err)
 			return err
 		}
 	}
 
+	// One timer, reset after every send, so heartbeats only go to idle streams
+	idle := time.NewTimer(s.heartbeat)
+	defer idle.Stop()
+	var heartbeats <-chan time.Time
+	if s.heartbeat > 0 {
+		heartbeats = idle.C
+	}
 	for {
 		select {
 		case <-stream.Context().Done():
 			log.Println("Stream context done")
 			return nil
-		case todo := <-ch:
-			log.Printf("Sending new todo to stream: %v", todo.Title)
-			if err := stream.Send(todo); err != nil {
-				log.Printf("Error sending new todo to stream: %v", err)
+		case event, ok := <-sub.C():
+			if !ok {
+				return streamEnded(sub.Err())
+			}
+			// Filtered out events still move the position heartbeats resume from
+			position = event.GetId()
+			if !match(event) {
+				continue
+			}
+			log.Printf("Sending %v todo to stream: %v", event.GetType(), event.GetTodo().GetTitle())
+			if err := stream.Send(event); err != nil {
+				log.Printf("Error sending todo event to stream: %v", err)
 				return err
 			}
-		case <-time.After(30 * time.Second):
-			// Keep alive
-			if err := stream.Send(&pb.Todo{}); err != nil {
-				log.Printf("Failed to send keep-alive: %v, closing stream", err)
+		case now := <-heartbeats:
+			if err := stream.Send(s.heartbeatEvent(position, now)); err != nil {
+				log.Printf("Failed to send heartbeat: %v, closing stream", err)
 				return err
 			}
 		}
+		if s.heartbeat > 0 {
+			idle.Reset(s.heartbeat)
+		}
+	}
+}
+
+// heartbeatEvent returns a heartbeat for a stream that has sent every event
+// up to position
+func (s *TodoService) heartbeatEvent(position uint64, now time.Time) *pb.TodoEvent {
+	return &pb.TodoEvent{
+		Id:          position,
+		ResumeToken: s.resumeToken(position),
+		Payload:     &pb.TodoEvent_Heartbeat{Heartbeat: &pb.Heartbeat{Time: timestamppb.New(now)}},
+	}
+}
+
+// todoFilter returns whether an event matches the filters of req
+func todoFilter(req *pb.StreamTodosRequest) func(*pb.TodoEvent) bool {
+	title := strings.ToLower(req.GetTitleContains())
+	return func(event *pb.TodoEvent) bool {
+		if types := req.GetTypes(); len(types) > 0 && !slices.Contains(types, event.GetType()) {
+			return false
+		}
+		return strings.Contains(strings.ToLower(event.GetTodo().GetTitle()), title)
+	}
+}
+
+// backlog returns the events a stream starts with: those after the resume
+// token, or without one the last event of each current todo, in order.
+// Must be called with s.mu held.
+func (s *TodoService) backlog(token string) ([]*pb.TodoEvent, error) {
+	if token == "" {
+		events := slices.Collect(maps.Values(s.todos))
+		slices.SortFunc(events, func(a, b *pb.TodoEvent) int { return cmp.Compare(a.GetId(), b.GetId()) })
+		return events, nil
+	}
+	epoch, id, ok := strings.Cut(token, ".")
+	after, err := strconv.ParseUint(id, 10, 64)
+	if !ok || err != nil {
+		return nil, status.Errorf(codes.InvalidArgument, "malformed resume token %q", token)
+	}
+	entries, ok := s.events.Since(after)
+	if epoch != s.epoch || !ok {
+		return nil, status.Error(codes.OutOfRange, "resume token expired; reconnect without it for the current todos")
+	}
+	events := make([]*pb.TodoEvent, len(entries))
+	for i, e := range entries {
+		events[i] = e.Value
+	}
+	return events, nil
+}
+
+// streamEnded maps the reason the broker ended a subscription to a status
+func streamEnded(err error) error {
+	if errors.Is(err, broker.ErrSlowConsumer) {
+		return status.Error(codes.ResourceExhausted, "stream fell too far behind; reconnect with the last resume token")
 	}
+	return status.Error(codes.Unavailable, "stream closed by the server")
 }
@@ -0,0 +1,478 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"grpc_anotation_sample/internal/broker"
+	"grpc_anotation_sample/internal/bus"
+	"grpc_anotation_sample/pb"
+	"net"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"google.golang.org/grpc/test/bufconn"
+)
+
+// dialTodoService starts svc on an in-memory listener and returns a client for it.
+func dialTodoService(t *testing.T, svc *TodoService) pb.TodoServiceClient {
+	t.Helper()
+	lis := bufconn.Listen(1024 * 1024)
+	grpcServer := grpc.NewServer()
+	pb.RegisterTodoServiceServer(grpcServer, svc)
+	go grpcServer.Serve(lis)
+	t.Cleanup(grpcServer.Stop)
+
+	conn, err := grpc.NewClient("passthrough:///bufnet",
+		grpc.WithContextDialer(func(ctx context.Context, _ string) (net.Conn, error) {
+			return lis.DialContext(ctx)
+		}),
+		grpc.WithTransportCredentials(insecure.NewCredentials()),
+	)
+	if err != nil {
+		t.Fatalf("failed to dial bufconn: %v", err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	return pb.NewTodoServiceClient(conn)
+}
+
+func TestStreamTodos(t *testing.T) {
+	client := dialTodoService(t, NewTodoService(TodoStreamOptions{}))
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	if _, err := client.CreateTodo(ctx, &pb.CreateTodoRequest{Title: "existing"}); err != nil {
+		t.Fatalf("CreateTodo returned error: %v", err)
+	}
+	stream, err := client.StreamTodos(ctx, &pb.StreamTodosRequest{})
+	if err != nil {
+		t.Fatalf("StreamTodos returned error: %v", err)
+	}
+	if event, err := stream.Recv(); err != nil || event.GetTodo().GetTitle() != "existing" || event.GetId() != 1 {
+		t.Fatalf("first message = %v, %v; want the existing todo", event, err)
+	}
+	if _, err := client.CreateTodo(ctx, &pb.CreateTodoRequest{Title: "new"}); err != nil {
+		t.Fatalf("CreateTodo returned error: %v", err)
+	}
+	if event, err := stream.Recv(); err != nil || event.GetTodo().GetTitle() != "new" || event.GetId() != 2 {
+		t.Errorf("second message = %v, %v; want the new todo", event, err)
+	}
+}
+
+// Todos created while streams open are sent to each stream exactly once,
+// either in its snapshot or as an update.
+func TestStreamTodosExactlyOnce(t *testing.T) {
+	const creates, streams = 50, 5
+	client := dialTodoService(t, NewTodoService(TodoStreamOptions{Queue: broker.Options{QueueSize: creates}}))
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	var wg sync.WaitGroup
+	results := make(chan map[string]int, streams)
+	for i := 0; i < streams; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			stream, err := client.StreamTodos(ctx, &pb.StreamTodosRequest{})
+			if err != nil {
+				t.Errorf("StreamTodos returned error: %v", err)
+				return
+			}
+			seen := map[string]int{}
+			for len(seen) < creates {
+				event, err := stream.Recv()
+				if err != nil {
+					t.Errorf("Recv after %d todos: %v", len(seen), err)
+					return
+				}
+				seen[event.GetTodo().GetId()]++
+			}
+			results <- seen
+		}()
+	}
+	for i := 0; i < creates; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			if _, err := client.CreateTodo(ctx, &pb.CreateTodoRequest{Title: fmt.Sprint(i)}); err != nil {
+				t.Errorf("CreateTodo returned error: %v", err)
+			}
+		}(i)
+	}
+	wg.Wait()
+	close(results)
+
+	for seen := range results {
+		for id, n := range seen {
+			if n != 1 {
+				t.Errorf("todo %s sent %d times", id, n)
+			}
+		}
+	}
+}
+
+func TestStreamTodosResume(t *testing.T) {
+	svc := NewTodoService(TodoStreamOptions{})
+	client := dialTodoService(t, svc)
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	create := func(title string) {
+		t.Helper()
+		if _, err := client.CreateTodo(ctx, &pb.CreateTodoRequest{Title: title}); err != nil {
+			t.Fatalf("CreateTodo returned error: %v", err)
+		}
+	}
+	titles := func(stream pb.TodoService_StreamTodosClient, n int) (got string, last *pb.TodoEvent) {
+		t.Helper()
+		for i := 0; i < n; i++ {
+			event, err := stream.Recv()
+			if err != nil {
+				t.Fatalf("Recv returned error: %v", err)
+			}
+			got, last = got+event.GetTodo().GetTitle(), event
+		}
+		return got, last
+	}
+
+	create("a")
+	create("b")
+	create("c")
+	first, _ := client.StreamTodos(ctx, &pb.StreamTodosRequest{})
+	got, last := titles(first, 2) // disconnect part way through the snapshot
+	if got != "ab" || last.GetResumeToken() == "" {
+		t.Fatalf("snapshot = %q, last event %v", got, last)
+	}
+
+	create("d")
+	resumed, _ := client.StreamTodos(ctx, &pb.StreamTodosRequest{ResumeToken: last.GetResumeToken()})
+	if got, _ := titles(resumed, 2); got != "cd" {
+		t.Errorf("resumed stream = %q, want the rest of the snapshot and the new todo", got)
+	}
+	create("e")
+	if got, event := titles(resumed, 1); got != "e" || event.GetId() != 5 {
+		t.Errorf("live event = %v", event)
+	}
+
+	// An event that has left the log can no longer be resumed from
+	for i := 0; i < todoEventLogSize; i++ {
+		svc.CreateTodo(ctx, &pb.CreateTodoRequest{Title: "x"})
+	}
+	tests := []struct {
+		token string
+		code  codes.Code
+	}{
+		{last.GetResumeToken(), codes.OutOfRange},
+		{"earlier-process.3", codes.OutOfRange},
+		{svc.epoch + ".99999", codes.OutOfRange},
+		{"nonsense", codes.InvalidArgument},
+	}
+	for _, tt := range tests {
+		stream, err := client.StreamTodos(ctx, &pb.StreamTodosRequest{ResumeToken: tt.token})
+		if err == nil {
+			_, err = stream.Recv()
+		}
+		if status.Code(err) != tt.code {
+			t.Errorf("resume from %q = %v, want %v", tt.token, err, tt.code)
+		}
+	}
+}
+
+func TestCompleteAndDeleteTodo(t *testing.T) {
+	svc := NewTodoService(TodoStreamOptions{})
+	client := dialTodoService(t, svc)
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	ids := map[string]string{}
+	for _, title := range []string{"Buy milk", "Walk dog", "buy bread"} {
+		resp, err := client.CreateTodo(ctx, &pb.CreateTodoRequest{Title: title})
+		if err != nil {
+			t.Fatalf("CreateTodo returned error: %v", err)
+		}
+		ids[title] = resp.GetTodo().GetId()
+	}
+	for i := 0; i < 2; i++ { // completing twice is not an error
+		resp, err := client.CompleteTodo(ctx, &pb.CompleteTodoRequest{Id: ids["Buy milk"]})
+		if err != nil || !resp.GetTodo().GetCompleted() {
+			t.Fatalf("CompleteTodo = %v, %v", resp, err)
+		}
+	}
+	if _, err := client.DeleteTodo(ctx, &pb.DeleteTodoRequest{Id: ids["Walk dog"]}); err != nil {
+		t.Fatalf("DeleteTodo returned error: %v", err)
+	}
+	if _, err := client.DeleteTodo(ctx, &pb.DeleteTodoRequest{Id: ids["Walk dog"]}); status.Code(err) != codes.NotFound {
+		t.Errorf("DeleteTodo of a deleted todo = %v, want NotFound", err)
+	}
+	if _, err := client.CompleteTodo(ctx, &pb.CompleteTodoRequest{Id: "missing"}); status.Code(err) != codes.NotFound {
+		t.Errorf("CompleteTodo of a missing todo = %v, want NotFound", err)
+	}
+
+	tests := []struct {
+		name string
+		req  *pb.StreamTodosRequest
+		want string
+	}{
+		{"snapshot", &pb.StreamTodosRequest{}, "buy bread CREATED 3, Buy milk COMPLETED 4"},
+		{"title", &pb.StreamTodosRequest{TitleContains: "MILK"}, "Buy milk COMPLETED 4"},
+		{"types", &pb.StreamTodosRequest{Types: []pb.TodoEvent_Type{pb.TodoEvent_CREATED}}, "buy bread CREATED 3"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			stream, err := client.StreamTodos(ctx, tt.req)
+			if err != nil {
+				t.Fatalf("StreamTodos returned error: %v", err)
+			}
+			var got []string
+			for range strings.Count(tt.want, ",") + 1 {
+				event, err := stream.Recv()
+				if err != nil {
+					t.Fatalf("Recv returned error: %v", err)
+				}
+				got = append(got, fmt.Sprintf("%s %v %d", event.GetTodo().GetTitle(), event.GetType(), event.GetId()))
+			}
+			if strings.Join(got, ", ") != tt.want {
+				t.Errorf("events = %q, want %q", got, tt.want)
+			}
+		})
+	}
+
+	// Resuming replays every change, deletions included
+	stream, _ := client.StreamTodos(ctx, &pb.StreamTodosRequest{
+		ResumeToken: svc.resumeToken(1),
+		Types:       []pb.TodoEvent_Type{pb.TodoEvent_DELETED},
+	})
+	if _, err := client.DeleteTodo(ctx, &pb.DeleteTodoRequest{Id: ids["buy bread"]}); err != nil {
+		t.Fatalf("DeleteTodo returned error: %v", err)
+	}
+	for _, want := range []string{"Walk dog", "buy bread"} {
+		if event, err := stream.Recv(); err != nil || event.GetType() != pb.TodoEvent_DELETED || event.GetTodo().GetTitle() != want {
+			t.Errorf("event = %v, %v; want %s deleted", event, err, want)
+		}
+	}
+}
+
+func TestStreamTodosHeartbeat(t *testing.T) {
+	client := dialTodoService(t, NewTodoService(TodoStreamOptions{Heartbeat: 20 * time.Millisecond}))
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if _, err := client.CreateTodo(ctx, &pb.CreateTodoRequest{Title: "a"}); err != nil {
+		t.Fatalf("CreateTodo returned error: %v", err)
+	}
+	stream, err := client.StreamTodos(ctx, &pb.StreamTodosRequest{})
+	if err != nil {
+		t.Fatalf("StreamTodos returned error: %v", err)
+	}
+	todo, err := stream.Recv()
+	if err != nil || todo.GetTodo() == nil {
+		t.Fatalf("first event = %v, %v; want the todo", todo, err)
+	}
+
+	// An idle stream gets heartbeats that resume after the last todo
+	for i := 0; i < 2; i++ {
+		event, err := stream.Recv()
+		if err != nil {
+			t.Fatalf("Recv returned error: %v", err)
+		}
+		if event.GetHeartbeat().GetTime() == nil {
+			t.Fatalf("idle event = %v, want a heartbeat", event)
+		}
+		if event.GetId() != todo.GetId() || event.GetResumeToken() != todo.GetResumeToken() {
+			t.Errorf("heartbeat at %d (%q), want the position of the todo %d (%q)",
+				event.GetId(), event.GetResumeToken(), todo.GetId(), todo.GetResumeToken())
+		}
+	}
+}
+
+// blockedStream is a StreamTodos server stream whose Send waits for release
+type blockedStream struct {
+	grpc.ServerStream
+	ctx     context.Context
+	release chan struct{}
+}
+
+func (s *blockedStream) Context() context.Context { return s.ctx }
+
+func (s *blockedStream) SendHeader(metadata.MD) error { return nil }
+
+func (s *blockedStream) Send(*pb.TodoEvent) error {
+	<-s.release
+	return nil
+}
+
+func TestSlowStreamDoesNotBlockCreate(t *testing.T) {
+	svc := NewTodoService(TodoStreamOptions{Queue: broker.Options{QueueSize: 2, Policy: broker.Disconnect}})
+	if _, err := svc.CreateTodo(context.Background(), &pb.CreateTodoRequest{Title: "existing"}); err != nil {
+		t.Fatal(err)
+	}
+	slow := &blockedStream{ctx: context.Background(), release: make(chan struct{})}
+	done := make(chan error, 1)
+	go func() { done <- svc.StreamTodos(&pb.StreamTodosRequest{}, slow) }()
+
+	// Wait for the stream to subscribe; it then blocks sending the snapshot
+	for svc.changed.Len() == 0 {
+		time.Sleep(time.Millisecond)
+	}
+	created := make(chan struct{})
+	go func() {
+		for i := 0; i < 10; i++ {
+			svc.CreateTodo(context.Background(), &pb.CreateTodoRequest{Title: fmt.Sprint(i)})
+		}
+		close(created)
+	}()
+	select {
+	case <-created:
+	case <-time.After(5 * time.Second):
+		t.Fatal("CreateTodo blocked on a slow stream")
+	}
+
+	close(slow.release)
+	select {
+	case err := <-done:
+		if status.Code(err) != codes.ResourceExhausted {
+			t.Errorf("StreamTodos = %v, want ResourceExhausted", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("slow stream was not disconnected")
+	}
+}
+
+func TestTodoServiceBus(t *testing.T) {
+	hub := bus.NewHub()
+	a, b := NewTodoService(TodoStreamOptions{}), NewTodoService(TodoStreamOptions{})
+	for _, svc := range []*TodoService{a, b} {
+		if err := svc.Connect(hub.Connect()); err != nil {
+			t.Fatalf("Connect returned error: %v", err)
+		}
+	}
+	clientA, clientB := dialTodoService(t, a), dialTodoService(t, b)
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	// Changes made through either instance reach the streams of both
+	stream, err := clientB.StreamTodos(ctx, &pb.StreamTodosRequest{})
+	if err != nil {
+		t.Fatalf("StreamTodos returned error: %v", err)
+	}
+	created, err := clientA.CreateTodo(ctx, &pb.CreateTodoRequest{Title: "Buy milk"})
+	if err != nil {
+		t.Fatalf("CreateTodo returned error: %v", err)
+	}
+	id := created.GetTodo().GetId()
+	if event, err := stream.Recv(); err != nil || event.GetType() != pb.TodoEvent_CREATED || event.GetTodo().GetId() != id {
+		t.Fatalf("event = %v, %v; want the todo created on the other instance", event, err)
+	}
+	if _, err := clientB.CompleteTodo(ctx, &pb.CompleteTodoRequest{Id: id}); err != nil {
+		t.Fatalf("CompleteTodo returned error: %v", err)
+	}
+	if event, err := stream.Recv(); err != nil || event.GetType() != pb.TodoEvent_COMPLETED {
+		t.Fatalf("event = %v, %v; want the completion", event, err)
+	}
+
+	// Both instances end up with the same todos
+	streamA, _ := clientA.StreamTodos(ctx, &pb.StreamTodosRequest{Types: []pb.TodoEvent_Type{pb.TodoEvent_COMPLETED}})
+	if event, err := streamA.Recv(); err != nil || event.GetTodo().GetId() != id {
+		t.Fatalf("event = %v, %v; want the todo completed on the other instance", event, err)
+	}
+	if _, err := clientA.DeleteTodo(ctx, &pb.DeleteTodoRequest{Id: id}); err != nil {
+		t.Fatalf("DeleteTodo returned error: %v", err)
+	}
+	if event, err := stream.Recv(); err != nil || event.GetType() != pb.TodoEvent_DELETED {
+		t.Fatalf("event = %v, %v; want the deletion", event, err)
+	}
+	if _, err := clientB.DeleteTodo(ctx, &pb.DeleteTodoRequest{Id: id}); status.Code(err) != codes.NotFound {
+		t.Errorf("DeleteTodo of a todo deleted elsewhere = %v, want NotFound", err)
+	}
+}
+
+// slowBus holds each message until released
+type slowBus struct {
+	bus.Bus
+	entered, release chan struct{}
+}
+
+func (b slowBus) Publish(subject string, data []byte) error {
+	b.entered <- struct{}{}
+	<-b.release
+	return b.Bus.Publish(subject, data)
+}
+
+func TestSlowBusDoesNotBlockStreams(t *testing.T) {
+	hub := bus.NewHub()
+	slow := slowBus{Bus: hub.Connect(), entered: make(chan struct{}), release: make(chan struct{})}
+	a, b := NewTodoService(TodoStreamOptions{}), NewTodoService(TodoStreamOptions{})
+	if err := a.Connect(slow); err != nil {
+		t.Fatalf("Connect returned error: %v", err)
+	}
+	if err := b.Connect(hub.Connect()); err != nil {
+		t.Fatalf("Connect returned error: %v", err)
+	}
+	clientA, clientB := dialTodoService(t, a), dialTodoService(t, b)
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	created, err := clientB.CreateTodo(ctx, &pb.CreateTodoRequest{Title: "Buy milk"})
+	if err != nil {
+		t.Fatalf("CreateTodo returned error: %v", err)
+	}
+	id := created.GetTodo().GetId()
+	for _, ok := a.current(id); !ok; _, ok = a.current(id) {
+		time.Sleep(time.Millisecond)
+	}
+	done := make(chan error, 1)
+	go func() {
+		_, err := clientA.CompleteTodo(ctx, &pb.CompleteTodoRequest{Id: id})
+		done <- err
+	}()
+	<-slow.entered
+
+	// While the bus holds the completion, streams open and changes from
+	// other instances apply
+	stream, err := clientA.StreamTodos(ctx, &pb.StreamTodosRequest{})
+	if err != nil {
+		t.Fatalf("StreamTodos returned error: %v", err)
+	}
+	if event, err := stream.Recv(); err != nil || event.GetType() != pb.TodoEvent_CREATED {
+		t.Fatalf("event = %v, %v; want the todo", event, err)
+	}
+	if _, err := clientB.DeleteTodo(ctx, &pb.DeleteTodoRequest{Id: id}); err != nil {
+		t.Fatalf("DeleteTodo returned error: %v", err)
+	}
+	if event, err := stream.Recv(); err != nil || event.GetType() != pb.TodoEvent_DELETED {
+		t.Fatalf("event = %v, %v; want the deletion", event, err)
+	}
+
+	// The completion no longer applies once the bus accepts it
+	close(slow.release)
+	if err := <-done; status.Code(err) != codes.NotFound {
+		t.Errorf("CompleteTodo of a todo deleted meanwhile = %v, want NotFound", err)
+	}
+	if _, ok := a.current(id); ok {
+		t.Error("completion brought back a deleted todo")
+	}
+}
+
+// failingBus accepts subscriptions but no messages
+type failingBus struct{ bus.Bus }
+
+func (failingBus) Subscribe(string, bus.Handler) (bus.Subscription, error) { return nil, nil }
+func (failingBus) Publish(string, []byte) error                            { return errors.New("bus down") }
+
+func TestTodoServiceBusDown(t *testing.T) {
+	svc := NewTodoService(TodoStreamOptions{})
+	svc.Connect(failingBus{})
+	client := dialTodoService(t, svc)
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if _, err := client.CreateTodo(ctx, &pb.CreateTodoRequest{Title: "lost"}); status.Code(err) != codes.Unavailable {
+		t.Errorf("CreateTodo = %v, want Unavailable", err)
+	}
+	if len(svc.todos) != 0 {
+		t.Errorf("todos = %v, want the unshared change not made", svc.todos)
+	}
+}
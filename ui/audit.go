@@ -0,0 +1,174 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// AuditEntry is one line of the audit log: who did what to which service,
+// and how it ended (ok, failed, refused by the breaking-change guard, invalid, denied).
+type AuditEntry struct {
+	Time    time.Time       `json:"time"`
+	User    string          `json:"user"`
+	Role    string          `json:"role,omitempty"`
+	Remote  string          `json:"remote,omitempty"`
+	Action  string          `json:"action"`
+	Service string          `json:"service,omitempty"`
+	Target  string          `json:"target,omitempty"`
+	Method  string          `json:"method,omitempty"`
+	Path    string          `json:"path,omitempty"`
+	Request json.RawMessage `json:"request,omitempty"`
+	Status  int             `json:"status,omitempty"`
+	Result  string          `json:"result"`
+	Error   string          `json:"error,omitempty"`
+}
+
+// describe names the change r makes. Service and Target come from the URL
+// (/api/services/{name}/fields/{field}) or the request body.
+func (e *AuditEntry) describe(r *http.Request, body []byte) {
+	var req struct {
+		ServiceName string `json:"serviceName"`
+		RpcName     string `json:"rpcName"`
+		FieldName   string `json:"fieldName"`
+		Service     string `json:"service"`
+		Method      string `json:"method"`
+		NewName     string `json:"newName"`
+	}
+	json.Unmarshal(body, &req)
+	// Console metadata may carry credentials, so it is never logged
+	var fields map[string]json.RawMessage
+	if json.Unmarshal(body, &fields) == nil {
+		delete(fields, "metadata")
+		e.Request, _ = json.Marshal(fields)
+	}
+
+	parts := strings.Split(strings.Trim(strings.TrimPrefix(r.URL.Path, "/api/services/"), "/"), "/")
+	switch {
+	case r.URL.Path == "/api/services" && r.Method == "POST":
+		e.Action, e.Service = "create-service", req.ServiceName
+	case r.URL.Path == "/api/rpc":
+		e.Action, e.Service, e.Target = "add-rpc", req.ServiceName, req.RpcName
+	case r.URL.Path == "/api/nested":
+		e.Action, e.Service, e.Target = "add-nested", req.ServiceName, req.FieldName
+	case r.URL.Path == "/api/console/invoke":
+		e.Action, e.Service, e.Target = "invoke", req.Service, req.Method
+	case r.URL.Path == "/api/logout":
+		e.Action = "logout"
+	case strings.HasPrefix(r.URL.Path, "/api/services/"):
+		e.Service = parts[0]
+		if len(parts) >= 3 {
+			e.Target = parts[2]
+		}
+		switch {
+		case len(parts) == 1:
+			e.Action = "remove-service"
+		case parts[1] == "fields" && r.Method == "DELETE":
+			e.Action = "remove-field"
+		case parts[1] == "fields" && req.NewName != "":
+			e.Action = "rename-field"
+		case parts[1] == "fields":
+			e.Action = "edit-field"
+		case len(parts) == 4 && parts[3] == "http":
+			e.Action = "set-http"
+		case parts[1] == "rpcs":
+			e.Action = "remove-rpc"
+		}
+	}
+	if e.Action == "" {
+		e.Action = strings.ToLower(r.Method) + " " + r.URL.Path
+	}
+}
+
+// AuditLog appends entries as JSON lines to a file opened in append-only mode.
+type AuditLog struct {
+	Path string
+	mu   sync.Mutex
+}
+
+// Record appends e. Failures are reported on stderr; they never fail the request.
+func (l *AuditLog) Record(e AuditEntry) {
+	if e.Time.IsZero() {
+		e.Time = time.Now().UTC()
+	}
+	line, err := json.Marshal(e)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "audit: %v\n", err)
+		return
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	f, err := os.OpenFile(l.Path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0o600)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "audit: %v\n", err)
+		return
+	}
+	defer f.Close()
+	if _, err := f.Write(append(line, '\n')); err != nil {
+		fmt.Fprintf(os.Stderr, "audit: %v\n", err)
+	}
+}
+
+// Tail returns the last n entries, newest first, optionally only those for service.
+func (l *AuditLog) Tail(n int, service string) ([]AuditEntry, error) {
+	f, err := os.Open(l.Path)
+	if os.IsNotExist(err) {
+		return []AuditEntry{}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var entries []AuditEntry
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(make([]byte, 0, 64<<10), 4<<20)
+	for scanner.Scan() {
+		var e AuditEntry
+		if json.Unmarshal(scanner.Bytes(), &e) != nil {
+			continue
+		}
+		if service != "" && !strings.EqualFold(e.Service, service) {
+			continue
+		}
+		entries = append(entries, e)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	if len(entries) > n {
+		entries = entries[len(entries)-n:]
+	}
+	out := make([]AuditEntry, 0, len(entries))
+	for i := len(entries) - 1; i >= 0; i-- {
+		out = append(out, entries[i])
+	}
+	return out, nil
+}
+
+// handleAudit serves GET /api/audit?limit=100&service=Book
+func (l *AuditLog) handleAudit(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	if r.Method != "GET" {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	limit := 100
+	if v, err := strconv.Atoi(r.URL.Query().Get("limit")); err == nil && v > 0 {
+		limit = min(v, 1000)
+	}
+	entries, err := l.Tail(limit, r.URL.Query().Get("service"))
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		json.NewEncoder(w).Encode(map[string]string{"error": fmt.Sprintf("Failed to read audit log: %v", err)})
+		return
+	}
+	json.NewEncoder(w).Encode(map[string][]AuditEntry{"entries": entries})
+}
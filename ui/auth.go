@@ -0,0 +1,458 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+// Role grants access to the UI. Each role includes the rights of the ones before it.
+type Role int
+
+const (
+	// RoleViewer can list services, read docs and view the console
+	RoleViewer Role = iota + 1
+	// RoleEditor can also create services, add RPCs and fields, change types and call RPCs
+	RoleEditor
+	// RoleAdmin can also remove services, fields and RPCs, force breaking changes and read the audit log
+	RoleAdmin
+)
+
+var roleNames = map[Role]string{RoleViewer: "viewer", RoleEditor: "editor", RoleAdmin: "admin"}
+
+func (r Role) String() string { return roleNames[r] }
+
+func parseRole(s string) (Role, error) {
+	for role, name := range roleNames {
+		if name == s {
+			return role, nil
+		}
+	}
+	return 0, fmt.Errorf("unknown role %q (want viewer, editor or admin)", s)
+}
+
+const (
+	sessionCookie = "sm_session"
+	csrfCookie    = "sm_csrf"
+	csrfHeader    = "X-CSRF-Token"
+	sessionTTL    = 12 * time.Hour
+)
+
+// User is one line of the users file: "name role bcrypt-hash".
+type User struct {
+	Name string
+	Role Role
+	Hash []byte
+}
+
+var userName = regexp.MustCompile(`^[A-Za-z0-9_.@-]+$`)
+
+// loadUsers reads the users file. Blank lines and lines starting with # are ignored.
+func loadUsers(path string) (map[string]User, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	users := map[string]User{}
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for n := 1; scanner.Scan(); n++ {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		parts := strings.Fields(line)
+		if len(parts) != 3 || !userName.MatchString(parts[0]) {
+			return nil, fmt.Errorf("%s:%d: expected \"name role bcrypt-hash\"", path, n)
+		}
+		role, err := parseRole(parts[1])
+		if err != nil {
+			return nil, fmt.Errorf("%s:%d: %v", path, n, err)
+		}
+		users[parts[0]] = User{Name: parts[0], Role: role, Hash: []byte(parts[2])}
+	}
+	return users, scanner.Err()
+}
+
+// saveUser adds name to the users file, or replaces its role and password.
+func saveUser(path, name string, role Role, password string) error {
+	if !userName.MatchString(name) {
+		return fmt.Errorf("invalid user name %q: use letters, digits and _.@-", name)
+	}
+	if len(password) < 8 {
+		return errors.New("password must be at least 8 characters")
+	}
+	hash, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+	if err != nil {
+		return err
+	}
+	users, err := loadUsers(path)
+	if errors.Is(err, os.ErrNotExist) {
+		users = map[string]User{}
+	} else if err != nil {
+		return err
+	}
+	users[name] = User{Name: name, Role: role, Hash: hash}
+
+	names := make([]string, 0, len(users))
+	for n := range users {
+		names = append(names, n)
+	}
+	sort.Strings(names)
+	var b strings.Builder
+	b.WriteString("# Service Manager UI users: name role bcrypt-hash (roles: viewer, editor, admin)\n")
+	for _, n := range names {
+		fmt.Fprintf(&b, "%s %s %s\n", n, users[n].Role, users[n].Hash)
+	}
+	return os.WriteFile(path, []byte(b.String()), 0o600)
+}
+
+// ensureUsersFile creates the users file with an admin account on first start
+// and prints its generated password once.
+func ensureUsersFile(path string) error {
+	if _, err := os.Stat(path); !errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+	password := randomToken(12)
+	if err := saveUser(path, "admin", RoleAdmin, password); err != nil {
+		return err
+	}
+	fmt.Printf("🔑 Created %s with user \"admin\", password %q. Change it with: go run . useradd admin admin\n", path, password)
+	return nil
+}
+
+// runUserAdd implements `go run . useradd NAME ROLE`, reading the password from stdin.
+func runUserAdd(path string, args []string) error {
+	if len(args) != 2 {
+		return errors.New("usage: go run . useradd NAME viewer|editor|admin  (password is read from stdin)")
+	}
+	role, err := parseRole(args[1])
+	if err != nil {
+		return err
+	}
+	fmt.Fprintf(os.Stderr, "Password for %s: ", args[0])
+	line, err := bufio.NewReader(os.Stdin).ReadString('\n')
+	if err != nil && !errors.Is(err, io.EOF) {
+		return err
+	}
+	if err := saveUser(path, args[0], role, strings.TrimRight(line, "\r\n")); err != nil {
+		return err
+	}
+	fmt.Fprintf(os.Stderr, "Saved %s (%s) to %s\n", args[0], role, path)
+	return nil
+}
+
+func randomToken(n int) string {
+	b := make([]byte, n)
+	if _, err := rand.Read(b); err != nil {
+		panic(err)
+	}
+	return base64.RawURLEncoding.EncodeToString(b)
+}
+
+// Session is a logged-in user. CSRF is the token the client must echo in the
+// X-CSRF-Token header (and the sm_csrf cookie) on every state-changing request.
+type Session struct {
+	User    string
+	Role    Role
+	CSRF    string
+	Expires time.Time
+}
+
+// Auth holds the users file location and the in-memory sessions.
+type Auth struct {
+	UsersFile string
+	Audit     *AuditLog
+
+	mu       sync.Mutex
+	sessions map[string]*Session
+}
+
+func NewAuth(usersFile string, audit *AuditLog) *Auth {
+	return &Auth{UsersFile: usersFile, Audit: audit, sessions: map[string]*Session{}}
+}
+
+// dummyHash keeps logins for unknown users as slow as for known ones
+var dummyHash, _ = bcrypt.GenerateFromPassword([]byte("not-a-password"), bcrypt.DefaultCost)
+
+// login checks the credentials against the users file, which is re-read so
+// users added with useradd take effect without a restart.
+func (a *Auth) login(name, password string) (*Session, string, error) {
+	users, err := loadUsers(a.UsersFile)
+	if err != nil {
+		return nil, "", fmt.Errorf("failed to read users: %v", err)
+	}
+	user, ok := users[name]
+	hash := user.Hash
+	if !ok {
+		hash = dummyHash
+	}
+	if bcrypt.CompareHashAndPassword(hash, []byte(password)) != nil || !ok {
+		return nil, "", errors.New("invalid username or password")
+	}
+
+	token := randomToken(32)
+	s := &Session{User: user.Name, Role: user.Role, CSRF: randomToken(32), Expires: time.Now().Add(sessionTTL)}
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	for t, old := range a.sessions {
+		if time.Now().After(old.Expires) {
+			delete(a.sessions, t)
+		}
+	}
+	a.sessions[token] = s
+	return s, token, nil
+}
+
+func (a *Auth) session(r *http.Request) (*Session, string) {
+	c, err := r.Cookie(sessionCookie)
+	if err != nil {
+		return nil, ""
+	}
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	s, ok := a.sessions[c.Value]
+	if !ok || time.Now().After(s.Expires) {
+		delete(a.sessions, c.Value)
+		return nil, ""
+	}
+	return s, c.Value
+}
+
+func (a *Auth) logout(token string) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	delete(a.sessions, token)
+}
+
+type LoginRequest struct {
+	Username string `json:"username"`
+	Password string `json:"password"`
+}
+
+// MeResponse describes the logged-in user to the UI.
+type MeResponse struct {
+	User      string `json:"user"`
+	Role      string `json:"role"`
+	CSRFToken string `json:"csrfToken"`
+}
+
+func (a *Auth) handleLogin(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	if r.Method != "POST" {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	var req LoginRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(ServiceResponse{Success: false, Error: "Invalid JSON request"})
+		return
+	}
+	s, token, err := a.login(req.Username, req.Password)
+	if err != nil {
+		a.Audit.Record(AuditEntry{User: req.Username, Remote: r.RemoteAddr, Action: "login", Result: "denied", Error: err.Error()})
+		w.WriteHeader(http.StatusUnauthorized)
+		json.NewEncoder(w).Encode(ServiceResponse{Success: false, Error: err.Error()})
+		return
+	}
+	a.Audit.Record(AuditEntry{User: s.User, Role: s.Role.String(), Remote: r.RemoteAddr, Action: "login", Result: "ok"})
+
+	secure := r.TLS != nil
+	http.SetCookie(w, &http.Cookie{Name: sessionCookie, Value: token, Path: "/", Expires: s.Expires,
+		HttpOnly: true, Secure: secure, SameSite: http.SameSiteStrictMode})
+	// Readable by the page so it can echo the token in X-CSRF-Token
+	http.SetCookie(w, &http.Cookie{Name: csrfCookie, Value: s.CSRF, Path: "/", Expires: s.Expires,
+		Secure: secure, SameSite: http.SameSiteStrictMode})
+	json.NewEncoder(w).Encode(MeResponse{User: s.User, Role: s.Role.String(), CSRFToken: s.CSRF})
+}
+
+func (a *Auth) handleLogout(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	if _, token := a.session(r); token != "" {
+		a.logout(token)
+	}
+	for _, name := range []string{sessionCookie, csrfCookie} {
+		http.SetCookie(w, &http.Cookie{Name: name, Value: "", Path: "/", MaxAge: -1})
+	}
+	json.NewEncoder(w).Encode(ServiceResponse{Success: true, Message: "Logged out"})
+}
+
+func (a *Auth) handleMe(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	s, _ := a.session(r)
+	json.NewEncoder(w).Encode(MeResponse{User: s.User, Role: s.Role.String(), CSRFToken: s.CSRF})
+}
+
+func handleLoginPage(w http.ResponseWriter, _ *http.Request) {
+	content, err := staticFile("login.html")
+	if err != nil {
+		http.Error(w, "Failed to read login.html", http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "text/html")
+	w.Write(content)
+}
+
+// publicPaths are served without a session
+var publicPaths = map[string]bool{"/login": true, "/api/login": true}
+
+// requiredRole returns the role needed for r. Reads need a viewer, changes an
+// editor; removals, forced breaking changes and the audit log need an admin.
+func requiredRole(r *http.Request, body []byte) Role {
+	switch {
+	case r.URL.Path == "/api/audit":
+		return RoleAdmin
+	case r.Method == "GET" || r.Method == "HEAD" || r.URL.Path == "/api/logout":
+		return RoleViewer
+	case r.Method == "DELETE" || isForced(r, body):
+		return RoleAdmin
+	default:
+		return RoleEditor
+	}
+}
+
+// isForced reports whether the request asks to override the breaking-change guard
+func isForced(r *http.Request, body []byte) bool {
+	if forceParam(r) {
+		return true
+	}
+	var req struct {
+		Force bool `json:"force"`
+	}
+	return json.Unmarshal(body, &req) == nil && req.Force
+}
+
+// Middleware authenticates every request except the login page, checks the
+// CSRF token on state-changing requests and enforces roles. Changes are
+// written to the audit log with their outcome.
+func (a *Auth) Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if publicPaths[r.URL.Path] {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		s, _ := a.session(r)
+		if s == nil {
+			if strings.HasPrefix(r.URL.Path, "/api/") {
+				writeAuthError(w, http.StatusUnauthorized, "Login required")
+			} else {
+				http.Redirect(w, r, "/login", http.StatusSeeOther)
+			}
+			return
+		}
+
+		readOnly := r.Method == "GET" || r.Method == "HEAD"
+		var body []byte
+		if !readOnly {
+			if !validCSRF(r, s) {
+				writeAuthError(w, http.StatusForbidden, "Missing or invalid CSRF token; reload the page")
+				return
+			}
+			var err error
+			if body, err = io.ReadAll(io.LimitReader(r.Body, 1<<20)); err != nil {
+				writeAuthError(w, http.StatusBadRequest, "Failed to read request")
+				return
+			}
+			r.Body = io.NopCloser(bytes.NewReader(body))
+		}
+
+		entry := AuditEntry{User: s.User, Role: s.Role.String(), Remote: r.RemoteAddr, Method: r.Method, Path: r.URL.RequestURI()}
+		entry.describe(r, body)
+		if need := requiredRole(r, body); s.Role < need {
+			if !readOnly {
+				entry.Result, entry.Error = "denied", fmt.Sprintf("requires %s role", need)
+				a.Audit.Record(entry)
+			}
+			writeAuthError(w, http.StatusForbidden, fmt.Sprintf("Permission denied: this requires the %s role (you are %s)", need, s.Role))
+			return
+		}
+		if readOnly {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		rec := &responseRecorder{ResponseWriter: w, status: http.StatusOK}
+		next.ServeHTTP(rec, r)
+		entry.Status = rec.status
+		entry.Result, entry.Error = rec.outcome()
+		a.Audit.Record(entry)
+	})
+}
+
+func validCSRF(r *http.Request, s *Session) bool {
+	c, err := r.Cookie(csrfCookie)
+	header := r.Header.Get(csrfHeader)
+	if err != nil || header == "" {
+		return false
+	}
+	return subtle.ConstantTimeCompare([]byte(header), []byte(c.Value)) == 1 &&
+		subtle.ConstantTimeCompare([]byte(header), []byte(s.CSRF)) == 1
+}
+
+func writeAuthError(w http.ResponseWriter, status int, msg string) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(ServiceResponse{Success: false, Error: msg})
+}
+
+// responseRecorder keeps the status and the start of the body so the outcome
+// of a change can be audited.
+type responseRecorder struct {
+	http.ResponseWriter
+	status int
+	body   bytes.Buffer
+}
+
+func (r *responseRecorder) WriteHeader(status int) {
+	r.status = status
+	r.ResponseWriter.WriteHeader(status)
+}
+
+func (r *responseRecorder) Write(b []byte) (int, error) {
+	if room := 64<<10 - r.body.Len(); room > 0 {
+		r.body.Write(b[:min(len(b), room)])
+	}
+	return r.ResponseWriter.Write(b)
+}
+
+// outcome classifies the response: ok, refused (breaking change), invalid, denied or failed.
+func (r *responseRecorder) outcome() (string, string) {
+	var resp struct {
+		Success  *bool  `json:"success"`
+		Breaking bool   `json:"breaking"`
+		Error    string `json:"error"`
+	}
+	json.Unmarshal(r.body.Bytes(), &resp)
+	switch {
+	case resp.Breaking || r.status == http.StatusConflict:
+		return "refused", firstLine(resp.Error)
+	case r.status == http.StatusBadRequest:
+		return "invalid", firstLine(resp.Error)
+	case r.status >= 400 || (resp.Success != nil && !*resp.Success) || resp.Error != "":
+		return "failed", firstLine(resp.Error)
+	default:
+		return "ok", ""
+	}
+}
+
+func firstLine(s string) string {
+	s, _, _ = strings.Cut(s, "\n")
+	return s
+}
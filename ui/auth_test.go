@@ -0,0 +1,214 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// authServer serves a stub API behind the auth middleware with an admin, an
+// editor and a viewer account, all with password "password1".
+func authServer(t *testing.T) (*httptest.Server, *AuditLog) {
+	t.Helper()
+	dir := t.TempDir()
+	users := filepath.Join(dir, "users.txt")
+	for name, role := range map[string]Role{"ada": RoleAdmin, "ed": RoleEditor, "vi": RoleViewer} {
+		if err := saveUser(users, name, role, "password1"); err != nil {
+			t.Fatal(err)
+		}
+	}
+	audit := &AuditLog{Path: filepath.Join(dir, "audit.jsonl")}
+	auth := NewAuth(users, audit)
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/api/login", auth.handleLogin)
+	mux.HandleFunc("/api/me", auth.handleMe)
+	mux.HandleFunc("/api/audit", audit.handleAudit)
+	ok := func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(ServiceResponse{Success: true})
+	}
+	mux.HandleFunc("/api/services", ok)
+	mux.HandleFunc("/api/services/", ok)
+	mux.HandleFunc("/", ok)
+	srv := httptest.NewServer(auth.Middleware(mux))
+	t.Cleanup(srv.Close)
+	return srv, audit
+}
+
+// login logs in and returns a function that sends requests with the session
+// cookies and, unless csrf is empty, the X-CSRF-Token header.
+func login(t *testing.T, srv *httptest.Server, user string) (func(method, path, body, csrf string) *http.Response, string) {
+	t.Helper()
+	resp, err := http.Post(srv.URL+"/api/login", "application/json",
+		strings.NewReader(`{"username":"`+user+`","password":"password1"}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("login %s: %s", user, resp.Status)
+	}
+	var me MeResponse
+	json.NewDecoder(resp.Body).Decode(&me)
+	cookies := resp.Cookies()
+
+	return func(method, path, body, csrf string) *http.Response {
+		req, _ := http.NewRequest(method, srv.URL+path, strings.NewReader(body))
+		for _, c := range cookies {
+			req.AddCookie(c)
+		}
+		if csrf != "" {
+			req.Header.Set(csrfHeader, csrf)
+		}
+		resp, err := http.DefaultTransport.RoundTrip(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+		return resp
+	}, me.CSRFToken
+}
+
+func TestLoginRequired(t *testing.T) {
+	srv, _ := authServer(t)
+
+	req, _ := http.NewRequest("GET", srv.URL+"/", nil)
+	resp, err := http.DefaultTransport.RoundTrip(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp.StatusCode != http.StatusSeeOther || resp.Header.Get("Location") != "/login" {
+		t.Errorf("GET / without session = %s %s, want redirect to /login", resp.Status, resp.Header.Get("Location"))
+	}
+	if resp, _ := http.Get(srv.URL + "/api/services"); resp.StatusCode != http.StatusUnauthorized {
+		t.Errorf("GET /api/services without session = %s, want 401", resp.Status)
+	}
+
+	bad, _ := http.Post(srv.URL+"/api/login", "application/json", strings.NewReader(`{"username":"ada","password":"nope"}`))
+	if bad.StatusCode != http.StatusUnauthorized {
+		t.Errorf("login with a wrong password = %s, want 401", bad.Status)
+	}
+	unknown, _ := http.Post(srv.URL+"/api/login", "application/json", strings.NewReader(`{"username":"nobody","password":"password1"}`))
+	if unknown.StatusCode != http.StatusUnauthorized {
+		t.Errorf("login as an unknown user = %s, want 401", unknown.Status)
+	}
+}
+
+func TestCSRFAndRoles(t *testing.T) {
+	srv, audit := authServer(t)
+	admin, adminCSRF := login(t, srv, "ada")
+	editor, editorCSRF := login(t, srv, "ed")
+	viewer, viewerCSRF := login(t, srv, "vi")
+
+	tests := []struct {
+		name   string
+		send   func(method, path, body, csrf string) *http.Response
+		method string
+		path   string
+		body   string
+		csrf   string
+		want   int
+	}{
+		{"viewer reads", viewer, "GET", "/api/services", "", "", http.StatusOK},
+		{"no CSRF token", admin, "POST", "/api/services", `{"serviceName":"Book"}`, "", http.StatusForbidden},
+		{"another session's token", admin, "POST", "/api/services", `{"serviceName":"Book"}`, editorCSRF, http.StatusForbidden},
+		{"viewer creates", viewer, "POST", "/api/services", `{"serviceName":"Book"}`, viewerCSRF, http.StatusForbidden},
+		{"editor creates", editor, "POST", "/api/services", `{"serviceName":"Book"}`, editorCSRF, http.StatusOK},
+		{"editor forces", editor, "POST", "/api/services", `{"serviceName":"Book","force":true}`, editorCSRF, http.StatusForbidden},
+		{"editor removes", editor, "DELETE", "/api/services/Book", "", editorCSRF, http.StatusForbidden},
+		{"admin removes", admin, "DELETE", "/api/services/Book?force=1", "", adminCSRF, http.StatusOK},
+		{"editor reads audit", editor, "GET", "/api/audit", "", "", http.StatusForbidden},
+		{"admin reads audit", admin, "GET", "/api/audit", "", "", http.StatusOK},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if resp := tt.send(tt.method, tt.path, tt.body, tt.csrf); resp.StatusCode != tt.want {
+				t.Errorf("%s %s = %s, want %d", tt.method, tt.path, resp.Status, tt.want)
+			}
+		})
+	}
+
+	entries, err := audit.Tail(100, "Book")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got []string
+	for _, e := range entries {
+		got = append(got, e.User+" "+e.Action+" "+e.Result)
+	}
+	want := []string{
+		"ada remove-service ok",
+		"ed remove-service denied",
+		"ed create-service denied",
+		"ed create-service ok",
+		"vi create-service denied",
+	}
+	if strings.Join(got, "\n") != strings.Join(want, "\n") {
+		t.Errorf("audit log for Book:\n%s\nwant:\n%s", strings.Join(got, "\n"), strings.Join(want, "\n"))
+	}
+}
+
+func TestAuditRecordsOutcome(t *testing.T) {
+	dir := t.TempDir()
+	audit := &AuditLog{Path: filepath.Join(dir, "audit.jsonl")}
+	auth := NewAuth(filepath.Join(dir, "users.txt"), audit)
+	if err := saveUser(auth.UsersFile, "ada", RoleAdmin, "password1"); err != nil {
+		t.Fatal(err)
+	}
+	s, token, err := auth.login("ada", "password1")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	refuse := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		writeBreaking(w, []byte("json: field removed"))
+	})
+	req := httptest.NewRequest("PUT", "/api/services/Book/fields/title", strings.NewReader(`{"type":"int32"}`))
+	req.AddCookie(&http.Cookie{Name: sessionCookie, Value: token})
+	req.AddCookie(&http.Cookie{Name: csrfCookie, Value: s.CSRF})
+	req.Header.Set(csrfHeader, s.CSRF)
+	auth.Middleware(refuse).ServeHTTP(httptest.NewRecorder(), req)
+
+	data, err := os.ReadFile(audit.Path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var e AuditEntry
+	if err := json.Unmarshal(data, &e); err != nil {
+		t.Fatal(err)
+	}
+	if e.User != "ada" || e.Action != "edit-field" || e.Service != "Book" || e.Target != "title" ||
+		e.Result != "refused" || e.Status != http.StatusConflict || string(e.Request) != `{"type":"int32"}` {
+		t.Errorf("audit entry = %+v", e)
+	}
+}
+
+func TestUsersFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "users.txt")
+	if err := ensureUsersFile(path); err != nil {
+		t.Fatal(err)
+	}
+	users, err := loadUsers(path)
+	if err != nil || users["admin"].Role != RoleAdmin {
+		t.Fatalf("users = %v, %v", users, err)
+	}
+	if info, _ := os.Stat(path); info.Mode().Perm() != 0o600 {
+		t.Errorf("users file mode = %v, want 0600", info.Mode().Perm())
+	}
+	if err := saveUser(path, "bad name", RoleViewer, "password1"); err == nil {
+		t.Error("expected an error for a user name with a space")
+	}
+	if err := saveUser(path, "bob", RoleViewer, "short"); err == nil {
+		t.Error("expected an error for a short password")
+	}
+	if err := os.WriteFile(path, []byte("bob root $2a$10$x\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := loadUsers(path); err == nil || !strings.Contains(err.Error(), "unknown role") {
+		t.Errorf("loadUsers with a bad role: %v", err)
+	}
+}
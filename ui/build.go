@@ -0,0 +1,405 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os/exec"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/connectivity"
+	"google.golang.org/grpc/credentials/insecure"
+
+	"grpc_anotation_sample/console"
+	"grpc_anotation_sample/pb"
+)
+
+// A build is what follows every change: gen_service.sh, `make proto`, a
+// `go build` of the project and, when the main server runs under `make dev`,
+// air restarting it. Each step and its output is streamed to the browser
+// over SSE (GET /api/build/events) and the build ends with a Health check.
+
+// Build timing; air waits a second after the last change before rebuilding.
+// Variables so tests can shorten them.
+var (
+	restartTimeout = 90 * time.Second
+	healthTimeout  = 30 * time.Second
+	healthInterval = 500 * time.Millisecond
+)
+
+// maxBuildEvents bounds the events kept for clients that connect mid-build
+const maxBuildEvents = 1000
+
+// BuildEvent is one line of build progress. A build starts with Status
+// "started" and ends with "succeeded", "failed" or "refused"; in between each
+// Step (generate, protoc, go-build, restart) goes "running", then "log" lines,
+// then "ok", "failed", "warning" or "skipped".
+type BuildEvent struct {
+	ID      int       `json:"id"`
+	Build   int       `json:"build"`
+	Action  string    `json:"action,omitempty"`
+	Step    string    `json:"step,omitempty"`
+	Status  string    `json:"status"`
+	Message string    `json:"message,omitempty"`
+	Time    time.Time `json:"time"`
+}
+
+// BuildHub runs builds one at a time and fans their events out to SSE
+// subscribers. Events of the latest build are kept for clients that connect
+// (or reconnect) while it is running.
+type BuildHub struct {
+	Root       string
+	HealthAddr string
+
+	run    sync.Mutex // held from Start until the build's files are generated
+	mu     sync.Mutex
+	seq    int
+	builds int
+	events []BuildEvent
+	subs   map[chan BuildEvent]struct{}
+	cancel context.CancelFunc // stops the previous build's verification
+}
+
+func NewBuildHub(root, healthAddr string) *BuildHub {
+	return &BuildHub{Root: root, HealthAddr: healthAddr, subs: map[chan BuildEvent]struct{}{}}
+}
+
+// builds serves the UI; the main server is expected at GRPC_ADDR
+var builds = NewBuildHub("..", console.GRPCAddr())
+
+func (h *BuildHub) publish(e BuildEvent) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.seq++
+	e.ID, e.Time = h.seq, time.Now().UTC()
+	if e.Status == "started" {
+		h.events = h.events[:0]
+	}
+	if len(h.events) < maxBuildEvents {
+		h.events = append(h.events, e)
+	}
+	for ch := range h.subs {
+		select {
+		case ch <- e:
+		default: // a stalled client misses lines rather than blocking the build
+		}
+	}
+}
+
+// subscribe returns the retained events after lastID and a channel of new ones
+func (h *BuildHub) subscribe(lastID int) ([]BuildEvent, chan BuildEvent, func()) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	var backlog []BuildEvent
+	for _, e := range h.events {
+		if e.ID > lastID {
+			backlog = append(backlog, e)
+		}
+	}
+	ch := make(chan BuildEvent, 256)
+	h.subs[ch] = struct{}{}
+	return backlog, ch, func() {
+		h.mu.Lock()
+		defer h.mu.Unlock()
+		delete(h.subs, ch)
+	}
+}
+
+// handleEvents serves GET /api/build/events as a text/event-stream. Browsers
+// send Last-Event-ID when they reconnect, so no line is shown twice.
+func (h *BuildHub) handleEvents(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "GET" {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		http.Error(w, "Streaming not supported", http.StatusInternalServerError)
+		return
+	}
+	lastID, _ := strconv.Atoi(r.Header.Get("Last-Event-ID"))
+	backlog, ch, unsubscribe := h.subscribe(lastID)
+	defer unsubscribe()
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.WriteHeader(http.StatusOK)
+	send := func(e BuildEvent) {
+		data, _ := json.Marshal(e)
+		fmt.Fprintf(w, "id: %d\ndata: %s\n\n", e.ID, data)
+	}
+	for _, e := range backlog {
+		send(e)
+	}
+	flusher.Flush()
+
+	keepalive := time.NewTicker(25 * time.Second)
+	defer keepalive.Stop()
+	for {
+		select {
+		case <-r.Context().Done():
+			return
+		case e := <-ch:
+			send(e)
+			flusher.Flush()
+		case <-keepalive.C:
+			fmt.Fprint(w, ": keepalive\n\n")
+			flusher.Flush()
+		}
+	}
+}
+
+// Build is one change being applied; see BuildHub.
+type Build struct {
+	hub    *BuildHub
+	ID     int
+	action string
+	// conn is connected to the main server if it answered before the
+	// change; air's restart shows as the connection dropping.
+	conn *grpc.ClientConn
+	done bool
+}
+
+// Start begins a build for action and waits for any other build to finish
+// generating. It stops the verification of the previous build, whose restart
+// this build supersedes.
+func (h *BuildHub) Start(action string) *Build {
+	h.run.Lock()
+	h.mu.Lock()
+	if h.cancel != nil {
+		h.cancel()
+		h.cancel = nil
+	}
+	h.builds++
+	b := &Build{hub: h, ID: h.builds, action: action}
+	h.mu.Unlock()
+
+	b.conn = h.connect()
+	b.publish("", "started", action)
+	return b
+}
+
+func (b *Build) publish(step, status, message string) {
+	b.hub.publish(BuildEvent{Build: b.ID, Action: b.action, Step: step, Status: status, Message: message})
+}
+
+// Run runs cmd as step, streaming each output line, and returns the combined
+// output like exec.Cmd.CombinedOutput.
+func (b *Build) Run(step string, cmd *exec.Cmd) ([]byte, error) {
+	b.publish(step, "running", cmdString(cmd))
+	pr, pw := io.Pipe()
+	var output bytes.Buffer
+	cmd.Stdout, cmd.Stderr = pw, pw
+	if err := cmd.Start(); err != nil {
+		b.publish(step, "failed", err.Error())
+		return nil, err
+	}
+	lines := make(chan struct{})
+	go func() {
+		defer close(lines)
+		scanner := bufio.NewScanner(pr)
+		scanner.Buffer(make([]byte, 0, 64<<10), 1<<20)
+		for scanner.Scan() {
+			output.Write(scanner.Bytes())
+			output.WriteByte('\n')
+			b.publish(step, "log", scanner.Text())
+		}
+		io.Copy(io.Discard, pr)
+	}()
+	err := cmd.Wait()
+	pw.Close()
+	<-lines
+
+	if err != nil {
+		b.publish(step, "failed", err.Error())
+	} else {
+		b.publish(step, "ok", "")
+	}
+	return output.Bytes(), err
+}
+
+func cmdString(cmd *exec.Cmd) string {
+	s := cmd.Path
+	if len(cmd.Args) > 0 {
+		s = cmd.Args[0]
+	}
+	for _, a := range cmd.Args[1:] {
+		if a == "" || strings.ContainsAny(a, " \t\"'\\") {
+			a = strconv.Quote(a)
+		}
+		s += " " + a
+	}
+	return s
+}
+
+// Fail ends a build whose generate or protoc step did not succeed; result is
+// "failed" or "refused" (breaking change).
+func (b *Build) Fail(result string) {
+	if b.done {
+		return
+	}
+	b.done = true
+	b.publish("", result, "")
+	b.hub.run.Unlock()
+	if b.conn != nil {
+		b.conn.Close()
+	}
+}
+
+// Verify lets the next build start, then builds the project and waits for the
+// main server to come back healthy, in the background.
+func (b *Build) Verify() {
+	if b.done {
+		return
+	}
+	b.done = true
+	ctx, cancel := context.WithCancel(context.Background())
+	b.hub.mu.Lock()
+	b.hub.cancel = cancel
+	b.hub.mu.Unlock()
+	b.hub.run.Unlock()
+
+	go func() {
+		defer cancel()
+		if b.conn != nil {
+			defer b.conn.Close()
+		}
+		goBuild := exec.CommandContext(ctx, "go", "build", "./...")
+		goBuild.Dir = b.hub.Root
+		if _, err := b.Run("go-build", goBuild); err != nil {
+			if ctx.Err() == nil {
+				b.publish("restart", "skipped", "The project does not compile; the main server keeps running the previous build")
+				b.publish("", "failed", "")
+			}
+			return
+		}
+		result := "succeeded"
+		if !b.waitRestart(ctx) {
+			result = "failed"
+		}
+		if ctx.Err() == nil {
+			b.publish("", result, "")
+		}
+	}()
+}
+
+// waitRestart follows the main server through air's restart. If it was up,
+// it waits for the connection opened before the change to drop and for
+// Health.Check to answer SERVING again; if it was down, it waits for it to
+// start. A server that never went away is reported as a warning: it is
+// probably not running under make dev.
+func (b *Build) waitRestart(ctx context.Context) bool {
+	addr := b.hub.HealthAddr
+	if b.conn == nil {
+		b.publish("restart", "running", fmt.Sprintf("Waiting for the main server at %s", addr))
+		if b.hub.waitHealthy(ctx, healthTimeout) == nil {
+			b.publish("restart", "ok", fmt.Sprintf("Main server at %s is healthy", addr))
+		} else {
+			b.publish("restart", "warning", fmt.Sprintf("Main server at %s is not running; start it with `make dev` to reload it on every change", addr))
+		}
+		return true
+	}
+
+	b.publish("restart", "running", fmt.Sprintf("Waiting for air to restart the main server at %s", addr))
+	start := time.Now()
+	restarted := waitDisconnect(ctx, b.conn, restartTimeout)
+	if ctx.Err() != nil {
+		return false
+	}
+	if !restarted && b.hub.checkHealth(ctx) == nil {
+		b.publish("restart", "warning", "Main server is healthy but did not restart; it is probably not running under `make dev`, so restart it to load the change")
+		return true
+	}
+	if err := b.hub.waitHealthy(ctx, healthTimeout); err != nil {
+		b.publish("restart", "failed", fmt.Sprintf("Main server did not come back healthy: %v", err))
+		return false
+	}
+	b.publish("restart", "ok", fmt.Sprintf("Main server restarted and healthy after %s", time.Since(start).Round(100*time.Millisecond)))
+	return true
+}
+
+// waitDisconnect reports whether conn, ready when the build started, has
+// dropped or drops within timeout.
+func waitDisconnect(ctx context.Context, conn *grpc.ClientConn, timeout time.Duration) bool {
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+	if conn.GetState() != connectivity.Ready {
+		return true
+	}
+	return conn.WaitForStateChange(ctx, connectivity.Ready)
+}
+
+// connect returns a connection to the main server if it answers Health.Check
+func (h *BuildHub) connect() *grpc.ClientConn {
+	conn, err := grpc.NewClient(h.HealthAddr, grpc.WithTransportCredentials(insecure.NewCredentials()))
+	if err != nil {
+		return nil
+	}
+	if err := checkHealth(context.Background(), conn); err != nil {
+		conn.Close()
+		return nil
+	}
+	return conn
+}
+
+// checkHealth calls Health.Check on the main server once over a new connection
+func (h *BuildHub) checkHealth(ctx context.Context) error {
+	conn, err := grpc.NewClient(h.HealthAddr, grpc.WithTransportCredentials(insecure.NewCredentials()))
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	return checkHealth(ctx, conn)
+}
+
+func checkHealth(ctx context.Context, conn *grpc.ClientConn) error {
+	ctx, cancel := context.WithTimeout(ctx, 2*time.Second)
+	defer cancel()
+	resp, err := pb.NewHealthClient(conn).Check(ctx, &pb.HealthCheckRequest{})
+	if err != nil {
+		return err
+	}
+	if resp.Status != pb.HealthCheckResponse_SERVING {
+		return fmt.Errorf("status %s", resp.Status)
+	}
+	return nil
+}
+
+// waitHealthy polls Health.Check until it answers SERVING or timeout passes
+func (h *BuildHub) waitHealthy(ctx context.Context, timeout time.Duration) error {
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+	for {
+		err := h.checkHealth(ctx)
+		if err == nil {
+			return nil
+		}
+		select {
+		case <-ctx.Done():
+			return err
+		case <-time.After(healthInterval):
+		}
+	}
+}
+
+// handleHealth serves GET /api/build/health with the main server's health
+func (h *BuildHub) handleHealth(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	if r.Method != "GET" {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	resp := map[string]any{"addr": h.HealthAddr, "healthy": true}
+	if err := h.checkHealth(r.Context()); err != nil {
+		resp["healthy"], resp["error"] = false, err.Error()
+	}
+	json.NewEncoder(w).Encode(resp)
+}
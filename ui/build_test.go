@@ -0,0 +1,202 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os/exec"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"google.golang.org/grpc"
+
+	"grpc_anotation_sample/generator"
+	"grpc_anotation_sample/pb"
+)
+
+type healthServer struct {
+	pb.UnimplementedHealthServer
+}
+
+func (healthServer) Check(context.Context, *pb.HealthCheckRequest) (*pb.HealthCheckResponse, error) {
+	return &pb.HealthCheckResponse{Status: pb.HealthCheckResponse_SERVING}, nil
+}
+
+// serveHealth starts a Health server on addr ("127.0.0.1:0" for any port)
+// and returns its address and a function that stops it.
+func serveHealth(t *testing.T, addr string) (string, func()) {
+	t.Helper()
+	lis, err := net.Listen("tcp", addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	srv := grpc.NewServer()
+	pb.RegisterHealthServer(srv, healthServer{})
+	go srv.Serve(lis)
+	t.Cleanup(srv.Stop)
+	return lis.Addr().String(), srv.Stop
+}
+
+// unusedAddr returns an address nothing listens on
+func unusedAddr(t *testing.T) string {
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	lis.Close()
+	return lis.Addr().String()
+}
+
+func shortTimeouts(t *testing.T) {
+	restart, health, interval := restartTimeout, healthTimeout, healthInterval
+	restartTimeout, healthTimeout, healthInterval = 2*time.Second, 2*time.Second, 50*time.Millisecond
+	t.Cleanup(func() { restartTimeout, healthTimeout, healthInterval = restart, health, interval })
+}
+
+func eventLines(events []BuildEvent) string {
+	var lines []string
+	for _, e := range events {
+		lines = append(lines, strings.TrimSpace(e.Step+" "+e.Status+" "+e.Message))
+	}
+	return strings.Join(lines, "\n")
+}
+
+func TestBuildRun(t *testing.T) {
+	hub := NewBuildHub(t.TempDir(), unusedAddr(t))
+	_, ch, unsubscribe := hub.subscribe(0)
+	defer unsubscribe()
+
+	b := hub.Start("test")
+	out, err := b.Run("generate", exec.Command("sh", "-c", "echo one; echo two >&2; exit 3"))
+	if !generator.IsBreaking(err) || string(out) != "one\ntwo\n" {
+		t.Fatalf("Run = %q, %v", out, err)
+	}
+	b.Fail("refused")
+	b.Fail("failed") // no-op once the build has ended
+
+	var events []BuildEvent
+	for len(ch) > 0 {
+		events = append(events, <-ch)
+	}
+	want := `started test
+generate running sh -c "echo one; echo two >&2; exit 3"
+generate log one
+generate log two
+generate failed exit status 3
+refused`
+	if got := eventLines(events); got != want {
+		t.Errorf("events:\n%s\nwant:\n%s", got, want)
+	}
+	for i, e := range events {
+		if e.Build != b.ID || e.ID != events[0].ID+i {
+			t.Errorf("event %d = %+v", i, e)
+		}
+	}
+
+	// The hub is free for the next build
+	done := make(chan struct{})
+	go func() {
+		hub.Start("next").Fail("failed")
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("second build did not start")
+	}
+}
+
+func TestBuildEventsStream(t *testing.T) {
+	hub := NewBuildHub(t.TempDir(), unusedAddr(t))
+	b := hub.Start("first")
+	b.Run("generate", exec.Command("echo", "hello"))
+
+	srv := httptest.NewServer(http.HandlerFunc(hub.handleEvents))
+	defer srv.Close()
+	read := func(lastID int, n int) []BuildEvent {
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		req, _ := http.NewRequestWithContext(ctx, "GET", srv.URL, nil)
+		if lastID > 0 {
+			req.Header.Set("Last-Event-ID", strconv.Itoa(lastID))
+		}
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer resp.Body.Close()
+		if ct := resp.Header.Get("Content-Type"); ct != "text/event-stream" {
+			t.Fatalf("Content-Type = %s", ct)
+		}
+		var events []BuildEvent
+		scanner := bufio.NewScanner(resp.Body)
+		for len(events) < n && scanner.Scan() {
+			if data, ok := strings.CutPrefix(scanner.Text(), "data: "); ok {
+				var e BuildEvent
+				if err := json.Unmarshal([]byte(data), &e); err != nil {
+					t.Fatal(err)
+				}
+				events = append(events, e)
+				if len(events) == 4 {
+					b.Fail("failed") // published while the client is connected
+				}
+			}
+		}
+		return events
+	}
+
+	all := read(0, 5)
+	if got := eventLines(all); got != "started first\ngenerate running echo hello\ngenerate log hello\ngenerate ok\nfailed" {
+		t.Errorf("events:\n%s", got)
+	}
+	if resumed := read(all[2].ID, 2); len(resumed) != 2 || resumed[0].ID != all[3].ID {
+		t.Errorf("resumed after %d: %+v", all[2].ID, resumed)
+	}
+}
+
+func TestWaitRestart(t *testing.T) {
+	shortTimeouts(t)
+	addr, stop := serveHealth(t, "127.0.0.1:0")
+	hub := NewBuildHub(t.TempDir(), addr)
+
+	// Restarted: the connection opened at Start drops and the server comes back
+	b := hub.Start("restart")
+	if b.conn == nil {
+		t.Fatal("Start did not connect to the running server")
+	}
+	stop()
+	serveHealth(t, addr)
+	if !b.waitRestart(context.Background()) {
+		t.Errorf("waitRestart: %s", eventLines(hub.events))
+	}
+	b.Fail("failed")
+	if got := hub.events[len(hub.events)-2]; got.Status != "ok" || !strings.Contains(got.Message, "restarted and healthy") {
+		t.Errorf("restart event = %+v", got)
+	}
+
+	// Not restarted: healthy, but not running under air
+	b = hub.Start("no restart")
+	if !b.waitRestart(context.Background()) {
+		t.Errorf("waitRestart: %s", eventLines(hub.events))
+	}
+	b.Fail("failed")
+	if got := hub.events[len(hub.events)-2]; got.Status != "warning" || !strings.Contains(got.Message, "did not restart") {
+		t.Errorf("restart event = %+v", got)
+	}
+
+	// Not running at all
+	hub.HealthAddr = unusedAddr(t)
+	b = hub.Start("down")
+	if b.conn != nil || !b.waitRestart(context.Background()) {
+		t.Errorf("waitRestart: %s", eventLines(hub.events))
+	}
+	b.Fail("failed")
+	if got := hub.events[len(hub.events)-2]; got.Status != "warning" || !strings.Contains(got.Message, "not running") {
+		t.Errorf("restart event = %+v", got)
+	}
+}
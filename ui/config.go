@@ -0,0 +1,114 @@
+package main
+
+import (
+	"embed"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+
+	"grpc_anotation_sample/generator"
+)
+
+// The pages are embedded so the binary runs from any directory; -static
+// serves them from disk instead, for editing without rebuilding.
+//
+//go:embed index.html login.html
+var pages embed.FS
+
+// projectRoot is the project the UI manages (where gen_service.sh, proto/ and
+// the Makefile live) and staticDir overrides the embedded pages; both are set
+// from flags in main. The default suits `go run .` and tests in ui/.
+var (
+	projectRoot = ".."
+	staticDir   = ""
+)
+
+// Config is where the UI listens and what it manages. Every flag has an
+// environment variable, used as its default.
+type Config struct {
+	Addr      string
+	Root      string
+	StaticDir string
+	UsersFile string
+	AuditLog  string
+}
+
+// loadConfig parses args (without the program name) and returns the
+// remaining arguments. The project root defaults to the nearest directory
+// containing gen_service.sh, looking up from the working directory and then
+// from the executable; the users file and audit log default to the root's ui/.
+func loadConfig(args []string, output io.Writer) (Config, []string, error) {
+	var c Config
+	fs := flag.NewFlagSet("service-manager-ui", flag.ContinueOnError)
+	fs.SetOutput(output)
+	fs.StringVar(&c.Addr, "addr", envOr("UI_ADDR", ":8081"), "listen address (UI_ADDR)")
+	fs.StringVar(&c.Root, "root", os.Getenv("UI_PROJECT_ROOT"), "project root containing gen_service.sh (UI_PROJECT_ROOT; default: found from the working directory or the executable)")
+	fs.StringVar(&c.StaticDir, "static", os.Getenv("UI_STATIC_DIR"), "serve index.html and login.html from this directory instead of the embedded copies (UI_STATIC_DIR)")
+	fs.StringVar(&c.UsersFile, "users", os.Getenv("UI_USERS_FILE"), "users file (UI_USERS_FILE; default ROOT/ui/users.txt)")
+	fs.StringVar(&c.AuditLog, "audit", os.Getenv("UI_AUDIT_LOG"), "audit log (UI_AUDIT_LOG; default ROOT/ui/audit.jsonl)")
+	if err := fs.Parse(args); err != nil {
+		return c, nil, err
+	}
+
+	if c.Root == "" {
+		root, err := findProjectRoot()
+		if err != nil {
+			return c, nil, err
+		}
+		c.Root = root
+	}
+	root, err := filepath.Abs(c.Root)
+	if err != nil {
+		return c, nil, err
+	}
+	if !generator.IsRoot(root) {
+		return c, nil, fmt.Errorf("%s is not a project root: gen_service.sh not found", root)
+	}
+	c.Root = root
+	if c.StaticDir != "" {
+		if _, err := os.Stat(filepath.Join(c.StaticDir, "index.html")); err != nil {
+			return c, nil, fmt.Errorf("static dir: %w", err)
+		}
+	}
+	if c.UsersFile == "" {
+		c.UsersFile = filepath.Join(root, "ui", defaultUsersFile)
+	}
+	if c.AuditLog == "" {
+		c.AuditLog = filepath.Join(root, "ui", defaultAuditLog)
+	}
+	return c, fs.Args(), nil
+}
+
+// findProjectRoot looks for gen_service.sh in the working directory and the
+// executable's directory and their parents.
+func findProjectRoot() (string, error) {
+	var starts []string
+	if wd, err := os.Getwd(); err == nil {
+		starts = append(starts, wd)
+	}
+	if exe, err := os.Executable(); err == nil {
+		if exe, err = filepath.EvalSymlinks(exe); err == nil {
+			starts = append(starts, filepath.Dir(exe))
+		}
+	}
+	if root, err := generator.FindRoot(starts...); err == nil {
+		return root, nil
+	}
+	return "", errors.New("project root not found: run from inside the project or pass -root (UI_PROJECT_ROOT)")
+}
+
+// staticFile returns a page from staticDir if set, else the embedded copy
+func staticFile(name string) ([]byte, error) {
+	if staticDir != "" {
+		return os.ReadFile(filepath.Join(staticDir, name))
+	}
+	return pages.ReadFile(name)
+}
+
+// rootPath joins elem to the project root
+func rootPath(elem ...string) string {
+	return filepath.Join(append([]string{projectRoot}, elem...)...)
+}
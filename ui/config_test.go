@@ -0,0 +1,98 @@
+package main
+
+import (
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// fakeProject creates a project root with gen_service.sh and a nested ui/ dir
+func fakeProject(t *testing.T) string {
+	t.Helper()
+	root := t.TempDir()
+	if err := os.MkdirAll(filepath.Join(root, "ui"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(root, "gen_service.sh"), []byte("#!/bin/sh\n"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	root, _ = filepath.EvalSymlinks(root)
+	return root
+}
+
+func TestLoadConfig(t *testing.T) {
+	root := fakeProject(t)
+	t.Chdir(filepath.Join(root, "ui"))
+	for _, key := range []string{"UI_ADDR", "UI_PROJECT_ROOT", "UI_STATIC_DIR", "UI_USERS_FILE", "UI_AUDIT_LOG"} {
+		t.Setenv(key, "")
+	}
+
+	cfg, rest, err := loadConfig(nil, io.Discard)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cfg.Addr != ":8081" || cfg.Root != root || len(rest) != 0 ||
+		cfg.UsersFile != filepath.Join(root, "ui", "users.txt") || cfg.AuditLog != filepath.Join(root, "ui", "audit.jsonl") {
+		t.Errorf("defaults = %+v, %v", cfg, rest)
+	}
+
+	// Environment variables are the defaults, flags win
+	other := fakeProject(t)
+	t.Setenv("UI_ADDR", "127.0.0.1:9000")
+	t.Setenv("UI_PROJECT_ROOT", other)
+	cfg, rest, err = loadConfig([]string{"-addr", ":7000", "-users", "/tmp/u.txt", "alice", "editor"}, io.Discard)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cfg.Addr != ":7000" || cfg.Root != other || cfg.UsersFile != "/tmp/u.txt" || strings.Join(rest, " ") != "alice editor" {
+		t.Errorf("overrides = %+v, %v", cfg, rest)
+	}
+
+	if _, _, err := loadConfig([]string{"-root", t.TempDir()}, io.Discard); err == nil || !strings.Contains(err.Error(), "not a project root") {
+		t.Errorf("root without gen_service.sh: %v", err)
+	}
+	if _, _, err := loadConfig([]string{"-static", t.TempDir()}, io.Discard); err == nil {
+		t.Error("expected an error for a static dir without index.html")
+	}
+
+	// Outside any project, the executable's directory is searched next; the
+	// test binary lives in a temporary directory, so nothing is found.
+	t.Chdir(t.TempDir())
+	t.Setenv("UI_PROJECT_ROOT", "")
+	if _, _, err := loadConfig(nil, io.Discard); err == nil || !strings.Contains(err.Error(), "project root not found") {
+		t.Errorf("outside a project: %v", err)
+	}
+}
+
+func TestStaticFile(t *testing.T) {
+	for _, name := range []string{"index.html", "login.html"} {
+		content, err := staticFile(name)
+		if err != nil || !strings.Contains(string(content), "<title>") {
+			t.Errorf("embedded %s: %v", name, err)
+		}
+	}
+
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, "index.html"), []byte("edited"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	staticDir = dir
+	t.Cleanup(func() { staticDir = "" })
+	if content, err := staticFile("index.html"); err != nil || string(content) != "edited" {
+		t.Errorf("index.html from -static = %q, %v", content, err)
+	}
+}
+
+func TestListenURL(t *testing.T) {
+	for addr, want := range map[string]string{
+		":8081":          "http://localhost:8081",
+		"0.0.0.0:9000":   "http://localhost:9000",
+		"127.0.0.1:8081": "http://127.0.0.1:8081",
+	} {
+		if got := listenURL(addr); got != want {
+			t.Errorf("listenURL(%q) = %s, want %s", addr, got, want)
+		}
+	}
+}
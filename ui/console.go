@@ -0,0 +1,67 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+
+	"grpc_anotation_sample/console"
+	"grpc_anotation_sample/protoset"
+)
+
+func handleConsoleMethods(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	if r.Method != "GET" {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	set, err := protoset.Compile(rootPath("proto"))
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		json.NewEncoder(w).Encode(map[string]string{"error": fmt.Sprintf("Failed to compile protos: %v", err)})
+		return
+	}
+	json.NewEncoder(w).Encode(map[string][]console.Method{"methods": console.Methods(set)})
+}
+
+func handleConsoleInvoke(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	if r.Method != "POST" {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	var req console.Request
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(console.Response{Error: "Invalid JSON request"})
+		return
+	}
+
+	set, err := protoset.Compile(rootPath("proto"))
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		json.NewEncoder(w).Encode(console.Response{Error: fmt.Sprintf("Failed to compile protos: %v", err)})
+		return
+	}
+	md, err := console.FindMethod(set, req.Service, req.Method)
+	if err != nil {
+		w.WriteHeader(http.StatusNotFound)
+		json.NewEncoder(w).Encode(console.Response{Error: err.Error()})
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), console.Timeout)
+	defer cancel()
+
+	resp, err := console.Invoke(ctx, set, md, req)
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(console.Response{Error: err.Error()})
+		return
+	}
+	json.NewEncoder(w).Encode(resp)
+}
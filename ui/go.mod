@@ -1,3 +1,23 @@
 module grpc-service-manager-ui
 
-go 1.21
+go 1.24.4
+
+require (
+	golang.org/x/crypto v0.38.0
+	google.golang.org/grpc v1.74.2
+	grpc_anotation_sample v0.0.0
+)
+
+require (
+	github.com/bufbuild/protocompile v0.14.1 // indirect
+	github.com/grpc-ecosystem/grpc-gateway/v2 v2.27.1 // indirect
+	golang.org/x/net v0.40.0 // indirect
+	golang.org/x/sync v0.15.0 // indirect
+	golang.org/x/sys v0.33.0 // indirect
+	golang.org/x/text v0.26.0 // indirect
+	google.golang.org/genproto/googleapis/api v0.0.0-20250603155806-513f23925822 // indirect
+	google.golang.org/genproto/googleapis/rpc v0.0.0-20250603155806-513f23925822 // indirect
+	google.golang.org/protobuf v1.36.7 // indirect
+)
+
+replace grpc_anotation_sample => ../
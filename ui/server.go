@@ -1,58 +1,162 @@
 package main
 
 import (
+	"context"
 	"encoding/json"
+	"errors"
+	"flag"
 	"fmt"
+	"net"
 	"net/http"
 	"os"
-	"os/exec"
-	"path/filepath"
 	"strings"
+
+	"grpc_anotation_sample/generator"
 )
 
 type ServiceRequest struct {
 	ServiceName   string `json:"serviceName"`
 	ServiceFields string `json:"serviceFields"`
+	// Force applies the change even if it breaks existing clients
+	Force bool `json:"force,omitempty"`
 }
 
 type ServiceResponse struct {
 	Success bool   `json:"success"`
 	Message string `json:"message,omitempty"`
 	Error   string `json:"error,omitempty"`
+	// Breaking is set when the change was refused because it would break
+	// clients of proto/baseline.binpb; retry with force to apply it.
+	Breaking bool `json:"breaking,omitempty"`
+	// Field and Code identify the rejected parameter of a 400 response
+	Field string `json:"field,omitempty"`
+	Code  string `json:"code,omitempty"`
+	// Build is the id of the build whose progress is streamed on /api/build/events
+	Build int `json:"build,omitempty"`
+}
+
+// writeBreaking reports a change refused by the breaking-change guard
+func writeBreaking(w http.ResponseWriter, output []byte) {
+	w.WriteHeader(http.StatusConflict)
+	json.NewEncoder(w).Encode(ServiceResponse{
+		Success:  false,
+		Breaking: true,
+		Error:    fmt.Sprintf("Change would break existing clients:\n%s", string(output)),
+	})
 }
 
-type Service struct {
-	Name   string   `json:"name"`
-	Fields []string `json:"fields"`
+// project is the checkout the UI manages
+func project() generator.Project {
+	return generator.Project{Root: projectRoot}
+}
+
+// writeInvalid answers 400 with the error and the offending parameter
+func writeInvalid(w http.ResponseWriter, err *generator.ValidationError) {
+	w.WriteHeader(http.StatusBadRequest)
+	json.NewEncoder(w).Encode(ServiceResponse{Success: false, Error: err.Message, Field: err.Field, Code: err.Code})
 }
 
 type ServicesResponse struct {
-	Services []Service `json:"services"`
-	Error    string    `json:"error,omitempty"`
+	Services []generator.Service `json:"services"`
+	Error    string              `json:"error,omitempty"`
+}
+
+// Files the UI keeps in the project's ui/; override with -users and -audit
+const (
+	defaultUsersFile = "users.txt"
+	defaultAuditLog  = "audit.jsonl"
+)
+
+func envOr(key, def string) string {
+	if v := os.Getenv(key); v != "" {
+		return v
+	}
+	return def
 }
 
 func main() {
+	args := os.Args[1:]
+	useradd := len(args) > 0 && args[0] == "useradd"
+	if useradd {
+		args = args[1:]
+	}
+	cfg, rest, err := loadConfig(args, os.Stderr)
+	if errors.Is(err, flag.ErrHelp) {
+		return
+	}
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(2)
+	}
+	projectRoot, staticDir, builds.Root = cfg.Root, cfg.StaticDir, cfg.Root
+
+	if useradd {
+		if err := runUserAdd(cfg.UsersFile, rest); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+		return
+	}
+	if len(rest) > 0 {
+		fmt.Fprintf(os.Stderr, "unexpected arguments: %v\n", rest)
+		os.Exit(2)
+	}
+	if err := ensureUsersFile(cfg.UsersFile); err != nil {
+		fmt.Printf("Error preparing users file: %v\n", err)
+		os.Exit(1)
+	}
+	audit := &AuditLog{Path: cfg.AuditLog}
+	auth := NewAuth(cfg.UsersFile, audit)
+
+	mux := http.NewServeMux()
 	// Serve static files
-	http.HandleFunc("/", handleIndex)
-	http.HandleFunc("/docs", handleDocs)
-	http.HandleFunc("/api/readme", handleReadme)
+	mux.HandleFunc("/", handleIndex)
+	mux.HandleFunc("/docs", handleDocs)
+	mux.HandleFunc("/login", handleLoginPage)
+	mux.HandleFunc("/api/readme", handleReadme)
 
-	// API endpoints
-	http.HandleFunc("/api/services", handleServices)
-	http.HandleFunc("/api/services/", handleServiceOperations)
-	http.HandleFunc("/api/rpc", handleRpc)
-	http.HandleFunc("/api/nested", handleNested)
+	// Session endpoints
+	mux.HandleFunc("/api/login", auth.handleLogin)
+	mux.HandleFunc("/api/logout", auth.handleLogout)
+	mux.HandleFunc("/api/me", auth.handleMe)
+	mux.HandleFunc("/api/audit", audit.handleAudit)
 
-	fmt.Println("🚀 gRPC Service Manager UI starting on http://localhost:8081")
-	fmt.Println("📁 Serving UI from: ui/")
+	// API endpoints
+	mux.HandleFunc("/api/services", handleServices)
+	mux.HandleFunc("/api/services/", handleServiceOperations)
+	mux.HandleFunc("/api/rpc", handleRpc)
+	mux.HandleFunc("/api/nested", handleNested)
+	mux.HandleFunc("/api/console/methods", handleConsoleMethods)
+	mux.HandleFunc("/api/console/invoke", handleConsoleInvoke)
+	mux.HandleFunc("/api/build/events", builds.handleEvents)
+	mux.HandleFunc("/api/build/health", builds.handleHealth)
+
+	fmt.Printf("🚀 gRPC Service Manager UI starting on %s\n", listenURL(cfg.Addr))
+	fmt.Printf("📁 Project: %s\n", cfg.Root)
+	if cfg.StaticDir != "" {
+		fmt.Printf("🎨 Serving pages from: %s\n", cfg.StaticDir)
+	}
 	fmt.Println("🔧 API endpoints: /api/services")
+	fmt.Printf("🔒 Users: %s, audit log: %s\n", cfg.UsersFile, audit.Path)
 
-	if err := http.ListenAndServe(":8081", nil); err != nil {
+	if err := http.ListenAndServe(cfg.Addr, auth.Middleware(mux)); err != nil {
 		fmt.Printf("Error starting server: %v\n", err)
 		os.Exit(1)
 	}
 }
 
+// listenURL turns a listen address like ":8081" into a URL to open
+func listenURL(addr string) string {
+	host, port, err := net.SplitHostPort(addr)
+	if err != nil {
+		return "http://" + addr
+	}
+	if host == "" || host == "0.0.0.0" || host == "::" {
+		host = "localhost"
+	}
+	return "http://" + net.JoinHostPort(host, port)
+}
+
 func handleIndex(w http.ResponseWriter, r *http.Request) {
 	if r.URL.Path != "/" {
 		// allow direct navigation to /docs
@@ -64,9 +168,8 @@ func handleIndex(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	// Read and serve the HTML file
-	htmlPath := "index.html"
-	content, err := os.ReadFile(htmlPath)
+	// Serve the embedded page, or the one in -static
+	content, err := staticFile("index.html")
 	if err != nil {
 		http.Error(w, "Failed to read index.html", http.StatusInternalServerError)
 		return
@@ -123,7 +226,7 @@ func handleDocs(w http.ResponseWriter, r *http.Request) {
 
 func handleReadme(w http.ResponseWriter, _ *http.Request) {
 	// Prefer project root README; fallback to ui/README
-	candidates := []string{"../README.md", "README.md"}
+	candidates := []string{rootPath("README.md"), rootPath("ui", "README.md")}
 	var content []byte
 	var err error
 	for _, p := range candidates {
@@ -142,14 +245,6 @@ func handleReadme(w http.ResponseWriter, _ *http.Request) {
 
 func handleServices(w http.ResponseWriter, r *http.Request) {
 	w.Header().Set("Content-Type", "application/json")
-	w.Header().Set("Access-Control-Allow-Origin", "*")
-	w.Header().Set("Access-Control-Allow-Methods", "GET, POST, DELETE, OPTIONS")
-	w.Header().Set("Access-Control-Allow-Headers", "Content-Type")
-
-	if r.Method == "OPTIONS" {
-		w.WriteHeader(http.StatusOK)
-		return
-	}
 
 	switch r.Method {
 	case "GET":
@@ -161,152 +256,214 @@ func handleServices(w http.ResponseWriter, r *http.Request) {
 	}
 }
 
+// handleServiceOperations serves everything below /api/services/{name}:
+//
+//	DELETE /api/services/{name}                  remove the service
+//	PUT    /api/services/{name}/fields/{field}   change a field's type, or rename it
+//	DELETE /api/services/{name}/fields/{field}   remove a field, reserving its number
+//	DELETE /api/services/{name}/rpcs/{rpc}       remove an RPC
+//	PUT    /api/services/{name}/rpcs/{rpc}/http  change or drop an RPC's HTTP binding
 func handleServiceOperations(w http.ResponseWriter, r *http.Request) {
 	w.Header().Set("Content-Type", "application/json")
-	w.Header().Set("Access-Control-Allow-Origin", "*")
-	w.Header().Set("Access-Control-Allow-Methods", "DELETE, OPTIONS")
-	w.Header().Set("Access-Control-Allow-Headers", "Content-Type")
 
-	if r.Method == "OPTIONS" {
-		w.WriteHeader(http.StatusOK)
+	parts := strings.Split(strings.Trim(strings.TrimPrefix(r.URL.Path, "/api/services/"), "/"), "/")
+	if err := generator.ValidateName("service", parts[0]); err != nil {
+		writeInvalid(w, err)
 		return
 	}
-
-	if r.Method == "DELETE" {
-		handleDeleteService(w, r)
-	} else {
+	if len(parts) >= 3 {
+		if err := generator.ValidateName(strings.TrimSuffix(parts[1], "s"), parts[2]); err != nil {
+			writeInvalid(w, err)
+			return
+		}
+	}
+	switch {
+	case len(parts) == 1 && r.Method == "DELETE":
+		handleDeleteService(w, r, parts[0])
+	case len(parts) == 3 && parts[1] == "fields" && r.Method == "PUT":
+		handleEditField(w, r, parts[0], parts[2])
+	case len(parts) == 3 && parts[1] == "fields" && r.Method == "DELETE":
+		handleRemoveField(w, r, parts[0], parts[2])
+	case len(parts) == 3 && parts[1] == "rpcs" && r.Method == "DELETE":
+		handleRemoveRpc(w, r, parts[0], parts[2])
+	case len(parts) == 4 && parts[1] == "rpcs" && parts[3] == "http" && r.Method == "PUT":
+		handleSetHttp(w, r, parts[0], parts[2])
+	default:
 		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
 	}
 }
 
-type AddRpcRequest struct {
-	ServiceName string `json:"serviceName"`
-	RpcName     string `json:"rpcName"`
-	ReqFields   string `json:"reqFields"`
-	ResFields   string `json:"resFields"`
-	Http        string `json:"http"`
-	Body        string `json:"body,omitempty"`
+type EditFieldRequest struct {
+	// Type is the new type in the field DSL, e.g. "duration" or "Kind{SMALL,LARGE}"
+	Type string `json:"type,omitempty"`
+	// NewName renames an entity field (with a data migration) instead of retyping it
+	NewName string `json:"newName,omitempty"`
+	// Message defaults to the service's entity message
+	Message string `json:"message,omitempty"`
+	Force   bool   `json:"force,omitempty"`
 }
 
-type AddNestedRequest struct {
-	ServiceName string `json:"serviceName"`
-	FieldName   string `json:"fieldName"`
-	Fields      string `json:"fields"`
-	Repeated    bool   `json:"repeated"`
-	MessageName string `json:"messageName,omitempty"`
+type SetHttpRequest struct {
+	// Method and Path set the binding; an empty Method removes it
+	Method string `json:"method"`
+	Path   string `json:"path,omitempty"`
+	Body   string `json:"body,omitempty"`
+	Force  bool   `json:"force,omitempty"`
 }
 
-func handleNested(w http.ResponseWriter, r *http.Request) {
-	w.Header().Set("Content-Type", "application/json")
-	w.Header().Set("Access-Control-Allow-Origin", "*")
-	w.Header().Set("Access-Control-Allow-Methods", "POST, OPTIONS")
-	w.Header().Set("Access-Control-Allow-Headers", "Content-Type")
-
-	if r.Method == "OPTIONS" {
-		w.WriteHeader(http.StatusOK)
-		return
-	}
+// forceParam reports whether ?force=1 was passed to override the breaking-change guard
+func forceParam(r *http.Request) bool {
+	return r.URL.Query().Get("force") == "1" || r.URL.Query().Get("force") == "true"
+}
 
-	if r.Method != "POST" {
-		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+// applyChange runs the validated change c, regenerates the protos and reports
+// the outcome; the build is verified in the background.
+func applyChange(w http.ResponseWriter, c generator.Change) {
+	build := builds.Start(c.Action)
+	defer build.Fail("failed")
+
+	p := project()
+	output, err := build.Run("generate", p.Command(context.Background(), c))
+	if generator.IsBreaking(err) {
+		build.Fail("refused")
+		writeBreaking(w, output)
 		return
 	}
-
-	var req AddNestedRequest
-	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-		json.NewEncoder(w).Encode(ServiceResponse{Success: false, Error: "Invalid JSON request"})
+	if err != nil {
+		json.NewEncoder(w).Encode(ServiceResponse{Success: false, Build: build.ID, Error: fmt.Sprintf("Failed to %s: %v\nOutput: %s", c.Action, err, string(output))})
 		return
 	}
 
-	if req.ServiceName == "" || req.FieldName == "" || req.Fields == "" {
-		json.NewEncoder(w).Encode(ServiceResponse{Success: false, Error: "serviceName, fieldName and fields are required"})
+	if protoOut, perr := build.Run("protoc", p.ProtoCommand(context.Background())); perr != nil {
+		json.NewEncoder(w).Encode(ServiceResponse{Success: false, Build: build.ID, Error: fmt.Sprintf("Proto regeneration failed after %s: %v\nOutput: %s", c.Action, perr, string(protoOut))})
 		return
 	}
 
-	args := []string{"gen_service.sh", "add-nested", req.ServiceName, req.FieldName, req.Fields}
-	if req.Repeated {
-		args = append(args, "repeated")
-	}
-	if strings.TrimSpace(req.MessageName) != "" {
-		args = append(args, req.MessageName)
-	}
-	cmd := exec.Command("./"+args[0], args[1:]...)
-	cmd.Dir = ".."
+	build.Verify()
+	json.NewEncoder(w).Encode(ServiceResponse{Success: true, Build: build.ID, Message: c.Success})
+}
 
-	output, err := cmd.CombinedOutput()
+// applyValidated applies c unless validating it failed
+func applyValidated(w http.ResponseWriter, c generator.Change, err *generator.ValidationError, force bool) {
 	if err != nil {
-		json.NewEncoder(w).Encode(ServiceResponse{Success: false, Error: fmt.Sprintf("Failed to add nested message: %v\nOutput: %s", err, string(output))})
+		writeInvalid(w, err)
 		return
 	}
+	c.Force = force
+	applyChange(w, c)
+}
 
-	protoCmd := exec.Command("make", "proto")
-	protoCmd.Dir = ".."
-	if protoOut, perr := protoCmd.CombinedOutput(); perr != nil {
-		json.NewEncoder(w).Encode(ServiceResponse{Success: false, Error: fmt.Sprintf("Nested added but proto regeneration failed: %v\nOutput: %s", perr, string(protoOut))})
+func handleEditField(w http.ResponseWriter, r *http.Request, service, field string) {
+	var req EditFieldRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeInvalid(w, generator.Invalid("body", "invalid_json", "Invalid JSON request"))
 		return
 	}
 
-	json.NewEncoder(w).Encode(ServiceResponse{Success: true, Message: "Nested message and field added"})
+	switch {
+	case req.NewName != "" && req.Type != "":
+		json.NewEncoder(w).Encode(ServiceResponse{Success: false, Error: "Rename and type change must be separate requests"})
+	case req.NewName != "":
+		if req.Message != "" {
+			if err := generator.ValidateName("message", req.Message); err != nil {
+				writeInvalid(w, err)
+				return
+			}
+			json.NewEncoder(w).Encode(ServiceResponse{Success: false, Error: "Only fields of the entity message can be renamed"})
+			return
+		}
+		c, err := generator.RenameField(service, field, req.NewName)
+		applyValidated(w, c, err, req.Force)
+	case req.Type != "":
+		c, err := generator.EditField(service, field, req.Type, req.Message)
+		applyValidated(w, c, err, req.Force)
+	default:
+		writeInvalid(w, generator.Invalid("type", "required", "type or newName is required"))
+	}
 }
 
-func handleRpc(w http.ResponseWriter, r *http.Request) {
-	w.Header().Set("Content-Type", "application/json")
-	w.Header().Set("Access-Control-Allow-Origin", "*")
-	w.Header().Set("Access-Control-Allow-Methods", "POST, OPTIONS")
-	w.Header().Set("Access-Control-Allow-Headers", "Content-Type")
+func handleRemoveField(w http.ResponseWriter, r *http.Request, service, field string) {
+	c, err := generator.RemoveField(service, field, r.URL.Query().Get("message"))
+	applyValidated(w, c, err, forceParam(r))
+}
 
-	if r.Method == "OPTIONS" {
-		w.WriteHeader(http.StatusOK)
+func handleRemoveRpc(w http.ResponseWriter, r *http.Request, service, rpc string) {
+	c, err := generator.RemoveRPC(service, rpc)
+	applyValidated(w, c, err, forceParam(r))
+}
+
+func handleSetHttp(w http.ResponseWriter, r *http.Request, service, rpc string) {
+	var req SetHttpRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeInvalid(w, generator.Invalid("body", "invalid_json", "Invalid JSON request"))
 		return
 	}
 
+	c, err := generator.SetHTTP(service, rpc, req.Method, req.Path, req.Body)
+	applyValidated(w, c, err, req.Force)
+}
+
+type AddRpcRequest struct {
+	ServiceName string `json:"serviceName"`
+	RpcName     string `json:"rpcName"`
+	ReqFields   string `json:"reqFields"`
+	ResFields   string `json:"resFields"`
+	Stream      string `json:"stream,omitempty"`
+	Http        string `json:"http,omitempty"`
+	Body        string `json:"body,omitempty"`
+}
+
+type AddNestedRequest struct {
+	ServiceName string `json:"serviceName"`
+	FieldName   string `json:"fieldName"`
+	Fields      string `json:"fields"`
+	Repeated    bool   `json:"repeated"`
+	MessageName string `json:"messageName,omitempty"`
+}
+
+func handleNested(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
 	if r.Method != "POST" {
 		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
 		return
 	}
 
-	var req AddRpcRequest
+	var req AddNestedRequest
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-		json.NewEncoder(w).Encode(ServiceResponse{Success: false, Error: "Invalid JSON request"})
+		writeInvalid(w, generator.Invalid("body", "invalid_json", "Invalid JSON request"))
 		return
 	}
 
-	if req.ServiceName == "" || req.RpcName == "" || req.ReqFields == "" || req.ResFields == "" || req.Http == "" {
-		json.NewEncoder(w).Encode(ServiceResponse{Success: false, Error: "serviceName, rpcName, reqFields, resFields and http are required"})
-		return
-	}
+	c, err := generator.AddNested(req.ServiceName, req.FieldName, req.Fields, req.Repeated, req.MessageName)
+	applyValidated(w, c, err, false)
+}
 
-	// Execute gen_service.sh add-rpc
-	args := []string{"gen_service.sh", "add-rpc", req.ServiceName, req.RpcName, req.ReqFields, req.ResFields, fmt.Sprintf("http=%s", req.Http)}
-	if strings.TrimSpace(req.Body) != "" {
-		args = append(args, fmt.Sprintf("body=%s", req.Body))
-	}
-	cmd := exec.Command("./"+args[0], args[1:]...)
-	cmd.Dir = ".."
+func handleRpc(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
 
-	output, err := cmd.CombinedOutput()
-	if err != nil {
-		json.NewEncoder(w).Encode(ServiceResponse{Success: false, Error: fmt.Sprintf("Failed to add RPC: %v\nOutput: %s", err, string(output))})
+	if r.Method != "POST" {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
 		return
 	}
 
-	// Regenerate proto
-	protoCmd := exec.Command("make", "proto")
-	protoCmd.Dir = ".."
-	if protoOut, perr := protoCmd.CombinedOutput(); perr != nil {
-		json.NewEncoder(w).Encode(ServiceResponse{Success: false, Error: fmt.Sprintf("RPC added but proto regeneration failed: %v\nOutput: %s", perr, string(protoOut))})
+	var req AddRpcRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeInvalid(w, generator.Invalid("body", "invalid_json", "Invalid JSON request"))
 		return
 	}
 
-	json.NewEncoder(w).Encode(ServiceResponse{Success: true, Message: fmt.Sprintf("RPC '%s' added to '%s'", req.RpcName, req.ServiceName)})
+	c, err := generator.AddRPC(req.ServiceName, req.RpcName, req.ReqFields, req.ResFields, req.Stream, req.Http, req.Body)
+	applyValidated(w, c, err, false)
 }
 
 func handleGetServices(w http.ResponseWriter, _ *http.Request) {
-	services, err := discoverServices()
+	services, err := generator.Discover(project().ProtoDir())
 	if err != nil {
 		response := ServicesResponse{
 			Error: fmt.Sprintf("Failed to discover services: %v", err),
 		}
+		w.WriteHeader(http.StatusInternalServerError)
 		json.NewEncoder(w).Encode(response)
 		return
 	}
@@ -320,201 +477,16 @@ func handleGetServices(w http.ResponseWriter, _ *http.Request) {
 func handleCreateService(w http.ResponseWriter, r *http.Request) {
 	var req ServiceRequest
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-		response := ServiceResponse{
-			Success: false,
-			Error:   "Invalid JSON request",
-		}
-		json.NewEncoder(w).Encode(response)
-		return
-	}
-
-	// Validate input
-	if req.ServiceName == "" || req.ServiceFields == "" {
-		response := ServiceResponse{
-			Success: false,
-			Error:   "Service name and fields are required",
-		}
-		json.NewEncoder(w).Encode(response)
-		return
-	}
-
-	// Execute the gen_service.sh script
-	cmd := exec.Command("./gen_service.sh", req.ServiceName, req.ServiceFields)
-	cmd.Dir = ".." // Run from parent directory where gen_service.sh is located
-
-	output, err := cmd.CombinedOutput()
-	if err != nil {
-		response := ServiceResponse{
-			Success: false,
-			Error:   fmt.Sprintf("Failed to create service: %v\nOutput: %s", err, string(output)),
-		}
-		json.NewEncoder(w).Encode(response)
-		return
-	}
-
-	// Run make proto to generate the protocol buffer code
-	protoCmd := exec.Command("make", "proto")
-	protoCmd.Dir = ".."
-	protoOutput, err := protoCmd.CombinedOutput()
-	if err != nil {
-		response := ServiceResponse{
-			Success: false,
-			Error:   fmt.Sprintf("Service created but proto generation failed: %v\nOutput: %s", err, string(protoOutput)),
-		}
-		json.NewEncoder(w).Encode(response)
-		return
-	}
-
-	response := ServiceResponse{
-		Success: true,
-		Message: fmt.Sprintf("Service '%s' created successfully with fields: %s", req.ServiceName, req.ServiceFields),
-	}
-	json.NewEncoder(w).Encode(response)
-}
-
-func handleDeleteService(w http.ResponseWriter, r *http.Request) {
-	// Extract service name from URL path
-	pathParts := strings.Split(r.URL.Path, "/")
-	if len(pathParts) < 4 {
-		http.Error(w, "Invalid service name", http.StatusBadRequest)
+		writeInvalid(w, generator.Invalid("body", "invalid_json", "Invalid JSON request"))
 		return
 	}
 
-	serviceName := pathParts[3] // /api/services/{serviceName}
-
-	// Execute the gen_service.sh script with remove command
-	cmd := exec.Command("./gen_service.sh", "remove", serviceName)
-	cmd.Dir = ".." // Run from parent directory where gen_service.sh is located
-
-	output, err := cmd.CombinedOutput()
-	if err != nil {
-		response := ServiceResponse{
-			Success: false,
-			Error:   fmt.Sprintf("Failed to remove service: %v\nOutput: %s", err, string(output)),
-		}
-		json.NewEncoder(w).Encode(response)
-		return
-	}
-
-	// Run make proto to regenerate the protocol buffer code
-	protoCmd := exec.Command("make", "proto")
-	protoCmd.Dir = ".."
-	protoOutput, err := protoCmd.CombinedOutput()
-	if err != nil {
-		response := ServiceResponse{
-			Success: false,
-			Error:   fmt.Sprintf("Service removed but proto regeneration failed: %v\nOutput: %s", err, string(protoOutput)),
-		}
-		json.NewEncoder(w).Encode(response)
-		return
-	}
-
-	response := ServiceResponse{
-		Success: true,
-		Message: fmt.Sprintf("Service '%s' removed successfully", serviceName),
-	}
-	json.NewEncoder(w).Encode(response)
+	c, err := generator.CreateService(req.ServiceName, req.ServiceFields)
+	applyValidated(w, c, err, req.Force)
 }
 
-func discoverServices() ([]Service, error) {
-	var services []Service
-
-	// Look for proto files in the proto directory
-	protoDir := "../proto"
-	files, err := os.ReadDir(protoDir)
-	if err != nil {
-		return nil, fmt.Errorf("failed to read proto directory: %v", err)
-	}
-
-	for _, file := range files {
-		if file.IsDir() || !strings.HasSuffix(file.Name(), ".proto") {
-			continue
-		}
-
-		// Skip google API proto files
-		if strings.Contains(file.Name(), "google") {
-			continue
-		}
-
-		// Extract service name from filename
-		serviceName := strings.TrimSuffix(file.Name(), ".proto")
-
-		// Convert to PascalCase for display
-		serviceName = strings.Title(serviceName)
-
-		// Try to read the proto file to extract fields
-		protoPath := filepath.Join(protoDir, file.Name())
-		content, err := os.ReadFile(protoPath)
-		if err != nil {
-			continue
-		}
-
-		fields := extractFieldsFromProto(string(content))
-
-		service := Service{
-			Name:   serviceName,
-			Fields: fields,
-		}
-
-		services = append(services, service)
-	}
-
-	return services, nil
-}
-
-func extractFieldsFromProto(content string) []string {
-	var fields []string
-	var inMessage bool
-
-	lines := strings.Split(content, "\n")
-	for _, line := range lines {
-		line = strings.TrimSpace(line)
-
-		// Check if we're entering a message definition
-		if strings.HasPrefix(line, "message ") && strings.Contains(line, "{") {
-			inMessage = true
-			continue
-		}
-
-		// Check if we're leaving a message definition
-		if inMessage && line == "}" {
-			inMessage = false
-			continue
-		}
-
-		// Only process lines inside message definitions
-		if !inMessage {
-			continue
-		}
-
-		// Look for field definitions (lines with type and field name)
-		if strings.Contains(line, " = ") && !strings.HasPrefix(line, "//") && !strings.HasPrefix(line, "option") {
-			// Extract field name and type
-			parts := strings.Fields(line)
-			if len(parts) >= 3 {
-				fieldType := parts[0]
-				fieldName := parts[1]
-
-				// Skip the "id" field as it's always present
-				if fieldName == "id" {
-					continue
-				}
-
-				// Skip fields that don't look like proper field definitions
-				if strings.Contains(fieldName, "(") || strings.Contains(fieldName, ")") {
-					continue
-				}
-
-				// Clean up field name (remove trailing comma, semicolon, etc.)
-				fieldName = strings.TrimRight(fieldName, ",;")
-
-				// Only add if it looks like a valid field
-				if fieldName != "" && fieldType != "" && !strings.Contains(fieldName, ":") {
-					fields = append(fields, fmt.Sprintf("%s:%s", fieldName, fieldType))
-				}
-			}
-		}
-	}
-
-	return fields
+// handleDeleteService removes serviceName; ?force=1 overrides the breaking-change guard
+func handleDeleteService(w http.ResponseWriter, r *http.Request, serviceName string) {
+	c, err := generator.RemoveService(serviceName)
+	applyValidated(w, c, err, forceParam(r))
 }
@@ -0,0 +1,51 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// TestHandlersRejectInjection checks that malicious names are refused with a
+// 400 before gen_service.sh runs.
+func TestHandlersRejectInjection(t *testing.T) {
+	tests := []struct {
+		handler http.HandlerFunc
+		method  string
+		target  string
+		body    string
+		field   string
+	}{
+		{handleServiceOperations, "DELETE", "/api/services/Book;touch%20pwned", "", "service"},
+		{handleServiceOperations, "DELETE", "/api/services/..%2F..%2Fetc", "", "service"},
+		{handleServiceOperations, "DELETE", "/api/services/Message", "", "service"},
+		{handleServiceOperations, "DELETE", "/api/services/Book/fields/$(id)", "", "field"},
+		{handleServiceOperations, "DELETE", "/api/services/Book/fields/title?message=A%3BB", "", "message"},
+		{handleServiceOperations, "DELETE", "/api/services/Book/rpcs/Get%60id%60", "", "rpc"},
+		{handleServiceOperations, "PUT", "/api/services/Book/fields/title", `{"type":"string/; s/x/y/"}`, "type"},
+		{handleServiceOperations, "PUT", "/api/services/Book/fields/title", `{"newName":"a'b"}`, "newName"},
+		{handleServiceOperations, "PUT", "/api/services/Book/rpcs/GetBook/http", `{"method":"GET","path":"/v1/x\" }"}`, "path"},
+		{handleServices, "POST", "/api/services", `{"serviceName":"Book","serviceFields":"title:string;rm -rf ~"}`, "serviceFields"},
+		{handleServices, "POST", "/api/services", `{"serviceName":"rpc","serviceFields":"title:string"}`, "serviceName"},
+		{handleServices, "POST", "/api/services", `not json`, "body"},
+		{handleRpc, "POST", "/api/rpc", `{"serviceName":"Book","rpcName":"Find|Evil","reqFields":"q:string","resFields":"n:int32","http":"GET:/v1/find"}`, "rpcName"},
+		{handleRpc, "POST", "/api/rpc", `{"serviceName":"Book","rpcName":"Find","reqFields":"q:string","resFields":"n:int32","http":"GET:/v1/find&&id"}`, "path"},
+		{handleRpc, "POST", "/api/rpc", `{"serviceName":"Book","rpcName":"Upload","reqFields":"q:string","resFields":"n:int32","stream":"client","http":"POST:/v1/upload"}`, "http"},
+		{handleNested, "POST", "/api/nested", `{"serviceName":"Book","fieldName":"loc","fields":"x:double","messageName":"Loc\nEvil"}`, "messageName"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.method+" "+tt.target, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			tt.handler(w, httptest.NewRequest(tt.method, tt.target, strings.NewReader(tt.body)))
+			var resp ServiceResponse
+			if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+				t.Fatalf("response %q: %v", w.Body.String(), err)
+			}
+			if w.Code != http.StatusBadRequest || resp.Success || resp.Field != tt.field || resp.Code == "" {
+				t.Errorf("got %d %+v, want 400 for %s", w.Code, resp, tt.field)
+			}
+		})
+	}
+}